@@ -0,0 +1,222 @@
+package websockify
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Authenticator checks a request before it is upgraded to a WebSocket.
+type Authenticator interface {
+	Authenticate(r *http.Request) error
+}
+
+// ErrUnauthorized is returned by authenticators for a request without valid
+// credentials.
+var ErrUnauthorized = errors.New("unauthorized")
+
+// challenger is implemented by authenticators that tell clients how to
+// authenticate, with a WWW-Authenticate header on refused requests.
+type challenger interface {
+	Challenge() string
+}
+
+// NewAuthenticator returns the authenticator for an auth plugin and its source:
+//
+//   - "basic": HTTP basic authentication against an htpasswd file
+//   - "jwt": a JSON Web Token signed by the key in a file, either a PEM public
+//     key or an HMAC secret, or by a key from a JWKS URL
+func NewAuthenticator(plugin, source string) (Authenticator, error) {
+	if source == "" {
+		return nil, fmt.Errorf("auth plugin %s needs a source", plugin)
+	}
+	switch strings.ToLower(plugin) {
+	case "basic":
+		return LoadBasicAuth(source)
+	case "jwt":
+		if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+			return &JWTAuth{JWKSURL: source}, nil
+		}
+		return LoadJWTKey(source)
+	}
+	return nil, fmt.Errorf("unknown auth plugin %q (want basic or jwt)", plugin)
+}
+
+// BasicAuth checks HTTP basic authentication against htpasswd entries.
+type BasicAuth struct {
+	Realm string
+	users map[string]string // Password hashes by user
+}
+
+// LoadBasicAuth reads an htpasswd file. Passwords hashed with htpasswd -m
+// (APR1 MD5), -s (SHA-1) or -p (plain text) are supported, and MD5-crypt
+// ($1$) hashes from openssl passwd -1. Other hashes, such as bcrypt, SHA-crypt
+// ($5$ and $6$), {SSHA} and the DES crypt of htpasswd -d, are refused rather
+// than taken for plain-text passwords.
+func LoadBasicAuth(path string) (*BasicAuth, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read htpasswd file: %v", err)
+	}
+	defer file.Close()
+
+	auth := &BasicAuth{Realm: "websockify", users: make(map[string]string)}
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		user, hash, ok := strings.Cut(text, ":")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: want user:hash", path, line)
+		}
+		if scheme := unsupportedHash(hash); scheme != "" {
+			return nil, fmt.Errorf("%s:%d: %s hashes are not supported; use htpasswd -m or -s", path, line, scheme)
+		}
+		auth.users[user] = hash
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read htpasswd file: %v", err)
+	}
+	if len(auth.users) == 0 {
+		return nil, fmt.Errorf("%s has no users", path)
+	}
+	return auth, nil
+}
+
+// Authenticate checks the request's basic authentication credentials.
+func (a *BasicAuth) Authenticate(r *http.Request) error {
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return fmt.Errorf("%w: no basic authentication credentials", ErrUnauthorized)
+	}
+	hash, ok := a.users[user]
+	if !ok || !checkPassword(password, hash) {
+		return fmt.Errorf("%w: wrong password for user %q", ErrUnauthorized, user)
+	}
+	return nil
+}
+
+// Challenge asks browsers to prompt for a user and password.
+func (a *BasicAuth) Challenge() string {
+	return fmt.Sprintf("Basic realm=%q", a.Realm)
+}
+
+// checkPassword reports whether password matches an htpasswd hash.
+func checkPassword(password, hash string) bool {
+	var want string
+	switch {
+	case strings.HasPrefix(hash, "{SHA}"):
+		sum := sha1.Sum([]byte(password))
+		want = "{SHA}" + base64.StdEncoding.EncodeToString(sum[:])
+	case strings.HasPrefix(hash, "$apr1$"):
+		want = md5Crypt(password, hash, "$apr1$")
+	case strings.HasPrefix(hash, "$1$"):
+		want = md5Crypt(password, hash, "$1$")
+	case unsupportedHash(hash) == "":
+		want = password
+	default:
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(want), []byte(hash)) == 1
+}
+
+// unsupportedHash names the scheme of an htpasswd hash checkPassword cannot
+// check, or returns "" for one it can or a plain-text password.
+func unsupportedHash(hash string) string {
+	switch {
+	case strings.HasPrefix(hash, "{SHA}"), strings.HasPrefix(hash, "$apr1$"), strings.HasPrefix(hash, "$1$"):
+		return ""
+	case strings.HasPrefix(hash, "$2"):
+		return "bcrypt"
+	case strings.HasPrefix(hash, "$"):
+		// Modular crypt: $id$ or $id,params$, such as $5$ and $6$ for SHA-crypt
+		if id, _, ok := strings.Cut(hash[1:], "$"); ok && id != "" {
+			return "$" + id + "$"
+		}
+	case strings.HasPrefix(hash, "{"):
+		if scheme, _, ok := strings.Cut(hash, "}"); ok {
+			return scheme + "}"
+		}
+	case len(hash) == 13 && strings.Trim(hash, "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz") == "":
+		// What htpasswd -d writes, and what unprefixed entries are on Unix
+		return "crypt(3) DES"
+	}
+	return ""
+}
+
+// md5Crypt hashes password with the salt of hash, as Apache's APR1 and the
+// MD5-crypt it is based on do, returning magic$salt$digest.
+func md5Crypt(password, hash, magic string) string {
+	salt := strings.TrimPrefix(hash, magic)
+	salt, _, _ = strings.Cut(salt, "$")
+	if len(salt) > 8 {
+		salt = salt[:8]
+	}
+	pw := []byte(password)
+
+	alt := md5.New()
+	alt.Write(pw)
+	alt.Write([]byte(salt))
+	alt.Write(pw)
+	altSum := alt.Sum(nil)
+
+	ctx := md5.New()
+	ctx.Write(pw)
+	ctx.Write([]byte(magic))
+	ctx.Write([]byte(salt))
+	for i := len(pw); i > 0; i -= 16 {
+		ctx.Write(altSum[:min(i, 16)])
+	}
+	for i := len(pw); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			ctx.Write([]byte{0})
+		} else {
+			ctx.Write(pw[:1])
+		}
+	}
+	sum := ctx.Sum(nil)
+
+	for i := 0; i < 1000; i++ {
+		round := md5.New()
+		if i&1 != 0 {
+			round.Write(pw)
+		} else {
+			round.Write(sum)
+		}
+		if i%3 != 0 {
+			round.Write([]byte(salt))
+		}
+		if i%7 != 0 {
+			round.Write(pw)
+		}
+		if i&1 != 0 {
+			round.Write(sum)
+		} else {
+			round.Write(pw)
+		}
+		sum = round.Sum(nil)
+	}
+
+	const itoa64 = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	var out strings.Builder
+	to64 := func(v uint32, n int) {
+		for ; n > 0; n-- {
+			out.WriteByte(itoa64[v&0x3f])
+			v >>= 6
+		}
+	}
+	for _, g := range [][3]int{{0, 6, 12}, {1, 7, 13}, {2, 8, 14}, {3, 9, 15}, {4, 10, 5}} {
+		to64(uint32(sum[g[0]])<<16|uint32(sum[g[1]])<<8|uint32(sum[g[2]]), 4)
+	}
+	to64(uint32(sum[11]), 2)
+	return magic + salt + "$" + out.String()
+}
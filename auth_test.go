@@ -0,0 +1,175 @@
+package websockify
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckPassword(t *testing.T) {
+	tests := []struct {
+		password, hash string
+		want           bool
+	}{
+		// From openssl passwd -apr1 and -1
+		{"secret", "$apr1$abcdefgh$h9FWgUz3n9YxylKLlR5SQ/", true},
+		{"a much longer password than sixteen", "$apr1$x$Og5dgLEe.PEZAsGZeU/kp0", true},
+		{"secret", "$1$abcdefgh$cHJi5PXp/ki/ktXzqlk6I1", true},
+		{"Secret", "$apr1$abcdefgh$h9FWgUz3n9YxylKLlR5SQ/", false},
+		{"secret", "{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=", true},
+		{"secrets", "{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=", false},
+		{"plain", "plain", true},
+		{"plain", "other", false},
+		// Hashes of other schemes never match as plain text
+		{"$5$salt$abc", "$5$salt$abc", false},
+		{"{SSHA}abc", "{SSHA}abc", false},
+		{"abJnggxhB/yWI", "abJnggxhB/yWI", false},
+	}
+	for _, tt := range tests {
+		if got := checkPassword(tt.password, tt.hash); got != tt.want {
+			t.Errorf("checkPassword(%q, %q) = %v, want %v", tt.password, tt.hash, got, tt.want)
+		}
+	}
+}
+
+func writeHtpasswd(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "htpasswd")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestBasicAuth(t *testing.T) {
+	auth, err := LoadBasicAuth(writeHtpasswd(t, "# Operators\nalice:$apr1$abcdefgh$h9FWgUz3n9YxylKLlR5SQ/\nbob:{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=\ndave:letmein\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		user, password string
+		want           bool
+	}{
+		{"alice", "secret", true},
+		{"bob", "secret", true},
+		{"alice", "wrong", false},
+		{"dave", "letmein", true},
+		{"dave", "wrong", false},
+		{"carol", "secret", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/websockify", nil)
+		r.SetBasicAuth(tt.user, tt.password)
+		if err := auth.Authenticate(r); (err == nil) != tt.want {
+			t.Errorf("Authenticate(%s:%s) = %v, want success %v", tt.user, tt.password, err, tt.want)
+		}
+	}
+	if err := auth.Authenticate(httptest.NewRequest("GET", "/websockify", nil)); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("Authenticate() without credentials = %v, want ErrUnauthorized", err)
+	}
+	if got := auth.Challenge(); got != `Basic realm="websockify"` {
+		t.Errorf("Challenge() = %q", got)
+	}
+}
+
+func TestLoadBasicAuthErrors(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{"alice:$2y$05$abcdefghijklmnopqrstuu\n", "bcrypt"},
+		{"alice:$5$saltsalt$Gcm6FsVtF/Qa77ZKD.iwsJlCVPY0XSMgLJL0Hnww/c1\n", "$5$ hashes"},
+		{"alice:$6$rounds=5000$saltsalt$abc\n", "$6$ hashes"},
+		{"alice:$y$j9T$salt$hash\n", "$y$ hashes"},
+		{"alice:{SSHA}hqAmlfvK7E4Vz0qa7PpXpVAjzJ1zYWx0\n", "{SSHA} hashes"},
+		{"alice:abJnggxhB/yWI\n", "crypt(3) DES"},
+		{"alice\n", "want user:hash"},
+		{"# Nobody\n", "no users"},
+	}
+	for _, tt := range tests {
+		_, err := LoadBasicAuth(writeHtpasswd(t, tt.content))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("LoadBasicAuth(%q) error = %v, want it to mention %q", tt.content, err, tt.want)
+		}
+	}
+}
+
+func TestNewAuthenticator(t *testing.T) {
+	htpasswd := writeHtpasswd(t, "alice:secret\n")
+	tests := []struct {
+		plugin, source string
+		wantErr        bool
+	}{
+		{"basic", htpasswd, false},
+		{"jwt", htpasswd, false}, // Read as an HMAC secret
+		{"jwt", "https://login.example.com/.well-known/jwks.json", false},
+		{"basic", "", true},
+		{"ldap", htpasswd, true},
+	}
+	for _, tt := range tests {
+		_, err := NewAuthenticator(tt.plugin, tt.source)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NewAuthenticator(%q, %q) error = %v, want error %v", tt.plugin, tt.source, err, tt.wantErr)
+		}
+	}
+}
+
+func TestServerRefusesUnauthenticated(t *testing.T) {
+	auth, err := LoadBasicAuth(writeHtpasswd(t, "alice:secret\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := New(Config{Target: "127.0.0.1:1", Authenticator: auth, Logger: &NoOpLogger{}})
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", "/websockify", nil))
+	if w.Code != 401 {
+		t.Errorf("status = %d, want 401", w.Code)
+	}
+	if got := w.Header().Get("WWW-Authenticate"); got != `Basic realm="websockify"` {
+		t.Errorf("WWW-Authenticate = %q", got)
+	}
+}
+
+func TestWebAuth(t *testing.T) {
+	auth, err := LoadBasicAuth(writeHtpasswd(t, "alice:secret\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	webRoot := t.TempDir()
+	if err := os.WriteFile(filepath.Join(webRoot, "vnc.html"), []byte("noVNC"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		webAuth  bool
+		user     string
+		wantCode int
+	}{
+		{false, "", 200},
+		{true, "", 401},
+		{true, "alice", 200},
+	}
+	for _, tt := range tests {
+		server := New(Config{WebRoot: webRoot, Authenticator: auth, WebAuth: tt.webAuth, Logger: &NoOpLogger{}})
+		r := httptest.NewRequest("GET", "/vnc.html", nil)
+		if tt.user != "" {
+			r.SetBasicAuth(tt.user, "secret")
+		}
+		w := httptest.NewRecorder()
+		server.fileServer().ServeHTTP(w, r)
+		if w.Code != tt.wantCode {
+			t.Errorf("WebAuth %v, user %q: status = %d, want %d", tt.webAuth, tt.user, w.Code, tt.wantCode)
+		}
+	}
+
+	server := New(Config{Listener: "127.0.0.1:0", WebRoot: webRoot, WebAuth: true, Logger: &NoOpLogger{}})
+	if err := server.Serve(context.Background()); err == nil || !strings.Contains(err.Error(), "Authenticator") {
+		t.Errorf("Serve() with WebAuth and no Authenticator = %v, want an error", err)
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"slices"
+	"sync"
+	"time"
+)
+
+// traffic counts what passed through a connection over some period
+type traffic struct {
+	bytesIn  int64
+	bytesOut int64
+	messages int64 // Reads from the client, each one message of its size
+	minSize  int
+	maxSize  int
+	rtts     int64
+	rttSum   time.Duration
+	rttMin   time.Duration
+	rttMax   time.Duration
+}
+
+// received counts a read of n bytes
+func (t *traffic) received(n int) {
+	t.bytesIn += int64(n)
+	if t.messages == 0 || n < t.minSize {
+		t.minSize = n
+	}
+	t.maxSize = max(t.maxSize, n)
+	t.messages++
+}
+
+// roundTrip counts the time data took to come back
+func (t *traffic) roundTrip(d time.Duration) {
+	if t.rtts == 0 || d < t.rttMin {
+		t.rttMin = d
+	}
+	t.rttMax = max(t.rttMax, d)
+	t.rttSum += d
+	t.rtts++
+}
+
+// add merges another period's counts into t
+func (t *traffic) add(o traffic) {
+	if o.messages > 0 && (t.messages == 0 || o.minSize < t.minSize) {
+		t.minSize = o.minSize
+	}
+	if o.rtts > 0 && (t.rtts == 0 || o.rttMin < t.rttMin) {
+		t.rttMin = o.rttMin
+	}
+	t.bytesIn += o.bytesIn
+	t.bytesOut += o.bytesOut
+	t.messages += o.messages
+	t.maxSize = max(t.maxSize, o.maxSize)
+	t.rtts += o.rtts
+	t.rttSum += o.rttSum
+	t.rttMax = max(t.rttMax, o.rttMax)
+}
+
+// throughput is traffic as reported in JSON
+type throughput struct {
+	BytesIn           int64       `json:"bytes_in"`
+	BytesOut          int64       `json:"bytes_out"`
+	BytesInPerSecond  float64     `json:"bytes_in_per_second"`
+	BytesOutPerSecond float64     `json:"bytes_out_per_second"`
+	Messages          int64       `json:"messages"`
+	MessageSize       *sizeReport `json:"message_size,omitempty"`
+	RTT               *rttReport  `json:"rtt,omitempty"` // Only when round trips were timed
+}
+
+type sizeReport struct {
+	Min  int     `json:"min"`
+	Mean float64 `json:"mean"`
+	Max  int     `json:"max"`
+}
+
+type rttReport struct {
+	Count  int64   `json:"count"`
+	MinMs  float64 `json:"min_ms"`
+	MeanMs float64 `json:"mean_ms"`
+	MaxMs  float64 `json:"max_ms"`
+}
+
+// report returns the traffic as throughput over seconds
+func (t traffic) report(seconds float64) throughput {
+	r := throughput{BytesIn: t.bytesIn, BytesOut: t.bytesOut, Messages: t.messages}
+	if seconds > 0 {
+		r.BytesInPerSecond = float64(t.bytesIn) / seconds
+		r.BytesOutPerSecond = float64(t.bytesOut) / seconds
+	}
+	if t.messages > 0 {
+		r.MessageSize = &sizeReport{Min: t.minSize, Mean: float64(t.bytesIn) / float64(t.messages), Max: t.maxSize}
+	}
+	if t.rtts > 0 {
+		ms := func(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+		r.RTT = &rttReport{Count: t.rtts, MinMs: ms(t.rttMin), MeanMs: ms(t.rttSum) / float64(t.rtts), MaxMs: ms(t.rttMax)}
+	}
+	return r
+}
+
+// benchConn counts a connection's traffic for the benchmark
+type benchConn struct {
+	net.Conn
+	bench *benchmark
+	id    uint64
+
+	mutex    sync.Mutex
+	interval traffic // Since the last report
+}
+
+func (c *benchConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.mutex.Lock()
+		c.interval.received(n)
+		c.mutex.Unlock()
+	}
+	return n, err
+}
+
+func (c *benchConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.mutex.Lock()
+	c.interval.bytesOut += int64(n)
+	c.mutex.Unlock()
+	return n, err
+}
+
+// roundTrip records the time data sent to the client took to come back
+func (c *benchConn) roundTrip(d time.Duration) {
+	c.mutex.Lock()
+	c.interval.roundTrip(d)
+	c.mutex.Unlock()
+}
+
+// Close stops counting the connection, keeping its traffic for the totals
+func (c *benchConn) Close() error {
+	c.bench.remove(c)
+	return c.Conn.Close()
+}
+
+// take returns the traffic since the last report, starting a new interval
+func (c *benchConn) take() traffic {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	t := c.interval
+	c.interval = traffic{}
+	return t
+}
+
+// benchReport is one JSON line of benchmark output: an "interval" report of
+// the traffic since the last one, or the "summary" of the whole run
+type benchReport struct {
+	Type        string       `json:"type"`
+	Time        time.Time    `json:"time"`
+	Seconds     float64      `json:"seconds"`
+	Connections []connReport `json:"connections,omitempty"`
+	Total       throughput   `json:"total"`
+}
+
+type connReport struct {
+	ID     uint64 `json:"id"`
+	Remote string `json:"remote"`
+	throughput
+}
+
+// benchmark measures every connection's traffic and reports it as JSON lines
+type benchmark struct {
+	out     *json.Encoder
+	started time.Time
+
+	mutex      sync.Mutex
+	conns      map[uint64]*benchConn
+	nextID     uint64
+	lastReport time.Time
+	closed     traffic // Traffic of closed connections since the last report
+	run        traffic // Traffic of every connection up to the last report
+}
+
+func newBenchmark(out io.Writer) *benchmark {
+	now := time.Now()
+	return &benchmark{out: json.NewEncoder(out), started: now, lastReport: now, conns: make(map[uint64]*benchConn)}
+}
+
+// wrap starts counting a connection's traffic
+func (b *benchmark) wrap(conn net.Conn) *benchConn {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.nextID++
+	c := &benchConn{Conn: conn, bench: b, id: b.nextID}
+	b.conns[c.id] = c
+	return c
+}
+
+func (b *benchmark) remove(c *benchConn) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if _, ok := b.conns[c.id]; ok {
+		delete(b.conns, c.id)
+		b.closed.add(c.take())
+	}
+}
+
+// report writes the traffic since the last report
+func (b *benchmark) report() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	now := time.Now()
+	seconds := now.Sub(b.lastReport).Seconds()
+	b.lastReport = now
+
+	r := benchReport{Type: "interval", Time: now, Seconds: seconds}
+	total := b.closed
+	b.closed = traffic{}
+	ids := make([]uint64, 0, len(b.conns))
+	for id := range b.conns {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	for _, id := range ids {
+		c := b.conns[id]
+		t := c.take()
+		total.add(t)
+		r.Connections = append(r.Connections, connReport{ID: id, Remote: c.RemoteAddr().String(), throughput: t.report(seconds)})
+	}
+	b.run.add(total)
+	r.Total = total.report(seconds)
+	b.out.Encode(r)
+}
+
+// reportEvery reports every interval until done is closed, then writes the summary
+func (b *benchmark) reportEvery(interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			b.report()
+		case <-done:
+			b.report()
+			b.summary()
+			return
+		}
+	}
+}
+
+// summary writes the traffic of the whole run
+func (b *benchmark) summary() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	now := time.Now()
+	seconds := now.Sub(b.started).Seconds()
+	b.out.Encode(benchReport{Type: "summary", Time: now, Seconds: seconds, Total: b.run.report(seconds)})
+}
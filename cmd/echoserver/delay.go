@@ -0,0 +1,67 @@
+package main
+
+import (
+	"io"
+	"math/rand/v2"
+	"net"
+	"time"
+)
+
+// heldChunk is data read from a client, waiting for the time to echo it
+type heldChunk struct {
+	data   []byte
+	sendAt time.Time
+}
+
+// delayedEcho echoes conn back to itself, holding each chunk it reads for
+// delay plus a random variation of up to +/- jitter. Later chunks are never
+// echoed before earlier ones, and what has been read is still echoed after
+// the client stops sending.
+func delayedEcho(conn net.Conn, delay, jitter time.Duration, rng *rand.Rand) error {
+	held := make(chan heldChunk, 256)
+	writeErr := make(chan error, 1)
+	go func() {
+		for chunk := range held {
+			time.Sleep(time.Until(chunk.sendAt))
+			if _, err := conn.Write(chunk.data); err != nil {
+				writeErr <- err
+				conn.Close() // Stop reading, as nothing more can be echoed
+				for range held {
+				}
+				return
+			}
+		}
+		writeErr <- nil
+	}()
+
+	var last time.Time
+	buf := make([]byte, 32*1024)
+	var readErr error
+	for {
+		n, err := conn.Read(buf)
+		if n > 0 {
+			hold := delay
+			if jitter > 0 {
+				hold += time.Duration(rng.Int64N(int64(2*jitter)+1)) - jitter
+			}
+			sendAt := time.Now().Add(max(hold, 0))
+			if sendAt.Before(last) {
+				sendAt = last
+			}
+			last = sendAt
+			held <- heldChunk{data: append([]byte(nil), buf[:n]...), sendAt: sendAt}
+		}
+		if err != nil {
+			readErr = err
+			break
+		}
+	}
+	close(held)
+	if err := <-writeErr; err != nil {
+		return err
+	}
+	if readErr == io.EOF {
+		return nil
+	}
+	return readErr
+}
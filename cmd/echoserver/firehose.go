@@ -0,0 +1,59 @@
+package main
+
+import (
+	"io"
+	"net"
+	"time"
+)
+
+// firehoseResult is what one firehose connection sent
+type firehoseResult struct {
+	bytes    int64
+	duration time.Duration
+	blocked  time.Duration // Time spent in writes, which grows with backpressure
+}
+
+// firehose writes chunk byte writes to conn at rate bytes per second, or as
+// fast as conn takes them if rate is 0, until the client closes the
+// connection or a write fails. What the client sends is discarded.
+func firehose(conn net.Conn, chunk, rate int) (firehoseResult, error) {
+	closed := make(chan struct{})
+	go func() {
+		io.Copy(io.Discard, conn)
+		close(closed)
+	}()
+
+	data := make([]byte, chunk)
+	for i := range data {
+		data[i] = byte(i*131 + i>>8)
+	}
+
+	var result firehoseResult
+	start := time.Now()
+	for {
+		select {
+		case <-closed:
+			result.duration = time.Since(start)
+			return result, nil
+		default:
+		}
+
+		writeStart := time.Now()
+		n, err := conn.Write(data)
+		result.blocked += time.Since(writeStart)
+		result.bytes += int64(n)
+		if err != nil {
+			result.duration = time.Since(start)
+			return result, err
+		}
+
+		if rate > 0 {
+			// Pace from the start, so time lost to a slow write is made up
+			due := start.Add(time.Duration(float64(result.bytes) / float64(rate) * float64(time.Second)))
+			select {
+			case <-time.After(time.Until(due)):
+			case <-closed:
+			}
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// connLimits bound each connection; zero values mean no limit
+type connLimits struct {
+	maxBytes    int64 // Bytes read and written together
+	maxDuration time.Duration
+}
+
+// trackedConn counts a connection's bytes, closes it once it passes its
+// limits, and remembers why it was closed
+type trackedConn struct {
+	net.Conn
+	limits   connLimits
+	started  time.Time
+	bytesIn  atomic.Int64
+	bytesOut atomic.Int64
+	timer    *time.Timer
+
+	mutex  sync.Mutex
+	reason string // Why the server cut the connection off, if it did
+}
+
+func trackConn(conn net.Conn, limits connLimits) *trackedConn {
+	c := &trackedConn{Conn: conn, limits: limits, started: time.Now()}
+	if limits.maxDuration > 0 {
+		c.timer = time.AfterFunc(limits.maxDuration, func() { c.cutOff("duration limit") })
+	}
+	return c
+}
+
+func (c *trackedConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.bytesIn.Add(int64(n))
+	c.checkBytes()
+	return n, err
+}
+
+func (c *trackedConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.bytesOut.Add(int64(n))
+	c.checkBytes()
+	return n, err
+}
+
+func (c *trackedConn) Close() error {
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	return c.Conn.Close()
+}
+
+func (c *trackedConn) checkBytes() {
+	if c.limits.maxBytes > 0 && c.bytesIn.Load()+c.bytesOut.Load() >= c.limits.maxBytes {
+		c.cutOff("byte limit")
+	}
+}
+
+// cutOff closes the connection for reason, the first one given
+func (c *trackedConn) cutOff(reason string) {
+	c.mutex.Lock()
+	if c.reason == "" {
+		c.reason = reason
+	}
+	c.mutex.Unlock()
+	c.Conn.Close()
+}
+
+// closeReason says why the connection ended, given the error its handler
+// returned
+func (c *trackedConn) closeReason(err error) string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	switch {
+	case c.reason != "":
+		return c.reason
+	case err == nil || errors.Is(err, io.EOF):
+		return "client closed"
+	}
+	return "error: " + err.Error()
+}
+
+// summary describes the ended connection as key=value pairs, for log analysis
+func (c *trackedConn) summary(mode string, err error) string {
+	return fmt.Sprintf("remote=%s mode=%s bytes_in=%d bytes_out=%d duration=%s reason=%q",
+		c.RemoteAddr(), mode, c.bytesIn.Load(), c.bytesOut.Load(), time.Since(c.started).Round(time.Millisecond), c.closeReason(err))
+}
@@ -5,11 +5,14 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"math/rand/v2"
 	"net"
 	"os"
 	"os/signal"
 	"strings"
+	"sync/atomic"
 	"syscall"
+	"time"
 
 	"github.com/coder/websockify/version"
 )
@@ -17,13 +20,29 @@ import (
 func main() {
 	var (
 		port        = flag.String("port", "5901", "Port to listen on")
+		listenUnix  = flag.String("listen-unix", "", "Listen on this unix socket path instead of a TCP port")
+		udp         = flag.Bool("udp", false, "Echo UDP datagrams to their sender instead of TCP streams")
+		delay       = flag.Duration("delay", 0, "Hold echoed bytes for this long, to simulate a slow backend")
+		jitter      = flag.Duration("jitter", 0, "Vary -delay randomly by up to this much in either direction")
+		seed        = flag.Uint64("seed", 1, "Seed for -jitter, so runs are repeatable")
+		pattern     = flag.Bool("pattern", false, "Send numbered, checksummed frames instead of echoing, and verify the frames that come back")
+		patternSize = flag.Int("pattern-size", 1024, "Payload bytes in each -pattern frame")
+		patternTime = flag.Duration("pattern-interval", 10*time.Millisecond, "Send a -pattern frame this often")
+		firehoseOn  = flag.Bool("firehose", false, "Stream data to clients without waiting for input, discarding what they send, instead of echoing")
+		firehoseBPS = flag.Int("firehose-rate", 0, "Bytes per second -firehose sends to each client (0 for as fast as it can)")
+		firehoseLen = flag.Int("firehose-chunk", 16384, "Bytes in each -firehose write")
+		maxConns    = flag.Int("max-conns", 0, "Refuse connections while this many are open (0 for no limit)")
+		maxBytes    = flag.Int64("max-bytes", 0, "Close each connection once it has read and written this many bytes together (0 for no limit)")
+		maxDuration = flag.Duration("max-duration", 0, "Close each connection once it has been open this long (0 for no limit)")
+		benchEvery  = flag.Duration("bench", 0, "Report throughput, message sizes and round trip times every this often as JSON lines, e.g. 5s")
+		benchFile   = flag.String("bench-file", "", "Append -bench reports to this file instead of writing them to stdout")
 		showVersion = flag.Bool("version", false, "Show version information")
 		help        = flag.Bool("help", false, "Show this help message")
 	)
 	flag.Parse()
 
 	if *showVersion {
-		fmt.Printf("echoserver %s\n", version.Version())
+		fmt.Printf("echoserver %s\n", version.Full())
 		os.Exit(0)
 	}
 
@@ -34,16 +53,103 @@ func main() {
 		flag.PrintDefaults()
 		fmt.Fprintf(os.Stderr, "\nExample:\n")
 		fmt.Fprintf(os.Stderr, "  %s -port 5901\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -port 5901 -delay 200ms -jitter 50ms -seed 42\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -port 5901 -bench 5s -bench-file bench.jsonl\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -port 5901 -pattern -pattern-size 4096 -bench 5s\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -port 5901 -udp\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -port 5901 -firehose -firehose-rate 10000000 -bench 1s\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -listen-unix /tmp/echo.sock\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -port 5901 -max-conns 100 -max-bytes 1048576 -max-duration 30s\n", os.Args[0])
 		os.Exit(0)
 	}
 
-	listener, err := net.Listen("tcp", ":"+*port)
-	if err != nil {
-		log.Fatalf("Failed to listen on port %s: %v", *port, err)
+	if *pattern && (*delay > 0 || *jitter > 0) {
+		log.Fatalf("-pattern does not echo, so -delay and -jitter do not apply")
+	}
+	if *patternSize < 0 || *patternSize > patternMaxPayload || *patternTime <= 0 {
+		log.Fatalf("-pattern-size must be 0 to %d and -pattern-interval positive", patternMaxPayload)
+	}
+
+	if *firehoseOn && (*pattern || *udp || *delay > 0 || *jitter > 0) {
+		log.Fatalf("-firehose does not echo, so it cannot be used with -pattern, -udp, -delay or -jitter")
+	}
+	if *firehoseLen <= 0 || *firehoseBPS < 0 {
+		log.Fatalf("-firehose-chunk must be positive and -firehose-rate not negative")
+	}
+	if *maxConns < 0 || *maxBytes < 0 || *maxDuration < 0 {
+		log.Fatalf("-max-conns, -max-bytes and -max-duration must not be negative")
+	}
+
+	if *udp {
+		if *listenUnix != "" {
+			log.Fatalf("-udp listens on a port, not with -listen-unix")
+		}
+		if *pattern || *benchEvery > 0 {
+			log.Fatalf("-pattern and -bench work on TCP streams, not with -udp")
+		}
+		if *maxConns > 0 || *maxBytes > 0 || *maxDuration > 0 {
+			log.Fatalf("-max-conns, -max-bytes and -max-duration limit TCP streams, not -udp")
+		}
+		var rng *rand.Rand
+		if *jitter > 0 {
+			rng = rand.New(rand.NewPCG(*seed, 0))
+		}
+		if err := serveUDP(*port, *delay, *jitter, rng); err != nil {
+			log.Fatalf("Failed to listen on UDP port %s: %v", *port, err)
+		}
+		return
+	}
+
+	var listener net.Listener
+	var err error
+	if *listenUnix != "" {
+		listener, err = listenUnixSocket(*listenUnix)
+		if err != nil {
+			log.Fatalf("Failed to listen on %s: %v", *listenUnix, err)
+		}
+		log.Printf("Echo server %s listening on unix socket %s", version.Full(), *listenUnix)
+	} else {
+		listener, err = net.Listen("tcp", ":"+*port)
+		if err != nil {
+			log.Fatalf("Failed to listen on port %s: %v", *port, err)
+		}
+		log.Printf("Echo server %s listening on port %s", version.Full(), *port)
 	}
 	defer listener.Close()
 
-	log.Printf("Echo server listening on port %s", *port)
+	if *firehoseOn {
+		rate := "as fast as clients take it"
+		if *firehoseBPS > 0 {
+			rate = fmt.Sprintf("at %d bytes/s", *firehoseBPS)
+		}
+		log.Printf("Streaming %d byte chunks to each client %s", *firehoseLen, rate)
+	}
+	if *pattern {
+		log.Printf("Sending %d byte pattern frames every %v and verifying them", *patternSize, *patternTime)
+	}
+	if *delay > 0 || *jitter > 0 {
+		log.Printf("Holding echoed bytes for %v +/- %v (seed %d)", *delay, *jitter, *seed)
+	}
+
+	var bench *benchmark
+	benchDone, benchFinished := make(chan struct{}), make(chan struct{})
+	if *benchEvery > 0 {
+		out := io.Writer(os.Stdout)
+		if *benchFile != "" {
+			file, err := os.OpenFile(*benchFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+			if err != nil {
+				log.Fatalf("Failed to open benchmark file: %v", err)
+			}
+			defer file.Close()
+			out = file
+		}
+		bench = newBenchmark(out)
+		go func() {
+			bench.reportEvery(*benchEvery, benchDone)
+			close(benchFinished)
+		}()
+		log.Printf("Reporting throughput every %v", *benchEvery)
+	}
 
 	// Handle graceful shutdown
 	sigChan := make(chan os.Signal, 1)
@@ -53,36 +159,104 @@ func main() {
 		<-sigChan
 		log.Println("Shutting down echo server...")
 		listener.Close()
+		if bench != nil {
+			// Write the run's summary before exiting
+			close(benchDone)
+			<-benchFinished
+		}
 		os.Exit(0)
 	}()
 
-	for {
+	limits := connLimits{maxBytes: *maxBytes, maxDuration: *maxDuration}
+	var active atomic.Int64
+	for n := uint64(0); ; n++ {
 		conn, err := listener.Accept()
 		if err != nil {
 			// Check if the error is due to the listener being closed
 			if strings.Contains(err.Error(), "use of closed network connection") {
 				log.Println("Listener closed, stopping accept loop")
+				if bench != nil {
+					<-benchFinished
+				}
 				return
 			}
 			log.Printf("Failed to accept connection: %v", err)
 			continue
 		}
 
-		go handleEchoConnection(conn)
+		if *maxConns > 0 && active.Load() >= int64(*maxConns) {
+			log.Printf("Refusing connection from %s: %d connections open", conn.RemoteAddr(), *maxConns)
+			conn.Close()
+			continue
+		}
+		active.Add(1)
+
+		go func(n uint64) {
+			defer active.Add(-1)
+			tracked := trackConn(conn, limits)
+			var conn net.Conn = tracked
+			if bench != nil {
+				conn = bench.wrap(conn)
+			}
+
+			var mode string
+			var err error
+			switch {
+			case *firehoseOn:
+				mode, err = "firehose", handleFirehoseConnection(conn, *firehoseLen, *firehoseBPS)
+			case *pattern:
+				// Clients' own streams are numbered below ours
+				mode, err = "pattern", handlePatternConnection(conn, 1<<31|uint32(n), *patternSize, *patternTime)
+			default:
+				// Each connection has its own jitter sequence, so runs are
+				// repeatable however connections interleave
+				var rng *rand.Rand
+				if *jitter > 0 {
+					rng = rand.New(rand.NewPCG(*seed, n))
+				}
+				mode, err = "echo", handleEchoConnection(conn, *delay, *jitter, rng)
+			}
+			log.Printf("Connection summary: %s", tracked.summary(mode, err))
+		}(n)
 	}
 }
 
-func handleEchoConnection(conn net.Conn) {
+func handleEchoConnection(conn net.Conn, delay, jitter time.Duration, rng *rand.Rand) error {
 	defer conn.Close()
 	
 	clientAddr := conn.RemoteAddr().String()
 	log.Printf("New echo connection from %s", clientAddr)
 
-	// Simple echo: copy everything from conn back to conn
-	_, err := io.Copy(conn, conn)
-	if err != nil {
-		log.Printf("Echo connection from %s ended: %v", clientAddr, err)
+	// Simple echo: copy everything from conn back to conn, unless it is held
+	var err error
+	if delay > 0 || jitter > 0 {
+		err = delayedEcho(conn, delay, jitter, rng)
 	} else {
-		log.Printf("Echo connection from %s closed", clientAddr)
+		_, err = io.Copy(conn, conn)
 	}
-}
\ No newline at end of file
+	return err
+}
+
+func handlePatternConnection(conn net.Conn, stream uint32, size int, interval time.Duration) error {
+	defer conn.Close()
+
+	clientAddr := conn.RemoteAddr().String()
+	log.Printf("New pattern connection from %s, stream %d", clientAddr, stream)
+
+	stats, err := patternSession(conn, stream, size, interval)
+	log.Printf("Pattern connection from %s closed: %d frames sent, %d verified, %d errors", clientAddr, stats.sent.Load(), stats.verified, stats.errors)
+	return err
+}
+
+func handleFirehoseConnection(conn net.Conn, chunk, rate int) error {
+	defer conn.Close()
+
+	clientAddr := conn.RemoteAddr().String()
+	log.Printf("New firehose connection from %s", clientAddr)
+
+	result, err := firehose(conn, chunk, rate)
+	seconds := result.duration.Seconds()
+	log.Printf("Firehose connection from %s closed: %d bytes in %v (%.0f bytes/s), %v blocked on writes",
+		clientAddr, result.bytes, result.duration.Round(time.Millisecond), float64(result.bytes)/max(seconds, 1e-9), result.blocked.Round(time.Millisecond))
+	return err
+}
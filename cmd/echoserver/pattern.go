@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// A pattern frame is
+//
+//	magic "WSPF" | stream uint32 | seq uint64 | sent unix ns int64 | length uint32 | payload | CRC-32
+//
+// in big endian, where the payload is a function of seq and the CRC covers
+// everything before it. Each sender numbers its frames from 0 on its own
+// stream, so a receiver can tell frames that were lost, repeated, reordered
+// or altered on the way.
+const (
+	patternMagic      = "WSPF"
+	patternHeaderSize = 4 + 4 + 8 + 8 + 4
+	patternMaxPayload = 1 << 20
+)
+
+// errLostFraming means a frame boundary was lost, so no more frames can be
+// read from the stream
+var errLostFraming = errors.New("lost framing")
+
+// patternPayload fills p with the bytes of frame seq
+func patternPayload(p []byte, seq uint64) {
+	for i := range p {
+		p[i] = byte(seq*7 + uint64(i)*131 + uint64(i>>8))
+	}
+}
+
+// encodePatternFrame returns frame seq of stream with size payload bytes
+func encodePatternFrame(stream uint32, seq uint64, sent time.Time, size int) []byte {
+	frame := make([]byte, patternHeaderSize+size+4)
+	copy(frame, patternMagic)
+	binary.BigEndian.PutUint32(frame[4:], stream)
+	binary.BigEndian.PutUint64(frame[8:], seq)
+	binary.BigEndian.PutUint64(frame[16:], uint64(sent.UnixNano()))
+	binary.BigEndian.PutUint32(frame[24:], uint32(size))
+	patternPayload(frame[patternHeaderSize:patternHeaderSize+size], seq)
+	binary.BigEndian.PutUint32(frame[patternHeaderSize+size:], crc32.ChecksumIEEE(frame[:patternHeaderSize+size]))
+	return frame
+}
+
+// patternFrame is a frame as read back
+type patternFrame struct {
+	stream uint32
+	seq    uint64
+	sent   time.Time
+}
+
+// readPatternFrame reads the next frame. For one that does not match its
+// checksum or pattern it returns the frame with an error; errors with no
+// frame are from reading, or errLostFraming when the stream cannot be
+// followed any further.
+func readPatternFrame(r io.Reader) (patternFrame, error) {
+	var header [patternHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return patternFrame{}, err
+	}
+	if string(header[:4]) != patternMagic {
+		return patternFrame{}, fmt.Errorf("%w: got %q, want frame magic %q", errLostFraming, header[:4], patternMagic)
+	}
+	f := patternFrame{
+		stream: binary.BigEndian.Uint32(header[4:]),
+		seq:    binary.BigEndian.Uint64(header[8:]),
+		sent:   time.Unix(0, int64(binary.BigEndian.Uint64(header[16:]))),
+	}
+	size := binary.BigEndian.Uint32(header[24:])
+	if size > patternMaxPayload {
+		return f, fmt.Errorf("%w: frame %d claims %d payload bytes", errLostFraming, f.seq, size)
+	}
+	rest := make([]byte, size+4)
+	if _, err := io.ReadFull(r, rest); err != nil {
+		return patternFrame{}, err
+	}
+
+	crc := crc32.NewIEEE()
+	crc.Write(header[:])
+	crc.Write(rest[:size])
+	if got, want := binary.BigEndian.Uint32(rest[size:]), crc.Sum32(); got != want {
+		return f, fmt.Errorf("frame %d of stream %d: checksum %08x, want %08x", f.seq, f.stream, got, want)
+	}
+	want := make([]byte, size)
+	patternPayload(want, f.seq)
+	if !bytes.Equal(rest[:size], want) {
+		return f, fmt.Errorf("frame %d of stream %d: payload does not match its pattern", f.seq, f.stream)
+	}
+	return f, nil
+}
+
+// patternStats counts one connection's pattern frames
+type patternStats struct {
+	sent     atomic.Uint64
+	verified uint64
+	errors   uint64
+}
+
+// patternSession sends frames on stream to conn every interval, and verifies
+// every frame that comes back: this server's own, echoed by the client, whose
+// round trip times go to the benchmark if there is one, or frames of the
+// client's own streams. It returns when the connection ends or its framing is
+// lost.
+func patternSession(conn net.Conn, stream uint32, size int, interval time.Duration) (*patternStats, error) {
+	stats := &patternStats{}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for seq := uint64(0); ; seq++ {
+			if _, err := conn.Write(encodePatternFrame(stream, seq, time.Now(), size)); err != nil {
+				return
+			}
+			stats.sent.Add(1)
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	timer, _ := conn.(interface{ roundTrip(time.Duration) })
+	next := make(map[uint32]uint64) // Next frame expected on each stream
+	r := bufio.NewReader(conn)
+	for {
+		f, err := readPatternFrame(r)
+		switch {
+		case err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, net.ErrClosed):
+			return stats, nil
+		case errors.Is(err, errLostFraming):
+			stats.errors++
+			return stats, err
+		case err != nil && f == (patternFrame{}):
+			return stats, err
+		case err != nil:
+			// The frame was altered, but the next one can still be read
+			stats.errors++
+			log.Printf("Pattern error from %s: %v", conn.RemoteAddr(), err)
+		case f.seq != next[f.stream]:
+			stats.errors++
+			log.Printf("Pattern error from %s: stream %d: got frame %d, want %d", conn.RemoteAddr(), f.stream, f.seq, next[f.stream])
+		default:
+			stats.verified++
+			if f.stream == stream && timer != nil {
+				timer.roundTrip(time.Since(f.sent))
+			}
+		}
+		next[f.stream] = f.seq + 1
+	}
+}
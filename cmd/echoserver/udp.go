@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"math/rand/v2"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/coder/websockify/version"
+)
+
+// maxDatagram is the largest UDP payload
+const maxDatagram = 65535
+
+// serveUDP echoes each datagram on port back to its sender until
+// interrupted, after delay plus up to +/- jitter if they are set. Unlike TCP
+// echo, delayed datagrams may come back out of order, as on a real network.
+func serveUDP(port string, delay, jitter time.Duration, rng *rand.Rand) error {
+	conn, err := net.ListenPacket("udp", ":"+port)
+	if err != nil {
+		return err
+	}
+	log.Printf("Echo server %s listening on UDP port %s", version.Full(), port)
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigChan
+		log.Println("Shutting down echo server...")
+		conn.Close()
+	}()
+
+	buf := make([]byte, maxDatagram)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		}
+		if err != nil {
+			log.Printf("Failed to read datagram: %v", err)
+			continue
+		}
+
+		hold := delay
+		if jitter > 0 {
+			hold += time.Duration(rng.Int64N(int64(2*jitter)+1)) - jitter
+		}
+		if hold <= 0 {
+			if _, err := conn.WriteTo(buf[:n], addr); err != nil {
+				log.Printf("Failed to echo datagram to %s: %v", addr, err)
+			}
+			continue
+		}
+		data := append([]byte(nil), buf[:n]...)
+		time.AfterFunc(hold, func() {
+			if _, err := conn.WriteTo(data, addr); err != nil && !errors.Is(err, net.ErrClosed) {
+				log.Printf("Failed to echo datagram to %s: %v", addr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/coder/websockify/vncclient"
+)
+
+func createWebMAnimation(config VNCConfig, frames []*image.RGBA) error {
+	if len(frames) == 0 {
+		return fmt.Errorf("no frames captured for WebM animation")
+	}
+
+	// For WebM, we'll need to use external tools like ffmpeg
+	// For now, let's create a simple approach using individual PNGs and ffmpeg
+	log.Printf("WebM creation requires ffmpeg. Use: ffmpeg -r %d -i %s/frame_%%04d.png -c:v libvpx-vp9 -pix_fmt yuva420p animation.webm",
+		config.frameRate, config.outputDir)
+
+	return nil
+}
+
+func createAPNGAnimation(config VNCConfig, frames []*image.RGBA) error {
+	if len(frames) == 0 {
+		return fmt.Errorf("no frames captured for APNG animation")
+	}
+
+	filename := filepath.Join(config.outputDir, "animation.apng")
+
+	// For APNG, we'll need to use external tools like apngasm
+	// For now, let's save instructions and create a simple multi-frame PNG approach
+	log.Printf("APNG creation with full transparency requires apngasm tool.")
+	log.Printf("Use: apngasm %s %s/frame_*.png 1/%d", filename, config.outputDir, config.frameRate)
+	log.Printf("Or install apngasm: brew install apngasm (macOS) or apt-get install apngasm (Linux)")
+
+	// Alternative: Create a simple animated approach by saving all frames in sequence
+	// This won't be a true APNG but will demonstrate the concept
+	return createFrameSequenceFile(config, frames)
+}
+
+// createGIFAnimation encodes the frames as animation.gif in the output
+// directory, without needing external tools
+func createGIFAnimation(config VNCConfig, frames []*image.RGBA) error {
+	if len(frames) == 0 {
+		return fmt.Errorf("no frames captured for GIF animation")
+	}
+	if err := os.MkdirAll(config.outputDir, 0o755); err != nil {
+		return err
+	}
+
+	filename := filepath.Join(config.outputDir, "animation.gif")
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := vncclient.EncodeGIF(file, frames, time.Second/time.Duration(config.frameRate)); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	log.Printf("Created GIF animation with %d frames: %s", len(frames), filename)
+	return nil
+}
+
+func createFrameSequenceFile(config VNCConfig, frames []*image.RGBA) error {
+	filename := filepath.Join(config.outputDir, "frame_sequence_info.txt")
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	size := frames[0].Rect.Size()
+	fmt.Fprintf(file, "Animation Info:\n")
+	fmt.Fprintf(file, "Total frames: %d\n", len(frames))
+	fmt.Fprintf(file, "Frame rate: %d fps\n", config.frameRate)
+	fmt.Fprintf(file, "Duration: %.2f seconds\n", float64(len(frames))/float64(config.frameRate))
+	fmt.Fprintf(file, "Frame size: %dx%d\n", size.X, size.Y)
+	for _, frame := range frames[1:] {
+		if frame.Rect.Size() != size {
+			fmt.Fprintf(file, "The server resized the desktop during capture; scale or pad the frames to one size before assembling them\n")
+			log.Printf("Captured frames have different sizes because the server resized the desktop")
+			break
+		}
+	}
+	fmt.Fprintf(file, "\nTo create APNG: apngasm animation.apng frame_*.png 1/%d\n", config.frameRate)
+	fmt.Fprintf(file, "To create WebM: ffmpeg -r %d -i frame_%%04d.png -c:v libvpx-vp9 -pix_fmt yuva420p animation.webm\n", config.frameRate)
+
+	log.Printf("Created animation info file: %s", filename)
+	return nil
+}
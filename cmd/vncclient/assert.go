@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/coder/websockify/vncclient"
+)
+
+// pixelAssertion is one -assert-pixel check
+type pixelAssertion struct {
+	x, y      int
+	want      color.RGBA
+	tolerance uint8
+}
+
+func (a pixelAssertion) String() string {
+	return fmt.Sprintf("(%d,%d) is %s", a.x, a.y, hexColor(a.want))
+}
+
+// check returns an error if the frame's pixel differs from the expected colour
+// by more than the tolerance
+func (a pixelAssertion) check(frame *image.RGBA) error {
+	if !image.Pt(a.x, a.y).In(frame.Rect) {
+		return fmt.Errorf("pixel (%d,%d) is outside the %dx%d framebuffer", a.x, a.y, frame.Rect.Dx(), frame.Rect.Dy())
+	}
+	want := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	want.SetRGBA(0, 0, a.want)
+	diff, err := vncclient.CompareFrames(frame.SubImage(image.Rect(a.x, a.y, a.x+1, a.y+1)), want, a.tolerance)
+	if err != nil {
+		return err
+	}
+	if !diff.Match() {
+		return fmt.Errorf("pixel (%d,%d) is %s, want %s", a.x, a.y, hexColor(frame.RGBAAt(a.x, a.y)), hexColor(a.want))
+	}
+	return nil
+}
+
+// checkPixels logs the result of each assertion against the client's latest
+// frame, returning whether they all passed
+func checkPixels(client *vncclient.Client, assertions pixelAssertions) bool {
+	if client.FrameCount() == 0 {
+		log.Printf("Pixel assertions failed: no frames received")
+		return false
+	}
+	frame := client.Snapshot()
+	passed := true
+	for _, a := range assertions {
+		if err := a.check(frame); err != nil {
+			log.Printf("Pixel assertion failed: %v", err)
+			passed = false
+		} else {
+			log.Printf("Pixel assertion passed: %v", a)
+		}
+	}
+	return passed
+}
+
+// pixelAssertions collects repeated -assert-pixel flags
+type pixelAssertions []pixelAssertion
+
+func (p *pixelAssertions) String() string {
+	return fmt.Sprintf("%d pixel assertions", len(*p))
+}
+
+func (p *pixelAssertions) Set(value string) error {
+	a, err := parsePixelAssertion(value)
+	if err != nil {
+		return err
+	}
+	*p = append(*p, a)
+	return nil
+}
+
+// parsePixelAssertion parses x,y,#RRGGBB with an optional ,tolerance
+func parsePixelAssertion(value string) (pixelAssertion, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 3 && len(parts) != 4 {
+		return pixelAssertion{}, fmt.Errorf("invalid pixel assertion %q: want x,y,#RRGGBB[,tolerance]", value)
+	}
+
+	var a pixelAssertion
+	var err error
+	if a.x, err = strconv.Atoi(parts[0]); err != nil || a.x < 0 {
+		return a, fmt.Errorf("invalid x in %q", value)
+	}
+	if a.y, err = strconv.Atoi(parts[1]); err != nil || a.y < 0 {
+		return a, fmt.Errorf("invalid y in %q", value)
+	}
+	hex, ok := strings.CutPrefix(parts[2], "#")
+	rgb, err := strconv.ParseUint(hex, 16, 32)
+	if !ok || len(hex) != 6 || err != nil {
+		return a, fmt.Errorf("invalid colour in %q: want #RRGGBB", value)
+	}
+	a.want = color.RGBA{R: uint8(rgb >> 16), G: uint8(rgb >> 8), B: uint8(rgb), A: 255}
+	if len(parts) == 4 {
+		tolerance, err := strconv.ParseUint(parts[3], 10, 8)
+		if err != nil {
+			return a, fmt.Errorf("invalid tolerance in %q: must be between 0 and 255", value)
+		}
+		a.tolerance = uint8(tolerance)
+	}
+	return a, nil
+}
+
+// hexColor formats a colour as #RRGGBB
+func hexColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02X%02X%02X", c.R, c.G, c.B)
+}
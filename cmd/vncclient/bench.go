@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/coder/websockify/vncclient"
+)
+
+// benchReport is the JSON summary printed by -bench
+type benchReport struct {
+	Host             string          `json:"host"`
+	DurationSeconds  float64         `json:"duration_seconds"`
+	Frames           int             `json:"frames"`
+	FPS              float64         `json:"fps"`
+	Bytes            int64           `json:"bytes"`
+	BytesPerSecond   float64         `json:"bytes_per_second"`
+	DecodeSeconds    float64         `json:"decode_seconds"`
+	DecodeMsPerFrame float64         `json:"decode_ms_per_frame"`
+	Continuous       bool            `json:"continuous_updates"`
+	Latency          durationSummary `json:"latency_ms"`
+	FrameInterval    durationSummary `json:"frame_interval_ms"`
+}
+
+// durationSummary describes update request to first byte latencies, or the
+// times between updates, in milliseconds
+type durationSummary struct {
+	Count int     `json:"count"`
+	Mean  float64 `json:"mean"`
+	P50   float64 `json:"p50"`
+	P95   float64 `json:"p95"`
+	Max   float64 `json:"max"`
+}
+
+// writeBenchReport writes the client's statistics as an indented JSON object
+func writeBenchReport(w io.Writer, host string, st vncclient.Stats) error {
+	report := benchReport{
+		Host:            host,
+		DurationSeconds: st.Duration.Seconds(),
+		Frames:          st.Frames,
+		FPS:             st.FPS(),
+		Bytes:           st.Bytes,
+		BytesPerSecond:  st.BytesPerSecond(),
+		DecodeSeconds:   st.DecodeTime.Seconds(),
+		Continuous:      st.ContinuousUpdates,
+		Latency:         summarizeDurations(st.Latencies),
+		FrameInterval:   summarizeDurations(st.Intervals),
+	}
+	if st.Frames > 0 {
+		report.DecodeMsPerFrame = milliseconds(st.DecodeTime / time.Duration(st.Frames))
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
+
+// summarizeDurations returns the mean, nearest-rank percentiles and maximum of durations
+func summarizeDurations(durations []time.Duration) durationSummary {
+	if len(durations) == 0 {
+		return durationSummary{}
+	}
+	sorted := slices.Clone(durations)
+	slices.Sort(sorted)
+
+	var total time.Duration
+	for _, l := range sorted {
+		total += l
+	}
+	percentile := func(p int) float64 {
+		rank := (p*len(sorted) + 99) / 100
+		return milliseconds(sorted[max(rank, 1)-1])
+	}
+	return durationSummary{
+		Count: len(sorted),
+		Mean:  milliseconds(total / time.Duration(len(sorted))),
+		P50:   percentile(50),
+		P95:   percentile(95),
+		Max:   milliseconds(sorted[len(sorted)-1]),
+	}
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/coder/websockify/vncclient"
+)
+
+// eventLog writes each client event as one line of JSON for -json
+type eventLog struct {
+	mutex sync.Mutex
+	file  *os.File
+	enc   *json.Encoder
+}
+
+// openEventLog creates path for the event log, or uses stdout for "-"
+func openEventLog(path string) (*eventLog, error) {
+	file := os.Stdout
+	if path != "-" {
+		var err error
+		if file, err = os.Create(path); err != nil {
+			return nil, err
+		}
+	}
+	return &eventLog{file: file, enc: json.NewEncoder(file)}, nil
+}
+
+// write appends ev to the log. Events are written unbuffered, so the log is
+// complete even when the client exits with log.Fatal.
+func (l *eventLog) write(ev vncclient.Event) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if err := l.enc.Encode(ev); err != nil {
+		log.Printf("Failed to write event: %v", err)
+	}
+}
+
+// Close closes the log file unless it is stdout
+func (l *eventLog) Close() error {
+	if l.file == os.Stdout {
+		return nil
+	}
+	return l.file.Close()
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"image"
+
+	"github.com/coder/websockify/vncclient"
+)
+
+// goldenCheck compares received frames with a reference image for -expect-frame
+type goldenCheck struct {
+	want      image.Image
+	tolerance uint8
+	onMatch   func() // Called once, for the first matching frame
+
+	frames  int
+	matched bool
+	closest *vncclient.FrameDiff // Comparison with the fewest differing pixels
+	err     error                // Why the last frame could not be compared
+}
+
+// newGoldenCheck loads the reference image from a PNG file
+func newGoldenCheck(filename string, tolerance uint8, onMatch func()) (*goldenCheck, error) {
+	want, err := vncclient.LoadPNG(filename)
+	if err != nil {
+		return nil, err
+	}
+	return &goldenCheck{want: want, tolerance: tolerance, onMatch: onMatch}, nil
+}
+
+// check compares a frame, until one has matched
+func (g *goldenCheck) check(frame *image.RGBA) {
+	if g.matched {
+		return
+	}
+	g.frames++
+	diff, err := vncclient.CompareFrames(frame, g.want, g.tolerance)
+	if err != nil {
+		g.err = err
+		return
+	}
+	if diff.Match() {
+		g.matched = true
+		if g.onMatch != nil {
+			g.onMatch()
+		}
+		return
+	}
+	if g.closest == nil || diff.Pixels < g.closest.Pixels {
+		g.closest = &diff
+	}
+}
+
+// result returns nil if a frame matched, otherwise describes the closest miss
+func (g *goldenCheck) result() error {
+	switch {
+	case g.matched:
+		return nil
+	case g.frames == 0:
+		return fmt.Errorf("no frames received")
+	case g.closest != nil:
+		return fmt.Errorf("none of %d frames matched: closest differs in %d pixels by up to %d, first at (%d,%d)",
+			g.frames, g.closest.Pixels, g.closest.MaxDelta, g.closest.First.X, g.closest.First.Y)
+	default:
+		return fmt.Errorf("none of %d frames matched: %v", g.frames, g.err)
+	}
+}
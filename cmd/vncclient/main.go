@@ -1,63 +1,77 @@
 package main
 
 import (
-	"encoding/binary"
+	"context"
+	"crypto/tls"
+	"errors"
 	"flag"
 	"fmt"
 	"image"
-	"image/color"
-	"image/png"
 	"io"
 	"log"
 	"net"
 	"os"
-	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/coder/websockify/rfb"
 	"github.com/coder/websockify/version"
 	"github.com/coder/websockify/viewer"
+	"github.com/coder/websockify/vncclient"
 )
 
-
-type VNCClient struct {
-	conn            net.Conn
-	width           int
-	height          int
-	framebuffer     *image.RGBA
-	frameCount      int
-	captureFrames   bool
-	outputDir       string
-	useCheckerboard bool
-	createWebM      bool
-	createAPNG      bool
-	frameRate       int
-	capturedFrames  []*image.RGBA // Store frames for animation
-	viewer          *viewer.FramebufferViewer
-	showGUI         bool
-	serverPixelFormat rfb.PixelFormat // Server's pixel format from handshake
-}
-
-
 func main() {
 	var (
-		host           = flag.String("host", "localhost:5900", "VNC server host:port")
-		capture        = flag.Bool("capture", false, "Capture framebuffer updates as PNG files")
-		output         = flag.String("output", "./test_output", "Output directory for captured frames")
-		duration       = flag.Int("duration", 10, "Duration to run client in seconds")
-		checkerboard   = flag.Bool("checkerboard", false, "Add checkerboard background to show transparency")
-		animateWebM    = flag.Bool("webm", false, "Create WebM video animation from captured frames")
-		animateAPNG    = flag.Bool("apng", false, "Create APNG animation from captured frames")
-		frameRate      = flag.Int("fps", 2, "Frame rate for animations (frames per second)")
-		gui            = flag.Bool("gui", false, "Show framebuffer in GUI window (requires GUI environment)")
+		host            = flag.String("host", "localhost:5900", "VNC server host:port, unix:///path for a unix socket, or a ws:// or wss:// URL to connect through websockify")
+		capture         = flag.Bool("capture", false, "Capture framebuffer updates as PNG files")
+		output          = flag.String("output", "./test_output", "Output directory for captured frames")
+		duration        = flag.Int("duration", 10, "Duration to run client in seconds")
+		checkerboard    = flag.Bool("checkerboard", false, "Add checkerboard background to show transparency")
+		animateWebM     = flag.Bool("webm", false, "Create WebM video animation from captured frames")
+		animateAPNG     = flag.Bool("apng", false, "Create APNG animation from captured frames")
+		animateGIF      = flag.Bool("gif", false, "Create an animated GIF of the received frames in the output directory")
+		frameRate       = flag.Int("fps", 2, "Frame rate for animations (frames per second)")
+		password        = flag.String("password", "", "Password for VNC Authentication (only the first 8 characters are used)")
+		passwordFile    = flag.String("password-file", "", "Read the VNC Authentication password from the first line of this file")
+		useTLS          = flag.Bool("tls", false, "Connect over TLS from the first byte, as to a server behind stunnel")
+		vencrypt        = flag.Bool("vencrypt", false, "Choose VeNCrypt (security type 19) when offered and upgrade to TLS during the handshake")
+		tlsCA           = flag.String("tls-ca", "", "PEM CA certificates to verify the server with for -tls, -vencrypt and wss:// instead of the system roots")
+		tlsInsecure     = flag.Bool("tls-insecure", false, "Skip verification of the server's TLS certificate")
+		hideCursor      = flag.Bool("hide-cursor", false, "Leave the server's cursor out of captured and displayed frames")
+		clipboardSend   = flag.String("clipboard-send", "", "Send this text to the server's clipboard with ClientCutText after connecting")
+		clipboardPrint  = flag.Bool("clipboard-print", false, "Print the text of each ServerCutText received to stdout")
+		clipboardOut    = flag.String("clipboard-out", "", "Save the text of the latest ServerCutText received to this file")
+		updateInterval  = flag.Duration("update-interval", vncclient.DefaultUpdateInterval, "Time between incremental FramebufferUpdateRequests while continuous updates are off")
+		poll            = flag.Bool("poll", false, "Request updates every -update-interval even when the server supports ContinuousUpdates")
+		jsonEvents      = flag.String("json", "", "Write one JSON object per event (handshake, updates, rectangles, cut text, bell, errors) to this file, or - for stdout")
+		bench           = flag.Bool("bench", false, "Print a JSON summary of frame rate, throughput, decode time and update latency to stdout when the run ends")
+		record          = flag.String("record", "", "Record the server's messages to this FBS file for -replay")
+		reconnect       = flag.Duration("reconnect", 0, "Reconnect this long after the connection drops, until -duration ends; 0 exits instead")
+		metricsAddr     = flag.String("metrics", "", "Serve Prometheus metrics totalled across reconnections at /metrics on this address, e.g. :9101 (JSON with ?format=json)")
+		listen          = flag.String("listen", "", "Wait for a server to make a reverse connection to this address, such as :5500, instead of connecting to -host")
+		replay          = flag.String("replay", "", "Decode this FBS recording instead of connecting to -host, until it ends")
+		replaySpeed     = flag.Float64("replay-speed", 0, "Replay at this multiple of real time; 0 replays as fast as possible")
+		screenshot      = flag.String("screenshot", "", "Save one full update to this PNG file and exit, waiting up to -duration seconds")
+		expectFrame     = flag.String("expect-frame", "", "Exit with status 1 unless a received frame matches this reference PNG; the run ends at the first match")
+		expectTolerance = flag.Uint("expect-tolerance", 0, "Largest difference allowed in any colour component (0-255) for -expect-frame")
+		gui             = flag.Bool("gui", false, "Show framebuffer in GUI window (requires GUI environment)")
+		viewOnly        = flag.Bool("view-only", false, "Do not send keyboard, mouse and clipboard input from the GUI window to the server")
+		web             = flag.String("web", "", "Serve a live view of the framebuffer at http://ADDR/ instead of a GUI window, such as :8081")
+		terminal        = flag.String("terminal", "", "Draw the framebuffer in the terminal in COLUMNSxROWS cells, such as 120x40, or auto for the terminal's size")
+		viewDir         = flag.String("view-dir", "", "Save the frames a viewer would show, up to ten a second, as PNG files in this directory listed in frames.ffconcat")
+		scale           = flag.String("scale", "fit", "How the GUI window shows the framebuffer: fit, stretch, integer (the largest whole multiple that fits) or 1:1 (scrolled when larger than the window)")
+		zoom            = flag.Float64("zoom", 1, "Zoom for -scale 1:1, such as 0.5 or 2")
+		devicePixels    = flag.Bool("device-pixels", false, "Map framebuffer pixels to display pixels rather than logical ones on HiDPI screens, so -scale 1:1 is pixel for pixel")
 		testPixelFormat = flag.Bool("test-pixel-format", false, "Send a test SetPixelFormat message (16bpp RGB565)")
-		showVersion    = flag.Bool("version", false, "Show version information")
-		help           = flag.Bool("help", false, "Show this help message")
+		showVersion     = flag.Bool("version", false, "Show version information")
+		help            = flag.Bool("help", false, "Show this help message")
 	)
+	var assertPixels pixelAssertions
+	flag.Var(&assertPixels, "assert-pixel", "Exit with status 1 unless the last frame's pixel matches: x,y,#RRGGBB[,tolerance] (repeatable)")
 	flag.Parse()
 
 	if *showVersion {
-		fmt.Printf("vncclient %s\n", version.Version())
+		fmt.Printf("vncclient %s\n", version.Full())
 		os.Exit(0)
 	}
 
@@ -69,26 +83,139 @@ func main() {
 		fmt.Fprintf(os.Stderr, "\nExamples:\n")
 		fmt.Fprintf(os.Stderr, "  %s -host localhost:5900\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "  %s -host localhost:8080 -capture -output ./test-frames\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -host ws://localhost:6080/websockify -duration 5\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -host unix:///tmp/vnc.sock\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -host localhost:5900 -password secret\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -host localhost:5900 -tls -tls-ca server.pem\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -host localhost:5900 -vencrypt -tls-insecure -password secret\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -host localhost:5900 -gui -view-only\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -host localhost:5900 -gui -scale 1:1 -zoom 2\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -host localhost:8080 -bench -duration 30\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -host localhost:8080 -bench -poll -update-interval 10ms -duration 30\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -host localhost:8080 -expect-frame golden.png -expect-tolerance 2\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -host localhost:8080 -screenshot screen.png\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -host localhost:8080 -json events.jsonl -duration 5\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -host localhost:8080 -record session.fbs -duration 30\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -replay session.fbs -capture -output ./replayed\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -listen :5500 -capture -duration 10\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -host localhost:8080 -reconnect 5s -metrics :9101 -duration 86400\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -host localhost:8080 -assert-pixel 0,0,#FF0000 -assert-pixel 10,20,#00FF00,8\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -host localhost:5900 -clipboard-send hello -clipboard-print -duration 2\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "  %s -host localhost:5900 -capture -checkerboard\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "  %s -host localhost:5900 -webm -apng -fps 5 -duration 10\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "  %s -host localhost:5900 -capture -checkerboard -webm -fps 2\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -host localhost:5900 -gif -fps 5 -duration 10\n", os.Args[0])
 		os.Exit(0)
 	}
 
+	if *password != "" && *passwordFile != "" {
+		fmt.Fprintf(os.Stderr, "Error: -password and -password-file cannot be used together\n")
+		os.Exit(1)
+	}
+	if *passwordFile != "" {
+		var err error
+		if *password, err = readPasswordFile(*passwordFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *listen != "" && *replay != "" {
+		fmt.Fprintf(os.Stderr, "Error: -listen and -replay cannot be used together\n")
+		os.Exit(1)
+	}
+	viewers := 0
+	for _, on := range []bool{*gui, *web != "", *terminal != "", *viewDir != ""} {
+		if on {
+			viewers++
+		}
+	}
+	if viewers > 1 {
+		fmt.Fprintf(os.Stderr, "Error: only one of -gui, -web, -terminal and -view-dir can be used\n")
+		os.Exit(1)
+	}
+	if *reconnect > 0 && (*replay != "" || *screenshot != "" || *capture || *animateGIF || viewers > 0) {
+		fmt.Fprintf(os.Stderr, "Error: -reconnect cannot be used with -replay, -screenshot, -capture, -gif, -gui, -web, -terminal or -view-dir\n")
+		os.Exit(1)
+	}
+	var terminalColumns, terminalRows int
+	if *terminal != "" {
+		var err error
+		if terminalColumns, terminalRows, err = viewer.TerminalSize(*terminal); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: -terminal: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	scaleMode, err := viewer.ParseScaleMode(*scale)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: -scale: %v\n", err)
+		os.Exit(1)
+	}
+	if *zoom <= 0 {
+		fmt.Fprintf(os.Stderr, "Error: -zoom must be greater than 0\n")
+		os.Exit(1)
+	}
+	if *frameRate < 1 {
+		fmt.Fprintf(os.Stderr, "Error: -fps must be at least 1\n")
+		os.Exit(1)
+	}
+	if *expectTolerance > 255 {
+		fmt.Fprintf(os.Stderr, "Error: -expect-tolerance must be between 0 and 255\n")
+		os.Exit(1)
+	}
+	if len(*password) > 8 {
+		fmt.Fprintf(os.Stderr, "Warning: VNC Authentication only uses the first 8 characters of the password\n")
+	}
+
+	tlsConfig, err := loadTLSConfig(*tlsCA, *tlsInsecure)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load TLS CA certificates: %v\n", err)
+		os.Exit(1)
+	}
+
 	// Configuration for VNC client
 	config := VNCConfig{
 		host:            *host,
+		password:        *password,
+		useTLS:          *useTLS,
+		vencrypt:        *vencrypt,
+		tlsConfig:       tlsConfig,
 		captureFrames:   *capture,
 		outputDir:       *output,
 		duration:        *duration,
 		useCheckerboard: *checkerboard,
+		hideCursor:      *hideCursor,
 		createWebM:      *animateWebM,
 		createAPNG:      *animateAPNG,
+		createGIF:       *animateGIF,
 		frameRate:       *frameRate,
+		clipboardSend:   *clipboardSend,
+		clipboardPrint:  *clipboardPrint,
+		clipboardOut:    *clipboardOut,
+		updateInterval:  *updateInterval,
+		poll:            *poll,
+		jsonEvents:      *jsonEvents,
+		bench:           *bench,
+		record:          *record,
+		reconnect:       *reconnect,
+		metricsAddr:     *metricsAddr,
+		listen:          *listen,
+		replay:          *replay,
+		replaySpeed:     *replaySpeed,
+		screenshot:      *screenshot,
+		expectFrame:     *expectFrame,
+		expectTolerance: uint8(*expectTolerance),
+		assertPixels:    assertPixels,
 		showGUI:         *gui,
+		webAddr:         *web,
+		terminalColumns: terminalColumns,
+		terminalRows:    terminalRows,
+		viewDir:         *viewDir,
+		viewOnly:        *viewOnly,
+		view:            viewer.View{Mode: scaleMode, Zoom: float32(*zoom), DevicePixels: *devicePixels},
 		testPixelFormat: *testPixelFormat,
 	}
 
+	log.Printf("Starting vncclient %s", version.Full())
 	if *gui {
 		// Run with GUI - this will block on main thread
 		runWithGUI(config)
@@ -100,513 +227,381 @@ func main() {
 
 type VNCConfig struct {
 	host            string
+	password        string
+	useTLS          bool
+	vencrypt        bool
+	tlsConfig       *tls.Config
 	captureFrames   bool
 	outputDir       string
 	duration        int
 	useCheckerboard bool
+	hideCursor      bool
 	createWebM      bool
 	createAPNG      bool
+	createGIF       bool
 	frameRate       int
+	clipboardSend   string
+	clipboardPrint  bool
+	clipboardOut    string
+	updateInterval  time.Duration
+	poll            bool
+	jsonEvents      string
+	bench           bool
+	record          string
+	reconnect       time.Duration
+	metricsAddr     string
+	listen          string
+	replay          string
+	replaySpeed     float64
+	screenshot      string
+	expectFrame     string
+	expectTolerance uint8
+	assertPixels    pixelAssertions
 	showGUI         bool
+	webAddr         string
+	terminalColumns int // Size of the -terminal view; disabled when 0
+	terminalRows    int
+	viewDir         string
+	viewOnly        bool
+	view            viewer.View
 	testPixelFormat bool
 }
 
 func runWithGUI(config VNCConfig) {
 	// This will run on the main thread as required by macOS
-	viewer.RunWithVNCClient("VNC Client", 800, 600, func(v *viewer.FramebufferViewer) {
+	viewer.RunWithVNCClient("VNC Client", 800, 600, func(v viewer.Viewer) {
 		runVNCClient(config, v)
 	})
 }
 
+// runWithoutGUI runs the client with the -web, -terminal or -view-dir viewer,
+// if any
 func runWithoutGUI(config VNCConfig) {
-	runVNCClient(config, nil)
-}
-
-func runVNCClient(config VNCConfig, guiViewer *viewer.FramebufferViewer) {
-	client := &VNCClient{
-		captureFrames:   config.captureFrames,
-		outputDir:       config.outputDir,
-		useCheckerboard: config.useCheckerboard,
-		createWebM:      config.createWebM,
-		createAPNG:      config.createAPNG,
-		frameRate:       config.frameRate,
-		capturedFrames:  make([]*image.RGBA, 0),
-		showGUI:         config.showGUI,
-		viewer:          guiViewer,
-	}
-
-	if client.captureFrames {
-		if err := os.MkdirAll(client.outputDir, 0755); err != nil {
-			log.Fatalf("Failed to create output directory: %v", err)
+	switch {
+	case config.webAddr != "":
+		web, err := viewer.ListenWebViewer(config.webAddr, "VNC Client")
+		if err != nil {
+			log.Fatalf("Failed to start web viewer: %v", err)
 		}
+		defer web.Close()
+		log.Printf("Serving live view on http://%s/", config.webAddr)
+		runVNCClient(config, web)
+	case config.terminalColumns > 0:
+		term := viewer.NewTerminalViewer(os.Stdout, config.terminalColumns, config.terminalRows)
+		defer term.Close()
+		runVNCClient(config, term)
+	case config.viewDir != "":
+		frames, err := viewer.NewRecordingViewer(config.viewDir, viewer.DefaultRecordingInterval)
+		if err != nil {
+			log.Fatalf("Failed to start recording viewer: %v", err)
+		}
+		defer func() {
+			frames.Close()
+			log.Printf("Saved %d viewer frames to %s", frames.Frames(), config.viewDir)
+		}()
+		runVNCClient(config, frames)
+	default:
+		runVNCClient(config, nil)
 	}
+}
 
-	log.Printf("Connecting to VNC server at %s", config.host)
-	conn, err := net.Dial("tcp", config.host)
-	if err != nil {
-		log.Fatalf("Failed to connect: %v", err)
-	}
-	defer conn.Close()
-
-	client.conn = conn
-
-	if err := client.handshake(); err != nil {
-		log.Fatalf("Handshake failed: %v", err)
+func runVNCClient(config VNCConfig, guiViewer viewer.Viewer) {
+	opts := vncclient.Options{
+		Password:          config.password,
+		TLS:               config.useTLS,
+		VeNCrypt:          config.vencrypt,
+		TLSConfig:         config.tlsConfig,
+		HideCursor:        config.hideCursor,
+		UpdateInterval:    config.updateInterval,
+		ContinuousUpdates: !config.poll,
+		Capture: vncclient.CaptureOptions{
+			Checkerboard: config.useCheckerboard,
+			Keep:         config.captureFrames && (config.createWebM || config.createAPNG) || config.createGIF,
+		},
+	}
+	if config.captureFrames {
+		opts.Capture.Dir = config.outputDir
 	}
-
-	log.Printf("VNC handshake completed. Screen: %dx%d", client.width, client.height)
-	
-	// Test SetPixelFormat if requested
 	if config.testPixelFormat {
-		// Send a 16bpp RGB565 pixel format
+		// Send a 16bpp RGB565 pixel format after the handshake
 		testFormat := rfb.RGB565PixelFormat()
-		log.Printf("Sending test SetPixelFormat message (16bpp RGB565)")
-		if err := client.sendSetPixelFormat(testFormat); err != nil {
-			log.Printf("Failed to send SetPixelFormat: %v", err)
-		}
-	}
-
-	// If GUI viewer was passed, reinitialize it with actual dimensions
-	if client.showGUI && client.viewer != nil {
-		client.viewer.Initialize(fmt.Sprintf("VNC Client - %s", config.host), client.width, client.height)
-		client.viewer.Show()
-		log.Printf("GUI viewer initialized with actual screen size")
-	}
-
-	// Request initial framebuffer update
-	if err := client.requestFramebufferUpdate(false, 0, 0, uint16(client.width), uint16(client.height)); err != nil {
-		log.Printf("Failed to request framebuffer update: %v", err)
+		opts.PixelFormat = &testFormat
 	}
-
-	// Run for specified duration
-	timeout := time.After(time.Duration(config.duration) * time.Second)
-	ticker := time.NewTicker(1 * time.Second)
-	defer ticker.Stop()
-
-	log.Printf("Running VNC client for %d seconds...", config.duration)
-
-	for {
-		select {
-		case <-timeout:
-			log.Printf("Client finished. Captured %d frames.", client.frameCount)
-			
-			// Create animations if requested
-			if client.createWebM {
-				if err := client.createWebMAnimation(); err != nil {
-					log.Printf("Failed to create WebM animation: %v", err)
-				}
+	if config.clipboardPrint || config.clipboardOut != "" || guiViewer != nil {
+		opts.OnCutText = func(text string) {
+			if guiViewer != nil {
+				guiViewer.SetClipboard(text)
 			}
-			if client.createAPNG {
-				if err := client.createAPNGAnimation(); err != nil {
-					log.Printf("Failed to create APNG animation: %v", err)
-				}
+			if config.clipboardPrint {
+				fmt.Println(text)
 			}
-			return
-		case <-ticker.C:
-			// Request periodic framebuffer updates
-			if err := client.requestFramebufferUpdate(true, 0, 0, uint16(client.width), uint16(client.height)); err != nil {
-				log.Printf("Failed to request framebuffer update: %v", err)
-			}
-		default:
-			// Handle incoming messages
-			if err := client.handleMessage(); err != nil {
-				if err == io.EOF {
-					log.Printf("Connection closed by server")
-					return
+			if config.clipboardOut != "" {
+				if err := os.WriteFile(config.clipboardOut, []byte(text), 0o644); err != nil {
+					log.Printf("Failed to save clipboard: %v", err)
 				}
-				log.Printf("Error handling message: %v", err)
 			}
 		}
 	}
-}
 
-func (c *VNCClient) handshake() error {
-	// Read server version
-	serverVersion, err := rfb.ReadRFBVersion(c.conn)
-	if err != nil {
-		return fmt.Errorf("failed to read server version: %v", err)
-	}
-	log.Printf("Server version: %s", serverVersion)
+	// stopRun ends the run before -duration, such as when -expect-frame matches
+	runCtx, stopRun := context.WithCancel(context.Background())
+	defer stopRun()
 
-	// Send client version
-	if err := rfb.SendRFBVersion(c.conn); err != nil {
-		return fmt.Errorf("failed to send client version: %v", err)
+	var onFrame []func(frame *image.RGBA)
+	if guiViewer != nil {
+		guiViewer.SetView(config.view)
+		opts.OnResize = func(width, height int) {
+			guiViewer.Init(fmt.Sprintf("VNC Client - %s", config.host), width, height)
+		}
+		var shown image.Rectangle
+		onFrame = append(onFrame, func(frame *image.RGBA) {
+			switch {
+			case config.useCheckerboard:
+				guiViewer.UpdateFramebuffer(vncclient.Checkerboard(frame))
+			case frame.Rect != shown:
+				guiViewer.UpdateFramebuffer(cloneFrame(frame))
+				shown = frame.Rect
+			default:
+				// Copied into the viewer's frame rather than cloned. It is
+				// copied whole, as the cursor may have moved outside the
+				// rectangles updated.
+				guiViewer.UpdateRegion(frame, frame.Rect)
+			}
+		})
+	}
+	var golden *goldenCheck
+	if config.expectFrame != "" {
+		var err error
+		golden, err = newGoldenCheck(config.expectFrame, config.expectTolerance, func() {
+			log.Printf("Frame matches %s", config.expectFrame)
+			stopRun()
+		})
+		if err != nil {
+			log.Fatalf("Failed to load -expect-frame: %v", err)
+		}
+		onFrame = append(onFrame, golden.check)
 	}
-
-	// Read security types
-	securityTypes, err := rfb.ReadSecurityTypes(c.conn)
-	if err != nil {
-		return fmt.Errorf("failed to read security types: %v", err)
+	if len(onFrame) > 0 {
+		opts.OnFrame = func(frame *image.RGBA) {
+			for _, fn := range onFrame {
+				fn(frame)
+			}
+		}
 	}
-	log.Printf("Available security types: %v", securityTypes)
 
-	// Choose security type (1 = None)
-	securityChoice := uint8(rfb.SecurityNone)
-	if err := binary.Write(c.conn, binary.BigEndian, securityChoice); err != nil {
-		return fmt.Errorf("failed to send security choice: %v", err)
+	if config.jsonEvents != "" {
+		events, err := openEventLog(config.jsonEvents)
+		if err != nil {
+			log.Fatalf("Failed to create event log: %v", err)
+		}
+		defer events.Close()
+		opts.OnEvent = events.write
 	}
 
-	// Read security result
-	securityResult, err := rfb.ReadSecurityResult(c.conn)
-	if err != nil {
-		return fmt.Errorf("failed to read security result: %v", err)
-	}
-	if securityResult != 0 {
-		return fmt.Errorf("security handshake failed: %d", securityResult)
+	if config.record != "" {
+		file, err := os.Create(config.record)
+		if err != nil {
+			log.Fatalf("Failed to create recording: %v", err)
+		}
+		defer file.Close()
+		opts.Record = file
 	}
 
-	// Send ClientInit (shared = 1)
-	clientInit := uint8(1)
-	if err := binary.Write(c.conn, binary.BigEndian, clientInit); err != nil {
-		return fmt.Errorf("failed to send client init: %v", err)
+	metrics := &soakMetrics{}
+	if config.metricsAddr != "" {
+		log.Printf("Serving metrics on http://%s/metrics", config.metricsAddr)
+		go func() {
+			log.Fatalf("Metrics server stopped: %v", serveSoakMetrics(config.metricsAddr, metrics))
+		}()
 	}
 
-	// Read ServerInit
-	serverInit, err := rfb.ReadServerInit(c.conn)
+	client, err := connect(runCtx, config, opts)
 	if err != nil {
-		return fmt.Errorf("failed to read server init: %v", err)
+		log.Fatalf("%v", err)
 	}
+	// -reconnect replaces client
+	defer func() { client.Close() }()
+	metrics.connected(client, false)
 
-	c.width = int(serverInit.Width)
-	c.height = int(serverInit.Height)
-	c.framebuffer = image.NewRGBA(image.Rect(0, 0, c.width, c.height))
-	c.serverPixelFormat = serverInit.PixelFormat
+	log.Printf("VNC handshake completed. Screen: %dx%d", client.Width(), client.Height())
 
-	log.Printf("Server: %s, %dx%d, %d bpp", serverInit.Name, c.width, c.height, serverInit.PixelFormat.BitsPerPixel)
-	log.Printf("Server pixel format: depth=%d, true-color=%d, endian=%s", 
-		serverInit.PixelFormat.Depth, serverInit.PixelFormat.TrueColorFlag,
-		map[uint8]string{0: "little", 1: "big"}[serverInit.PixelFormat.BigEndianFlag])
-	log.Printf("Color maximums: R=%d G=%d B=%d, Shifts: R=%d G=%d B=%d",
-		serverInit.PixelFormat.RedMax, serverInit.PixelFormat.GreenMax, serverInit.PixelFormat.BlueMax,
-		serverInit.PixelFormat.RedShift, serverInit.PixelFormat.GreenShift, serverInit.PixelFormat.BlueShift)
-
-	return nil
-}
-
-// sendSetPixelFormat sends a SetPixelFormat message to the server
-func (c *VNCClient) sendSetPixelFormat(pf rfb.PixelFormat) error {
-	msg := rfb.CreateSetPixelFormat(pf)
-	
-	if _, err := c.conn.Write(msg); err != nil {
-		return fmt.Errorf("failed to send SetPixelFormat message: %v", err)
-	}
-	
-	log.Printf("Sent SetPixelFormat: %d bpp, depth %d, %s-endian, true-color=%d", 
-		pf.BitsPerPixel, pf.Depth, 
-		map[uint8]string{0: "little", 1: "big"}[pf.BigEndianFlag],
-		pf.TrueColorFlag)
-	
-	return nil
-}
-
-func (c *VNCClient) requestFramebufferUpdate(incremental bool, x, y, width, height uint16) error {
-	msg := make([]byte, 10)
-	msg[0] = rfb.FramebufferUpdateRequest
-	if incremental {
-		msg[1] = 1
-	} else {
-		msg[1] = 0
+	// If GUI viewer was passed, reinitialize it with actual dimensions
+	if guiViewer != nil {
+		guiViewer.Init(fmt.Sprintf("VNC Client - %s", config.host), client.Width(), client.Height())
+		log.Printf("GUI viewer initialized with actual screen size")
+		go handleViewerEvents(guiViewer.Events(), client, config.viewOnly, stopRun)
+		defer logFrameStats(guiViewer)
 	}
-	binary.BigEndian.PutUint16(msg[2:4], x)
-	binary.BigEndian.PutUint16(msg[4:6], y)
-	binary.BigEndian.PutUint16(msg[6:8], width)
-	binary.BigEndian.PutUint16(msg[8:10], height)
 
-	_, err := c.conn.Write(msg)
-	return err
-}
+	sendClipboard(client, config)
 
-func (c *VNCClient) handleMessage() error {
-	c.conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
-	
-	var messageType uint8
-	if err := binary.Read(c.conn, binary.BigEndian, &messageType); err != nil {
-		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
-			return nil // Timeout is expected
-		}
-		return err
-	}
-
-	c.conn.SetReadDeadline(time.Time{}) // Clear deadline
-
-	switch messageType {
-	case rfb.FramebufferUpdate: // FramebufferUpdate
-		return c.handleFramebufferUpdate()
-	case rfb.SetColorMapEntries: // SetColorMapEntries
-		log.Printf("Received SetColorMapEntries (not implemented)")
-		return c.skipMessage(6) // Skip the rest of the message
-	case rfb.Bell: // Bell
-		log.Printf("Received Bell")
-		return nil
-	case rfb.ServerCutText: // ServerCutText
-		return c.handleServerCutText()
-	default:
-		log.Printf("Unknown message type: %d", messageType)
-		return fmt.Errorf("unknown message type: %d", messageType)
+	if config.screenshot != "" {
+		takeScreenshot(client, config)
+		checkResults(client, config, golden)
+		return
 	}
-}
-
-func (c *VNCClient) handleFramebufferUpdate() error {
-	var padding uint8
-	var numRects uint16
 
-	if err := binary.Read(c.conn, binary.BigEndian, &padding); err != nil {
-		return err
+	// Run for specified duration, or to the end of a replay
+	ctx, cancel := context.WithCancel(runCtx)
+	if config.replay == "" {
+		log.Printf("Running VNC client for %d seconds...", config.duration)
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(config.duration)*time.Second)
 	}
-	if err := binary.Read(c.conn, binary.BigEndian, &numRects); err != nil {
-		return err
-	}
-
-	log.Printf("Framebuffer update: %d rectangles", numRects)
+	defer cancel()
 
-	for i := uint16(0); i < numRects; i++ {
-		var x, y, width, height uint16
-		var encoding int32
-
-		if err := binary.Read(c.conn, binary.BigEndian, &x); err != nil {
-			return err
-		}
-		if err := binary.Read(c.conn, binary.BigEndian, &y); err != nil {
-			return err
-		}
-		if err := binary.Read(c.conn, binary.BigEndian, &width); err != nil {
-			return err
-		}
-		if err := binary.Read(c.conn, binary.BigEndian, &height); err != nil {
-			return err
-		}
-		if err := binary.Read(c.conn, binary.BigEndian, &encoding); err != nil {
-			return err
-		}
+	client, err = runSessions(ctx, client, config, opts, metrics)
+	checkResults(client, config, golden)
+	switch {
+	case errors.Is(err, io.EOF) && config.replay != "":
+		log.Printf("Reached the end of %s", config.replay)
+	case errors.Is(err, io.EOF):
+		log.Printf("Connection closed by server")
+		return
+	case !errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, context.Canceled):
+		log.Printf("Error handling message: %v", err)
+		return
+	}
 
-		log.Printf("Rectangle %d: %dx%d at (%d,%d), encoding %d", i, width, height, x, y, encoding)
+	log.Printf("Client finished. Captured %d frames.", client.FrameCount())
 
-		if encoding == 0 { // Raw encoding
-			if err := c.handleRawRectangle(int(x), int(y), int(width), int(height)); err != nil {
-				return err
-			}
-		} else {
-			log.Printf("Unsupported encoding: %d", encoding)
-			// Skip unknown encoding data - this is a simplified approach
-			pixelBytes := int(width) * int(height) * 4 // Assume 32-bit pixels
-			if _, err := io.CopyN(io.Discard, c.conn, int64(pixelBytes)); err != nil {
-				return err
-			}
+	// Create animations if requested
+	frames := client.Frames()
+	if config.createWebM {
+		if err := createWebMAnimation(config, frames); err != nil {
+			log.Printf("Failed to create WebM animation: %v", err)
 		}
 	}
-
-	// Update GUI viewer if enabled
-	if c.showGUI && c.viewer != nil {
-		var displayImage image.Image = c.framebuffer
-		if c.useCheckerboard {
-			displayImage = c.compositeWithCheckerboard()
+	if config.createAPNG {
+		if err := createAPNGAnimation(config, frames); err != nil {
+			log.Printf("Failed to create APNG animation: %v", err)
 		}
-		c.viewer.UpdateFramebuffer(displayImage)
 	}
-
-	// Save frame if capturing
-	if c.captureFrames {
-		if err := c.saveFrame(); err != nil {
-			log.Printf("Failed to save frame: %v", err)
+	if config.createGIF {
+		if err := createGIFAnimation(config, frames); err != nil {
+			log.Printf("Failed to create GIF animation: %v", err)
 		}
 	}
-
-	return nil
 }
 
-func (c *VNCClient) handleRawRectangle(x, y, width, height int) error {
-	// Calculate bytes per pixel based on server's pixel format
-	bytesPerPixel := int(c.serverPixelFormat.BitsPerPixel) / 8
-	pixelDataSize := width * height * bytesPerPixel
-	pixelData := make([]byte, pixelDataSize)
-	
-	if _, err := io.ReadFull(c.conn, pixelData); err != nil {
-		return err
-	}
-
-	// Update framebuffer by converting server pixel format to RGBA
-	for row := 0; row < height; row++ {
-		for col := 0; col < width; col++ {
-			pixelOffset := (row*width + col) * bytesPerPixel
-			if pixelOffset+bytesPerPixel <= len(pixelData) {
-				rgba := rfb.ConvertPixelToRGBA(pixelData[pixelOffset:pixelOffset+bytesPerPixel], c.serverPixelFormat)
-				c.framebuffer.Set(x+col, y+row, rgba)
-			}
+// handleViewerEvents forwards the viewer window's input and clipboard text to
+// client unless viewOnly, and stops the run when the window closes
+func handleViewerEvents(events <-chan viewer.Event, client *vncclient.Client, viewOnly bool, stop func()) {
+	for ev := range events {
+		var err error
+		switch {
+		case ev.Type == viewer.EventClosed:
+			stop()
+			return
+		case viewOnly:
+		case ev.Type == viewer.EventKey:
+			err = client.SendKey(ev.Key, ev.Down)
+		case ev.Type == viewer.EventPointer:
+			err = client.SendPointer(ev.X, ev.Y, ev.Buttons)
+		case ev.Type == viewer.EventClipboard:
+			err = client.SendCutText(ev.Text)
+		}
+		if err != nil {
+			log.Printf("%v", err)
 		}
 	}
-
-	return nil
 }
 
-
-func (c *VNCClient) handleServerCutText() error {
-	var padding [3]uint8
-	var length uint32
-
-	if err := binary.Read(c.conn, binary.BigEndian, &padding); err != nil {
-		return err
+// logFrameStats logs how many frames the viewer showed, if it counts them
+func logFrameStats(v viewer.Viewer) {
+	counter, ok := v.(interface{ FrameStats() viewer.FrameStats })
+	if !ok {
+		return
 	}
-	if err := binary.Read(c.conn, binary.BigEndian, &length); err != nil {
-		return err
-	}
-
-	text := make([]byte, length)
-	if _, err := io.ReadFull(c.conn, text); err != nil {
-		return err
-	}
-
-	log.Printf("Server cut text: %s", string(text))
-	return nil
-}
-
-func (c *VNCClient) skipMessage(bytes int) error {
-	_, err := io.CopyN(io.Discard, c.conn, int64(bytes))
-	return err
+	stats := counter.FrameStats()
+	log.Printf("Viewer drew %d times for %d frames, coalescing %d to keep up", stats.Shown, stats.Received, stats.Coalesced)
 }
 
-func (c *VNCClient) saveFrame() error {
-	c.frameCount++
-	
-	var imageToSave *image.RGBA = c.framebuffer
-	
-	// Composite with checkerboard background if requested
-	if c.useCheckerboard {
-		imageToSave = c.compositeWithCheckerboard()
-	}
-
-	// Store frame for animation if needed
-	if c.createWebM || c.createAPNG {
-		// Create a copy of the frame for animation
-		frameCopy := image.NewRGBA(imageToSave.Bounds())
-		copy(frameCopy.Pix, imageToSave.Pix)
-		c.capturedFrames = append(c.capturedFrames, frameCopy)
-	}
-
-	// Save individual PNG if capture is enabled
-	if c.captureFrames {
-		filename := filepath.Join(c.outputDir, fmt.Sprintf("frame_%04d.png", c.frameCount))
-		
-		file, err := os.Create(filename)
+// connect connects to config.host, waits for a reverse connection to
+// config.listen, or replays config.replay
+func connect(ctx context.Context, config VNCConfig, opts vncclient.Options) (*vncclient.Client, error) {
+	if config.listen != "" {
+		listener, err := net.Listen("tcp", config.listen)
 		if err != nil {
-			return err
+			return nil, fmt.Errorf("failed to listen for reverse connections: %v", err)
 		}
-		defer file.Close()
-
-		if err := png.Encode(file, imageToSave); err != nil {
-			return err
-		}
-
-		log.Printf("Saved frame %d to %s", c.frameCount, filename)
+		// Only one server is accepted
+		defer listener.Close()
+		log.Printf("Listening for a reverse connection on %s", listener.Addr())
+		return vncclient.Accept(ctx, listener, opts)
+	}
+	if config.replay == "" {
+		log.Printf("Connecting to VNC server at %s", config.host)
+		return vncclient.Connect(ctx, config.host, opts)
 	}
 
-	return nil
+	log.Printf("Replaying %s", config.replay)
+	file, err := os.Open(config.replay)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open recording: %v", err)
+	}
+	// The file stays open for the rest of the run
+	return vncclient.Replay(ctx, file, config.replaySpeed, opts)
 }
 
-func (c *VNCClient) compositeWithCheckerboard() *image.RGBA {
-	// Create a new image with checkerboard background
-	composite := image.NewRGBA(image.Rect(0, 0, c.width, c.height))
-	
-	// Checkerboard square size
-	squareSize := 20
-	
-	// Light and dark gray colors for checkerboard
-	lightGray := color.RGBA{240, 240, 240, 255}
-	darkGray := color.RGBA{200, 200, 200, 255}
-	
-	// Draw checkerboard background
-	for y := 0; y < c.height; y++ {
-		for x := 0; x < c.width; x++ {
-			// Determine checkerboard square
-			squareX := x / squareSize
-			squareY := y / squareSize
-			
-			var bgColor color.RGBA
-			if (squareX+squareY)%2 == 0 {
-				bgColor = lightGray
-			} else {
-				bgColor = darkGray
-			}
-			
-			// Get the framebuffer pixel
-			fbPixel := c.framebuffer.RGBAAt(x, y)
-			
-			// Alpha blend the framebuffer pixel over the checkerboard
-			alpha := float64(fbPixel.A) / 255.0
-			invAlpha := 1.0 - alpha
-			
-			finalR := uint8(float64(fbPixel.R)*alpha + float64(bgColor.R)*invAlpha)
-			finalG := uint8(float64(fbPixel.G)*alpha + float64(bgColor.G)*invAlpha)
-			finalB := uint8(float64(fbPixel.B)*alpha + float64(bgColor.B)*invAlpha)
-			
-			// Preserve the original alpha channel
-			composite.Set(x, y, color.RGBA{finalR, finalG, finalB, fbPixel.A})
+// sendClipboard sends -clipboard-send to the server, if set
+func sendClipboard(client *vncclient.Client, config VNCConfig) {
+	if config.clipboardSend != "" {
+		if err := client.SendCutText(config.clipboardSend); err != nil {
+			log.Fatalf("%v", err)
 		}
 	}
-	
-	return composite
 }
 
-// GetFramebuffer returns the current framebuffer for programmatic access
-func (c *VNCClient) GetFramebuffer() *image.RGBA {
-	return c.framebuffer
+// takeScreenshot saves the next full update to config.screenshot, exiting
+// with status 1 if none arrives within config.duration
+func takeScreenshot(client *vncclient.Client, config VNCConfig) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(config.duration)*time.Second)
+	defer cancel()
+	frame, err := client.Screenshot(ctx)
+	if err != nil {
+		log.Fatalf("Failed to take screenshot: %v", err)
+	}
+	if config.useCheckerboard {
+		frame = vncclient.Checkerboard(frame)
+	}
+	if err := vncclient.SavePNG(config.screenshot, frame); err != nil {
+		log.Fatalf("Failed to save screenshot: %v", err)
+	}
+	log.Printf("Saved %dx%d screenshot to %s", frame.Rect.Dx(), frame.Rect.Dy(), config.screenshot)
 }
 
-// GetPixel returns the color at the specified coordinates
-func (c *VNCClient) GetPixel(x, y int) color.RGBA {
-	if x < 0 || y < 0 || x >= c.width || y >= c.height {
-		return color.RGBA{}
+// checkResults prints the -bench report and evaluates -expect-frame and
+// -assert-pixel, exiting with status 1 if a check fails
+func checkResults(client *vncclient.Client, config VNCConfig, golden *goldenCheck) {
+	if config.bench {
+		if err := writeBenchReport(os.Stdout, config.host, client.Stats()); err != nil {
+			log.Printf("Failed to write benchmark report: %v", err)
+		}
+	}
+	if golden != nil {
+		if err := golden.result(); err != nil {
+			log.Fatalf("Frame does not match %s: %v", config.expectFrame, err)
+		}
+	}
+	if len(config.assertPixels) > 0 && !checkPixels(client, config.assertPixels) {
+		os.Exit(1)
 	}
-	return c.framebuffer.RGBAAt(x, y)
 }
 
-func (c *VNCClient) createWebMAnimation() error {
-	if len(c.capturedFrames) == 0 {
-		return fmt.Errorf("no frames captured for WebM animation")
+// readPasswordFile returns the first line of a password file, without the line ending
+func readPasswordFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read password file: %v", err)
 	}
-
-	// For WebM, we'll need to use external tools like ffmpeg
-	// For now, let's create a simple approach using individual PNGs and ffmpeg
-	log.Printf("WebM creation requires ffmpeg. Use: ffmpeg -r %d -i %s/frame_%%04d.png -c:v libvpx-vp9 -pix_fmt yuva420p animation.webm", 
-		c.frameRate, c.outputDir)
-	
-	return nil
+	line, _, _ := strings.Cut(string(data), "\n")
+	return strings.TrimRight(line, "\r"), nil
 }
 
-func (c *VNCClient) createAPNGAnimation() error {
-	if len(c.capturedFrames) == 0 {
-		return fmt.Errorf("no frames captured for APNG animation")
-	}
-
-	filename := filepath.Join(c.outputDir, "animation.apng")
-	
-	// For APNG, we'll need to use external tools like apngasm
-	// For now, let's save instructions and create a simple multi-frame PNG approach
-	log.Printf("APNG creation with full transparency requires apngasm tool.")
-	log.Printf("Use: apngasm %s %s/frame_*.png 1/%d", filename, c.outputDir, c.frameRate)
-	log.Printf("Or install apngasm: brew install apngasm (macOS) or apt-get install apngasm (Linux)")
-	
-	// Alternative: Create a simple animated approach by saving all frames in sequence
-	// This won't be a true APNG but will demonstrate the concept
-	return c.createFrameSequenceFile()
+// cloneFrame copies a frame so the viewer can keep it after OnFrame returns,
+// for the first frame of each size
+func cloneFrame(frame *image.RGBA) *image.RGBA {
+	clone := image.NewRGBA(frame.Rect)
+	copy(clone.Pix, frame.Pix)
+	return clone
 }
-
-func (c *VNCClient) createFrameSequenceFile() error {
-	filename := filepath.Join(c.outputDir, "frame_sequence_info.txt")
-	
-	file, err := os.Create(filename)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-	
-	fmt.Fprintf(file, "Animation Info:\n")
-	fmt.Fprintf(file, "Total frames: %d\n", len(c.capturedFrames))
-	fmt.Fprintf(file, "Frame rate: %d fps\n", c.frameRate)
-	fmt.Fprintf(file, "Duration: %.2f seconds\n", float64(len(c.capturedFrames))/float64(c.frameRate))
-	fmt.Fprintf(file, "Frame size: %dx%d\n", c.width, c.height)
-	fmt.Fprintf(file, "\nTo create APNG: apngasm animation.apng frame_*.png 1/%d\n", c.frameRate)
-	fmt.Fprintf(file, "To create WebM: ffmpeg -r %d -i frame_%%04d.png -c:v libvpx-vp9 -pix_fmt yuva420p animation.webm\n", c.frameRate)
-	
-	log.Printf("Created animation info file: %s", filename)
-	return nil
-}
\ No newline at end of file
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/coder/websockify/vncclient"
+)
+
+// soakMetrics counts across every connection of a run, for -metrics
+type soakMetrics struct {
+	mutex           sync.Mutex
+	client          *vncclient.Client // Current connection; nil between connections
+	frames          int               // Frames of earlier connections
+	bytes           int64             // Bytes of earlier connections
+	decodeErrors    int64
+	disconnects     int64
+	reconnects      int64
+	connectFailures int64
+}
+
+// soakSnapshot is the run's counters at one moment, including the current connection
+type soakSnapshot struct {
+	Connected       bool  `json:"connected"`
+	Frames          int   `json:"frames_total"`
+	Bytes           int64 `json:"bytes_received_total"`
+	DecodeErrors    int64 `json:"decode_errors_total"`
+	Disconnects     int64 `json:"disconnects_total"`
+	Reconnects      int64 `json:"reconnects_total"`
+	ConnectFailures int64 `json:"connect_failures_total"`
+}
+
+// connected starts counting a new connection
+func (m *soakMetrics) connected(client *vncclient.Client, reconnect bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.client = client
+	if reconnect {
+		m.reconnects++
+	}
+}
+
+// disconnected adds the current connection's counts to the totals and
+// classifies the error that ended its run
+func (m *soakMetrics) disconnected(err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.client != nil {
+		st := m.client.Stats()
+		m.frames += st.Frames
+		m.bytes += st.Bytes
+		m.client = nil
+	}
+
+	switch {
+	case err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+	case isDisconnect(err):
+		m.disconnects++
+	default:
+		m.decodeErrors++
+	}
+}
+
+// connectFailed counts a failed reconnection attempt
+func (m *soakMetrics) connectFailed() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.connectFailures++
+}
+
+// snapshot returns the counters so far
+func (m *soakMetrics) snapshot() soakSnapshot {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	s := soakSnapshot{
+		Connected:       m.client != nil,
+		Frames:          m.frames,
+		Bytes:           m.bytes,
+		DecodeErrors:    m.decodeErrors,
+		Disconnects:     m.disconnects,
+		Reconnects:      m.reconnects,
+		ConnectFailures: m.connectFailures,
+	}
+	if m.client != nil {
+		st := m.client.Stats()
+		s.Frames += st.Frames
+		s.Bytes += st.Bytes
+	}
+	return s
+}
+
+// isDisconnect reports whether err ended a run because the connection closed
+// or failed, rather than because a message could not be decoded
+func isDisconnect(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, net.ErrClosed) || errors.As(err, &netErr)
+}
+
+// soakMetric describes one Prometheus series exported by -metrics
+type soakMetric struct {
+	name  string
+	kind  string
+	help  string
+	value func(soakSnapshot) int64
+}
+
+var soakMetricList = []soakMetric{
+	{"vncclient_connected", "gauge", "Whether the client is connected", func(s soakSnapshot) int64 {
+		if s.Connected {
+			return 1
+		}
+		return 0
+	}},
+	{"vncclient_frames_total", "counter", "Framebuffer updates received", func(s soakSnapshot) int64 { return int64(s.Frames) }},
+	{"vncclient_bytes_received_total", "counter", "Bytes read from the server after the handshake", func(s soakSnapshot) int64 { return s.Bytes }},
+	{"vncclient_decode_errors_total", "counter", "Connections ended by a message that could not be decoded", func(s soakSnapshot) int64 { return s.DecodeErrors }},
+	{"vncclient_disconnects_total", "counter", "Connections closed by the server or the network", func(s soakSnapshot) int64 { return s.Disconnects }},
+	{"vncclient_reconnects_total", "counter", "Successful reconnections", func(s soakSnapshot) int64 { return s.Reconnects }},
+	{"vncclient_connect_failures_total", "counter", "Reconnection attempts that failed", func(s soakSnapshot) int64 { return s.ConnectFailures }},
+}
+
+// serveSoakMetrics serves the run's counters at /metrics in the Prometheus
+// text format, or as JSON with ?format=json
+func serveSoakMetrics(addr string, metrics *soakMetrics) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		snapshot := metrics.snapshot()
+		if r.URL.Query().Get("format") == "json" {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(snapshot)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		for _, m := range soakMetricList {
+			fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %d\n", m.name, m.help, m.name, m.kind, m.name, m.value(snapshot))
+		}
+	})
+	return http.ListenAndServe(addr, mux)
+}
+
+// runSessions runs client until ctx ends. With -reconnect, a connection that
+// ends early is replaced after the delay for as long as ctx lasts. It returns
+// the last client and the error that ended its run.
+func runSessions(ctx context.Context, client *vncclient.Client, config VNCConfig, opts vncclient.Options, metrics *soakMetrics) (*vncclient.Client, error) {
+	for {
+		err := client.Run(ctx)
+		metrics.disconnected(err)
+		if ctx.Err() != nil || config.reconnect <= 0 {
+			return client, err
+		}
+		log.Printf("Connection lost: %v; reconnecting in %s", err, config.reconnect)
+		client.Close()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return client, ctx.Err()
+			case <-time.After(config.reconnect):
+			}
+			next, err := connect(ctx, config, opts)
+			if err == nil {
+				client = next
+				break
+			}
+			if ctx.Err() == nil {
+				metrics.connectFailed()
+				log.Printf("Reconnect failed: %v", err)
+			}
+		}
+		metrics.connected(client, true)
+		sendClipboard(client, config)
+	}
+}
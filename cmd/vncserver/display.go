@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/coder/websockify/mockvnc"
+)
+
+// displaySpec describes where and what one display serves. Fields a -display
+// flag leaves unset take their values from the main flags.
+type displaySpec struct {
+	port       string
+	listenUnix string
+	animation  string
+	width      int
+	height     int
+	name       string
+}
+
+// listenName describes where the display listens, for logs
+func (d displaySpec) listenName() string {
+	if d.listenUnix != "" {
+		return "unix socket " + d.listenUnix
+	}
+	return "port " + d.port
+}
+
+// displayFlags collects repeated -display flags
+type displayFlags []displaySpec
+
+func (d *displayFlags) String() string {
+	return fmt.Sprintf("%d displays", len(*d))
+}
+
+func (d *displayFlags) Set(value string) error {
+	spec, err := parseDisplay(value)
+	if err != nil {
+		return err
+	}
+	*d = append(*d, spec)
+	return nil
+}
+
+// parseDisplay parses a comma-separated list of key=value settings, such as
+// port=5901,animation=plasma,width=1024,height=768. Either port or unix is required.
+func parseDisplay(value string) (displaySpec, error) {
+	var spec displaySpec
+	for _, item := range strings.Split(value, ",") {
+		key, val, ok := strings.Cut(strings.TrimSpace(item), "=")
+		if !ok || val == "" {
+			return spec, fmt.Errorf("invalid display setting %q: want key=value", item)
+		}
+
+		var err error
+		switch key {
+		case "port":
+			spec.port = val
+		case "unix":
+			spec.listenUnix = val
+		case "animation":
+			spec.animation = val
+		case "width":
+			spec.width, err = parseDimension(val)
+		case "height":
+			spec.height, err = parseDimension(val)
+		case "name":
+			spec.name = val
+		default:
+			return spec, fmt.Errorf("unknown display setting %q: must be port, unix, animation, width, height or name", key)
+		}
+		if err != nil {
+			return spec, fmt.Errorf("invalid %s in %q: %v", key, item, err)
+		}
+	}
+
+	if (spec.port == "") == (spec.listenUnix == "") {
+		return spec, fmt.Errorf("display %q needs exactly one of port or unix", value)
+	}
+	return spec, nil
+}
+
+// parseDimension parses a display width or height, which must be positive
+func parseDimension(value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err == nil && n < 1 {
+		err = fmt.Errorf("must be positive")
+	}
+	return n, err
+}
+
+// display is a mock server with the address it listens on
+type display struct {
+	displaySpec
+	server   *mockvnc.Server
+	listener net.Listener
+}
+
+// newDisplay creates the server for a display, overriding the main options
+// with the display's own settings and filling in the spec from them
+func newDisplay(spec displaySpec, options mockvnc.Options) (display, error) {
+	if spec.animation != "" {
+		options.Animation = spec.animation
+	}
+	if spec.width != 0 {
+		options.Width = spec.width
+	}
+	if spec.height != 0 {
+		options.Height = spec.height
+	}
+	if spec.name != "" {
+		options.Name = spec.name
+	}
+
+	server, err := mockvnc.New(options)
+	if err != nil {
+		return display{}, err
+	}
+	spec.animation, spec.width, spec.height = options.Animation, options.Width, options.Height
+	return display{displaySpec: spec, server: server}, nil
+}
+
+// listen opens the display's unix socket if it has one, otherwise its TCP port.
+// A socket file left behind by an earlier run is removed first.
+func (d *display) listen() error {
+	var err error
+	if d.listenUnix == "" {
+		d.listener, err = net.Listen("tcp", ":"+d.port)
+		return err
+	}
+	if info, err := os.Lstat(d.listenUnix); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(d.listenUnix)
+	}
+	d.listener, err = net.Listen("unix", d.listenUnix)
+	return err
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/coder/websockify/mockvnc"
+)
+
+// parseSizes parses a comma-separated list of WIDTHxHEIGHT sizes
+func parseSizes(list string) ([]mockvnc.Size, error) {
+	var sizes []mockvnc.Size
+	for _, item := range strings.Split(list, ",") {
+		w, h, ok := strings.Cut(strings.TrimSpace(item), "x")
+		if !ok {
+			return nil, fmt.Errorf("invalid size %q: want WIDTHxHEIGHT", item)
+		}
+		width, err := strconv.Atoi(w)
+		if err != nil {
+			return nil, fmt.Errorf("invalid width in %q: %v", item, err)
+		}
+		height, err := strconv.Atoi(h)
+		if err != nil {
+			return nil, fmt.Errorf("invalid height in %q: %v", item, err)
+		}
+		if width < 1 || width > 65535 || height < 1 || height > 65535 {
+			return nil, fmt.Errorf("invalid size %q: width and height must be between 1 and 65535", item)
+		}
+		sizes = append(sizes, mockvnc.Size{Width: width, Height: height})
+	}
+	return sizes, nil
+}
+
+// parseFaults parses a comma-separated -chaos-faults list
+func parseFaults(list string) ([]string, error) {
+	var faults []string
+	for _, fault := range strings.Split(list, ",") {
+		fault = strings.TrimSpace(fault)
+		if !slices.Contains(mockvnc.Faults, fault) {
+			return nil, fmt.Errorf("unknown fault %q: must be one of %s", fault, strings.Join(mockvnc.Faults, ", "))
+		}
+		faults = append(faults, fault)
+	}
+	return faults, nil
+}
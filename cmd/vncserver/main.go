@@ -1,65 +1,74 @@
 package main
 
 import (
+	"crypto/tls"
 	"flag"
 	"fmt"
 	"image"
-	"image/color"
 	"log"
-	"math"
-	"net"
 	"os"
-	"os/signal"
+	"path/filepath"
 	"strings"
-	"syscall"
 	"time"
 
-	"github.com/coder/websockify/rfb"
+	"github.com/coder/websockify/mockvnc"
 	"github.com/coder/websockify/version"
 	"github.com/coder/websockify/viewer"
 )
 
 const (
-	SCREEN_WIDTH  = 800
-	SCREEN_HEIGHT = 600
+	DEFAULT_WIDTH  = 800
+	DEFAULT_HEIGHT = 600
 )
 
-var (
-	animationType string
-	globalServer *VNCServer
-)
-
-
-type VNCConnection struct {
-	conn        net.Conn
-	frameNumber int // Frame number for 30fps animation
-	animationType string // Type of animation to generate
-	buffer      []byte   // Message buffer for proper framing
-	pixelFormat rfb.PixelFormat // Client's requested pixel format
-}
-
-type VNCServer struct {
-	viewer    *viewer.FramebufferViewer
-	showGUI   bool
-	animation string
-	fps       int
-}
-
-type AnimationGenerator func(frameNumber, width, height int) []byte
-
 func main() {
 	var (
-		port        = flag.String("port", "5900", "Port to listen on")
-		animation   = flag.String("animation", "wheel", "Animation type: wheel, waves, plasma, orbits, gradient")
-		gui         = flag.Bool("gui", false, "Show server framebuffer in GUI window (requires GUI environment)")
-		fps         = flag.Int("fps", 30, "Frame rate for GUI animation (frames per second)")
-		showVersion = flag.Bool("version", false, "Show version information")
-		help        = flag.Bool("help", false, "Show this help message")
+		port              = flag.String("port", "5900", "Port to listen on")
+		listenUnix        = flag.String("listen-unix", "", "Listen on this unix socket path instead of the TCP port")
+		animation         = flag.String("animation", "wheel", "Animation type: "+strings.Join(mockvnc.AnimationNames(), ", "))
+		gui               = flag.Bool("gui", false, "Show each display's framebuffer in a GUI window (requires GUI environment)")
+		terminal          = flag.String("terminal", "", "Draw the server framebuffer in the terminal in COLUMNSxROWS cells, such as 120x40, or auto for the terminal's size")
+		viewDir           = flag.String("view-dir", "", "Save the server framebuffer, up to ten frames a second, as PNG files in this directory listed in frames.ffconcat")
+		web               = flag.String("web", "", "Serve a live view of the server framebuffer at http://ADDR/ instead of a GUI window, such as :8081")
+		fps               = flag.Int("fps", 30, "Frame rate for GUI animation and push mode (frames per second)")
+		speed             = flag.Int("speed", 4, "Movement in pixels per frame for the ball animation")
+		push              = flag.Bool("push", false, "Stream updates to each client at -fps after its first update request")
+		width             = flag.Int("width", DEFAULT_WIDTH, "Framebuffer width in pixels")
+		height            = flag.Int("height", DEFAULT_HEIGHT, "Framebuffer height in pixels")
+		imagePath         = flag.String("image", "", "Serve a fixed PNG or JPEG image instead of an animation (sets the framebuffer size unless -width/-height are given)")
+		slideshow         = flag.String("slideshow", "", "Cycle through the PNG and JPEG files in this directory, one per frame, in file name order")
+		resize            = flag.String("resize", "", "Comma-separated WIDTHxHEIGHT sizes to cycle each client through via DesktopSize, e.g. 1024x768,640x480")
+		resizeInterval    = flag.Duration("resize-interval", 10*time.Second, "Time between -resize size changes")
+		latency           = flag.Duration("latency", 0, "Delay every write to clients by this long")
+		jitter            = flag.Duration("jitter", 0, "Vary -latency randomly by up to this much in either direction")
+		bandwidth         = flag.Int("bandwidth", 0, "Limit writes to each client to this many kilobits per second (0 is unlimited)")
+		seed              = flag.Uint64("seed", 1, "Seed for random behaviour such as -jitter and -chaos, so runs are repeatable")
+		scenarioPath      = flag.String("scenario", "", "Play the timeline of events in this JSON file against each client")
+		recordDir         = flag.String("record", "", "Record everything sent to each client to an FBS file in this directory, one per session")
+		chaosRate         = flag.Float64("chaos", 0, "Probability (0-1) that each framebuffer update is corrupted with a protocol fault")
+		chaosFaultList    = flag.String("chaos-faults", strings.Join(mockvnc.Faults, ","), "Comma-separated faults -chaos may inject")
+		maxFPS            = flag.Int("max-fps", 0, "Cap each client at this many framebuffer updates per second (0 is unlimited)")
+		metricsAddr       = flag.String("metrics", "", "Serve Prometheus metrics at /metrics on this address, e.g. :9100 (JSON with ?format=json), and the build at /version")
+		statsInterval     = flag.Duration("stats-interval", 0, "Log each client's frames, bytes and frame rate at this interval (0 logs only at disconnect)")
+		bellInterval      = flag.Duration("bell-interval", 0, "Send a Bell message to each client at this interval (0 disables)")
+		clipboardEcho     = flag.String("clipboard-echo", "off", "Send each ClientCutText back as ServerCutText: off, echo, upper, reverse")
+		clipboardInterval = flag.Duration("clipboard-interval", 0, "Send a numbered ServerCutText to each client at this interval (0 disables)")
+		echoInput         = flag.Bool("echo-input", false, "Draw a dot at each client's pointer and the text it types onto its framebuffer")
+		password          = flag.String("password", "", "Require VNC Authentication with this password (only the first 8 characters are used)")
+		ws                = flag.Bool("ws", false, "Accept RFB over WebSocket (wss with -tls) instead of plain RFB")
+		useTLS            = flag.Bool("tls", false, "Serve RFB over TLS from the first byte, as behind stunnel")
+		vencrypt          = flag.Bool("vencrypt", false, "Offer VeNCrypt (security type 19) and upgrade to TLS during the handshake")
+		tlsCert           = flag.String("tls-cert", "", "PEM certificate for -tls and -vencrypt (a self-signed certificate is generated if omitted)")
+		tlsKey            = flag.String("tls-key", "", "PEM private key for -tls-cert")
+		showVersion       = flag.Bool("version", false, "Show version information")
+		help              = flag.Bool("help", false, "Show this help message")
 	)
+	var extraDisplays displayFlags
+	flag.Var(&extraDisplays, "display", "Serve another display, e.g. port=5901,animation=plasma,width=1024,height=768,name=second (repeatable; keys: port, unix, animation, width, height, name)")
 	flag.Parse()
 
 	if *showVersion {
-		fmt.Printf("vncserver %s\n", version.Version())
+		fmt.Printf("vncserver %s\n", version.Full())
 		os.Exit(0)
 	}
 
@@ -71,683 +80,297 @@ func main() {
 		fmt.Fprintf(os.Stderr, "\nExamples:\n")
 		fmt.Fprintf(os.Stderr, "  %s -port 5900\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "  %s -port 5900 -gui\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -listen-unix /tmp/vnc.sock\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -port 5900 -display port=5901,animation=clock -display unix=/tmp/vnc2.sock,width=640,height=480\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "  %s -port 5900 -animation plasma -gui\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "  %s -port 5900 -gui -fps 60\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -port 5900 -width 3840 -height 2160\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -port 5900 -push -fps 60\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -port 5900 -animation ball -speed 8\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -port 5900 -echo-input -animation testcard\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -port 5900 -clipboard-echo upper -clipboard-interval 5s\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -port 5900 -bell-interval 10s\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -port 5900 -resize 1024x768,640x480 -resize-interval 5s\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -port 5900 -latency 100ms -jitter 20ms -bandwidth 2000\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -port 5900 -scenario scenario.json\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -port 5900 -animation plasma -push -record recordings\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -port 5900 -max-fps 15 -stats-interval 10s\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -port 5900 -metrics :9100\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -port 5900 -chaos 0.1 -chaos-faults truncate,disconnect -seed 42\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -port 5900 -password secret\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -port 5900 -vencrypt -password secret\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -port 6080 -ws\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -port 5900 -tls -tls-cert server.pem -tls-key server-key.pem\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -port 5900 -image screenshot.png\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -port 5900 -slideshow ./captures -push -fps 10\n", os.Args[0])
 		os.Exit(0)
 	}
 
-	// Configuration
-	config := VNCServerConfig{
-		port:      *port,
-		animation: *animation,
-		showGUI:   *gui,
-		fps:       *fps,
-	}
-
-	if *gui {
-		// Run with GUI - this will block on main thread
-		runWithGUI(config)
-	} else {
-		// Run without GUI
-		runWithoutGUI(config)
+	viewers := 0
+	for _, on := range []bool{*gui, *web != "", *terminal != "", *viewDir != ""} {
+		if on {
+			viewers++
+		}
 	}
-}
-
-type VNCServerConfig struct {
-	port      string
-	animation string
-	showGUI   bool
-	fps       int
-}
-
-func runWithGUI(config VNCServerConfig) {
-	// This will run on the main thread as required by macOS
-	viewer.RunWithVNCClient(fmt.Sprintf("VNC Server - %s:%s", config.animation, config.port), SCREEN_WIDTH, SCREEN_HEIGHT, func(v *viewer.FramebufferViewer) {
-		runVNCServer(config, v)
-	})
-}
-
-func runWithoutGUI(config VNCServerConfig) {
-	runVNCServer(config, nil)
-}
-
-func runVNCServer(config VNCServerConfig, guiViewer *viewer.FramebufferViewer) {
-	animationType = config.animation
-	
-	globalServer = &VNCServer{
-		viewer:    guiViewer,
-		showGUI:   config.showGUI,
-		animation: config.animation,
-		fps:       config.fps,
+	if viewers > 1 {
+		fmt.Fprintf(os.Stderr, "Only one of -gui, -web, -terminal and -view-dir can be used\n")
+		os.Exit(1)
 	}
-
-	listener, err := net.Listen("tcp", ":"+config.port)
-	if err != nil {
-		log.Fatalf("Failed to listen on port %s: %v", config.port, err)
+	var terminalColumns, terminalRows int
+	if *terminal != "" {
+		var err error
+		if terminalColumns, terminalRows, err = viewer.TerminalSize(*terminal); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -terminal: %v\n", err)
+			os.Exit(1)
+		}
 	}
-	defer listener.Close()
-
-	log.Printf("Mock VNC server listening on port %s", config.port)
-	if globalServer.showGUI {
-		log.Printf("GUI viewer enabled for server framebuffer")
-		// Start continuous framebuffer generation for GUI
-		go startFramebufferAnimation()
+	if *imagePath != "" && *slideshow != "" {
+		fmt.Fprintf(os.Stderr, "-image and -slideshow cannot be used together\n")
+		os.Exit(1)
 	}
 
-	// Handle graceful shutdown
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
-
-	go func() {
-		<-sigChan
-		log.Println("Shutting down VNC server...")
-		listener.Close()
-		os.Exit(0)
-	}()
-
-	for {
-		conn, err := listener.Accept()
+	var images []image.Image
+	switch {
+	case *imagePath != "":
+		img, err := loadImage(*imagePath)
 		if err != nil {
-			// Check if the error is due to the listener being closed
-			if strings.Contains(err.Error(), "use of closed network connection") {
-				log.Println("Listener closed, stopping accept loop")
-				return
-			}
-			log.Printf("Failed to accept connection: %v", err)
-			continue
+			fmt.Fprintf(os.Stderr, "Failed to load image: %v\n", err)
+			os.Exit(1)
+		}
+		images = []image.Image{img}
+	case *slideshow != "":
+		var err error
+		images, err = loadSlideshow(*slideshow)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load slideshow: %v\n", err)
+			os.Exit(1)
 		}
-
-		go handleVNCConnection(conn)
 	}
-}
 
-func startFramebufferAnimation() {
-	frameNumber := 0
-	// Calculate frame interval from FPS (default 30 FPS = 33ms interval)
-	frameInterval := time.Duration(1000/globalServer.fps) * time.Millisecond
-	ticker := time.NewTicker(frameInterval)
-	defer ticker.Stop()
-	
-	log.Printf("Starting framebuffer animation for GUI viewer at %d FPS", globalServer.fps)
-	
-	for {
-		select {
-		case <-ticker.C:
-			if globalServer != nil && globalServer.showGUI && globalServer.viewer != nil {
-				// Generate frame data
-				pixelData := generateAnimationFrame(globalServer.animation, frameNumber, SCREEN_WIDTH, SCREEN_HEIGHT)
-				updateServerGUI(pixelData, SCREEN_WIDTH, SCREEN_HEIGHT)
-				frameNumber++
-			}
+	if len(images) > 0 {
+		// The first image sets the framebuffer size unless it was given explicitly
+		explicit := map[string]bool{}
+		flag.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+		if !explicit["width"] {
+			*width = images[0].Bounds().Dx()
+		}
+		if !explicit["height"] {
+			*height = images[0].Bounds().Dy()
 		}
 	}
-}
 
-func handleVNCConnection(conn net.Conn) {
-	defer conn.Close()
-	
-	clientAddr := conn.RemoteAddr().String()
-	log.Printf("New VNC connection from %s", clientAddr)
-
-	// Create VNC connection state with default pixel format (matches ServerInit)
-	defaultPixelFormat := rfb.DefaultPixelFormat()
-	
-	vncConn := &VNCConnection{
-		conn:        conn,
-		frameNumber: 0,
-		animationType: animationType,
-		pixelFormat: defaultPixelFormat,
+	var resizeSizes []mockvnc.Size
+	if *resize != "" {
+		var err error
+		resizeSizes, err = parseSizes(*resize)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -resize: %v\n", err)
+			os.Exit(1)
+		}
 	}
 
-	// RFB Protocol Handshake
-	if err := doVNCHandshake(vncConn.conn); err != nil {
-		log.Printf("VNC handshake failed for %s: %v", clientAddr, err)
-		return
+	faults, err := parseFaults(*chaosFaultList)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -chaos-faults: %v\n", err)
+		os.Exit(1)
 	}
 
-	log.Printf("VNC handshake completed for %s", clientAddr)
-
-	// Keep connection alive and handle client messages with proper framing
-	readBuffer := make([]byte, 1024)
-	for {
-		vncConn.conn.SetReadDeadline(time.Now().Add(30 * time.Second))
-		n, err := vncConn.conn.Read(readBuffer)
+	var sc *mockvnc.Scenario
+	if *scenarioPath != "" {
+		sc, err = mockvnc.LoadScenario(*scenarioPath)
 		if err != nil {
-			log.Printf("VNC connection from %s ended: %v", clientAddr, err)
-			return
+			fmt.Fprintf(os.Stderr, "Invalid -scenario: %v\n", err)
+			os.Exit(1)
 		}
+	}
 
-		if n > 0 {
-			log.Printf("VNC client %s sent %d bytes", clientAddr, n)
-			// Append new data to connection buffer
-			vncConn.buffer = append(vncConn.buffer, readBuffer[:n]...)
-			
-			// Process complete messages from buffer
-			if err := processCompleteMessages(vncConn); err != nil {
-				log.Printf("VNC message processing failed for %s: %v", clientAddr, err)
-				return
-			}
+	if (*tlsCert == "") != (*tlsKey == "") {
+		fmt.Fprintf(os.Stderr, "-tls-cert and -tls-key must be given together\n")
+		os.Exit(1)
+	}
+	var tlsConfig *tls.Config
+	if *useTLS || *vencrypt {
+		tlsConfig, err = loadTLSConfig(*tlsCert, *tlsKey)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load TLS certificate: %v\n", err)
+			os.Exit(1)
 		}
 	}
-}
 
-func doVNCHandshake(conn net.Conn) error {
-	// Step 1: Send RFB version
-	if err := rfb.SendRFBVersion(conn); err != nil {
-		return fmt.Errorf("failed to send RFB version: %v", err)
+	if len(*password) > 8 {
+		fmt.Fprintf(os.Stderr, "Warning: VNC Authentication only uses the first 8 characters of the password\n")
 	}
 
-	// Step 2: Read client version
-	clientVersion, err := rfb.ReadRFBVersion(conn)
-	if err != nil {
-		return fmt.Errorf("failed to read client version: %v", err)
-	}
-	log.Printf("Client version: %s", clientVersion)
+	options := mockvnc.Options{
+		Width:     *width,
+		Height:    *height,
+		Animation: *animation,
+		FPS:       *fps,
+		MaxFPS:    *maxFPS,
+		Speed:     *speed,
+		Push:      *push,
+		EchoInput: *echoInput,
+		Password:  *password,
+		Images:    images,
 
-	// Step 3: Send security types (1 = None)
-	if err := rfb.SendSecurityTypes(conn, []uint8{rfb.SecurityNone}); err != nil {
-		return fmt.Errorf("failed to send security types: %v", err)
-	}
+		ClipboardEcho:     *clipboardEcho,
+		ClipboardInterval: *clipboardInterval,
+		BellInterval:      *bellInterval,
 
-	// Step 4: Read client security choice
-	securityChoice := make([]byte, 1)
-	if _, err := conn.Read(securityChoice); err != nil {
-		return fmt.Errorf("failed to read security choice: %v", err)
-	}
+		ResizeSizes:    resizeSizes,
+		ResizeInterval: *resizeInterval,
 
-	// Step 5: Send security result (0 = OK)
-	if err := rfb.SendSecurityResult(conn, 0); err != nil {
-		return fmt.Errorf("failed to send security result: %v", err)
-	}
+		Network: mockvnc.NetworkConditions{
+			Latency:   *latency,
+			Jitter:    *jitter,
+			Bandwidth: *bandwidth,
+		},
+		Seed: *seed,
 
-	// Step 6: Read ClientInit
-	clientInit := make([]byte, 1)
-	if _, err := conn.Read(clientInit); err != nil {
-		return fmt.Errorf("failed to read client init: %v", err)
-	}
+		WebSocket: *ws,
+		TLS:       *useTLS,
+		VeNCrypt:  *vencrypt,
+		TLSConfig: tlsConfig,
 
-	// Step 7: Send ServerInit
-	serverInit := rfb.ServerInit{
-		Width:       SCREEN_WIDTH,
-		Height:      SCREEN_HEIGHT,
-		PixelFormat: rfb.DefaultPixelFormat(),
-		Name:        "Test",
-	}
+		Scenario: sc,
 
-	if err := rfb.SendServerInit(conn, serverInit); err != nil {
-		return fmt.Errorf("failed to send server init: %v", err)
-	}
+		StatsInterval: *statsInterval,
 
-	return nil
-}
+		RecordDir: *recordDir,
 
-// getMessageLength returns the expected length of a VNC client message based on its type
-func getMessageLength(messageType byte, data []byte) (int, error) {
-	length, err := rfb.GetMessageLength(messageType, data)
-	if err != nil {
-		return -1, err
-	}
-	if length == 0 && len(data) < 8 {
-		return -1, nil // Need more data to determine length
+		ChaosRate:   *chaosRate,
+		ChaosFaults: faults,
 	}
-	return length, nil
-}
 
-// processCompleteMessages processes all complete messages in the buffer
-func processCompleteMessages(vncConn *VNCConnection) error {
-	for len(vncConn.buffer) > 0 {
-		// Need at least 1 byte to determine message type
-		if len(vncConn.buffer) < 1 {
-			break
-		}
-		
-		messageType := vncConn.buffer[0]
-		expectedLength, err := getMessageLength(messageType, vncConn.buffer)
+	primary, err := newDisplay(displaySpec{port: *port, listenUnix: *listenUnix}, options)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid options: %v\n", err)
+		os.Exit(1)
+	}
+	displays := []display{primary}
+	for _, spec := range extraDisplays {
+		d, err := newDisplay(spec, options)
 		if err != nil {
-			return fmt.Errorf("invalid message type %d: %v", messageType, err)
-		}
-		
-		// If expectedLength is -1, we need more data to determine the full message length
-		if expectedLength == -1 {
-			log.Printf("Need more data to determine message length for type %d", messageType)
-			break
-		}
-		
-		// Check if we have the complete message
-		if len(vncConn.buffer) < expectedLength {
-			log.Printf("Incomplete message: have %d bytes, need %d for type %d", 
-				len(vncConn.buffer), expectedLength, messageType)
-			break
+			fmt.Fprintf(os.Stderr, "Invalid -display on %s: %v\n", spec.listenName(), err)
+			os.Exit(1)
 		}
-		
-		// We have a complete message, process it
-		messageData := vncConn.buffer[:expectedLength]
-		if err := handleVNCMessage(vncConn, messageData); err != nil {
-			return err
-		}
-		
-		// Remove processed message from buffer
-		vncConn.buffer = vncConn.buffer[expectedLength:]
-		log.Printf("Processed message type %d (%d bytes), %d bytes remaining in buffer", 
-			messageType, expectedLength, len(vncConn.buffer))
-	}
-	
-	return nil
-}
-
-func handleVNCMessage(vncConn *VNCConnection, data []byte) error {
-	if len(data) == 0 {
-		return nil
+		displays = append(displays, d)
 	}
 
-	messageType := data[0]
-	log.Printf("Processing complete message type %d (%d bytes)", messageType, len(data))
-	
-	switch messageType {
-	case rfb.SetPixelFormat: // SetPixelFormat (20 bytes total)
-		return handleSetPixelFormat(vncConn, data)
-		
-	case rfb.SetEncodings: // SetEncodings (variable length)
-		numEncodings := (int(data[2]) << 8) | int(data[3])
-		log.Printf("Received SetEncodings message with %d encodings", numEncodings)
-		return nil
-		
-	case rfb.FramebufferUpdateRequest: // FramebufferUpdateRequest (10 bytes total)
-		log.Printf("Received FramebufferUpdateRequest message")
-		sendFramebufferUpdate(vncConn)
-		return nil
-		
-	case rfb.KeyEvent: // KeyEvent (8 bytes total)
-		log.Printf("Received KeyEvent message")
-		return nil
-		
-	case rfb.PointerEvent: // PointerEvent (6 bytes total)
-		log.Printf("Received PointerEvent message")
-		return nil
-		
-	case rfb.ClientCutText: // ClientCutText (variable length)
-		textLength := (int(data[4]) << 24) | (int(data[5]) << 16) | (int(data[6]) << 8) | int(data[7])
-		log.Printf("Received ClientCutText message with %d bytes of text", textLength)
-		return nil
-		
-	default:
-		log.Printf("Received invalid message type: %d (0x%02X) - closing connection", messageType, messageType)
-		return fmt.Errorf("invalid message type: %d", messageType)
+	// Configuration
+	config := VNCServerConfig{
+		displays:        displays,
+		metricsAddr:     *metricsAddr,
+		showGUI:         *gui,
+		webAddr:         *web,
+		terminalColumns: terminalColumns,
+		terminalRows:    terminalRows,
+		viewDir:         *viewDir,
+		fps:             *fps,
+		width:           *width,
+		height:          *height,
+		animation:       *animation,
+		image:           *imagePath,
+		slideshow:       *slideshow,
+	}
+
+	log.Printf("Starting vncserver %s", version.Full())
+	if *gui {
+		// Run with GUI - this will block on main thread
+		runWithGUI(config)
+	} else {
+		// Run without GUI
+		runWithoutGUI(config)
 	}
 }
 
-func handleSetPixelFormat(vncConn *VNCConnection, data []byte) error {
-	pf, err := rfb.ParseSetPixelFormat(data)
-	if err != nil {
-		return err
-	}
-	
-	// Update connection's pixel format
-	vncConn.pixelFormat = pf
-	
-	log.Printf("SetPixelFormat: %d bpp, depth %d, %s-endian, true-color=%d", 
-		pf.BitsPerPixel, pf.Depth, 
-		map[uint8]string{0: "little", 1: "big"}[pf.BigEndianFlag],
-		pf.TrueColorFlag)
-	log.Printf("Color maximums: R=%d G=%d B=%d, Shifts: R=%d G=%d B=%d",
-		pf.RedMax, pf.GreenMax, pf.BlueMax,
-		pf.RedShift, pf.GreenShift, pf.BlueShift)
-	
-	return nil
+// VNCServerConfig holds the command-line settings that are not server options
+type VNCServerConfig struct {
+	displays        []display // The -port or -listen-unix display, then any -display flags
+	metricsAddr     string    // Address for the metrics endpoint; disabled when empty
+	showGUI         bool
+	webAddr         string // Address for the web viewer; disabled when empty
+	terminalColumns int    // Size of the terminal viewer; disabled when 0
+	terminalRows    int
+	viewDir         string // Directory for the recording viewer; disabled when empty
+	fps             int
+	width           int
+	height          int
+	animation       string
+	image           string
+	slideshow       string
 }
 
-
-func sendFramebufferUpdate(vncConn *VNCConnection) {
-	// Send a simple framebuffer update (solid color rectangle)
-	update := make([]byte, 16)
-	update[0] = 0 // FramebufferUpdate message type
-	update[1] = 0 // padding
-	// number-of-rectangles (16-bit big-endian)
-	update[2] = 0
-	update[3] = 1
-	// rectangle: x, y, width, height (each 16-bit big-endian)
-	update[4] = 0   // x high
-	update[5] = 0   // x low
-	update[6] = 0   // y high  
-	update[7] = 0   // y low
-	update[8] = byte(SCREEN_WIDTH >> 8)   // width high
-	update[9] = byte(SCREEN_WIDTH & 0xFF) // width low
-	update[10] = byte(SCREEN_HEIGHT >> 8)   // height high
-	update[11] = byte(SCREEN_HEIGHT & 0xFF) // height low
-	// encoding-type (32-bit big-endian) - 0 = Raw
-	update[12] = 0
-	update[13] = 0
-	update[14] = 0  
-	update[15] = 0
-
-	if _, err := vncConn.conn.Write(update); err != nil {
-		log.Printf("Failed to send framebuffer update header: %v", err)
-		return
-	}
-	log.Printf("Sent FramebufferUpdate header: %v", update)
-
-	// Generate animated pixel data in BGRA format
-	bgraData := generateAnimationFrame(vncConn.animationType, vncConn.frameNumber, SCREEN_WIDTH, SCREEN_HEIGHT)
-	
-	// Convert to client's requested pixel format
-	pixelData := rfb.ConvertPixelFormat(bgraData, SCREEN_WIDTH, SCREEN_HEIGHT, vncConn.pixelFormat)
-	log.Printf("Sending pixel data: %d bytes (converted from BGRA to client format), first 16 bytes: %v", len(pixelData), pixelData[:16])
-
-	if _, err := vncConn.conn.Write(pixelData); err != nil {
-		log.Printf("Failed to send framebuffer update data: %v", err)
-	}
-
-	// Update GUI viewer if enabled (use original BGRA data for GUI)
-	if globalServer != nil && globalServer.showGUI && globalServer.viewer != nil {
-		updateServerGUI(bgraData, SCREEN_WIDTH, SCREEN_HEIGHT)
-	}
-
-	// Increment frame number for next frame (30fps)
-	vncConn.frameNumber++
+// listenName describes where the main display listens, for window titles and logs
+func (c VNCServerConfig) listenName() string {
+	return c.displays[0].listenName()
 }
 
-func updateServerGUI(pixelData []byte, width, height int) {
-	// Convert raw pixel data (BGRA) to image.RGBA
-	img := image.NewRGBA(image.Rect(0, 0, width, height))
-	
-	for i := 0; i < len(pixelData); i += 4 {
-		pixelIndex := i / 4
-		y := pixelIndex / width
-		x := pixelIndex % width
-		
-		if x < width && y < height {
-			// VNC uses BGRA format, convert to RGBA
-			b := pixelData[i]
-			g := pixelData[i+1]
-			r := pixelData[i+2]
-			a := pixelData[i+3]
-			
-			img.SetRGBA(x, y, color.RGBA{R: r, G: g, B: b, A: a})
-		}
+// sourceName describes what the server is showing, for window titles and logs
+func (c VNCServerConfig) sourceName() string {
+	if c.image != "" {
+		return filepath.Base(c.image)
 	}
-	
-	globalServer.viewer.UpdateFramebuffer(img)
-}
-
-func generateAnimationFrame(animationType string, frameNumber, width, height int) []byte {
-	switch animationType {
-	case "wheel":
-		return generateColorWheel(frameNumber, width, height)
-	case "waves":
-		return generateAlphaWaves(frameNumber, width, height)
-	case "plasma":
-		return generatePlasma(frameNumber, width, height)
-	case "orbits":
-		return generateOrbitingCircles(frameNumber, width, height)
-	case "gradient":
-		return generateGradientSweep(frameNumber, width, height)
-	default:
-		return generateColorWheel(frameNumber, width, height)
+	if c.slideshow != "" {
+		return filepath.Base(c.slideshow)
 	}
+	return c.animation
 }
 
-func generateColorWheel(frameNumber, width, height int) []byte {
-	pixelData := make([]byte, width*height*4)
-	centerX := float64(width) / 2
-	centerY := float64(height) / 2
-	maxRadius := math.Min(centerX, centerY) * 0.8
-	
-	// Rotation based on frame number (360 degrees over 120 frames = 3 seconds at 30fps)
-	rotation := float64(frameNumber) * 2 * math.Pi / 120
-	
-	for i := 0; i < len(pixelData); i += 4 {
-		pixel := i / 4
-		row := pixel / width
-		col := pixel % width
-		
-		// Calculate distance from center and angle
-		dx := float64(col) - centerX
-		dy := float64(row) - centerY
-		distance := math.Sqrt(dx*dx + dy*dy)
-		angle := math.Atan2(dy, dx) + rotation
-		
-		if distance <= maxRadius {
-			// Convert angle to hue (0-360 degrees)
-			hue := angle * 180 / math.Pi
-			if hue < 0 {
-				hue += 360
+// runWithGUI opens a window for each display
+func runWithGUI(config VNCServerConfig) {
+	// This will run on the main thread as required by macOS
+	viewer.RunWindows(func(windows viewer.Manager) {
+		viewers := make([]viewer.Viewer, len(config.displays))
+		for i, d := range config.displays {
+			source := d.animation
+			if i == 0 {
+				source = config.sourceName()
 			}
-			
-			// Create saturation gradient from center to edge
-			saturation := distance / maxRadius
-			
-			// Create alpha gradient (more transparent towards edge)
-			alpha := 1.0 - (distance / maxRadius) * 0.7
-			
-			// Convert HSV to RGB
-			r, g, b := hsvToRgb(hue, saturation, 1.0)
-			
-			pixelData[i] = uint8(b * 255)     // blue
-			pixelData[i+1] = uint8(g * 255)   // green
-			pixelData[i+2] = uint8(r * 255)   // red
-			pixelData[i+3] = uint8(alpha * 255) // alpha
-		} else {
-			// Transparent outside the wheel
-			pixelData[i] = 0
-			pixelData[i+1] = 0
-			pixelData[i+2] = 0
-			pixelData[i+3] = 0
+			viewers[i] = windows.NewViewer(fmt.Sprintf("VNC Server - %s on %s", source, d.listenName()), d.width, d.height)
 		}
-	}
-	
-	return pixelData
-}
-
-func generateAlphaWaves(frameNumber, width, height int) []byte {
-	pixelData := make([]byte, width*height*4)
-	
-	// Wave parameters
-	timeOffset := float64(frameNumber) * 0.1
-	
-	for i := 0; i < len(pixelData); i += 4 {
-		pixel := i / 4
-		row := pixel / width
-		col := pixel % width
-		
-		// Create multiple wave patterns
-		x := float64(col) / float64(width) * 4 * math.Pi
-		y := float64(row) / float64(height) * 3 * math.Pi
-		
-		// Combine multiple sine waves for complex patterns
-		wave1 := math.Sin(x + timeOffset)
-		wave2 := math.Sin(y + timeOffset*1.3)
-		wave3 := math.Sin((x+y)*0.5 + timeOffset*0.7)
-		
-		// Create RGB values based on waves
-		r := (wave1 + 1) / 2
-		g := (wave2 + 1) / 2
-		b := (wave3 + 1) / 2
-		
-		// Create alpha based on wave interference
-		alpha := (wave1*wave2 + 1) / 2
-		alpha = math.Max(0.1, alpha) // Minimum 10% alpha
-		
-		pixelData[i] = uint8(b * 255)     // blue
-		pixelData[i+1] = uint8(g * 255)   // green
-		pixelData[i+2] = uint8(r * 255)   // red
-		pixelData[i+3] = uint8(alpha * 255) // alpha
-	}
-	
-	return pixelData
+		if err := run(config, viewers); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+		for _, v := range viewers {
+			v.Close()
+		}
+	})
 }
 
-func generatePlasma(frameNumber, width, height int) []byte {
-	pixelData := make([]byte, width*height*4)
-	
-	time := float64(frameNumber) * 0.05
-	
-	for i := 0; i < len(pixelData); i += 4 {
-		pixel := i / 4
-		row := pixel / width
-		col := pixel % width
-		
-		x := float64(col) / float64(width)
-		y := float64(row) / float64(height)
-		
-		// Classic plasma effect
-		v1 := math.Sin(x*10 + time)
-		v2 := math.Sin(y*10 + time*1.2)
-		v3 := math.Sin((x+y)*10 + time*0.8)
-		v4 := math.Sin(math.Sqrt(x*x+y*y)*10 + time*1.5)
-		
-		plasma := (v1 + v2 + v3 + v4) / 4
-		
-		// Convert plasma value to color
-		hue := (plasma + 1) * 180 // 0-360 degrees
-		saturation := 0.8
-		brightness := 0.9
-		
-		r, g, b := hsvToRgb(hue, saturation, brightness)
-		
-		// Alpha varies with plasma intensity
-		alpha := (math.Abs(plasma) + 0.3) * 0.9
-		
-		pixelData[i] = uint8(b * 255)     // blue
-		pixelData[i+1] = uint8(g * 255)   // green
-		pixelData[i+2] = uint8(r * 255)   // red
-		pixelData[i+3] = uint8(alpha * 255) // alpha
+// runWithoutGUI runs the server with the -web, -terminal or -view-dir viewer,
+// if any
+func runWithoutGUI(config VNCServerConfig) {
+	var headless viewer.Viewer
+	switch {
+	case config.webAddr != "":
+		v, err := viewer.ListenWebViewer(config.webAddr, fmt.Sprintf("VNC Server - %s on %s", config.sourceName(), config.listenName()))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to start web viewer: %v\n", err)
+			os.Exit(1)
+		}
+		log.Printf("Serving live view on http://%s/", config.webAddr)
+		headless = v
+	case config.terminalColumns > 0:
+		headless = viewer.NewTerminalViewer(os.Stdout, config.terminalColumns, config.terminalRows)
+	case config.viewDir != "":
+		v, err := viewer.NewRecordingViewer(config.viewDir, viewer.DefaultRecordingInterval)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to start recording viewer: %v\n", err)
+			os.Exit(1)
+		}
+		headless = v
 	}
-	
-	return pixelData
-}
-
-func generateOrbitingCircles(frameNumber, width, height int) []byte {
-	pixelData := make([]byte, width*height*4)
-	
-	// Clear background (transparent)
-	for i := 0; i < len(pixelData); i += 4 {
-		pixelData[i+3] = 0 // alpha = 0 (transparent)
+	var viewers []viewer.Viewer
+	if headless != nil {
+		viewers = append(viewers, headless)
 	}
-	
-	centerX := float64(width) / 2
-	centerY := float64(height) / 2
-	orbitRadius := math.Min(centerX, centerY) * 0.6
-	
-	// Multiple orbiting circles
-	numCircles := 5
-	time := float64(frameNumber) * 0.1
-	
-	for c := 0; c < numCircles; c++ {
-		// Each circle has different orbit speed and phase
-		phase := float64(c) * 2 * math.Pi / float64(numCircles)
-		speed := 1.0 + float64(c)*0.3
-		angle := time*speed + phase
-		
-		// Circle position
-		circleX := centerX + math.Cos(angle)*orbitRadius
-		circleY := centerY + math.Sin(angle)*orbitRadius
-		circleRadius := 30.0 + float64(c)*10
-		
-		// Circle color (different hue for each circle)
-		hue := float64(c) * 360 / float64(numCircles)
-		r, g, b := hsvToRgb(hue, 0.8, 0.9)
-		
-		// Draw circle
-		for i := 0; i < len(pixelData); i += 4 {
-			pixel := i / 4
-			row := pixel / width
-			col := pixel % width
-			
-			dx := float64(col) - circleX
-			dy := float64(row) - circleY
-			distance := math.Sqrt(dx*dx + dy*dy)
-			
-			if distance <= circleRadius {
-				// Soft edge with alpha falloff
-				alpha := 1.0 - (distance / circleRadius) * 0.7
-				alpha = math.Max(0, alpha)
-				
-				// Blend with existing pixel (additive blending)
-				existingAlpha := float64(pixelData[i+3]) / 255.0
-				newAlpha := alpha + existingAlpha*(1-alpha)
-				
-				if newAlpha > 0 {
-					// Blend colors
-					blendR := (r*alpha + (float64(pixelData[i+2])/255.0)*existingAlpha) / newAlpha
-					blendG := (g*alpha + (float64(pixelData[i+1])/255.0)*existingAlpha) / newAlpha
-					blendB := (b*alpha + (float64(pixelData[i])/255.0)*existingAlpha) / newAlpha
-					
-					pixelData[i] = uint8(blendB * 255)     // blue
-					pixelData[i+1] = uint8(blendG * 255)   // green
-					pixelData[i+2] = uint8(blendR * 255)   // red
-					pixelData[i+3] = uint8(newAlpha * 255) // alpha
-				}
-			}
-		}
+	err := run(config, viewers)
+	if headless != nil {
+		headless.Close()
 	}
-	
-	return pixelData
-}
-
-func generateGradientSweep(frameNumber, width, height int) []byte {
-	pixelData := make([]byte, width*height*4)
-	
-	// Rotating gradient
-	rotation := float64(frameNumber) * 2 * math.Pi / 90 // 3-second rotation at 30fps
-	
-	centerX := float64(width) / 2
-	centerY := float64(height) / 2
-	
-	for i := 0; i < len(pixelData); i += 4 {
-		pixel := i / 4
-		row := pixel / width
-		col := pixel % width
-		
-		// Calculate angle from center
-		dx := float64(col) - centerX
-		dy := float64(row) - centerY
-		angle := math.Atan2(dy, dx) + rotation
-		
-		// Normalize angle to 0-1
-		normalizedAngle := (angle + math.Pi) / (2 * math.Pi)
-		normalizedAngle = normalizedAngle - math.Floor(normalizedAngle) // Keep in 0-1 range
-		
-		// Create gradient colors
-		hue := normalizedAngle * 360
-		r, g, b := hsvToRgb(hue, 0.9, 0.8)
-		
-		// Distance-based alpha
-		distance := math.Sqrt(dx*dx + dy*dy)
-		maxDistance := math.Sqrt(centerX*centerX + centerY*centerY)
-		alpha := 0.3 + 0.7*(1.0 - distance/maxDistance) // More opaque in center
-		
-		pixelData[i] = uint8(b * 255)     // blue
-		pixelData[i+1] = uint8(g * 255)   // green
-		pixelData[i+2] = uint8(r * 255)   // red
-		pixelData[i+3] = uint8(alpha * 255) // alpha
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
 	}
-	
-	return pixelData
 }
-
-// HSV to RGB conversion
-func hsvToRgb(h, s, v float64) (float64, float64, float64) {
-	h = math.Mod(h, 360) / 60
-	c := v * s
-	x := c * (1 - math.Abs(math.Mod(h, 2) - 1))
-	m := v - c
-	
-	var r, g, b float64
-	
-	switch int(h) {
-	case 0:
-		r, g, b = c, x, 0
-	case 1:
-		r, g, b = x, c, 0
-	case 2:
-		r, g, b = 0, c, x
-	case 3:
-		r, g, b = 0, x, c
-	case 4:
-		r, g, b = x, 0, c
-	default:
-		r, g, b = c, 0, x
-	}
-	
-	return r + m, g + m, b + m
-}
\ No newline at end of file
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/coder/websockify/mockvnc"
+	"github.com/coder/websockify/version"
+)
+
+// metric describes one Prometheus series exported for every display
+type metric struct {
+	name  string
+	kind  string
+	help  string
+	value func(mockvnc.Metrics) int64
+}
+
+var metrics = []metric{
+	{"mockvnc_clients", "gauge", "Connected clients that completed the handshake", func(m mockvnc.Metrics) int64 { return int64(m.Clients) }},
+	{"mockvnc_connections_total", "counter", "Connections accepted", func(m mockvnc.Metrics) int64 { return m.Connections }},
+	{"mockvnc_handshake_failures_total", "counter", "Connections that failed the RFB handshake", func(m mockvnc.Metrics) int64 { return m.HandshakeFailures }},
+	{"mockvnc_frames_total", "counter", "Framebuffer updates sent with at least one rectangle", func(m mockvnc.Metrics) int64 { return m.Frames }},
+	{"mockvnc_bytes_sent_total", "counter", "Bytes written to clients", func(m mockvnc.Metrics) int64 { return m.Bytes }},
+}
+
+// displayMetrics is one display's counters in the JSON output
+type displayMetrics struct {
+	Display string `json:"display"`
+	mockvnc.Metrics
+}
+
+// serveMetrics serves every display's counters at /metrics in the Prometheus
+// text format, or as JSON with ?format=json, and the build at /version
+func serveMetrics(addr string, displays []display) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		snapshot := make([]displayMetrics, len(displays))
+		for i, d := range displays {
+			snapshot[i] = displayMetrics{Display: d.listenName(), Metrics: d.server.Metrics()}
+		}
+
+		if r.URL.Query().Get("format") == "json" {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]any{"displays": snapshot})
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		for _, m := range metrics {
+			fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+			for _, d := range snapshot {
+				fmt.Fprintf(w, "%s{display=%q} %d\n", m.name, d.Display, m.value(d.Metrics))
+			}
+		}
+	})
+	mux.Handle("/version", version.Handler())
+	return http.ListenAndServe(addr, mux)
+}
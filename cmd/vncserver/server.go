@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/coder/websockify/mockvnc"
+	"github.com/coder/websockify/viewer"
+)
+
+// shutdownTimeout bounds how long clients get to be disconnected cleanly on interrupt
+const shutdownTimeout = 5 * time.Second
+
+// run listens on every display's port or unix socket and serves clients until
+// interrupted, then shuts every display down cleanly. viewers[i] shows
+// display i; there may be fewer viewers than displays, or none.
+func run(config VNCServerConfig, viewers []viewer.Viewer) error {
+	displays := config.displays
+	for i := range displays {
+		if err := displays[i].listen(); err != nil {
+			return fmt.Errorf("failed to listen on %s: %v", displays[i].listenName(), err)
+		}
+	}
+
+	for _, d := range displays {
+		log.Printf("Mock VNC server listening on %s (%dx%d, %s)", d.listenName(), d.width, d.height, d.animation)
+	}
+	if config.metricsAddr != "" {
+		log.Printf("Serving metrics on http://%s/metrics", config.metricsAddr)
+		go func() {
+			log.Fatalf("Metrics server stopped: %v", serveMetrics(config.metricsAddr, displays))
+		}()
+	}
+	for i, v := range viewers {
+		log.Printf("GUI viewer enabled for %s", displays[i].listenName())
+		// Start continuous framebuffer generation for GUI, until its window closes
+		closed := make(chan struct{})
+		go runGUIAnimation(config.fps, displays[i], v, closed)
+		go watchViewer(displays[i].listenName(), v.Events(), closed)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errs := make(chan error, len(displays))
+	for _, d := range displays {
+		go func() { errs <- d.server.Serve(d.listener) }()
+	}
+
+	// Serve only returns before shutdown if a listener fails
+	var serveErr error
+	select {
+	case <-ctx.Done():
+	case err := <-errs:
+		serveErr = fmt.Errorf("server stopped: %v", err)
+	}
+	stop()
+
+	log.Println("Shutting down VNC server...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	for _, d := range displays {
+		if err := d.server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Forced shutdown of %s: %v", d.listenName(), err)
+		}
+		if d.listenUnix != "" {
+			os.Remove(d.listenUnix)
+		}
+	}
+	return serveErr
+}
+
+// runGUIAnimation renders a display's animation into its GUI viewer at the
+// configured frame rate until closed is closed
+func runGUIAnimation(fps int, d display, guiViewer viewer.Viewer, closed <-chan struct{}) {
+	if fps <= 0 {
+		fps = mockvnc.DefaultFPS
+	}
+
+	frameNumber := 0
+	// Calculate frame interval from FPS (default 30 FPS = 33ms interval)
+	frameInterval := time.Duration(1000/fps) * time.Millisecond
+	ticker := time.NewTicker(frameInterval)
+	defer ticker.Stop()
+
+	log.Printf("Starting framebuffer animation for GUI viewer at %d FPS", fps)
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-closed:
+			return
+		}
+		pixelData := d.server.Frame(frameNumber)
+		updateGUI(guiViewer, pixelData, d.width, d.height)
+		frameNumber++
+	}
+}
+
+// watchViewer logs the keyboard and mouse input in a display's GUI viewer,
+// to check what a client would send for it, and closes closed when the
+// viewer closes. The display keeps serving clients.
+func watchViewer(name string, events <-chan viewer.Event, closed chan<- struct{}) {
+	for ev := range events {
+		switch ev.Type {
+		case viewer.EventClosed:
+			log.Printf("Viewer for %s closed", name)
+			close(closed)
+			return
+		case viewer.EventResized:
+		default:
+			log.Printf("Viewer input on %s: %v", name, ev)
+		}
+	}
+}
+
+func updateGUI(guiViewer viewer.Viewer, pixelData []byte, width, height int) {
+	// Convert raw pixel data (BGRA) to image.RGBA
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for i := 0; i < len(pixelData); i += 4 {
+		pixelIndex := i / 4
+		y := pixelIndex / width
+		x := pixelIndex % width
+
+		if x < width && y < height {
+			// VNC uses BGRA format, convert to RGBA
+			b := pixelData[i]
+			g := pixelData[i+1]
+			r := pixelData[i+2]
+			a := pixelData[i+3]
+
+			img.SetRGBA(x, y, color.RGBA{R: r, G: g, B: b, A: a})
+		}
+	}
+
+	guiViewer.UpdateFramebuffer(img)
+}
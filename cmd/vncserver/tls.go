@@ -0,0 +1,34 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"log"
+
+	"github.com/coder/websockify/mockvnc"
+)
+
+// loadTLSConfig builds the server's TLS configuration from a PEM certificate
+// and key, or from a freshly generated self-signed certificate when both are empty
+func loadTLSConfig(certFile, keyFile string) (*tls.Config, error) {
+	var cert tls.Certificate
+	var err error
+	if certFile != "" || keyFile != "" {
+		cert, err = tls.LoadX509KeyPair(certFile, keyFile)
+	} else {
+		cert, err = mockvnc.SelfSignedCertificate()
+		if err == nil {
+			log.Printf("Generated self-signed TLS certificate for localhost")
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	fingerprint := sha256.Sum256(cert.Certificate[0])
+	log.Printf("TLS certificate SHA-256 fingerprint: %x", fingerprint)
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
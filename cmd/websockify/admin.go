@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/coder/websockify"
+	"github.com/coder/websockify/version"
+)
+
+// metric describes one Prometheus series exported at /metrics
+type metric struct {
+	name  string
+	kind  string
+	help  string
+	value func(websockify.Metrics) int64
+}
+
+var metrics = []metric{
+	{"websockify_sessions", "gauge", "Connections being proxied", func(m websockify.Metrics) int64 { return int64(m.Sessions) }},
+	{"websockify_connections_total", "counter", "Connections proxied to their target", func(m websockify.Metrics) int64 { return m.Connections }},
+	{"websockify_refused_total", "counter", "Requests refused by authentication, token lookup or connection limits", func(m websockify.Metrics) int64 { return m.Refused }},
+	{"websockify_target_failures_total", "counter", "Connections whose target could not be reached", func(m websockify.Metrics) int64 { return m.TargetFailures }},
+	{"websockify_bytes_to_target_total", "counter", "Bytes forwarded from clients to targets", func(m websockify.Metrics) int64 { return m.BytesToTarget }},
+	{"websockify_bytes_to_client_total", "counter", "Bytes forwarded from targets to clients", func(m websockify.Metrics) int64 { return m.BytesToClient }},
+}
+
+// serveAdmin serves the operational endpoints on their own address
+func serveAdmin(addr string, server *websockify.Server, withPprof bool) error {
+	return http.ListenAndServe(addr, adminHandler(server, withPprof))
+}
+
+// adminHandler serves metrics in the Prometheus text format (JSON with
+// ?format=json), a health check, the open sessions and the build as JSON, and
+// with withPprof, Go's profiler
+func adminHandler(server *websockify.Server, withPprof bool) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		snapshot := server.Metrics()
+		if r.URL.Query().Get("format") == "json" {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(snapshot)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		for _, m := range metrics {
+			fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %d\n", m.name, m.help, m.name, m.kind, m.name, m.value(snapshot))
+		}
+	})
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/sessions", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"sessions": server.Sessions()})
+	})
+	mux.Handle("/version", version.Handler())
+	if withPprof {
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	}
+	return mux
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/coder/websockify"
+)
+
+// refusingServer returns a server that has refused one connection
+func refusingServer() *websockify.Server {
+	server := websockify.New(websockify.Config{
+		TargetFunc: func(r *http.Request) (string, error) { return "", errors.New("closed") },
+		Logger:     &websockify.NoOpLogger{},
+	})
+	server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/websockify", nil))
+	return server
+}
+
+func TestAdminMetrics(t *testing.T) {
+	handler := adminHandler(refusingServer(), false)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if got := rec.Header().Get("Content-Type"); got != "text/plain; version=0.0.4" {
+		t.Errorf("Content-Type = %q, want the Prometheus text format", got)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		"# HELP websockify_sessions Connections being proxied\n# TYPE websockify_sessions gauge\nwebsockify_sessions 0\n",
+		"# TYPE websockify_refused_total counter\nwebsockify_refused_total 1\n",
+		"\nwebsockify_bytes_to_client_total 0\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("/metrics = %q, want it to contain %q", body, want)
+		}
+	}
+	if got, want := strings.Count(body, "# TYPE "), len(metrics); got != want {
+		t.Errorf("/metrics has %d metrics, want %d", got, want)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics?format=json", nil))
+	if got := rec.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", got)
+	}
+	var got websockify.Metrics
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("/metrics?format=json = %q: %v", rec.Body.String(), err)
+	}
+	if want := (websockify.Metrics{Refused: 1}); got != want {
+		t.Errorf("/metrics?format=json = %+v, want %+v", got, want)
+	}
+	if !strings.Contains(rec.Body.String(), `"refused_total":1`) {
+		t.Errorf("/metrics?format=json = %q, want refused_total", rec.Body.String())
+	}
+}
+
+func TestAdminPprof(t *testing.T) {
+	for _, withPprof := range []bool{false, true} {
+		rec := httptest.NewRecorder()
+		adminHandler(refusingServer(), withPprof).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/pprof/", nil))
+		if found := rec.Code == http.StatusOK; found != withPprof {
+			t.Errorf("/debug/pprof/ with pprof %v = %d", withPprof, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// configValue is one key of a config file, named as its flag
+type configValue struct {
+	name   string
+	values []string // One per element of an array, for repeatable flags
+	array  bool
+	line   int
+}
+
+// repeatableFlag is a flag.Value that collects every value it is set to,
+// such as -route's, so arrays in a config file set it once per element
+type repeatableFlag interface {
+	flag.Value
+	repeatable()
+}
+
+// commaListFlags take a comma-separated list, which a config file may give
+// as an array instead
+var commaListFlags = map[string]bool{"acme-domains": true}
+
+// loadConfigFile sets the flags named in a TOML config file, except those
+// given on the command line, which override it. Keys are flag names, and a
+// [table] prefixes the flag names of its keys, so
+//
+//	[token]
+//	plugin = "file"
+//
+// sets -token-plugin. Underscores in keys may stand for dashes. Arrays set a
+// repeatable flag once for each element, are joined with commas for flags
+// that take a list, and are refused for any other flag.
+func loadConfigFile(path string, flags *flag.FlagSet) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+	values, err := parseConfig(string(data))
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+
+	given := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	for _, v := range values {
+		if flags.Lookup(v.name) == nil || v.name == "config" {
+			return fmt.Errorf("%s:%d: unknown option %q", path, v.line, v.name)
+		}
+		if given[v.name] {
+			continue
+		}
+		elements := v.values
+		if v.array {
+			_, repeatable := flags.Lookup(v.name).Value.(repeatableFlag)
+			switch {
+			case commaListFlags[v.name]:
+				elements = []string{strings.Join(elements, ",")}
+			case !repeatable:
+				return fmt.Errorf("%s:%d: %s takes one value, not an array", path, v.line, v.name)
+			}
+		}
+		for _, value := range elements {
+			if err := flags.Set(v.name, value); err != nil {
+				return fmt.Errorf("%s:%d: %s: %v", path, v.line, v.name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// parseConfig parses the subset of TOML config files use: tables, and keys
+// set to strings, numbers, booleans or arrays of them, which may span lines
+func parseConfig(text string) ([]configValue, error) {
+	var values []configValue
+	prefix := ""
+	lines := strings.Split(text, "\n")
+	for i := 0; i < len(lines); i++ {
+		n := i + 1
+		line := strings.TrimSpace(stripConfigComment(lines[i]))
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("line %d: unterminated table name", n)
+			}
+			prefix = ""
+			if table := strings.TrimSpace(line[1 : len(line)-1]); table != "" {
+				prefix = configFlagName(strings.ReplaceAll(table, ".", "-")) + "-"
+			}
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: want key = value", n)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		// Arrays may continue over several lines
+		for strings.HasPrefix(value, "[") && !strings.HasSuffix(value, "]") && i+1 < len(lines) {
+			i++
+			value += " " + strings.TrimSpace(stripConfigComment(lines[i]))
+		}
+		parsed, err := parseConfigValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s: %v", n, key, err)
+		}
+		values = append(values, configValue{
+			name:   prefix + configFlagName(key),
+			values: parsed,
+			array:  strings.HasPrefix(value, "["),
+			line:   n,
+		})
+	}
+	return values, nil
+}
+
+// configFlagName returns the flag name of a config key
+func configFlagName(key string) string {
+	return strings.ReplaceAll(strings.Trim(key, `"`), "_", "-")
+}
+
+// stripConfigComment removes a # comment that is not inside a string
+func stripConfigComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// parseConfigValue returns the text of a scalar value, or of each element of
+// an array, as a flag would take it
+func parseConfigValue(value string) ([]string, error) {
+	if !strings.HasPrefix(value, "[") {
+		v, rest, err := scanConfigScalar(value)
+		if err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(rest) != "" {
+			return nil, fmt.Errorf("unexpected %q after value", rest)
+		}
+		return []string{v}, nil
+	}
+
+	if !strings.HasSuffix(value, "]") {
+		return nil, fmt.Errorf("unterminated array")
+	}
+	var elements []string
+	rest := strings.TrimSpace(value[1 : len(value)-1])
+	for rest != "" {
+		v, after, err := scanConfigScalar(rest)
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, v)
+		after = strings.TrimSpace(after)
+		if after == "" {
+			break
+		}
+		if after[0] != ',' {
+			return nil, fmt.Errorf("want , between array elements, not %q", after)
+		}
+		rest = strings.TrimSpace(after[1:])
+	}
+	return elements, nil
+}
+
+// scanConfigScalar reads a quoted string or a bare number or boolean from the
+// start of s, returning the rest of s
+func scanConfigScalar(s string) (value, rest string, err error) {
+	switch {
+	case strings.HasPrefix(s, `"`):
+		quoted, err := strconv.QuotedPrefix(s)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid string %s", s)
+		}
+		value, err := strconv.Unquote(quoted)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid string %s", quoted)
+		}
+		return value, s[len(quoted):], nil
+	case strings.HasPrefix(s, "'"):
+		end := strings.IndexByte(s[1:], '\'')
+		if end < 0 {
+			return "", "", fmt.Errorf("unterminated string %s", s)
+		}
+		return s[1 : end+1], s[end+2:], nil
+	}
+	end := strings.IndexByte(s, ',')
+	if end < 0 {
+		end = len(s)
+	}
+	value = strings.TrimSpace(s[:end])
+	if value == "" {
+		return "", "", fmt.Errorf("missing value")
+	}
+	return value, s[end:], nil
+}
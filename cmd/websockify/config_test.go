@@ -0,0 +1,144 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testFlags returns a flag set with a few of the real flags' kinds
+func testFlags() *flag.FlagSet {
+	flags := flag.NewFlagSet("websockify", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	flags.String("config", "", "")
+	flags.String("listen", "0.0.0.0:6080", "")
+	flags.String("target", "localhost:5900", "")
+	flags.String("token-plugin", "", "")
+	flags.String("token-source", "", "")
+	flags.String("acme-domains", "", "")
+	flags.Bool("web-auth", false, "")
+	flags.Int("max-connections", 0, "")
+	flags.Var(&routeFlags{}, "route", "")
+	return flags
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		args    []string
+		want    map[string]string
+		wantErr string
+	}{
+		{
+			name:   "scalars",
+			config: "listen = \":8080\"\nweb-auth = true\nmax_connections = 10\n",
+			want:   map[string]string{"listen": ":8080", "web-auth": "true", "max-connections": "10"},
+		},
+		{
+			name:   "quoting",
+			config: "target = \"host \\\"a\\\":5900\"\ntoken-source = 'C:\\tokens # not a comment'\n",
+			want:   map[string]string{"target": `host "a":5900`, "token-source": `C:\tokens # not a comment`},
+		},
+		{
+			name:   "comments",
+			config: "# Proxy settings\n\nlisten = \":8080\" # all addresses\n",
+			want:   map[string]string{"listen": ":8080"},
+		},
+		{
+			name:   "tables",
+			config: "listen = \":8080\"\n[token]\nplugin = \"file\"\nsource = \"/etc/tokens\"\n",
+			want:   map[string]string{"listen": ":8080", "token-plugin": "file", "token-source": "/etc/tokens"},
+		},
+		{
+			name:   "repeatable array",
+			config: "route = [\n  \"/a=localhost:5901\", # first\n  \"/b=localhost:5902\",\n]\n",
+			want:   map[string]string{"route": "/a=localhost:5901,/b=localhost:5902"},
+		},
+		{
+			name:   "list array",
+			config: "acme-domains = [\"a.example.com\", \"b.example.com\"]\n",
+			want:   map[string]string{"acme-domains": "a.example.com,b.example.com"},
+		},
+		{
+			name:   "command line wins",
+			config: "listen = \":8080\"\ntarget = \"localhost:5901\"\n",
+			args:   []string{"-listen", ":9000"},
+			want:   map[string]string{"listen": ":9000", "target": "localhost:5901"},
+		},
+		{
+			name:    "array for a single value",
+			config:  "target = [\"localhost:5900\", \"localhost:5901\"]\n",
+			wantErr: ":1: target takes one value, not an array",
+		},
+		{
+			name:    "unknown key",
+			config:  "listen = \":8080\"\nlisten-port = 8080\n",
+			wantErr: `:2: unknown option "listen-port"`,
+		},
+		{
+			name:    "config key",
+			config:  "config = \"other.toml\"\n",
+			wantErr: `unknown option "config"`,
+		},
+		{
+			name:    "bad value",
+			config:  "max-connections = \"many\"\n",
+			wantErr: ":1: max-connections:",
+		},
+		{
+			name:    "unterminated string",
+			config:  "listen = \":8080\n",
+			wantErr: "line 1: listen: invalid string",
+		},
+		{
+			name:    "missing equals",
+			config:  "listen\n",
+			wantErr: "line 1: want key = value",
+		},
+		{
+			name:    "text after value",
+			config:  "listen = \":8080\" \":9000\"\n",
+			wantErr: "unexpected",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "websockify.toml")
+			if err := os.WriteFile(path, []byte(tt.config), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			flags := testFlags()
+			if err := flags.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+
+			err := loadConfigFile(path, flags)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("loadConfigFile() = %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadConfigFile() = %v", err)
+			}
+			for name, want := range tt.want {
+				if got := flags.Lookup(name).Value.String(); got != want {
+					t.Errorf("-%s = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadConfigFileMissing(t *testing.T) {
+	flags := testFlags()
+	err := loadConfigFile(filepath.Join(t.TempDir(), "missing.toml"), flags)
+	if err == nil || !strings.Contains(err.Error(), "failed to read config file") {
+		t.Errorf("loadConfigFile() = %v, want a read error", err)
+	}
+}
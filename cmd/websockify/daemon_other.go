@@ -0,0 +1,10 @@
+//go:build !unix
+
+package main
+
+import "fmt"
+
+// daemonize is only supported on Unix; elsewhere, run websockify as a service
+func daemonize() (int, error) {
+	return 0, fmt.Errorf("-daemon is not supported on this platform")
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// openTestLog opens a rotating log in a temporary directory
+func openTestLog(t *testing.T, maxSize int64, backups int) *rotatingFile {
+	t.Helper()
+	f, err := openRotatingFile(filepath.Join(t.TempDir(), "websockify.log"), maxSize, backups)
+	if err != nil {
+		t.Fatalf("openRotatingFile() = %v", err)
+	}
+	t.Cleanup(func() { f.file.Close() })
+	return f
+}
+
+// checkLogs compares the log file and its backups with want, in order, and
+// checks that there is no backup past them
+func checkLogs(t *testing.T, path string, want ...string) {
+	t.Helper()
+	for i, content := range want {
+		name := path
+		if i > 0 {
+			name = fmt.Sprintf("%s.%d", path, i)
+		}
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Errorf("%s: %v", filepath.Base(name), err)
+		} else if string(data) != content {
+			t.Errorf("%s = %q, want %q", filepath.Base(name), data, content)
+		}
+	}
+	extra := fmt.Sprintf("%s.%d", path, len(want))
+	if _, err := os.Stat(extra); err == nil {
+		t.Errorf("%s exists, want no more backups", filepath.Base(extra))
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	f := openTestLog(t, 10, 2)
+	write := func(s string) {
+		t.Helper()
+		if n, err := f.Write([]byte(s)); n != len(s) || err != nil {
+			t.Fatalf("Write(%q) = %d, %v", s, n, err)
+		}
+	}
+
+	// Writes that fit stay in the file, up to maxSize exactly
+	write("aaaa\n")
+	write("bbbb\n")
+	checkLogs(t, f.path, "aaaa\nbbbb\n")
+
+	// One that would pass maxSize renames the file first
+	write("cccc\n")
+	checkLogs(t, f.path, "cccc\n", "aaaa\nbbbb\n")
+
+	// Later rotations shift the backups up
+	write("dddddddd\n")
+	checkLogs(t, f.path, "dddddddd\n", "cccc\n", "aaaa\nbbbb\n")
+
+	// Past the backup limit the oldest is dropped
+	write("eeee\n")
+	checkLogs(t, f.path, "eeee\n", "dddddddd\n", "cccc\n")
+}
+
+func TestRotatingFileLongLine(t *testing.T) {
+	// A write longer than maxSize goes whole into an empty file rather than
+	// rotating it again
+	f := openTestLog(t, 4, 1)
+	f.Write([]byte("longer than four\n"))
+	f.Write([]byte("next\n"))
+	checkLogs(t, f.path, "next\n", "longer than four\n")
+}
+
+func TestRotatingFileNoBackups(t *testing.T) {
+	f := openTestLog(t, 8, 0)
+	f.Write([]byte("first\n"))
+	f.Write([]byte("second\n"))
+	checkLogs(t, f.path, "second\n")
+}
+
+func TestRotatingFileAppends(t *testing.T) {
+	// An existing file counts towards maxSize
+	path := filepath.Join(t.TempDir(), "websockify.log")
+	if err := os.WriteFile(path, []byte("earlier\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := openRotatingFile(path, 10, 1)
+	if err != nil {
+		t.Fatalf("openRotatingFile() = %v", err)
+	}
+	defer f.file.Close()
+	f.Write([]byte("later\n"))
+	checkLogs(t, path, "later\n", "earlier\n")
+}
+
+func TestRotatingFileReopen(t *testing.T) {
+	f := openTestLog(t, 0, 0)
+	f.Write([]byte("before\n"))
+
+	// As logrotate moves the file away before signalling
+	if err := os.Rename(f.path, f.path+".moved"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Reopen(); err != nil {
+		t.Fatalf("Reopen() = %v", err)
+	}
+	f.Write([]byte("after\n"))
+	checkLogs(t, f.path, "after\n")
+	if data, _ := os.ReadFile(f.path + ".moved"); string(data) != "before\n" {
+		t.Errorf("moved file = %q, want %q", data, "before\n")
+	}
+}
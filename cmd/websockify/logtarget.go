@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+)
+
+// journalSocket is where journald takes native protocol messages
+const journalSocket = "/run/systemd/journal/socket"
+
+// openLogTarget returns where to write logs for -log-target: stderr, syslog,
+// which is sent to journald with fields when it is running, or journald.
+// fields are added to each journald entry.
+func openLogTarget(target string, fields map[string]string) (io.Writer, error) {
+	switch target {
+	case "", "stderr":
+		return os.Stderr, nil
+	case "syslog":
+		if _, err := os.Stat(journalSocket); err == nil {
+			return openJournal(fields)
+		}
+		return openSyslog()
+	case "journald":
+		return openJournal(fields)
+	}
+	return nil, fmt.Errorf("unknown log target %q (want stderr, syslog or journald)", target)
+}
+
+// journalWriter sends each log line to journald as an entry with its fields
+type journalWriter struct {
+	conn   *net.UnixConn
+	fields []byte // Encoded once, as they do not change
+}
+
+func openJournal(fields map[string]string) (*journalWriter, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: journalSocket, Net: "unixgram"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to journald: %v", err)
+	}
+	var encoded bytes.Buffer
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		writeJournalField(&encoded, key, fields[key])
+	}
+	return &journalWriter{conn: conn, fields: encoded.Bytes()}, nil
+}
+
+// Write sends p as the MESSAGE of one entry
+func (j *journalWriter) Write(p []byte) (int, error) {
+	var entry bytes.Buffer
+	writeJournalField(&entry, "MESSAGE", strings.TrimSuffix(string(p), "\n"))
+	writeJournalField(&entry, "PRIORITY", "6") // Informational
+	entry.Write(j.fields)
+	if _, err := j.conn.Write(entry.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// writeJournalField encodes a field in journald's native protocol: KEY=value,
+// or for values with newlines, KEY, then the value's length and the value
+func writeJournalField(b *bytes.Buffer, key, value string) {
+	if !strings.Contains(value, "\n") {
+		fmt.Fprintf(b, "%s=%s\n", key, value)
+		return
+	}
+	b.WriteString(key + "\n")
+	binary.Write(b, binary.LittleEndian, uint64(len(value)))
+	b.WriteString(value + "\n")
+}
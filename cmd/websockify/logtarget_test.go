@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteJournalField(t *testing.T) {
+	tests := []struct {
+		key, value string
+		want       string
+	}{
+		{"MESSAGE", "Serving at :6080", "MESSAGE=Serving at :6080\n"},
+		{"EMPTY", "", "EMPTY=\n"},
+		{"EQUALS", "a=b", "EQUALS=a=b\n"},
+		// Values with newlines are sent as the key, a 64-bit little-endian
+		// length and the value
+		{"MESSAGE", "two\nlines", "MESSAGE\n\x09\x00\x00\x00\x00\x00\x00\x00two\nlines\n"},
+		{"TRAILING", "line\n", "TRAILING\n\x05\x00\x00\x00\x00\x00\x00\x00line\n\n"},
+	}
+	for _, tt := range tests {
+		var b bytes.Buffer
+		writeJournalField(&b, tt.key, tt.value)
+		if got := b.String(); got != tt.want {
+			t.Errorf("writeJournalField(%q, %q) = %q, want %q", tt.key, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestJournalWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.socket")
+	journal, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Skipf("no unixgram sockets: %v", err)
+	}
+	defer journal.Close()
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	var fields bytes.Buffer
+	writeJournalField(&fields, "SYSLOG_IDENTIFIER", "websockify")
+	w := &journalWriter{conn: conn, fields: fields.Bytes()}
+
+	// Each write is one entry, without the log line's own newline
+	line := "2024/05/01 10:00:00 Serving at :6080\n"
+	if n, err := w.Write([]byte(line)); n != len(line) || err != nil {
+		t.Fatalf("Write() = %d, %v, want %d", n, err, len(line))
+	}
+	entry := make([]byte, 1024)
+	n, err := journal.Read(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "MESSAGE=2024/05/01 10:00:00 Serving at :6080\nPRIORITY=6\nSYSLOG_IDENTIFIER=websockify\n"
+	if got := string(entry[:n]); got != want {
+		t.Errorf("entry = %q, want %q", got, want)
+	}
+}
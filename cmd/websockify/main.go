@@ -4,44 +4,294 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"io/fs"
 	"log"
 	"os"
 	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
 	"syscall"
 
 	"github.com/coder/websockify"
+	"github.com/coder/websockify/novnc"
 	"github.com/coder/websockify/version"
 )
 
 func main() {
 	var (
+		configFile  = flag.String("config", "", "Read options from this TOML file, whose keys are flag names; flags given override it")
 		listener    = flag.String("listen", "0.0.0.0:6080", "Host:port to listen on")
 		target      = flag.String("target", "localhost:5900", "Host:port to connect to")
 		webRoot     = flag.String("web-root", "", "Path to web files (leave empty for no static files)")
+		targetList  = flag.String("target-list", "", "Read more routes from this file, one /path=host:port per line")
+		tokenPlugin = flag.String("token-plugin", "", "Pick each connection's target by its token with this plugin: file, directory, config, redis or exec (python-websockify's TokenFile, ReadOnlyTokenFile and TokenRedis work too)")
+		tokenSource = flag.String("token-source", "", "Where -token-plugin looks tokens up: a file, a directory, host[:port[:db[:password[:namespace]]]] for redis, or a command for exec")
+		targetCfg   = flag.String("target-config", "", "Pick each connection's target by its token from this file or directory, reloaded when it changes (python-websockify's --target-config; short for -token-plugin config)")
+		authPlugin  = flag.String("auth-plugin", "", "Require authentication with this plugin: basic (htpasswd) or jwt")
+		authSource  = flag.String("auth-source", "", "Credentials for -auth-plugin: an htpasswd file for basic; a PEM public key, secret file or JWKS URL for jwt")
+		noVNC       = flag.Bool("novnc", false, "Serve the bundled noVNC client at / (needs a build with -tags novnc)")
+		certFile    = flag.String("cert", "", "Serve wss:// and https:// with this PEM certificate, which may hold the key too; read again when it changes")
+		keyFile     = flag.String("key", "", "PEM private key for -cert, if it is not in the same file")
+		acmeDomains = flag.String("acme-domains", "", "Obtain and renew certificates from Let's Encrypt for these comma-separated domains; needs -acme-cache and the listener reachable on port 443")
+		acmeCache   = flag.String("acme-cache", "", "Directory keeping the -acme-domains certificates and account key across restarts")
+		acmeEmail   = flag.String("acme-email", "", "Email the CA may send certificate expiry notices to")
+		acmeDir     = flag.String("acme-directory", "", "ACME directory URL, e.g. Let's Encrypt's staging CA for testing (default Let's Encrypt)")
+		webAuth     = flag.Bool("web-auth", false, "Require the -auth-plugin credentials for the -web-root files too, not just WebSockets")
+		maxConns    = flag.Int("max-connections", 0, "Refuse new connections with 503 while this many are proxied (0 for no limit)")
+		maxConnsIP  = flag.Int("max-conn-per-ip", 0, "Refuse new connections with 429 while this many are proxied from the same client address (0 for no limit)")
+		idleTimeout = flag.Duration("idle-timeout", 0, "Close connections that pass no data either way for this long, e.g. 15m (0 for never)")
+		sessionTime = flag.Duration("session-timeout", 0, "Close connections once they have been open this long, e.g. 8h (0 for never)")
+		adminListen = flag.String("admin-listen", "", "Serve /metrics, /healthz, /sessions and /version on this address, e.g. 127.0.0.1:9100, apart from the proxy")
+		adminPprof  = flag.Bool("admin-pprof", false, "Also serve Go's profiler at /debug/pprof/ on -admin-listen")
+		daemon      = flag.Bool("daemon", false, "Run in the background, detached from the terminal; use with -logfile and -pidfile")
+		pidfile     = flag.String("pidfile", "", "Write the process ID to this file, and remove it on exit")
+		logfile     = flag.String("logfile", "", "Append logs to this file instead of stderr; SIGHUP reopens it")
+		logTarget   = flag.String("log-target", "stderr", "Where to send logs: stderr, syslog (as journald entries with fields when journald runs) or journald")
+		logMaxSize  = flag.Int("log-max-size", 10, "Rotate -logfile once it would pass this many megabytes (0 to never rotate)")
+		logBackups  = flag.Int("log-backups", 5, "Keep this many rotated log files, as <logfile>.1 and up")
+		service     = flag.String("service", "", "Windows only: install, uninstall, start or stop the websockify service, which runs with the other flags given; run is used by the service itself")
+		serviceName = flag.String("service-name", "websockify", "Name of the Windows service and its event log source, for more than one instance")
 		showVersion = flag.Bool("version", false, "Show version information")
 		help        = flag.Bool("help", false, "Show this help message")
 	)
-	flag.Parse()
+	var routes routeFlags
+	flag.Var(&routes, "route", "Proxy WebSockets to this path to their own target: /path=host:port (repeatable)")
+	positional, err := parseArgs(flag.CommandLine, os.Args[1:])
+	if err == nil {
+		err = applyPositional(flag.CommandLine, positional)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+	if *configFile != "" {
+		if err := loadConfigFile(*configFile, flag.CommandLine); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
 
 	if *showVersion {
-		fmt.Printf("websockify %s\n", version.Version())
+		fmt.Printf("websockify %s\n", version.Full())
 		os.Exit(0)
 	}
 
 	if *help {
-		fmt.Fprintf(os.Stderr, "Usage: %s [OPTIONS]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Usage: %s [OPTIONS] [[source_addr:]source_port [target_addr:target_port]]\n\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "websockify - WebSocket to TCP proxy\n\n")
 		fmt.Fprintf(os.Stderr, "OPTIONS:\n")
 		flag.PrintDefaults()
 		fmt.Fprintf(os.Stderr, "\nExample:\n")
 		fmt.Fprintf(os.Stderr, "  %s -listen :8080 -target localhost:5900 -web-root ./web\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s --web-root ./web 8080 localhost:5900\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -listen :8080 -token-plugin file -token-source ./tokens.conf\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -listen :8080 -target localhost:5900 -auth-plugin basic -auth-source ./htpasswd\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -listen :8080 -route /vnc=localhost:5900 -route /ssh=localhost:22\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -listen :8080 -target localhost:5900 -novnc\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -listen :443 -target localhost:5900 -acme-domains vnc.example.com -acme-cache /var/lib/websockify\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -config /etc/websockify.toml -listen :9000\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -listen :8080 -target localhost:5900 -admin-listen 127.0.0.1:9100\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -listen :8080 -target localhost:5900 -daemon -pidfile /run/websockify.pid -logfile /var/log/websockify.log\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -listen :8080 -target localhost:5900 -service install\n", os.Args[0])
 		os.Exit(0)
 	}
 
+	if *targetCfg != "" {
+		if *tokenPlugin != "" || *tokenSource != "" {
+			fmt.Fprintf(os.Stderr, "Error: -target-config cannot be used with -token-plugin or -token-source\n")
+			os.Exit(1)
+		}
+		*tokenPlugin, *tokenSource = "config", *targetCfg
+	}
+	var tokens websockify.TokenResolver
+	if *tokenPlugin != "" || *tokenSource != "" {
+		if *tokenPlugin == "" {
+			fmt.Fprintf(os.Stderr, "Error: -token-source needs -token-plugin\n")
+			os.Exit(1)
+		}
+		var err error
+		tokens, err = websockify.NewTokenResolver(*tokenPlugin, *tokenSource)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	var auth websockify.Authenticator
+	if *authPlugin != "" || *authSource != "" {
+		if *authPlugin == "" {
+			fmt.Fprintf(os.Stderr, "Error: -auth-source needs -auth-plugin\n")
+			os.Exit(1)
+		}
+		var err error
+		auth, err = websockify.NewAuthenticator(*authPlugin, *authSource)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if *maxConns < 0 || *maxConnsIP < 0 || *idleTimeout < 0 || *sessionTime < 0 {
+		fmt.Fprintf(os.Stderr, "Error: connection limits and timeouts cannot be negative\n")
+		os.Exit(1)
+	}
+	var webFS fs.FS
+	if *noVNC {
+		if *webRoot != "" {
+			fmt.Fprintf(os.Stderr, "Error: -novnc serves its own files, so it cannot be used with -web-root\n")
+			os.Exit(1)
+		}
+		var err error
+		webFS, err = novnc.FS()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	var autoCert *websockify.AutoCert
+	if *acmeDomains != "" {
+		if *certFile != "" || *keyFile != "" {
+			fmt.Fprintf(os.Stderr, "Error: -acme-domains cannot be used with -cert or -key\n")
+			os.Exit(1)
+		}
+		if *acmeCache == "" {
+			fmt.Fprintf(os.Stderr, "Error: -acme-domains needs -acme-cache\n")
+			os.Exit(1)
+		}
+		autoCert = &websockify.AutoCert{
+			Domains:      strings.Split(*acmeDomains, ","),
+			CacheDir:     *acmeCache,
+			Email:        *acmeEmail,
+			DirectoryURL: *acmeDir,
+		}
+	} else if *acmeCache != "" || *acmeEmail != "" || *acmeDir != "" {
+		fmt.Fprintf(os.Stderr, "Error: -acme-cache, -acme-email and -acme-directory need -acme-domains\n")
+		os.Exit(1)
+	}
+	if *webAuth && auth == nil {
+		fmt.Fprintf(os.Stderr, "Error: -web-auth needs -auth-plugin\n")
+		os.Exit(1)
+	}
+	if *adminPprof && *adminListen == "" {
+		fmt.Fprintf(os.Stderr, "Error: -admin-pprof needs -admin-listen\n")
+		os.Exit(1)
+	}
+	if *logMaxSize < 0 || *logBackups < 0 {
+		fmt.Fprintf(os.Stderr, "Error: -log-max-size and -log-backups cannot be negative\n")
+		os.Exit(1)
+	}
+	if *service != "" {
+		if !slices.Contains(serviceActions, *service) {
+			fmt.Fprintf(os.Stderr, "Error: unknown -service %q (want %s)\n", *service, strings.Join(serviceActions, ", "))
+			os.Exit(1)
+		}
+		if *daemon || *pidfile != "" {
+			fmt.Fprintf(os.Stderr, "Error: -service cannot be used with -daemon or -pidfile\n")
+			os.Exit(1)
+		}
+	}
+
+	if *targetList != "" {
+		listed, err := websockify.ReadRouteList(*targetList)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		routes = append(routes, listed...)
+	}
+	// With routes, /websockify is only served if -target is given
+	if len(routes) > 0 && !flagGiven("target") {
+		*target = ""
+	}
+
 	config := websockify.Config{
 		Listener: *listener,
 		Target:   *target,
 		WebRoot:  *webRoot,
+		WebFS:    webFS,
+
+		TokenResolver: tokens,
+		Authenticator: auth,
+		WebAuth:       *webAuth,
+		Routes:        routes,
+		CertFile:      *certFile,
+		KeyFile:       *keyFile,
+		AutoCert:      autoCert,
+		Limits: websockify.Limits{
+			MaxConnections:      *maxConns,
+			MaxConnectionsPerIP: *maxConnsIP,
+			IdleTimeout:         *idleTimeout,
+			SessionTimeout:      *sessionTime,
+		},
+	}
+
+	// Installing or controlling the service is all this run does
+	if *service != "" && *service != "run" {
+		args, err := serviceArgs(os.Args[1:], *tokenPlugin)
+		if err == nil {
+			err = controlService(*service, *serviceName, args)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("websockify service %s: %s done\n", *serviceName, *service)
+		os.Exit(0)
+	}
+
+	// Open the log file or target before going to the background, so a bad
+	// path is reported on the terminal
+	if *logfile != "" && *logTarget != "stderr" {
+		fmt.Fprintf(os.Stderr, "Error: -logfile cannot be used with -log-target %s\n", *logTarget)
+		os.Exit(1)
+	}
+	logOutput, err := openLogTarget(*logTarget, map[string]string{
+		"SYSLOG_IDENTIFIER":  "websockify",
+		"SYSLOG_PID":         strconv.Itoa(os.Getpid()),
+		"WEBSOCKIFY_VERSION": version.Version(),
+		"WEBSOCKIFY_LISTEN":  *listener,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if *service == "run" && *logfile == "" && *logTarget == "stderr" {
+		// A service has no terminal, so it logs to the event log
+		logOutput, err = openEventLog(*serviceName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	var logs *rotatingFile
+	if *logfile != "" {
+		logs, err = openRotatingFile(*logfile, int64(*logMaxSize)<<20, *logBackups)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *daemon && os.Getenv(daemonEnv) == "" {
+		pid, err := daemonize()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("websockify running in the background as process %d\n", pid)
+		os.Exit(0)
+	}
+	if logs != nil {
+		log.SetOutput(logs)
+	} else if logOutput != os.Stderr {
+		// The system log timestamps entries itself
+		log.SetFlags(0)
+		log.SetOutput(logOutput)
+	}
+	if *pidfile != "" {
+		if err := writePidfile(*pidfile); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
 	}
 
 	server := websockify.New(config)
@@ -60,14 +310,72 @@ func main() {
 		cancel()
 	}()
 
-	log.Printf("Starting websockify server...")
+	// SIGHUP reopens the log file after logrotate moves it
+	if logs != nil {
+		hupChan := make(chan os.Signal, 1)
+		signal.Notify(hupChan, syscall.SIGHUP)
+		go func() {
+			for range hupChan {
+				if err := logs.Reopen(); err != nil {
+					fmt.Fprintf(os.Stderr, "websockify: %v\n", err)
+				}
+				log.Printf("Reopened log file %s", *logfile)
+			}
+		}()
+	}
+
+	log.Printf("Starting websockify %s", version.Full())
 	log.Printf("Listening on: %s", *listener)
-	log.Printf("Proxying to: %s", *target)
+	switch {
+	case tokens != nil:
+		log.Printf("Proxying to targets from %s token plugin: %s", *tokenPlugin, *tokenSource)
+	case *target != "":
+		log.Printf("Proxying to: %s", *target)
+	}
+	for _, route := range routes {
+		log.Printf("Proxying %s to: %s", route.Path, route.Target)
+	}
+	if auth != nil {
+		log.Printf("Authentication: %s from %s", *authPlugin, *authSource)
+		if *webAuth {
+			log.Printf("Authentication also required for the web root")
+		}
+	}
 	if *webRoot != "" {
 		log.Printf("Web root: %s", *webRoot)
 	}
+	if *noVNC {
+		log.Printf("Serving the bundled noVNC client at /")
+	}
+	if *adminListen != "" {
+		log.Printf("Serving metrics, health and sessions on http://%s", *adminListen)
+		go func() {
+			log.Fatalf("Admin server stopped: %v", serveAdmin(*adminListen, server, *adminPprof))
+		}()
+	}
 
-	if err := server.Serve(ctx); err != nil {
+	if *service == "run" {
+		// The service control manager starts and stops the server
+		err = runService(ctx, *serviceName, server.Serve)
+	} else {
+		err = server.Serve(ctx)
+	}
+	if *pidfile != "" {
+		removePidfile(*pidfile)
+	}
+	if err != nil && ctx.Err() == nil {
 		log.Fatalf("Server error: %v", err)
 	}
 }
+
+// flagGiven reports whether a flag was set on the command line or in the
+// config file
+func flagGiven(name string) bool {
+	given := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			given = true
+		}
+	})
+	return given
+}
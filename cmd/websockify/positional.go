@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// parseArgs parses args like flags.Parse, but lets flags follow positional
+// arguments, as python-websockify's do, returning the positional ones
+func parseArgs(flags *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+		args = flags.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// applyPositional sets -listen and -target from python-websockify's
+// positional arguments, "[source_addr:]source_port [target_addr:target_port]"
+func applyPositional(flags *flag.FlagSet, args []string) error {
+	if len(args) > 2 {
+		return fmt.Errorf("too many arguments %q; want [source_addr:]source_port [target_addr:target_port]", args)
+	}
+	given := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) { given[f.Name] = true })
+
+	if len(args) > 0 {
+		listen, err := positionalListen(args[0])
+		if err != nil {
+			return err
+		}
+		if given["listen"] {
+			return fmt.Errorf("listen address given both as -listen and as %q", args[0])
+		}
+		flags.Set("listen", listen)
+	}
+	if len(args) > 1 {
+		if _, port, err := net.SplitHostPort(args[1]); err != nil || port == "" {
+			return fmt.Errorf("invalid target %q; want target_addr:target_port", args[1])
+		}
+		if given["target"] {
+			return fmt.Errorf("target given both as -target and as %q", args[1])
+		}
+		flags.Set("target", args[1])
+	}
+	return nil
+}
+
+// positionalListen returns the listen address of a source argument, which is
+// a port, listened on at every address, or addr:port
+func positionalListen(source string) (string, error) {
+	if !strings.Contains(source, ":") {
+		if _, err := strconv.ParseUint(source, 10, 16); err != nil {
+			return "", fmt.Errorf("invalid source port %q", source)
+		}
+		return ":" + source, nil
+	}
+	if _, port, err := net.SplitHostPort(source); err != nil || port == "" {
+		return "", fmt.Errorf("invalid source %q; want [source_addr:]source_port", source)
+	}
+	return source, nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		positional []string
+		want       map[string]string
+	}{
+		{"flags only", []string{"-listen", ":8080"}, nil, map[string]string{"listen": ":8080"}},
+		{"positionals only", []string{"6080", "localhost:5900"}, []string{"6080", "localhost:5900"}, nil},
+		{
+			"flags after positionals",
+			[]string{"6080", "--token-plugin", "TokenFile", "localhost:5900", "-web-auth"},
+			[]string{"6080", "localhost:5900"},
+			map[string]string{"token-plugin": "TokenFile", "web-auth": "true"},
+		},
+		{"flags before and after", []string{"-web-auth", "6080", "-max-connections", "3"}, []string{"6080"}, map[string]string{"web-auth": "true", "max-connections": "3"}},
+		{"double dash", []string{"--", "-6080"}, []string{"-6080"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags := testFlags()
+			positional, err := parseArgs(flags, tt.args)
+			if err != nil {
+				t.Fatalf("parseArgs() = %v", err)
+			}
+			if !slices.Equal(positional, tt.positional) {
+				t.Errorf("parseArgs() positional = %q, want %q", positional, tt.positional)
+			}
+			for name, want := range tt.want {
+				if got := flags.Lookup(name).Value.String(); got != want {
+					t.Errorf("-%s = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+
+	if _, err := parseArgs(testFlags(), []string{"6080", "-no-such-flag"}); err == nil {
+		t.Errorf("parseArgs() with an unknown flag after a positional = nil, want an error")
+	}
+}
+
+func TestApplyPositional(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		positional []string
+		wantListen string
+		wantTarget string
+		wantErr    string
+	}{
+		{"none", nil, nil, "0.0.0.0:6080", "localhost:5900", ""},
+		{"bare port", nil, []string{"8080"}, ":8080", "localhost:5900", ""},
+		{"host and port", nil, []string{"127.0.0.1:8080"}, "127.0.0.1:8080", "localhost:5900", ""},
+		{"IPv6 host", nil, []string{"[::1]:8080"}, "[::1]:8080", "localhost:5900", ""},
+		{"with target", nil, []string{"8080", "vnc.internal:5901"}, ":8080", "vnc.internal:5901", ""},
+		{"other flags", []string{"-web-auth"}, []string{"8080"}, ":8080", "localhost:5900", ""},
+		{"listen conflict", []string{"-listen", ":9000"}, []string{"8080"}, "", "", "listen address given both"},
+		{"target conflict", []string{"-target", "a:1"}, []string{"8080", "b:2"}, "", "", "target given both"},
+		{"port too large", nil, []string{"70000"}, "", "", "invalid source port"},
+		{"port not a number", nil, []string{"http"}, "", "", "invalid source port"},
+		{"negative port", nil, []string{"-1"}, "", "", "invalid source port"},
+		{"host without port", nil, []string{"localhost:"}, "", "", "invalid source"},
+		{"target without port", nil, []string{"8080", "localhost"}, "", "", "invalid target"},
+		{"target with empty port", nil, []string{"8080", "localhost:"}, "", "", "invalid target"},
+		{"too many", nil, []string{"8080", "localhost:5900", "extra"}, "", "", "too many arguments"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags := testFlags()
+			if err := flags.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			err := applyPositional(flags, tt.positional)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("applyPositional(%q) = %v, want an error containing %q", tt.positional, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyPositional(%q) = %v", tt.positional, err)
+			}
+			if got := flags.Lookup("listen").Value.String(); got != tt.wantListen {
+				t.Errorf("-listen = %q, want %q", got, tt.wantListen)
+			}
+			if got := flags.Lookup("target").Value.String(); got != tt.wantTarget {
+				t.Errorf("-target = %q, want %q", got, tt.wantTarget)
+			}
+		})
+	}
+}
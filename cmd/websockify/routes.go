@@ -0,0 +1,29 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/coder/websockify"
+)
+
+// routeFlags collects repeated -route flags
+type routeFlags []websockify.Route
+
+func (r *routeFlags) String() string {
+	var routes []string
+	for _, route := range *r {
+		routes = append(routes, route.String())
+	}
+	return strings.Join(routes, ",")
+}
+
+func (r *routeFlags) Set(value string) error {
+	route, err := websockify.ParseRoute(value)
+	if err != nil {
+		return err
+	}
+	*r = append(*r, route)
+	return nil
+}
+
+func (r *routeFlags) repeatable() {}
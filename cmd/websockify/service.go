@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// serviceActions are the values of -service
+var serviceActions = []string{"install", "uninstall", "start", "stop", "run"}
+
+// servicePathFlags are the flags naming files. Services start in System32, so
+// an installed service is given them as absolute paths.
+var servicePathFlags = map[string]bool{
+	"config":        true,
+	"web-root":      true,
+	"target-list":   true,
+	"target-config": true,
+	"cert":          true,
+	"key":           true,
+	"acme-cache":    true,
+	"logfile":       true,
+	"auth-source":   true, // Unless a JWKS URL
+	"token-source":  true, // For the plugins reading files
+}
+
+// serviceArgs returns args without -service and -service-name, as the
+// arguments an installed service runs with, with the files they name made
+// absolute. tokenPlugin tells whether -token-source names a file.
+func serviceArgs(args []string, tokenPlugin string) ([]string, error) {
+	var kept []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" || !strings.HasPrefix(arg, "-") {
+			kept = append(kept, arg)
+			if arg == "--" {
+				return append(kept, args[i+1:]...), nil
+			}
+			continue
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		separate := !hasValue && (name == "service" || name == "service-name" || servicePathFlags[name]) && i+1 < len(args)
+		if separate {
+			i++ // The value is the next argument
+			value = args[i]
+		}
+		switch {
+		case name == "service" || name == "service-name":
+			continue
+		case servicePathFlags[name] && isServicePath(name, value, tokenPlugin):
+			abs, err := filepath.Abs(value)
+			if err != nil {
+				return nil, fmt.Errorf("-%s: %v", name, err)
+			}
+			value = abs
+		case !hasValue && !separate:
+			kept = append(kept, arg)
+			continue
+		}
+		kept = append(kept, "-"+name+"="+value)
+	}
+	return kept, nil
+}
+
+// isServicePath reports whether value of the path flag name is a file rather
+// than a URL or another kind of source
+func isServicePath(name, value, tokenPlugin string) bool {
+	switch {
+	case value == "":
+		return false
+	case name == "auth-source":
+		return !strings.Contains(value, "://")
+	case name == "token-source":
+		switch strings.ToLower(tokenPlugin) {
+		case "file", "tokenfile", "readonlytokenfile", "directory", "config":
+			return true
+		}
+		return false
+	}
+	return true
+}
@@ -0,0 +1,23 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// Services are Windows only; elsewhere, use -daemon or an init system
+
+func runService(ctx context.Context, name string, run func(context.Context) error) error {
+	return fmt.Errorf("-service is only supported on Windows")
+}
+
+func controlService(action, name string, args []string) error {
+	return fmt.Errorf("-service is only supported on Windows")
+}
+
+func openEventLog(name string) (io.Writer, error) {
+	return nil, fmt.Errorf("the event log is only supported on Windows")
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestServiceArgs(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	abs := func(name string) string { return filepath.Join(dir, name) }
+
+	tests := []struct {
+		name        string
+		args        []string
+		tokenPlugin string
+		want        []string
+	}{
+		{
+			name: "service flags dropped",
+			args: []string{"-service", "install", "-listen", ":8080", "--service-name=vnc", "-web-auth"},
+			want: []string{"-listen", ":8080", "-web-auth"},
+		},
+		{
+			name: "relative paths",
+			args: []string{"-cert", "cert.pem", "--key=keys/key.pem", "-web-root", "./www", "-config", "websockify.toml"},
+			want: []string{"-cert=" + abs("cert.pem"), "-key=" + abs("keys/key.pem"), "-web-root=" + abs("www"), "-config=" + abs("websockify.toml")},
+		},
+		{
+			name: "absolute paths",
+			args: []string{"-logfile", abs("websockify.log"), "-target-list=" + abs("routes")},
+			want: []string{"-logfile=" + abs("websockify.log"), "-target-list=" + abs("routes")},
+		},
+		{
+			name: "JWKS URL",
+			args: []string{"-auth-plugin", "jwt", "-auth-source", "https://login.example.com/jwks.json"},
+			want: []string{"-auth-plugin", "jwt", "-auth-source=https://login.example.com/jwks.json"},
+		},
+		{
+			name: "htpasswd",
+			args: []string{"-auth-plugin", "basic", "-auth-source", "htpasswd"},
+			want: []string{"-auth-plugin", "basic", "-auth-source=" + abs("htpasswd")},
+		},
+		{
+			name:        "token file",
+			args:        []string{"-token-plugin", "TokenFile", "-token-source", "tokens.conf"},
+			tokenPlugin: "TokenFile",
+			want:        []string{"-token-plugin", "TokenFile", "-token-source=" + abs("tokens.conf")},
+		},
+		{
+			name:        "token redis",
+			args:        []string{"-token-plugin", "redis", "-token-source", "localhost:6379"},
+			tokenPlugin: "redis",
+			want:        []string{"-token-plugin", "redis", "-token-source=localhost:6379"},
+		},
+		{
+			name:        "token command",
+			args:        []string{"-token-plugin=exec", "-token-source", "lookup.sh --table desks"},
+			tokenPlugin: "exec",
+			want:        []string{"-token-plugin=exec", "-token-source=lookup.sh --table desks"},
+		},
+		{
+			name: "positionals",
+			args: []string{"-service", "install", "6080", "localhost:5900", "-cert", "cert.pem"},
+			want: []string{"6080", "localhost:5900", "-cert=" + abs("cert.pem")},
+		},
+		{
+			name: "after a double dash",
+			args: []string{"-cert", "cert.pem", "--", "-web-root", "www"},
+			want: []string{"-cert=" + abs("cert.pem"), "--", "-web-root", "www"},
+		},
+		{
+			name: "missing value",
+			args: []string{"-listen", ":8080", "-cert"},
+			want: []string{"-listen", ":8080", "-cert"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := serviceArgs(tt.args, tt.tokenPlugin)
+			if err != nil {
+				t.Fatalf("serviceArgs() = %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("serviceArgs(%q) = %q, want %q", tt.args, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServiceArgsParse(t *testing.T) {
+	// What an installed service is given parses as the command line did,
+	// from any directory
+	t.Chdir(t.TempDir())
+	args, err := serviceArgs([]string{"-service", "install", "-web-auth", "-token-source", "tokens", "6080", "-listen", ":1"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(os.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	flags := testFlags()
+	positional, err := parseArgs(flags, args)
+	if err != nil {
+		t.Fatalf("parseArgs(%q) = %v", args, err)
+	}
+	if !slices.Equal(positional, []string{"6080"}) || flags.Lookup("web-auth").Value.String() != "true" ||
+		flags.Lookup("token-source").Value.String() != "tokens" || flags.Lookup("listen").Value.String() != ":1" {
+		t.Errorf("parseArgs(%q) parsed differently from the command line", args)
+	}
+}
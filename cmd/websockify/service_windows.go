@@ -0,0 +1,151 @@
+//go:build windows
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// winService runs the server for the service control manager
+type winService struct {
+	ctx context.Context
+	run func(context.Context) error
+	err error // Why run failed, if it was not stopped
+}
+
+// runService hands the process to the service control manager, which runs
+// the server with run until the service is stopped. It returns run's error,
+// or nil when the service was stopped.
+func runService(ctx context.Context, name string, run func(context.Context) error) error {
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		return fmt.Errorf("failed to tell whether this is a service: %v", err)
+	}
+	if !isService {
+		return fmt.Errorf("-service run is for the service control manager; use -service start")
+	}
+	s := &winService{ctx: ctx, run: run}
+	if err := svc.Run(name, s); err != nil {
+		return fmt.Errorf("failed to run service %s: %v", name, err)
+	}
+	return s.err
+}
+
+// Execute runs the server until it fails or the service control manager
+// stops it
+func (s *winService) Execute(_ []string, requests <-chan svc.ChangeRequest, changes chan<- svc.Status) (bool, uint32) {
+	changes <- svc.Status{State: svc.StartPending}
+	ctx, cancel := context.WithCancel(s.ctx)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- s.run(ctx) }()
+	changes <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+
+	for {
+		select {
+		case err := <-done:
+			if err != nil && ctx.Err() == nil {
+				// Failed rather than stopped, which the service control
+				// manager reports as a service-specific error
+				s.err = err
+				return true, 1
+			}
+			return false, 0
+		case request := <-requests:
+			switch request.Cmd {
+			case svc.Interrogate:
+				changes <- request.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				changes <- svc.Status{State: svc.StopPending, WaitHint: 10000}
+				cancel()
+			}
+		}
+	}
+}
+
+// controlService installs, uninstalls, starts or stops the service. An
+// installed service runs this executable with args and -service run.
+func controlService(action, name string, args []string) error {
+	manager, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to open the service control manager: %v", err)
+	}
+	defer manager.Disconnect()
+
+	if action == "install" {
+		exe, err := os.Executable()
+		if err != nil {
+			return err
+		}
+		config := mgr.Config{
+			StartType:   mgr.StartAutomatic,
+			DisplayName: name,
+			Description: "WebSocket to TCP proxy",
+		}
+		args = append([]string{"-service", "run", "-service-name", name}, args...)
+		service, err := manager.CreateService(name, exe, config, args...)
+		if err != nil {
+			return fmt.Errorf("failed to create service %s: %v", name, err)
+		}
+		defer service.Close()
+		if err := eventlog.InstallAsEventCreate(name, eventlog.Error|eventlog.Warning|eventlog.Info); err != nil {
+			service.Delete()
+			return fmt.Errorf("failed to register event log source %s: %v", name, err)
+		}
+		return nil
+	}
+
+	service, err := manager.OpenService(name)
+	if err != nil {
+		return fmt.Errorf("failed to open service %s: %v", name, err)
+	}
+	defer service.Close()
+	switch action {
+	case "uninstall":
+		if err := service.Delete(); err != nil {
+			return fmt.Errorf("failed to delete service %s: %v", name, err)
+		}
+		if err := eventlog.Remove(name); err != nil {
+			return fmt.Errorf("failed to remove event log source %s: %v", name, err)
+		}
+	case "start":
+		if err := service.Start(); err != nil {
+			return fmt.Errorf("failed to start service %s: %v", name, err)
+		}
+	case "stop":
+		if _, err := service.Control(svc.Stop); err != nil {
+			return fmt.Errorf("failed to stop service %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// eventLogWriter reports each log line as an information event
+type eventLogWriter struct {
+	log *eventlog.Log
+}
+
+func openEventLog(name string) (io.Writer, error) {
+	log, err := eventlog.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the event log: %v", err)
+	}
+	return &eventLogWriter{log: log}, nil
+}
+
+func (e *eventLogWriter) Write(p []byte) (int, error) {
+	message := strings.TrimRight(strings.ReplaceAll(string(p), "\x00", ""), "\n")
+	// Event ID 1 is the EventCreate message that shows its string as is
+	if err := e.log.Info(1, message); err != nil {
+		return 0, fmt.Errorf("failed to write to the event log: %v", err)
+	}
+	return len(p), nil
+}
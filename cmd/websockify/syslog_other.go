@@ -0,0 +1,13 @@
+//go:build windows || plan9
+
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// openSyslog fails, as there is no syslog daemon on this platform
+func openSyslog() (io.Writer, error) {
+	return nil, fmt.Errorf("syslog is not supported on this platform")
+}
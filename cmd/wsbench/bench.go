@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/coder/websockify/rfb"
+)
+
+// benchConfig is what every run shares
+type benchConfig struct {
+	url       string
+	duration  time.Duration // Measured time of each run
+	timeout   time.Duration // Longest a round trip may take before it counts as an error
+	tlsConfig *tls.Config
+}
+
+// runResult is the report of one run: one message size at one concurrency
+type runResult struct {
+	Size              int        `json:"size"`
+	Concurrency       int        `json:"concurrency"`
+	Seconds           float64    `json:"seconds"`
+	Messages          int        `json:"messages"`
+	Errors            int        `json:"errors"`
+	MessagesPerSecond float64    `json:"messages_per_second"`
+	BytesPerSecond    float64    `json:"bytes_per_second"` // Payload echoed, counted once
+	RTT               rttSummary `json:"rtt_ms"`
+}
+
+// rttSummary describes round trip times in milliseconds, with nearest-rank
+// percentiles
+type rttSummary struct {
+	Min  float64 `json:"min"`
+	Mean float64 `json:"mean"`
+	P50  float64 `json:"p50"`
+	P90  float64 `json:"p90"`
+	P99  float64 `json:"p99"`
+	Max  float64 `json:"max"`
+}
+
+// worker is one connection's share of a run
+type worker struct {
+	rtts []time.Duration
+	err  error
+}
+
+// run connects concurrency clients and has each send size-byte messages and
+// wait for their echo, one at a time, for the configured duration. Connecting
+// and a first round trip on every connection are not measured.
+func run(ctx context.Context, config benchConfig, size, concurrency int) (runResult, error) {
+	conns := make([]*rfb.WebSocketConn, concurrency)
+	defer func() {
+		for _, conn := range conns {
+			if conn != nil {
+				conn.Close()
+			}
+		}
+	}()
+	for i := range conns {
+		conn, err := rfb.DialWebSocketTLS(ctx, config.url, nil, config.tlsConfig)
+		if err != nil {
+			return runResult{}, fmt.Errorf("connection %d of %d: %v", i+1, concurrency, err)
+		}
+		conns[i] = conn
+		if err := roundTrip(conn, payload(size, i), make([]byte, size), config.timeout); err != nil {
+			return runResult{}, fmt.Errorf("connection %d of %d: %v", i+1, concurrency, err)
+		}
+	}
+
+	workers := make([]worker, concurrency)
+	started := time.Now()
+	deadline := started.Add(config.duration)
+	var wg sync.WaitGroup
+	for i, conn := range conns {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := &workers[i]
+			sent, echoed := payload(size, i), make([]byte, size)
+			for time.Now().Before(deadline) && ctx.Err() == nil {
+				start := time.Now()
+				if w.err = roundTrip(conn, sent, echoed, config.timeout); w.err != nil {
+					return
+				}
+				w.rtts = append(w.rtts, time.Since(start))
+			}
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(started)
+
+	result := runResult{Size: size, Concurrency: concurrency, Seconds: elapsed.Seconds()}
+	var rtts []time.Duration
+	for _, w := range workers {
+		rtts = append(rtts, w.rtts...)
+		if w.err != nil {
+			result.Errors++
+		}
+	}
+	result.Messages = len(rtts)
+	result.MessagesPerSecond = float64(result.Messages) / elapsed.Seconds()
+	result.BytesPerSecond = float64(result.Messages*size) / elapsed.Seconds()
+	result.RTT = summarize(rtts)
+	return result, nil
+}
+
+// payload returns the message connection n sends, which differs between
+// connections so echoes that cross are noticed
+func payload(size, n int) []byte {
+	p := make([]byte, size)
+	for i := range p {
+		p[i] = byte(i*31 + n)
+	}
+	return p
+}
+
+// roundTrip sends p and reads its echo into buf, which may come back split
+// into several messages
+func roundTrip(conn *rfb.WebSocketConn, p, buf []byte, timeout time.Duration) error {
+	conn.SetDeadline(time.Now().Add(timeout))
+	if _, err := conn.Write(p); err != nil {
+		return fmt.Errorf("send failed: %v", err)
+	}
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return fmt.Errorf("echo failed: %v", err)
+	}
+	if !bytes.Equal(p, buf) {
+		return fmt.Errorf("echo did not match the %d bytes sent", len(p))
+	}
+	return nil
+}
+
+// summarize returns the minimum, mean, percentiles and maximum of rtts
+func summarize(rtts []time.Duration) rttSummary {
+	if len(rtts) == 0 {
+		return rttSummary{}
+	}
+	sorted := slices.Clone(rtts)
+	slices.Sort(sorted)
+
+	var total time.Duration
+	for _, d := range sorted {
+		total += d
+	}
+	percentile := func(p int) float64 {
+		rank := (p*len(sorted) + 99) / 100
+		return milliseconds(sorted[max(rank, 1)-1])
+	}
+	return rttSummary{
+		Min:  milliseconds(sorted[0]),
+		Mean: milliseconds(total / time.Duration(len(sorted))),
+		P50:  percentile(50),
+		P90:  percentile(90),
+		P99:  percentile(99),
+		Max:  milliseconds(sorted[len(sorted)-1]),
+	}
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/coder/websockify/version"
+)
+
+func main() {
+	var (
+		url         = flag.String("url", "ws://localhost:8080/websockify", "ws:// or wss:// URL of a websockify instance proxying to an echo server")
+		sizes       = flag.String("sizes", "64,1024,16384", "Comma-separated message sizes in bytes to run with")
+		concurrency = flag.String("concurrency", "1,10,50", "Comma-separated numbers of connections to run with")
+		duration    = flag.Duration("duration", 5*time.Second, "Measure each size and concurrency for this long")
+		timeout     = flag.Duration("timeout", 10*time.Second, "Longest a round trip may take before the connection counts as failed")
+		tlsInsecure = flag.Bool("tls-insecure", false, "Skip verification of the server's TLS certificate for wss://")
+		jsonOut     = flag.Bool("json", false, "Print one JSON object per run instead of a table")
+		showVersion = flag.Bool("version", false, "Show version information")
+		help        = flag.Bool("help", false, "Show this help message")
+	)
+	flag.Parse()
+
+	if *showVersion {
+		fmt.Printf("wsbench %s\n", version.Full())
+		os.Exit(0)
+	}
+
+	if *help {
+		fmt.Fprintf(os.Stderr, "Usage: %s [OPTIONS]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "wsbench - Measure round trip latency and throughput through websockify to an echo server\n\n")
+		fmt.Fprintf(os.Stderr, "OPTIONS:\n")
+		flag.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExample:\n")
+		fmt.Fprintf(os.Stderr, "  %s -url ws://localhost:8080/websockify\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -url ws://localhost:8080/websockify -sizes 16,65536 -concurrency 1,100 -duration 10s -json\n", os.Args[0])
+		os.Exit(0)
+	}
+
+	sizeList, err := parseInts(*sizes)
+	if err != nil {
+		log.Fatalf("Invalid -sizes: %v", err)
+	}
+	concurrencyList, err := parseInts(*concurrency)
+	if err != nil {
+		log.Fatalf("Invalid -concurrency: %v", err)
+	}
+	if *duration <= 0 || *timeout <= 0 {
+		log.Fatalf("-duration and -timeout must be positive")
+	}
+	if !strings.HasPrefix(*url, "ws://") && !strings.HasPrefix(*url, "wss://") {
+		log.Fatalf("-url must be a ws:// or wss:// URL")
+	}
+
+	config := benchConfig{url: *url, duration: *duration, timeout: *timeout}
+	if *tlsInsecure {
+		config.tlsConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Rows are printed as each run ends, so the columns have fixed widths
+	const row = "%8v %6v %9v %9v %8v %8v %8v %8v %8v %8v %6v\n"
+	if !*jsonOut {
+		fmt.Printf("wsbench %s: %s, %v per run\n\n", version.Full(), *url, *duration)
+		fmt.Printf(row, "SIZE", "CONNS", "MSGS", "MSG/S", "MB/S", "MIN ms", "P50 ms", "P90 ms", "P99 ms", "MAX ms", "ERRORS")
+	}
+	failed := 0
+	for _, size := range sizeList {
+		for _, conns := range concurrencyList {
+			result, err := run(ctx, config, size, conns)
+			if ctx.Err() != nil {
+				os.Exit(1)
+			}
+			if err != nil {
+				log.Fatalf("Run of %d byte messages on %d connections failed: %v", size, conns, err)
+			}
+			failed += result.Errors
+			if *jsonOut {
+				json.NewEncoder(os.Stdout).Encode(result)
+				continue
+			}
+			ms := func(v float64) string { return fmt.Sprintf("%.3f", v) }
+			fmt.Printf(row, result.Size, result.Concurrency, result.Messages, fmt.Sprintf("%.0f", result.MessagesPerSecond),
+				fmt.Sprintf("%.2f", result.BytesPerSecond/1e6), ms(result.RTT.Min), ms(result.RTT.P50), ms(result.RTT.P90),
+				ms(result.RTT.P99), ms(result.RTT.Max), result.Errors)
+		}
+	}
+	if failed > 0 {
+		log.Fatalf("%d connections failed during the runs", failed)
+	}
+}
+
+// parseInts parses a comma-separated list of positive integers
+func parseInts(list string) ([]int, error) {
+	var values []int
+	for _, field := range strings.Split(list, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("%q is not a positive integer", field)
+		}
+		values = append(values, n)
+	}
+	return values, nil
+}
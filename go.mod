@@ -1,5 +1,14 @@
 module github.com/coder/websockify
 
-go 1.24
+go 1.24.0
 
-require github.com/gorilla/websocket v1.5.3
\ No newline at end of file
+require (
+	github.com/gorilla/websocket v1.5.3
+	golang.org/x/crypto v0.45.0
+	golang.org/x/sys v0.38.0
+)
+
+require (
+	golang.org/x/net v0.47.0 // indirect
+	golang.org/x/text v0.31.0 // indirect
+)
@@ -0,0 +1,87 @@
+// Package e2e runs the mock VNC server, a websockify.Server and the VNC
+// client library together in one process, so tests can check what a client
+// sees at the far end of the whole chain.
+package e2e
+
+import (
+	"context"
+	"image"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/coder/websockify"
+	"github.com/coder/websockify/mockvnc"
+	"github.com/coder/websockify/vncclient"
+)
+
+// Chain is a mock VNC server behind a websockify proxy
+type Chain struct {
+	VNC   *mockvnc.Server
+	Proxy *websockify.Server
+	URL   string // ws:// URL of the proxy
+}
+
+// Start runs a mock VNC server and a websockify.Server in front of it, each on
+// a random localhost port, for the duration of a test. The proxy targets the
+// VNC server unless config sets a Target or TokenResolver of its own, and
+// logs nothing unless config sets a Logger.
+func Start(t testing.TB, vncOpts mockvnc.Options, config websockify.Config) *Chain {
+	t.Helper()
+	vnc := mockvnc.Start(t, vncOpts)
+	if config.Target == "" && config.TokenResolver == nil {
+		config.Target = vnc.Addr()
+	}
+	if config.Logger == nil {
+		config.Logger = &websockify.NoOpLogger{}
+	}
+	proxy := websockify.New(config)
+	web := httptest.NewServer(proxy)
+	t.Cleanup(web.Close)
+
+	return &Chain{
+		VNC:   vnc,
+		Proxy: proxy,
+		URL:   "ws" + strings.TrimPrefix(web.URL, "http"),
+	}
+}
+
+// Connect connects a client to the VNC server through the proxy
+func (c *Chain) Connect(t testing.TB, opts vncclient.Options) *vncclient.Client {
+	t.Helper()
+	client, err := c.Dial(t, c.URL, opts)
+	if err != nil {
+		t.Fatalf("Connect() through %s error = %v", c.URL, err)
+	}
+	return client
+}
+
+// Dial connects a client to url, which may add a token or path to the
+// proxy's URL, and closes it when the test finishes
+func (c *Chain) Dial(t testing.TB, url string, opts vncclient.Options) (*vncclient.Client, error) {
+	t.Helper()
+	if opts.Logf == nil {
+		opts.Logf = t.Logf
+	}
+	client, err := vncclient.Connect(context.Background(), url, opts)
+	if err != nil {
+		return nil, err
+	}
+	t.Cleanup(func() { client.Close() })
+	return client, nil
+}
+
+// CheckFrame fails the test unless got has the pixels of a frame from
+// mockvnc.Server.Frame, which are BGRA, ignoring alpha
+func CheckFrame(t testing.TB, got *image.RGBA, bgra []byte) {
+	t.Helper()
+	if len(got.Pix) != len(bgra) {
+		t.Fatalf("Frame has %d bytes of pixels, want %d", len(got.Pix), len(bgra))
+	}
+	for i := 0; i < len(bgra); i += 4 {
+		p := got.Pix[i : i+4]
+		if p[0] != bgra[i+2] || p[1] != bgra[i+1] || p[2] != bgra[i] {
+			t.Fatalf("Pixel (%d, %d) = %v, want BGRA %v", i/4%got.Rect.Dx(), i/4/got.Rect.Dx(), p[:3], bgra[i:i+4])
+		}
+	}
+}
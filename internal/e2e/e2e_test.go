@@ -0,0 +1,93 @@
+package e2e
+
+import (
+	"context"
+	"errors"
+	"image"
+	"testing"
+
+	"github.com/coder/websockify"
+	"github.com/coder/websockify/mockvnc"
+	"github.com/coder/websockify/rfb"
+	"github.com/coder/websockify/vncclient"
+)
+
+func TestFramesThroughProxy(t *testing.T) {
+	// Every encoding the mock server can send
+	for _, enc := range rfb.SupportedEncodings() {
+		t.Run(rfb.EncodingName(enc), func(t *testing.T) {
+			chain := Start(t, mockvnc.Options{Width: 64, Height: 48, Animation: "testcard"}, websockify.Config{})
+			c := chain.Connect(t, vncclient.Options{Encodings: []int32{enc}})
+
+			// Two updates, so stateful decoders see more than one rectangle
+			for i := 0; i < 2; i++ {
+				frame, err := c.Screenshot(context.Background())
+				if err != nil {
+					t.Fatalf("Screenshot() error = %v", err)
+				}
+				if frame.Rect != image.Rect(0, 0, 64, 48) {
+					t.Fatalf("Screenshot() size = %v, want 64x48", frame.Rect)
+				}
+				CheckFrame(t, frame, chain.VNC.Frame(0))
+			}
+		})
+	}
+}
+
+func TestPasswordThroughProxy(t *testing.T) {
+	chain := Start(t, mockvnc.Options{Width: 16, Height: 16, Animation: "testcard", Password: "secret"}, websockify.Config{})
+
+	if _, err := chain.Dial(t, chain.URL, vncclient.Options{Password: "wrong"}); !errors.Is(err, vncclient.ErrAuthFailed) {
+		t.Errorf("Dial() with the wrong password error = %v, want %v", err, vncclient.ErrAuthFailed)
+	}
+	c := chain.Connect(t, vncclient.Options{Password: "secret"})
+	frame, err := c.Screenshot(context.Background())
+	if err != nil {
+		t.Fatalf("Screenshot() error = %v", err)
+	}
+	CheckFrame(t, frame, chain.VNC.Frame(0))
+}
+
+// tokens resolves tokens from a map
+type tokens map[string]string
+
+func (m tokens) Resolve(token string) (string, error) {
+	if target, ok := m[token]; ok {
+		return target, nil
+	}
+	return "", websockify.ErrUnknownToken
+}
+
+func TestTokenTargets(t *testing.T) {
+	desks := tokens{}
+	chain := Start(t, mockvnc.Options{Width: 16, Height: 16, Animation: "testcard", Name: "desk"}, websockify.Config{TokenResolver: desks})
+	desks["desk"] = chain.VNC.Addr()
+
+	c, err := chain.Dial(t, chain.URL+"/websockify?token=desk", vncclient.Options{})
+	if err != nil {
+		t.Fatalf("Dial() with a known token error = %v", err)
+	}
+	if c.Name() != "desk" {
+		t.Errorf("Name() = %q, want %q", c.Name(), "desk")
+	}
+	if _, err := chain.Dial(t, chain.URL+"/websockify?token=other", vncclient.Options{}); err == nil {
+		t.Error("Dial() with an unknown token succeeded, want it refused")
+	}
+}
+
+func TestProxyCountsSession(t *testing.T) {
+	chain := Start(t, mockvnc.Options{Width: 32, Height: 32, Animation: "testcard"}, websockify.Config{})
+	c := chain.Connect(t, vncclient.Options{Encodings: []int32{rfb.RawEncoding}})
+	if _, err := c.Screenshot(context.Background()); err != nil {
+		t.Fatalf("Screenshot() error = %v", err)
+	}
+
+	// At least the raw pixels of the frame came through the proxy
+	m := chain.Proxy.Metrics()
+	if m.Sessions != 1 || m.Connections != 1 || m.BytesToClient < 32*32*4 || m.BytesToTarget == 0 {
+		t.Errorf("Metrics() = %+v, want one session with the frame forwarded", m)
+	}
+	if sessions := chain.Proxy.Sessions(); len(sessions) != 1 || sessions[0].Target != chain.VNC.Addr() {
+		t.Errorf("Sessions() = %+v, want one session to %s", sessions, chain.VNC.Addr())
+	}
+}
@@ -0,0 +1,346 @@
+package websockify
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// jwksRefreshInterval is how often JWTAuth fetches its JWKS URL again at most,
+// when a token names a key it does not have.
+const jwksRefreshInterval = time.Minute
+
+// JWTAuth checks a JSON Web Token sent as an "Authorization: Bearer" header,
+// or, since browsers cannot set headers on WebSockets, as the access_token
+// query parameter or cookie. Tokens must be signed with HS256, RS256 or
+// ES256 (or their 384 and 512 bit variants) and be within their exp and nbf
+// times.
+type JWTAuth struct {
+	Secret    []byte           // HMAC key for HS* tokens
+	PublicKey crypto.PublicKey // RSA or ECDSA key for RS* and ES* tokens
+	JWKSURL   string           // Where to fetch keys, chosen by the token's kid
+
+	mutex   sync.Mutex
+	jwks    map[string]crypto.PublicKey
+	fetched time.Time
+	now     func() time.Time // For tests; time.Now if nil
+}
+
+// LoadJWTKey reads the key tokens are signed with from a file: a PEM public
+// key or certificate, or otherwise an HMAC secret.
+func LoadJWTKey(path string) (*JWTAuth, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWT key: %v", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		secret := []byte(strings.TrimSpace(string(data)))
+		if len(secret) == 0 {
+			return nil, fmt.Errorf("JWT key %s is empty", path)
+		}
+		return &JWTAuth{Secret: secret}, nil
+	}
+
+	switch block.Type {
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JWT certificate: %v", err)
+		}
+		return &JWTAuth{PublicKey: cert.PublicKey}, nil
+	case "RSA PUBLIC KEY":
+		key, err := x509.ParsePKCS1PublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JWT key: %v", err)
+		}
+		return &JWTAuth{PublicKey: key}, nil
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JWT key: %v", err)
+	}
+	return &JWTAuth{PublicKey: key}, nil
+}
+
+// Authenticate checks the request's token.
+func (a *JWTAuth) Authenticate(r *http.Request) error {
+	token := bearerToken(r)
+	if token == "" {
+		return fmt.Errorf("%w: no JWT", ErrUnauthorized)
+	}
+	if err := a.verify(token); err != nil {
+		return fmt.Errorf("%w: %v", ErrUnauthorized, err)
+	}
+	return nil
+}
+
+// Challenge tells clients to send a bearer token.
+func (a *JWTAuth) Challenge() string {
+	return "Bearer"
+}
+
+// bearerToken returns the token from the Authorization header, or the
+// access_token query parameter or cookie.
+func bearerToken(r *http.Request) string {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	if token := r.URL.Query().Get("access_token"); token != "" {
+		return token
+	}
+	if cookie, err := r.Cookie("access_token"); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+// verify checks a token's signature and times.
+func (a *JWTAuth) verify(token string) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return fmt.Errorf("malformed JWT")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return fmt.Errorf("invalid JWT header: %v", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return fmt.Errorf("invalid JWT signature: %v", err)
+	}
+	hash, err := jwtHash(header.Alg)
+	if err != nil {
+		return err
+	}
+	key, err := a.key(header.Alg, header.Kid)
+	if err != nil {
+		return err
+	}
+	if err := verifyJWTSignature(header.Alg, hash, key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return err
+	}
+
+	var claims struct {
+		Exp *float64 `json:"exp"`
+		Nbf *float64 `json:"nbf"`
+	}
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return fmt.Errorf("invalid JWT claims: %v", err)
+	}
+	now := time.Now
+	if a.now != nil {
+		now = a.now
+	}
+	t := float64(now().Unix())
+	if claims.Exp != nil && t >= *claims.Exp {
+		return fmt.Errorf("JWT expired")
+	}
+	if claims.Nbf != nil && t < *claims.Nbf {
+		return fmt.Errorf("JWT not valid yet")
+	}
+	return nil
+}
+
+// decodeJWTPart decodes a base64url JSON part of a token into v.
+func decodeJWTPart(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// jwtHash returns the hash of a signing algorithm.
+func jwtHash(alg string) (crypto.Hash, error) {
+	family, bits := alg[:min(len(alg), 2)], alg[min(len(alg), 2):]
+	if family == "HS" || family == "RS" || family == "ES" {
+		switch bits {
+		case "256":
+			return crypto.SHA256, nil
+		case "384":
+			return crypto.SHA384, nil
+		case "512":
+			return crypto.SHA512, nil
+		}
+	}
+	return 0, fmt.Errorf("unsupported JWT algorithm %q", alg)
+}
+
+// key returns the key for a token's algorithm and key ID.
+func (a *JWTAuth) key(alg, kid string) (interface{}, error) {
+	if strings.HasPrefix(alg, "HS") {
+		if a.Secret == nil {
+			return nil, fmt.Errorf("JWT algorithm %s needs a secret", alg)
+		}
+		return a.Secret, nil
+	}
+	if a.PublicKey != nil {
+		return a.PublicKey, nil
+	}
+	if a.JWKSURL == "" {
+		return nil, fmt.Errorf("JWT algorithm %s needs a public key", alg)
+	}
+	return a.jwksKey(kid)
+}
+
+// verifyJWTSignature checks signature over signed with key.
+func verifyJWTSignature(alg string, hash crypto.Hash, key interface{}, signed, signature []byte) error {
+	h := hash.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(hash.New, k)
+		mac.Write(signed)
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return fmt.Errorf("invalid JWT signature")
+		}
+		return nil
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(alg, "RS") {
+			break
+		}
+		if err := rsa.VerifyPKCS1v15(k, hash, digest, signature); err != nil {
+			return fmt.Errorf("invalid JWT signature")
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if !strings.HasPrefix(alg, "ES") || len(signature) != 2*size {
+			break
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return fmt.Errorf("invalid JWT signature")
+		}
+		return nil
+	}
+	return fmt.Errorf("JWT algorithm %s does not match the key", alg)
+}
+
+// jwksKey returns the key with ID kid from the JWKS URL, fetching the keys
+// when kid is not among them and they were not fetched recently.
+func (a *JWTAuth) jwksKey(kid string) (crypto.PublicKey, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if key, ok := a.jwks[kid]; ok {
+		return key, nil
+	}
+	if time.Since(a.fetched) < jwksRefreshInterval {
+		return nil, fmt.Errorf("unknown JWT key %q", kid)
+	}
+	keys, err := fetchJWKS(a.JWKSURL)
+	a.fetched = time.Now()
+	if err != nil {
+		return nil, err
+	}
+	a.jwks = keys
+	if key, ok := a.jwks[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown JWT key %q", kid)
+}
+
+// fetchJWKS fetches the RSA and EC keys of a JSON Web Key Set by key ID.
+func fetchJWKS(url string) (map[string]crypto.PublicKey, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch JWKS: %s", resp.Status)
+	}
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("invalid JWKS: %v", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, k := range set.Keys {
+		key, err := k.publicKey()
+		if err != nil {
+			continue // Skip keys of other types, such as symmetric ones
+		}
+		keys[k.Kid] = key
+	}
+	return keys, nil
+}
+
+// jsonWebKey is an RSA or EC public key in a JWKS.
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	number := func(s string) (*big.Int, error) {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil || len(b) == 0 {
+			return nil, fmt.Errorf("invalid key parameter %q", s)
+		}
+		return new(big.Int).SetBytes(b), nil
+	}
+
+	switch k.Kty {
+	case "RSA":
+		n, err := number(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := number(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := number(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := number(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
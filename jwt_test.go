@@ -0,0 +1,196 @@
+package websockify
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// signJWT returns a token with the given header and claims, signed with key
+func signJWT(t *testing.T, header, claims map[string]interface{}, key interface{}) string {
+	t.Helper()
+	part := func(v interface{}) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	signed := part(header) + "." + part(claims)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		var err error
+		signature, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func bearerRequest(token string) *http.Request {
+	r := httptest.NewRequest("GET", "/websockify", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	return r
+}
+
+func TestJWTAuth(t *testing.T) {
+	secret := []byte("shared secret")
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1700000000, 0)
+	valid := map[string]interface{}{"sub": "alice", "exp": now.Unix() + 60}
+
+	tests := []struct {
+		name   string
+		auth   *JWTAuth
+		header map[string]interface{}
+		claims map[string]interface{}
+		key    interface{}
+		want   bool
+	}{
+		{"HS256", &JWTAuth{Secret: secret}, map[string]interface{}{"alg": "HS256"}, valid, secret, true},
+		{"RS256", &JWTAuth{PublicKey: &rsaKey.PublicKey}, map[string]interface{}{"alg": "RS256"}, valid, rsaKey, true},
+		{"ES256", &JWTAuth{PublicKey: &ecKey.PublicKey}, map[string]interface{}{"alg": "ES256"}, valid, ecKey, true},
+		{"wrong secret", &JWTAuth{Secret: secret}, map[string]interface{}{"alg": "HS256"}, valid, []byte("guess"), false},
+		{"expired", &JWTAuth{Secret: secret}, map[string]interface{}{"alg": "HS256"}, map[string]interface{}{"exp": now.Unix() - 1}, secret, false},
+		{"not yet valid", &JWTAuth{Secret: secret}, map[string]interface{}{"alg": "HS256"}, map[string]interface{}{"nbf": now.Unix() + 60}, secret, false},
+		{"none", &JWTAuth{Secret: secret}, map[string]interface{}{"alg": "none"}, valid, secret, false},
+		// An HMAC signed with a public key must not pass for RS256
+		{"HS256 with public key", &JWTAuth{PublicKey: &rsaKey.PublicKey}, map[string]interface{}{"alg": "HS256"}, valid, secret, false},
+		{"RS256 with EC key", &JWTAuth{PublicKey: &ecKey.PublicKey}, map[string]interface{}{"alg": "RS256"}, valid, rsaKey, false},
+	}
+	for _, tt := range tests {
+		tt.auth.now = func() time.Time { return now }
+		token := signJWT(t, tt.header, tt.claims, tt.key)
+		if err := tt.auth.Authenticate(bearerRequest(token)); (err == nil) != tt.want {
+			t.Errorf("%s: Authenticate() = %v, want success %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestJWTAuthQueryAndCookie(t *testing.T) {
+	secret := []byte("shared secret")
+	auth := &JWTAuth{Secret: secret}
+	token := signJWT(t, map[string]interface{}{"alg": "HS256"}, map[string]interface{}{}, secret)
+
+	if err := auth.Authenticate(httptest.NewRequest("GET", "/websockify?access_token="+token, nil)); err != nil {
+		t.Errorf("Authenticate() with access_token parameter = %v", err)
+	}
+	r := httptest.NewRequest("GET", "/websockify", nil)
+	r.AddCookie(&http.Cookie{Name: "access_token", Value: token})
+	if err := auth.Authenticate(r); err != nil {
+		t.Errorf("Authenticate() with access_token cookie = %v", err)
+	}
+	if err := auth.Authenticate(httptest.NewRequest("GET", "/websockify", nil)); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("Authenticate() without a token = %v, want ErrUnauthorized", err)
+	}
+}
+
+func TestJWTAuthJWKS(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encode := func(n *big.Int) string { return base64.RawURLEncoding.EncodeToString(n.Bytes()) }
+	fetches := 0
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{
+			{"kty": "RSA", "kid": "rsa1", "n": encode(rsaKey.N), "e": encode(big.NewInt(int64(rsaKey.E)))},
+			{"kty": "EC", "kid": "ec1", "crv": "P-256", "x": encode(ecKey.X), "y": encode(ecKey.Y)},
+			{"kty": "oct", "kid": "sym", "k": "c2VjcmV0"},
+		}})
+	}))
+	defer jwks.Close()
+
+	auth := &JWTAuth{JWKSURL: jwks.URL}
+	rsaToken := signJWT(t, map[string]interface{}{"alg": "RS256", "kid": "rsa1"}, map[string]interface{}{}, rsaKey)
+	ecToken := signJWT(t, map[string]interface{}{"alg": "ES256", "kid": "ec1"}, map[string]interface{}{}, ecKey)
+	unknown := signJWT(t, map[string]interface{}{"alg": "RS256", "kid": "rsa2"}, map[string]interface{}{}, rsaKey)
+
+	if err := auth.Authenticate(bearerRequest(rsaToken)); err != nil {
+		t.Errorf("Authenticate() with RSA key = %v", err)
+	}
+	if err := auth.Authenticate(bearerRequest(ecToken)); err != nil {
+		t.Errorf("Authenticate() with EC key = %v", err)
+	}
+	if err := auth.Authenticate(bearerRequest(unknown)); err == nil {
+		t.Errorf("Authenticate() with unknown kid succeeded")
+	}
+	if fetches != 1 {
+		t.Errorf("JWKS fetched %d times, want once within jwksRefreshInterval", fetches)
+	}
+}
+
+func TestLoadJWTKey(t *testing.T) {
+	dir := t.TempDir()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pemFile := filepath.Join(dir, "key.pem")
+	os.WriteFile(pemFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o644)
+	secretFile := filepath.Join(dir, "secret")
+	os.WriteFile(secretFile, []byte("shared secret\n"), 0o600)
+
+	auth, err := LoadJWTKey(pemFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key, ok := auth.PublicKey.(*rsa.PublicKey); !ok || !key.Equal(&rsaKey.PublicKey) {
+		t.Errorf("LoadJWTKey(PEM) key = %T, want the RSA public key", auth.PublicKey)
+	}
+	auth, err = LoadJWTKey(secretFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(auth.Secret) != "shared secret" {
+		t.Errorf("LoadJWTKey(secret) = %q, want \"shared secret\"", auth.Secret)
+	}
+}
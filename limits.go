@@ -0,0 +1,86 @@
+package websockify
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Limits bound the connections a server proxies. Zero values mean no limit.
+type Limits struct {
+	MaxConnections      int           // Connections proxied at once
+	MaxConnectionsPerIP int           // Connections proxied at once from one client address
+	IdleTimeout         time.Duration // Close connections with no data either way for this long
+	SessionTimeout      time.Duration // Close connections once they have been open this long
+}
+
+// connLimiter counts the connections being proxied against Limits.
+type connLimiter struct {
+	limits Limits
+
+	mutex sync.Mutex
+	total int
+	perIP map[string]int
+}
+
+func newConnLimiter(limits Limits) *connLimiter {
+	return &connLimiter{limits: limits, perIP: make(map[string]int)}
+}
+
+// acquire counts a connection from ip, or returns the HTTP status to refuse
+// it with if that would exceed a limit.
+func (l *connLimiter) acquire(ip string) (int, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.limits.MaxConnections > 0 && l.total >= l.limits.MaxConnections {
+		return http.StatusServiceUnavailable, false
+	}
+	if l.limits.MaxConnectionsPerIP > 0 && l.perIP[ip] >= l.limits.MaxConnectionsPerIP {
+		return http.StatusTooManyRequests, false
+	}
+	l.total++
+	l.perIP[ip]++
+	return 0, true
+}
+
+// release stops counting a connection from ip.
+func (l *connLimiter) release(ip string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.total--
+	if l.perIP[ip]--; l.perIP[ip] <= 0 {
+		delete(l.perIP, ip)
+	}
+}
+
+// open returns how many connections are counted.
+func (l *connLimiter) open() int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.total
+}
+
+// clientIP returns the address a request came from, without its port.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// activity records when data last passed through a connection.
+type activity struct {
+	last atomic.Int64 // Unix nanoseconds
+}
+
+func (a *activity) touch() {
+	a.last.Store(time.Now().UnixNano())
+}
+
+// idleFor returns how long it has been since data last passed.
+func (a *activity) idleFor() time.Duration {
+	return time.Since(time.Unix(0, a.last.Load()))
+}
@@ -0,0 +1,171 @@
+package websockify
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestConnLimiter(t *testing.T) {
+	l := newConnLimiter(Limits{MaxConnections: 3, MaxConnectionsPerIP: 2})
+
+	steps := []struct {
+		ip         string
+		wantStatus int
+		wantOK     bool
+	}{
+		{"10.0.0.1", 0, true},
+		{"10.0.0.1", 0, true},
+		{"10.0.0.1", http.StatusTooManyRequests, false},
+		{"10.0.0.2", 0, true},
+		{"10.0.0.3", http.StatusServiceUnavailable, false},
+	}
+	for i, step := range steps {
+		status, ok := l.acquire(step.ip)
+		if status != step.wantStatus || ok != step.wantOK {
+			t.Errorf("step %d: acquire(%s) = %d, %v, want %d, %v", i, step.ip, status, ok, step.wantStatus, step.wantOK)
+		}
+	}
+
+	l.release("10.0.0.1")
+	if _, ok := l.acquire("10.0.0.3"); !ok {
+		t.Errorf("acquire() after release() refused, want accepted")
+	}
+	if len(l.perIP) != 3 {
+		t.Errorf("limiter tracks %d addresses, want 3", len(l.perIP))
+	}
+	l.release("10.0.0.2")
+	if _, ok := l.perIP["10.0.0.2"]; ok {
+		t.Errorf("limiter still tracks an address with no connections")
+	}
+}
+
+func TestConnLimiterUnlimited(t *testing.T) {
+	l := newConnLimiter(Limits{})
+	for i := 0; i < 100; i++ {
+		if _, ok := l.acquire("10.0.0.1"); !ok {
+			t.Fatalf("acquire() #%d refused with no limits", i)
+		}
+	}
+}
+
+// limitedServer serves a proxy to an echo listener at /echo with limits
+func limitedServer(t *testing.T, limits Limits) string {
+	t.Helper()
+	server := New(Config{Logger: &NoOpLogger{}, Limits: limits})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/echo", server.routeHandler(echoListener(t, "echo")))
+	web := httptest.NewServer(mux)
+	t.Cleanup(web.Close)
+	return web.URL
+}
+
+func dialEcho(t *testing.T, base string) (*websocket.Conn, *http.Response, error) {
+	t.Helper()
+	url := "ws" + strings.TrimPrefix(base, "http") + "/echo"
+	return websocket.DefaultDialer.Dial(url, http.Header{"Origin": {base}})
+}
+
+// echo sends ping and checks the reply
+func echo(t *testing.T, conn *websocket.Conn) {
+	t.Helper()
+	if err := conn.WriteMessage(websocket.BinaryMessage, []byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, reply, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(reply) != "echo:ping" {
+		t.Errorf("reply = %q, want echo:ping", reply)
+	}
+}
+
+func TestMaxConnectionsPerIP(t *testing.T) {
+	base := limitedServer(t, Limits{MaxConnectionsPerIP: 1})
+
+	first, _, err := dialEcho(t, base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, resp, err := dialEcho(t, base)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("second Dial() = %v, want 429 Too Many Requests", err)
+	}
+
+	first.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		conn, _, err := dialEcho(t, base)
+		if err == nil {
+			conn.Close()
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Dial() after closing the first connection = %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestIdleConnectionStaysOpen(t *testing.T) {
+	conn, _, err := dialEcho(t, limitedServer(t, Limits{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	echo(t, conn)
+	time.Sleep(300 * time.Millisecond)
+	echo(t, conn)
+}
+
+func TestIdleTimeout(t *testing.T) {
+	conn, _, err := dialEcho(t, limitedServer(t, Limits{IdleTimeout: 200 * time.Millisecond}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// Traffic keeps the connection open past the timeout
+	for i := 0; i < 4; i++ {
+		echo(t, conn)
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	start := time.Now()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, _, err := conn.ReadMessage(); err == nil {
+		t.Fatalf("ReadMessage() on an idle connection succeeded, want it closed")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("idle connection closed after %v, want about 200ms", elapsed)
+	}
+}
+
+func TestSessionTimeout(t *testing.T) {
+	conn, _, err := dialEcho(t, limitedServer(t, Limits{SessionTimeout: 300 * time.Millisecond}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	start := time.Now()
+	for time.Since(start) < 5*time.Second {
+		if err := conn.WriteMessage(websocket.BinaryMessage, []byte("ping")); err != nil {
+			break
+		}
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if _, _, err := conn.ReadMessage(); err != nil {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("busy session closed after %v, want about 300ms", elapsed)
+	}
+}
@@ -0,0 +1,536 @@
+package mockvnc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	// clockBarcodeBits is the number of cells in the clock's machine-readable
+	// strip: the frame number (32 bits) then the Unix time in milliseconds (48 bits)
+	clockBarcodeBits = 80
+)
+
+// AnimationGenerator produces a BGRA frame for the given frame number
+type AnimationGenerator func(frameNumber, width, height int) []byte
+
+// animation renders one frame; speed is the movement in pixels per frame for
+// animations with moving objects
+type animation func(frameNumber, width, height, speed int) []byte
+
+var (
+	animationsMutex sync.RWMutex
+	animationNames  = []string{"wheel", "waves", "plasma", "orbits", "gradient", "clock", "testcard", "noise", "ball"}
+	animations      = map[string]animation{
+		"wheel":    withoutSpeed(generateColorWheel),
+		"waves":    withoutSpeed(generateAlphaWaves),
+		"plasma":   withoutSpeed(generatePlasma),
+		"orbits":   withoutSpeed(generateOrbitingCircles),
+		"gradient": withoutSpeed(generateGradientSweep),
+		"clock":    withoutSpeed(generateClock),
+		"testcard": withoutSpeed(generateTestCard),
+		"noise":    withoutSpeed(generateNoise),
+		"ball":     generateBouncingBall,
+	}
+)
+
+// withoutSpeed adapts a generator that has nothing moving at a set speed
+func withoutSpeed(gen AnimationGenerator) animation {
+	return func(frameNumber, width, height, _ int) []byte {
+		return gen(frameNumber, width, height)
+	}
+}
+
+// RegisterAnimation makes gen available under name wherever a built-in
+// animation can be chosen: Options.Animation, scenario events, SetAnimation
+// and the vncserver -animation flag. gen may be called from several
+// goroutines at once and should return width*height*4 bytes; frames of
+// another length are cropped or padded with black.
+func RegisterAnimation(name string, gen AnimationGenerator) error {
+	if name == "" || gen == nil {
+		return fmt.Errorf("animation needs a name and a generator")
+	}
+
+	animationsMutex.Lock()
+	defer animationsMutex.Unlock()
+	if _, ok := animations[name]; ok {
+		return fmt.Errorf("animation %q is already registered", name)
+	}
+	animations[name] = withoutSpeed(gen)
+	animationNames = append(animationNames, name)
+	return nil
+}
+
+// AnimationNames returns the built-in animations followed by registered ones
+// in the order they were registered
+func AnimationNames() []string {
+	animationsMutex.RLock()
+	defer animationsMutex.RUnlock()
+	return slices.Clone(animationNames)
+}
+
+// generateAnimationFrame renders one frame of the named animation, falling
+// back to the color wheel for unknown names
+func generateAnimationFrame(animationType string, frameNumber, width, height, speed int) []byte {
+	animationsMutex.RLock()
+	gen, ok := animations[animationType]
+	if !ok {
+		gen = animations["wheel"]
+	}
+	animationsMutex.RUnlock()
+
+	frame := gen(frameNumber, width, height, speed)
+	if len(frame) != width*height*4 {
+		fitted := make([]byte, width*height*4)
+		copy(fitted, frame)
+		frame = fitted
+	}
+	return frame
+}
+
+func generateColorWheel(frameNumber, width, height int) []byte {
+	pixelData := make([]byte, width*height*4)
+	centerX := float64(width) / 2
+	centerY := float64(height) / 2
+	maxRadius := math.Min(centerX, centerY) * 0.8
+
+	// Rotation based on frame number (360 degrees over 120 frames = 3 seconds at 30fps)
+	rotation := float64(frameNumber) * 2 * math.Pi / 120
+
+	for i := 0; i < len(pixelData); i += 4 {
+		pixel := i / 4
+		row := pixel / width
+		col := pixel % width
+
+		// Calculate distance from center and angle
+		dx := float64(col) - centerX
+		dy := float64(row) - centerY
+		distance := math.Sqrt(dx*dx + dy*dy)
+		angle := math.Atan2(dy, dx) + rotation
+
+		if distance <= maxRadius {
+			// Convert angle to hue (0-360 degrees)
+			hue := angle * 180 / math.Pi
+			if hue < 0 {
+				hue += 360
+			}
+
+			// Create saturation gradient from center to edge
+			saturation := distance / maxRadius
+
+			// Create alpha gradient (more transparent towards edge)
+			alpha := 1.0 - (distance/maxRadius)*0.7
+
+			// Convert HSV to RGB
+			r, g, b := hsvToRgb(hue, saturation, 1.0)
+
+			pixelData[i] = uint8(b * 255)       // blue
+			pixelData[i+1] = uint8(g * 255)     // green
+			pixelData[i+2] = uint8(r * 255)     // red
+			pixelData[i+3] = uint8(alpha * 255) // alpha
+		} else {
+			// Transparent outside the wheel
+			pixelData[i] = 0
+			pixelData[i+1] = 0
+			pixelData[i+2] = 0
+			pixelData[i+3] = 0
+		}
+	}
+
+	return pixelData
+}
+
+func generateAlphaWaves(frameNumber, width, height int) []byte {
+	pixelData := make([]byte, width*height*4)
+
+	// Wave parameters
+	timeOffset := float64(frameNumber) * 0.1
+
+	for i := 0; i < len(pixelData); i += 4 {
+		pixel := i / 4
+		row := pixel / width
+		col := pixel % width
+
+		// Create multiple wave patterns
+		x := float64(col) / float64(width) * 4 * math.Pi
+		y := float64(row) / float64(height) * 3 * math.Pi
+
+		// Combine multiple sine waves for complex patterns
+		wave1 := math.Sin(x + timeOffset)
+		wave2 := math.Sin(y + timeOffset*1.3)
+		wave3 := math.Sin((x+y)*0.5 + timeOffset*0.7)
+
+		// Create RGB values based on waves
+		r := (wave1 + 1) / 2
+		g := (wave2 + 1) / 2
+		b := (wave3 + 1) / 2
+
+		// Create alpha based on wave interference
+		alpha := (wave1*wave2 + 1) / 2
+		alpha = math.Max(0.1, alpha) // Minimum 10% alpha
+
+		pixelData[i] = uint8(b * 255)       // blue
+		pixelData[i+1] = uint8(g * 255)     // green
+		pixelData[i+2] = uint8(r * 255)     // red
+		pixelData[i+3] = uint8(alpha * 255) // alpha
+	}
+
+	return pixelData
+}
+
+func generatePlasma(frameNumber, width, height int) []byte {
+	pixelData := make([]byte, width*height*4)
+
+	time := float64(frameNumber) * 0.05
+
+	for i := 0; i < len(pixelData); i += 4 {
+		pixel := i / 4
+		row := pixel / width
+		col := pixel % width
+
+		x := float64(col) / float64(width)
+		y := float64(row) / float64(height)
+
+		// Classic plasma effect
+		v1 := math.Sin(x*10 + time)
+		v2 := math.Sin(y*10 + time*1.2)
+		v3 := math.Sin((x+y)*10 + time*0.8)
+		v4 := math.Sin(math.Sqrt(x*x+y*y)*10 + time*1.5)
+
+		plasma := (v1 + v2 + v3 + v4) / 4
+
+		// Convert plasma value to color
+		hue := (plasma + 1) * 180 // 0-360 degrees
+		saturation := 0.8
+		brightness := 0.9
+
+		r, g, b := hsvToRgb(hue, saturation, brightness)
+
+		// Alpha varies with plasma intensity
+		alpha := (math.Abs(plasma) + 0.3) * 0.9
+
+		pixelData[i] = uint8(b * 255)       // blue
+		pixelData[i+1] = uint8(g * 255)     // green
+		pixelData[i+2] = uint8(r * 255)     // red
+		pixelData[i+3] = uint8(alpha * 255) // alpha
+	}
+
+	return pixelData
+}
+
+func generateOrbitingCircles(frameNumber, width, height int) []byte {
+	pixelData := make([]byte, width*height*4)
+
+	// Clear background (transparent)
+	for i := 0; i < len(pixelData); i += 4 {
+		pixelData[i+3] = 0 // alpha = 0 (transparent)
+	}
+
+	centerX := float64(width) / 2
+	centerY := float64(height) / 2
+	orbitRadius := math.Min(centerX, centerY) * 0.6
+
+	// Multiple orbiting circles
+	numCircles := 5
+	time := float64(frameNumber) * 0.1
+
+	for c := 0; c < numCircles; c++ {
+		// Each circle has different orbit speed and phase
+		phase := float64(c) * 2 * math.Pi / float64(numCircles)
+		speed := 1.0 + float64(c)*0.3
+		angle := time*speed + phase
+
+		// Circle position
+		circleX := centerX + math.Cos(angle)*orbitRadius
+		circleY := centerY + math.Sin(angle)*orbitRadius
+		circleRadius := 30.0 + float64(c)*10
+
+		// Circle color (different hue for each circle)
+		hue := float64(c) * 360 / float64(numCircles)
+		r, g, b := hsvToRgb(hue, 0.8, 0.9)
+
+		// Draw circle
+		for i := 0; i < len(pixelData); i += 4 {
+			pixel := i / 4
+			row := pixel / width
+			col := pixel % width
+
+			dx := float64(col) - circleX
+			dy := float64(row) - circleY
+			distance := math.Sqrt(dx*dx + dy*dy)
+
+			if distance <= circleRadius {
+				// Soft edge with alpha falloff
+				alpha := 1.0 - (distance/circleRadius)*0.7
+				alpha = math.Max(0, alpha)
+
+				// Blend with existing pixel (additive blending)
+				existingAlpha := float64(pixelData[i+3]) / 255.0
+				newAlpha := alpha + existingAlpha*(1-alpha)
+
+				if newAlpha > 0 {
+					// Blend colors
+					blendR := (r*alpha + (float64(pixelData[i+2])/255.0)*existingAlpha) / newAlpha
+					blendG := (g*alpha + (float64(pixelData[i+1])/255.0)*existingAlpha) / newAlpha
+					blendB := (b*alpha + (float64(pixelData[i])/255.0)*existingAlpha) / newAlpha
+
+					pixelData[i] = uint8(blendB * 255)     // blue
+					pixelData[i+1] = uint8(blendG * 255)   // green
+					pixelData[i+2] = uint8(blendR * 255)   // red
+					pixelData[i+3] = uint8(newAlpha * 255) // alpha
+				}
+			}
+		}
+	}
+
+	return pixelData
+}
+
+func generateGradientSweep(frameNumber, width, height int) []byte {
+	pixelData := make([]byte, width*height*4)
+
+	// Rotating gradient
+	rotation := float64(frameNumber) * 2 * math.Pi / 90 // 3-second rotation at 30fps
+
+	centerX := float64(width) / 2
+	centerY := float64(height) / 2
+
+	for i := 0; i < len(pixelData); i += 4 {
+		pixel := i / 4
+		row := pixel / width
+		col := pixel % width
+
+		// Calculate angle from center
+		dx := float64(col) - centerX
+		dy := float64(row) - centerY
+		angle := math.Atan2(dy, dx) + rotation
+
+		// Normalize angle to 0-1
+		normalizedAngle := (angle + math.Pi) / (2 * math.Pi)
+		normalizedAngle = normalizedAngle - math.Floor(normalizedAngle) // Keep in 0-1 range
+
+		// Create gradient colors
+		hue := normalizedAngle * 360
+		r, g, b := hsvToRgb(hue, 0.9, 0.8)
+
+		// Distance-based alpha
+		distance := math.Sqrt(dx*dx + dy*dy)
+		maxDistance := math.Sqrt(centerX*centerX + centerY*centerY)
+		alpha := 0.3 + 0.7*(1.0-distance/maxDistance) // More opaque in center
+
+		pixelData[i] = uint8(b * 255)       // blue
+		pixelData[i+1] = uint8(g * 255)     // green
+		pixelData[i+2] = uint8(r * 255)     // red
+		pixelData[i+3] = uint8(alpha * 255) // alpha
+	}
+
+	return pixelData
+}
+
+// generateClock renders the current time and frame number as large text, with a
+// barcode strip along the bottom edge so captured frames can be decoded
+// programmatically to measure latency and spot dropped or repeated frames
+func generateClock(frameNumber, width, height int) []byte {
+	return renderClock(time.Now(), frameNumber, width, height)
+}
+
+func renderClock(now time.Time, frameNumber, width, height int) []byte {
+	pixelData := make([]byte, width*height*4)
+	fillRect(pixelData, width, height, 0, 0, width, height, 24, 24, 32)
+
+	lines := []string{
+		now.Format("15:04:05.000"),
+		fmt.Sprintf("FRAME %06d", frameNumber),
+	}
+
+	// Scale the text to fill most of the width while leaving room for the strip
+	barHeight := max(height/20, 1)
+	scale := max(min(width*9/10/textWidth(lines[0], 1), (height-barHeight)*6/10/(len(lines)*lineAdvance)), 1)
+
+	textHeight := len(lines) * lineAdvance * scale
+	y := (height - barHeight - textHeight) / 2
+	for _, line := range lines {
+		x := (width - textWidth(line, scale)) / 2
+		drawText(pixelData, width, height, x, y, scale, line, 255, 255, 255)
+		y += lineAdvance * scale
+	}
+
+	// Barcode strip: one cell per bit, most significant first, white for 1
+	frameBits := uint64(uint32(frameNumber))
+	timeBits := uint64(now.UnixMilli()) & (1<<48 - 1)
+	cellWidth := max(width/clockBarcodeBits, 1)
+	for bit := 0; bit < clockBarcodeBits; bit++ {
+		var value uint64
+		if bit < 32 {
+			value = frameBits >> (31 - bit) & 1
+		} else {
+			value = timeBits >> (clockBarcodeBits - 1 - bit) & 1
+		}
+		level := uint8(value * 255)
+		fillRect(pixelData, width, height, bit*cellWidth, height-barHeight, cellWidth, barHeight, level, level, level)
+	}
+
+	return pixelData
+}
+
+// Test card colours: 100% bars so every channel is either 0 or its maximum,
+// which any true-colour pixel format represents exactly
+var (
+	testCardBars = [7][3]uint8{
+		{255, 255, 255}, // white
+		{255, 255, 0},   // yellow
+		{0, 255, 255},   // cyan
+		{0, 255, 0},     // green
+		{255, 0, 255},   // magenta
+		{255, 0, 0},     // red
+		{0, 0, 255},     // blue
+	}
+	testCardReverseBars = [7][3]uint8{
+		{0, 0, 255},     // blue
+		{0, 0, 0},       // black
+		{255, 0, 255},   // magenta
+		{0, 0, 0},       // black
+		{0, 255, 255},   // cyan
+		{0, 0, 0},       // black
+		{255, 255, 255}, // white
+	}
+)
+
+// generateTestCard draws a static SMPTE-style test card with known values at
+// known coordinates: colour bars, reverse bars, a 16-step grey scale and a
+// 16-pixel grid. The layout is documented in docs/vncserver.md.
+func generateTestCard(frameNumber, width, height int) []byte {
+	pixelData := make([]byte, width*height*4)
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			r, g, b := testCardColor(x, y, width, height)
+			i := (y*width + x) * 4
+			pixelData[i] = b
+			pixelData[i+1] = g
+			pixelData[i+2] = r
+			pixelData[i+3] = 255
+		}
+	}
+
+	return pixelData
+}
+
+// testCardColor returns the test card colour at (x, y)
+func testCardColor(x, y, width, height int) (r, g, b uint8) {
+	switch {
+	case y < height*7/12:
+		c := testCardBars[x*7/width]
+		return c[0], c[1], c[2]
+	case y < height*8/12:
+		c := testCardReverseBars[x*7/width]
+		return c[0], c[1], c[2]
+	case y < height*10/12:
+		// Grey steps 0, 17, 34, ... 255
+		level := uint8(x * 16 / width * 17)
+		return level, level, level
+	default:
+		if x%16 == 0 || y%16 == 0 {
+			return 255, 255, 255
+		}
+		return 0, 0, 0
+	}
+}
+
+// generateNoise fills every pixel with random colour so no encoding can
+// compress it, giving a worst-case bandwidth workload. Each frame is seeded
+// from its frame number, so runs are repeatable.
+func generateNoise(frameNumber, width, height int) []byte {
+	var seed [32]byte
+	binary.LittleEndian.PutUint64(seed[:], uint64(frameNumber))
+	pixelData := make([]byte, width*height*4)
+	rand.NewChaCha8(seed).Read(pixelData)
+
+	for i := 3; i < len(pixelData); i += 4 {
+		pixelData[i] = 255
+	}
+	return pixelData
+}
+
+// generateBouncingBall draws a ball moving diagonally across a plain
+// background and bouncing off the edges. The ball looks the same in every
+// frame and only its position changes, so each frame differs from the last
+// in a small region: the workload incremental updates and CopyRect are for.
+func generateBouncingBall(frameNumber, width, height, speed int) []byte {
+	pixelData := make([]byte, width*height*4)
+	fillRect(pixelData, width, height, 0, 0, width, height, 16, 32, 64)
+
+	radius := max(min(width, height)/16, 4)
+	size := 2 * radius
+	x := bounce(frameNumber*speed, width-size)
+	y := bounce(frameNumber*speed*3/4, height-size)
+
+	for dy := 0; dy < size; dy++ {
+		for dx := 0; dx < size; dx++ {
+			// Distance from the centre of the pixel to the centre of the ball
+			fx := float64(dx) + 0.5 - float64(radius)
+			fy := float64(dy) + 0.5 - float64(radius)
+			distance := math.Sqrt(fx*fx + fy*fy)
+			if distance > float64(radius) {
+				continue
+			}
+
+			// Shade towards the edge, with a highlight up and to the left
+			hx := fx + float64(radius)/3
+			hy := fy + float64(radius)/3
+			light := 1 - math.Sqrt(hx*hx+hy*hy)/(2*float64(radius))
+			fillRect(pixelData, width, height, x+dx, y+dy, 1, 1,
+				uint8(255*light), uint8(140*light), uint8(32*light))
+		}
+	}
+
+	return pixelData
+}
+
+// bounce maps a distance travelled onto a position in [0, span] that
+// reflects off both ends
+func bounce(distance, span int) int {
+	if span <= 0 {
+		return 0
+	}
+	distance %= 2 * span
+	if distance < 0 {
+		distance += 2 * span
+	}
+	if distance > span {
+		return 2*span - distance
+	}
+	return distance
+}
+
+// HSV to RGB conversion
+func hsvToRgb(h, s, v float64) (float64, float64, float64) {
+	h = math.Mod(h, 360) / 60
+	c := v * s
+	x := c * (1 - math.Abs(math.Mod(h, 2)-1))
+	m := v - c
+
+	var r, g, b float64
+
+	switch int(h) {
+	case 0:
+		r, g, b = c, x, 0
+	case 1:
+		r, g, b = x, c, 0
+	case 2:
+		r, g, b = 0, c, x
+	case 3:
+		r, g, b = 0, x, c
+	case 4:
+		r, g, b = x, 0, c
+	default:
+		r, g, b = c, 0, x
+	}
+
+	return r + m, g + m, b + m
+}
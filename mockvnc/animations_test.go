@@ -0,0 +1,72 @@
+package mockvnc
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+)
+
+// solid-red is registered once per test binary, so tests stay repeatable with -count
+func init() {
+	if err := RegisterAnimation("solid-red", func(frameNumber, width, height int) []byte {
+		return bytes.Repeat([]byte{0, 0, 255, 255}, width*height)
+	}); err != nil {
+		panic(err)
+	}
+}
+
+func TestAnimationsRender(t *testing.T) {
+	for _, name := range AnimationNames() {
+		t.Run(name, func(t *testing.T) {
+			frame := generateAnimationFrame(name, 7, 33, 17, DefaultSpeed)
+			if len(frame) != 33*17*4 {
+				t.Errorf("Frame length = %d, want %d", len(frame), 33*17*4)
+			}
+		})
+	}
+}
+
+func TestRegisterAnimation(t *testing.T) {
+	if names := AnimationNames(); names[len(names)-1] != "solid-red" {
+		t.Errorf("AnimationNames() = %v, want solid-red last", names)
+	}
+
+	s := Start(t, Options{Width: 4, Height: 2, Animation: "solid-red"})
+	if got, want := s.Frame(3), bytes.Repeat([]byte{0, 0, 255, 255}, 8); !bytes.Equal(got, want) {
+		t.Errorf("Frame() = %v, want %v", got, want)
+	}
+
+	tests := []struct {
+		name string
+		gen  AnimationGenerator
+	}{
+		{"solid-red", func(int, int, int) []byte { return nil }},
+		{"wheel", func(int, int, int) []byte { return nil }},
+		{"", func(int, int, int) []byte { return nil }},
+		{"no-generator", nil},
+	}
+	for _, tt := range tests {
+		if err := RegisterAnimation(tt.name, tt.gen); err == nil {
+			t.Errorf("RegisterAnimation(%q) expected error, but got none", tt.name)
+		}
+	}
+	if slices.Contains(AnimationNames(), "no-generator") {
+		t.Error("Failed registration was added to AnimationNames()")
+	}
+}
+
+func TestAnimationWrongSize(t *testing.T) {
+	animationsMutex.Lock()
+	animations["short"] = withoutSpeed(func(int, int, int) []byte { return []byte{1, 2, 3, 4} })
+	animationsMutex.Unlock()
+	defer func() {
+		animationsMutex.Lock()
+		delete(animations, "short")
+		animationsMutex.Unlock()
+	}()
+
+	frame := generateAnimationFrame("short", 0, 2, 2, DefaultSpeed)
+	if want := []byte{1, 2, 3, 4, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}; !bytes.Equal(frame, want) {
+		t.Errorf("generateAnimationFrame() = %v, want %v", frame, want)
+	}
+}
@@ -0,0 +1,83 @@
+package mockvnc
+
+import (
+	"fmt"
+	"math/rand/v2"
+)
+
+// Faults that Options.ChaosRate can inject into framebuffer updates
+const (
+	FaultTruncate   = "truncate"   // Cut the update short, leaving the stream out of sync
+	FaultBogusType  = "bogus-type" // Send a message with an undefined type before the update
+	FaultDisconnect = "disconnect" // Send part of the update, then close the connection
+	FaultRectCount  = "rect-count" // Claim an absurd number of rectangles
+)
+
+// Faults lists every fault in the order they are documented
+var Faults = []string{FaultTruncate, FaultBogusType, FaultDisconnect, FaultRectCount}
+
+// chaos injects protocol violations into a connection's updates at random
+type chaos struct {
+	rate   float64
+	faults []string
+	rng    *rand.Rand
+}
+
+func newChaos(rate float64, faults []string, seed uint64) *chaos {
+	return &chaos{
+		rate:   rate,
+		faults: faults,
+		rng:    rand.New(rand.NewPCG(seed, 1)),
+	}
+}
+
+// corrupt decides whether to inject a fault into an encoded FramebufferUpdate.
+// It returns the bytes to send instead, the fault chosen ("" for none) and
+// whether the connection should be closed once they are sent.
+func (ch *chaos) corrupt(update []byte) (out []byte, fault string, disconnect bool) {
+	if ch.rng.Float64() >= ch.rate {
+		return update, "", false
+	}
+
+	fault = ch.faults[ch.rng.IntN(len(ch.faults))]
+	switch fault {
+	case FaultTruncate:
+		// Keep the header and at least one byte, but never the whole update
+		return update[:5+ch.rng.IntN(max(len(update)-5, 1))], fault, false
+
+	case FaultBogusType:
+		// Types 4-126 are unassigned server-to-client messages
+		bogus := []byte{byte(4 + ch.rng.IntN(123)), byte(ch.rng.Uint32()), byte(ch.rng.Uint32()), byte(ch.rng.Uint32())}
+		return append(bogus, update...), fault, false
+
+	case FaultDisconnect:
+		return update[:ch.rng.IntN(len(update))], fault, true
+
+	default: // FaultRectCount
+		out = append([]byte(nil), update...)
+		out[2], out[3] = 0xFF, 0xFF
+		return out, fault, false
+	}
+}
+
+// writeUpdate sends an encoded FramebufferUpdate, passing it through chaos
+// first when enabled. Callers must hold c.mutex.
+func (c *connection) writeUpdate(update []byte) error {
+	if c.chaos != nil {
+		out, fault, disconnect := c.chaos.corrupt(update)
+		if fault != "" {
+			c.logf("Chaos: injecting %s fault (%d of %d bytes)", fault, len(out), len(update))
+		}
+		if _, err := c.conn.Write(out); err != nil {
+			return err
+		}
+		if disconnect {
+			c.conn.Close()
+			return fmt.Errorf("chaos disconnect")
+		}
+		return nil
+	}
+
+	_, err := c.conn.Write(update)
+	return err
+}
@@ -0,0 +1,43 @@
+package mockvnc
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/coder/websockify/rfb"
+)
+
+func TestChaosCorrupt(t *testing.T) {
+	update := append(rfb.CreateFramebufferUpdateHeader(1), make([]byte, 12+64)...)
+
+	tests := []struct {
+		fault      string
+		disconnect bool
+		check      func(out []byte) bool
+	}{
+		{FaultTruncate, false, func(out []byte) bool { return len(out) >= 5 && len(out) < len(update) }},
+		{FaultBogusType, false, func(out []byte) bool { return out[0] >= 4 && out[0] <= 126 && bytes.Equal(out[4:], update) }},
+		{FaultDisconnect, true, func(out []byte) bool { return len(out) < len(update) }},
+		{FaultRectCount, false, func(out []byte) bool { return out[2] == 0xFF && out[3] == 0xFF && len(out) == len(update) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fault, func(t *testing.T) {
+			ch := newChaos(1, []string{tt.fault}, 1)
+			out, fault, disconnect := ch.corrupt(update)
+			if fault != tt.fault || disconnect != tt.disconnect {
+				t.Errorf("corrupt() fault = %q, disconnect = %v, want %q, %v", fault, disconnect, tt.fault, tt.disconnect)
+			}
+			if !tt.check(out) {
+				t.Errorf("corrupt() output %v does not match a %s fault", out[:min(len(out), 8)], tt.fault)
+			}
+		})
+	}
+
+	if update[3] != 1 {
+		t.Error("corrupt() modified the original update")
+	}
+	if out, fault, _ := newChaos(0, Faults, 1).corrupt(update); fault != "" || !bytes.Equal(out, update) {
+		t.Error("corrupt() with rate 0 should leave the update unchanged")
+	}
+}
@@ -0,0 +1,60 @@
+package mockvnc
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/coder/websockify/rfb"
+)
+
+// clipboardTransforms maps ClipboardEcho modes to the change made to the
+// client's text before it is sent back
+var clipboardTransforms = map[string]func(string) string{
+	"echo":    func(text string) string { return text },
+	"upper":   strings.ToUpper,
+	"reverse": reverseString,
+}
+
+// handleClientCutText logs the client's clipboard and, with ClipboardEcho,
+// sends it back transformed as ServerCutText
+func (c *connection) handleClientCutText(data []byte) error {
+	text, err := rfb.ParseClientCutText(data)
+	if err != nil {
+		return err
+	}
+	c.logf("Received ClientCutText: %q", text)
+
+	transform, ok := clipboardTransforms[c.server.opts.ClipboardEcho]
+	if !ok {
+		return nil
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.sendServerCutText(transform(text))
+}
+
+// sendPeriodicClipboard sends a numbered ServerCutText for ClipboardInterval.
+// Callers must hold c.mutex.
+func (c *connection) sendPeriodicClipboard() {
+	c.clipboardCount++
+	c.sendServerCutText(fmt.Sprintf("vncserver clipboard #%d", c.clipboardCount))
+}
+
+// sendServerCutText sends text to the client's clipboard. Callers must hold c.mutex.
+func (c *connection) sendServerCutText(text string) error {
+	if _, err := c.conn.Write(rfb.CreateServerCutText(text)); err != nil {
+		return fmt.Errorf("failed to send ServerCutText: %v", err)
+	}
+	c.logf("Sent ServerCutText: %q", text)
+	return nil
+}
+
+// reverseString reverses text by character
+func reverseString(text string) string {
+	runes := []rune(text)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
@@ -0,0 +1,62 @@
+package mockvnc
+
+import (
+	"slices"
+
+	"github.com/coder/websockify/rfb"
+)
+
+// announceContinuousUpdates tells a client that lists the ContinuousUpdates
+// pseudo-encoding that the server supports it, the first time it does.
+// Callers must hold c.mutex.
+func (c *connection) announceContinuousUpdates() {
+	if c.continuousAnnounced || !slices.Contains(c.encodings, rfb.ContinuousUpdatesEncoding) {
+		return
+	}
+	c.continuousAnnounced = true
+	c.sendEndOfContinuousUpdates()
+}
+
+// handleEnableContinuousUpdates starts or stops streaming the client's region
+// at the configured frame rate, as in push mode. Stopping is confirmed with
+// EndOfContinuousUpdates.
+func (c *connection) handleEnableContinuousUpdates(data []byte) error {
+	msg, err := rfb.ParseEnableContinuousUpdates(data)
+	if err != nil {
+		return err
+	}
+	c.logf("Received EnableContinuousUpdates: enable=%v %dx%d at (%d,%d)",
+		msg.Enable, msg.Width, msg.Height, msg.X, msg.Y)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if !c.continuousAnnounced {
+		// The protocol forbids the message before EndOfContinuousUpdates
+		c.logf("Ignoring EnableContinuousUpdates from a client that did not list the ContinuousUpdates pseudo-encoding")
+		return nil
+	}
+	if !msg.Enable {
+		c.continuousUpdates = false
+		c.sendEndOfContinuousUpdates()
+		return nil
+	}
+
+	c.continuousUpdates = true
+	c.pushRegion = msg.Rectangle
+	if !c.pushing {
+		c.pushing = true
+		c.logf("Starting continuous updates to %s at %d FPS", c.conn.RemoteAddr(), c.server.opts.FPS)
+		go c.pushFrames()
+	}
+	return nil
+}
+
+// sendEndOfContinuousUpdates sends EndOfContinuousUpdates. Callers must hold c.mutex.
+func (c *connection) sendEndOfContinuousUpdates() {
+	if _, err := c.conn.Write(rfb.CreateEndOfContinuousUpdates()); err != nil {
+		c.logf("Failed to send EndOfContinuousUpdates: %v", err)
+		return
+	}
+	c.logf("Sent EndOfContinuousUpdates")
+}
@@ -0,0 +1,99 @@
+package mockvnc
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/coder/websockify/rfb"
+)
+
+// readRawUpdate reads the rest of a FramebufferUpdate of Raw rectangles in the default pixel format
+func readRawUpdate(t *testing.T, conn net.Conn) {
+	t.Helper()
+	header := make([]byte, 3)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		t.Fatalf("Reading update header error = %v", err)
+	}
+	for range binary.BigEndian.Uint16(header[1:]) {
+		rect := make([]byte, rfb.RectangleHeaderLength)
+		if _, err := io.ReadFull(conn, rect); err != nil {
+			t.Fatalf("Reading rectangle header error = %v", err)
+		}
+		width, height := binary.BigEndian.Uint16(rect[4:]), binary.BigEndian.Uint16(rect[6:])
+		if _, err := io.CopyN(io.Discard, conn, int64(width)*int64(height)*4); err != nil {
+			t.Fatalf("Reading pixels error = %v", err)
+		}
+	}
+}
+
+func TestContinuousUpdates(t *testing.T) {
+	s := Start(t, Options{Width: 16, Height: 16, Animation: "plasma", FPS: 50})
+	conn, _ := dialClient(t, s)
+	screen := rfb.Rectangle{Width: 16, Height: 16}
+
+	conn.Write(rfb.CreateSetEncodings([]int32{rfb.RawEncoding, rfb.ContinuousUpdatesEncoding}))
+	msgType := make([]byte, 1)
+	if _, err := io.ReadFull(conn, msgType); err != nil || msgType[0] != rfb.EndOfContinuousUpdates {
+		t.Fatalf("First message = %v, %v, want EndOfContinuousUpdates", msgType, err)
+	}
+
+	// Updates arrive without any FramebufferUpdateRequest
+	conn.Write(rfb.CreateEnableContinuousUpdates(true, screen))
+	for i := 0; i < 3; i++ {
+		if _, err := io.ReadFull(conn, msgType); err != nil || msgType[0] != rfb.FramebufferUpdate {
+			t.Fatalf("Message %d = %v, %v, want FramebufferUpdate", i, msgType, err)
+		}
+		readRawUpdate(t, conn)
+	}
+
+	// Disabling is confirmed once the updates already on their way are read
+	conn.Write(rfb.CreateEnableContinuousUpdates(false, screen))
+	for {
+		if _, err := io.ReadFull(conn, msgType); err != nil {
+			t.Fatalf("Reading message type error = %v", err)
+		}
+		if msgType[0] == rfb.EndOfContinuousUpdates {
+			break
+		}
+		if msgType[0] != rfb.FramebufferUpdate {
+			t.Fatalf("Message type = %d, want FramebufferUpdate or EndOfContinuousUpdates", msgType[0])
+		}
+		readRawUpdate(t, conn)
+	}
+}
+
+func TestContinuousUpdatesOutlastIdleTimeout(t *testing.T) {
+	defer func(timeout time.Duration) { idleTimeout = timeout }(idleTimeout)
+	idleTimeout = 100 * time.Millisecond
+
+	s := Start(t, Options{Width: 16, Height: 16, Animation: "plasma", FPS: 50})
+	idle, _ := dialClient(t, s)
+	conn, _ := dialClient(t, s)
+	screen := rfb.Rectangle{Width: 16, Height: 16}
+
+	conn.Write(rfb.CreateSetEncodings([]int32{rfb.RawEncoding, rfb.ContinuousUpdatesEncoding}))
+	msgType := make([]byte, 1)
+	if _, err := io.ReadFull(conn, msgType); err != nil || msgType[0] != rfb.EndOfContinuousUpdates {
+		t.Fatalf("First message = %v, %v, want EndOfContinuousUpdates", msgType, err)
+	}
+	conn.Write(rfb.CreateEnableContinuousUpdates(true, screen))
+
+	// A watching client sends nothing for several idle timeouts
+	deadline := time.Now().Add(5 * idleTimeout)
+	for time.Now().Before(deadline) {
+		if _, err := io.ReadFull(conn, msgType); err != nil || msgType[0] != rfb.FramebufferUpdate {
+			t.Fatalf("Message = %v, %v, want FramebufferUpdate", msgType, err)
+		}
+		readRawUpdate(t, conn)
+	}
+
+	// A client that is neither streamed to nor sending is still dropped
+	if _, err := io.ReadFull(idle, msgType); err == nil || errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("Idle client read = %v, want the server to close the connection", err)
+	}
+}
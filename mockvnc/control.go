@@ -0,0 +1,76 @@
+package mockvnc
+
+import "time"
+
+// Clients returns the number of connected clients that have completed the handshake
+func (s *Server) Clients() int {
+	return len(s.clients())
+}
+
+// SetAnimation switches every connected client to another animation
+func (s *Server) SetAnimation(name string) error {
+	return s.broadcast(ScenarioEvent{Action: ActionAnimation, Animation: name})
+}
+
+// Bell rings every connected client's bell
+func (s *Server) Bell() {
+	s.broadcast(ScenarioEvent{Action: ActionBell})
+}
+
+// Resize changes every connected client's framebuffer size. Clients that did
+// not list the DesktopSize pseudo-encoding keep their size.
+func (s *Server) Resize(width, height int) error {
+	return s.broadcast(ScenarioEvent{Action: ActionResize, Width: width, Height: height})
+}
+
+// SendClipboard sends text to every connected client's clipboard
+func (s *Server) SendClipboard(text string) {
+	s.broadcast(ScenarioEvent{Action: ActionClipboard, Text: text})
+}
+
+// DisconnectAll closes every client connection; the server keeps listening
+func (s *Server) DisconnectAll() {
+	s.broadcast(ScenarioEvent{Action: ActionDisconnect})
+}
+
+// WaitForClients waits until at least n clients have completed the handshake,
+// reporting whether they did before the timeout
+func (s *Server) WaitForClients(n int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for s.Clients() < n {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return true
+}
+
+// broadcast applies an event to every connected client, as a scenario would
+func (s *Server) broadcast(ev ScenarioEvent) error {
+	if err := ev.validate(); err != nil {
+		return err
+	}
+	for _, c := range s.clients() {
+		c.mutex.Lock()
+		if !c.closed {
+			c.applyEvent(ev)
+		}
+		c.mutex.Unlock()
+	}
+	return nil
+}
+
+// clients returns the connections that have completed the handshake
+func (s *Server) clients() []*connection {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var clients []*connection
+	for _, c := range s.conns {
+		if c != nil {
+			clients = append(clients, c)
+		}
+	}
+	return clients
+}
@@ -0,0 +1,39 @@
+package mockvnc
+
+import (
+	"image"
+	"image/draw"
+)
+
+// imageToBGRA renders img into a width x height BGRA frame. The image is
+// placed at the top-left corner without scaling so pixel values survive
+// unchanged; it is cropped if larger and padded with black if smaller.
+func imageToBGRA(img image.Image, width, height int) []byte {
+	rgba := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(rgba, rgba.Bounds(), image.Black, image.Point{}, draw.Src)
+	draw.Draw(rgba, rgba.Bounds(), img, img.Bounds().Min, draw.Over)
+
+	pixelData := make([]byte, width*height*4)
+	for i := 0; i < len(pixelData); i += 4 {
+		pixelData[i] = rgba.Pix[i+2]   // B
+		pixelData[i+1] = rgba.Pix[i+1] // G
+		pixelData[i+2] = rgba.Pix[i]   // R
+		pixelData[i+3] = 255           // A
+	}
+	return pixelData
+}
+
+// fitFrame places a BGRA frame at the top-left of a frame of another size,
+// cropping it or padding with black as needed
+func fitFrame(src []byte, srcWidth, srcHeight, width, height int) []byte {
+	pixelData := make([]byte, width*height*4)
+	for i := 3; i < len(pixelData); i += 4 {
+		pixelData[i] = 255
+	}
+
+	rowBytes := min(srcWidth, width) * 4
+	for y := 0; y < min(srcHeight, height); y++ {
+		copy(pixelData[y*width*4:y*width*4+rowBytes], src[y*srcWidth*4:])
+	}
+	return pixelData
+}
@@ -0,0 +1,129 @@
+package mockvnc
+
+import "github.com/coder/websockify/rfb"
+
+const (
+	// echoCursorRadius is the radius of the pointer dot drawn in EchoInput mode
+	echoCursorRadius = 6
+	// echoMargin is the gap between the typed text panel and the screen edge
+	echoMargin = 8
+)
+
+// inputEcho holds the input a client has sent so it can be drawn back onto
+// that client's framebuffer, making input round trips visible in captures
+type inputEcho struct {
+	pointerSeen bool
+	pointerX    int
+	pointerY    int
+	buttons     uint8
+	lines       []string // Typed text; the last line is the one being edited
+}
+
+// handleKey applies a key press: printable characters are appended, Return
+// starts a new line, BackSpace deletes and Escape clears. Characters the
+// font cannot draw are shown as '?'.
+func (e *inputEcho) handleKey(ev rfb.KeyEventMessage) {
+	if !ev.Down {
+		return
+	}
+	if len(e.lines) == 0 {
+		e.lines = []string{""}
+	}
+	last := len(e.lines) - 1
+
+	switch ev.Key {
+	case rfb.KeyReturn:
+		e.lines = append(e.lines, "")
+	case rfb.KeyBackSpace:
+		if e.lines[last] != "" {
+			e.lines[last] = e.lines[last][:len(e.lines[last])-1]
+		} else if last > 0 {
+			e.lines = e.lines[:last]
+		}
+	case rfb.KeyEscape:
+		e.lines = nil
+	default:
+		r, ok := rfb.KeysymToRune(ev.Key)
+		if !ok {
+			return
+		}
+		if r > 126 {
+			r = '?'
+		}
+		e.lines[last] += string(r)
+	}
+}
+
+// handlePointer records the pointer position and held buttons
+func (e *inputEcho) handlePointer(ev rfb.PointerEventMessage) {
+	e.pointerSeen = true
+	e.pointerX = int(ev.X)
+	e.pointerY = int(ev.Y)
+	e.buttons = ev.ButtonMask
+}
+
+// draw renders the typed text in a panel at the top-left corner and a dot at
+// the pointer position, coloured by the buttons held: red for left, green
+// for middle, blue for right, white for none
+func (e *inputEcho) draw(pixelData []byte, width, height int) {
+	scale := 1
+	if width >= 320 {
+		scale = 2
+	}
+
+	if len(e.lines) > 0 {
+		// Show the most recent lines that fit in the top third of the screen,
+		// each trimmed to its end so the cursor position stays visible
+		maxLines := max((height/3-2*echoMargin)/(lineAdvance*scale), 1)
+		maxChars := max((width-4*echoMargin)/(glyphAdvance*scale)-1, 1)
+		lines := e.lines[max(len(e.lines)-maxLines, 0):]
+
+		panelHeight := len(lines)*lineAdvance*scale + 2*echoMargin
+		fillRect(pixelData, width, height, echoMargin, echoMargin, width-2*echoMargin, panelHeight, 0, 0, 0)
+
+		for i, line := range lines {
+			if i == len(lines)-1 {
+				line += "_"
+			}
+			if len(line) > maxChars {
+				line = line[len(line)-maxChars:]
+			}
+			y := 2*echoMargin + i*lineAdvance*scale
+			drawText(pixelData, width, height, 2*echoMargin, y, scale, line, 255, 255, 255)
+		}
+	}
+
+	if e.pointerSeen {
+		r, g, b := uint8(255), uint8(255), uint8(255)
+		if e.buttons&(rfb.ButtonLeft|rfb.ButtonMiddle|rfb.ButtonRight) != 0 {
+			r, g, b = 0, 0, 0
+			if e.buttons&rfb.ButtonLeft != 0 {
+				r = 255
+			}
+			if e.buttons&rfb.ButtonMiddle != 0 {
+				g = 255
+			}
+			if e.buttons&rfb.ButtonRight != 0 {
+				b = 255
+			}
+		}
+		drawDot(pixelData, width, height, e.pointerX, e.pointerY, echoCursorRadius*scale, r, g, b)
+	}
+}
+
+// drawDot draws a filled circle with a one-pixel black outline centred on (cx, cy)
+func drawDot(pixelData []byte, width, height, cx, cy, radius int, r, g, b uint8) {
+	outer := (radius + 1) * (radius + 1)
+	inner := radius * radius
+	for dy := -radius - 1; dy <= radius+1; dy++ {
+		for dx := -radius - 1; dx <= radius+1; dx++ {
+			d := dx*dx + dy*dy
+			switch {
+			case d <= inner:
+				fillRect(pixelData, width, height, cx+dx, cy+dy, 1, 1, r, g, b)
+			case d <= outer:
+				fillRect(pixelData, width, height, cx+dx, cy+dy, 1, 1, 0, 0, 0)
+			}
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package mockvnc
+
+// Metrics are server-wide counters for correlating proxy tests with what the
+// backend saw. Counters cover every connection since the server was created.
+type Metrics struct {
+	Clients           int   `json:"clients"`                  // Connected clients that completed the handshake
+	Connections       int64 `json:"connections_total"`        // Connections accepted
+	HandshakeFailures int64 `json:"handshake_failures_total"` // Connections that failed the RFB handshake
+	Frames            int64 `json:"frames_total"`             // FramebufferUpdates with at least one rectangle
+	Bytes             int64 `json:"bytes_sent_total"`         // Bytes written to clients
+}
+
+// Metrics returns the server's current counters
+func (s *Server) Metrics() Metrics {
+	return Metrics{
+		Clients:           s.Clients(),
+		Connections:       s.connections.Load(),
+		HandshakeFailures: s.handshakeFailures.Load(),
+		Frames:            s.frames.Load(),
+		Bytes:             s.bytes.Load(),
+	}
+}
@@ -0,0 +1,40 @@
+package mockvnc
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/coder/websockify/rfb"
+)
+
+func TestMetrics(t *testing.T) {
+	s := Start(t, Options{Width: 8, Height: 8})
+	conn, _ := dialClient(t, s)
+	conn.Write(rfb.CreateFramebufferUpdateRequest(false, rfb.Rectangle{Width: 8, Height: 8}))
+	if _, err := io.ReadFull(conn, make([]byte, 4+12+8*8*4)); err != nil {
+		t.Fatalf("Reading update error = %v", err)
+	}
+
+	// A client that picks a security type that was not offered fails the handshake
+	bad, err := net.Dial("tcp", s.Addr())
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer bad.Close()
+	rfb.ReadRFBVersion(bad)
+	rfb.SendRFBVersion(bad)
+	rfb.ReadSecurityTypes(bad)
+	bad.Write([]byte{rfb.SecurityVNCAuth})
+	bad.SetReadDeadline(time.Now().Add(5 * time.Second))
+	io.Copy(io.Discard, bad)
+
+	m := s.Metrics()
+	if m.Clients != 1 || m.Connections != 2 || m.HandshakeFailures != 1 || m.Frames != 1 {
+		t.Errorf("Metrics() = %+v, want 1 client, 2 connections, 1 handshake failure, 1 frame", m)
+	}
+	if m.Bytes < 4+12+8*8*4 {
+		t.Errorf("Metrics().Bytes = %d, want at least one update", m.Bytes)
+	}
+}
@@ -0,0 +1,123 @@
+package mockvnc
+
+import (
+	"math/rand/v2"
+	"net"
+	"sync"
+	"time"
+)
+
+// NetworkConditions describes the slow link simulated for writes to clients
+type NetworkConditions struct {
+	Latency   time.Duration // Delay before each write reaches the client
+	Jitter    time.Duration // Random variation of up to +/- Jitter added to Latency
+	Bandwidth int           // Throughput limit in kilobits per second; 0 is unlimited
+}
+
+// enabled reports whether any shaping is configured
+func (n NetworkConditions) enabled() bool {
+	return n.Latency > 0 || n.Jitter > 0 || n.Bandwidth > 0
+}
+
+// shapedConn delays and throttles writes to simulate a slow link. Each write
+// is held for the link's transmission time, then delivered after the latency
+// plus jitter without blocking later writes, so latency and throughput are
+// independent as on a real network. Delivery order is always preserved.
+type shapedConn struct {
+	net.Conn
+	conditions NetworkConditions
+
+	mutex        sync.Mutex // Serializes writers
+	rng          *rand.Rand
+	lastDelivery time.Time
+
+	errMutex sync.Mutex
+	err      error // First error from delivering to the underlying connection
+
+	queue     chan shapedWrite
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// shapedWrite is a write waiting for its delivery time
+type shapedWrite struct {
+	data      []byte
+	deliverAt time.Time
+}
+
+// newShapedConn wraps conn, seeding the jitter sequence so runs are repeatable
+func newShapedConn(conn net.Conn, conditions NetworkConditions, seed uint64) *shapedConn {
+	c := &shapedConn{
+		Conn:       conn,
+		conditions: conditions,
+		rng:        rand.New(rand.NewPCG(seed, 0)),
+		queue:      make(chan shapedWrite, 256),
+		done:       make(chan struct{}),
+	}
+	go c.deliver()
+	return c
+}
+
+// Write queues p for delayed delivery after waiting out its transmission time
+func (c *shapedConn) Write(p []byte) (int, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.errMutex.Lock()
+	err := c.err
+	c.errMutex.Unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	if c.conditions.Bandwidth > 0 {
+		bitsPerSecond := time.Duration(c.conditions.Bandwidth) * 1000
+		time.Sleep(time.Duration(len(p)) * 8 * time.Second / bitsPerSecond)
+	}
+
+	delay := c.conditions.Latency
+	if c.conditions.Jitter > 0 {
+		delay += time.Duration(c.rng.Int64N(int64(2*c.conditions.Jitter)+1)) - c.conditions.Jitter
+	}
+	deliverAt := time.Now().Add(max(delay, 0))
+	if deliverAt.Before(c.lastDelivery) {
+		// Jitter never reorders data on a stream
+		deliverAt = c.lastDelivery
+	}
+	c.lastDelivery = deliverAt
+
+	select {
+	case c.queue <- shapedWrite{data: append([]byte(nil), p...), deliverAt: deliverAt}:
+		return len(p), nil
+	case <-c.done:
+		return 0, net.ErrClosed
+	}
+}
+
+// deliver writes queued data to the client when it is due
+func (c *shapedConn) deliver() {
+	for {
+		select {
+		case w := <-c.queue:
+			select {
+			case <-time.After(time.Until(w.deliverAt)):
+			case <-c.done:
+				return
+			}
+			if _, err := c.Conn.Write(w.data); err != nil {
+				c.errMutex.Lock()
+				c.err = err
+				c.errMutex.Unlock()
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// Close discards undelivered data and closes the underlying connection
+func (c *shapedConn) Close() error {
+	c.closeOnce.Do(func() { close(c.done) })
+	return c.Conn.Close()
+}
@@ -0,0 +1,158 @@
+package mockvnc
+
+import (
+	"crypto/tls"
+	"fmt"
+	"image"
+	"log"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Default option values, matching the vncserver command's flag defaults
+const (
+	DefaultWidth     = 800
+	DefaultHeight    = 600
+	DefaultAnimation = "wheel"
+	DefaultFPS       = 30
+	DefaultSpeed     = 4
+	DefaultName      = "Test"
+)
+
+// Options configures a Server. The zero value serves the wheel animation at
+// 800x600 with no authentication; every field is optional.
+type Options struct {
+	Width     int    // Framebuffer width in pixels
+	Height    int    // Framebuffer height in pixels
+	Animation string // One of AnimationNames; unknown names fall back to wheel
+	FPS       int    // Frame rate for push mode and incremental update retries
+	MaxFPS    int    // Cap on each client's framebuffer updates per second; 0 is unlimited
+	Speed     int    // Movement in pixels per frame for the ball animation
+	Push      bool   // Stream updates at FPS after the first update request
+	EchoInput bool   // Draw each client's pointer and typed text onto its framebuffer
+	Password  string // Require VNC Authentication with this password
+	Name      string // Desktop name sent in ServerInit
+
+	// Images are served instead of the animation, one per frame in turn.
+	// They are placed at the top-left of the framebuffer without scaling.
+	Images []image.Image
+
+	ClipboardEcho     string        // Send ClientCutText back: "", "off", "echo", "upper" or "reverse"
+	ClipboardInterval time.Duration // Send a numbered ServerCutText at this interval
+	BellInterval      time.Duration // Send a Bell message at this interval
+
+	ResizeSizes    []Size        // Sizes cycled through via DesktopSize after the starting size
+	ResizeInterval time.Duration // Time between ResizeSizes changes
+
+	Network NetworkConditions // Simulated slow link for writes to clients
+	Seed    uint64            // Seed for network jitter and chaos faults
+
+	WebSocket bool        // Accept RFB over WebSocket instead of raw connections
+	TLS       bool        // Wrap accepted connections in TLS using TLSConfig
+	VeNCrypt  bool        // Offer VeNCrypt and start TLS using TLSConfig during the handshake
+	TLSConfig *tls.Config // Certificate for TLS and VeNCrypt
+
+	Scenario *Scenario // Timeline played against each client
+
+	StatsInterval time.Duration // Log each client's frames, bytes and frame rate at this interval
+
+	// RecordDir receives an FBS recording of everything sent to each client,
+	// one file per session. It is created if it does not exist.
+	RecordDir string
+
+	ChaosRate   float64  // Probability (0-1) that each update is corrupted
+	ChaosFaults []string // Faults ChaosRate may inject; all of Faults when empty
+
+	// Logf receives the server's log output; log.Printf when nil
+	Logf func(format string, args ...any)
+}
+
+// Size is a framebuffer width and height
+type Size struct {
+	Width  int
+	Height int
+}
+
+func (s Size) String() string {
+	return fmt.Sprintf("%dx%d", s.Width, s.Height)
+}
+
+// valid reports whether the size fits the protocol's 16-bit dimensions
+func (s Size) valid() bool {
+	return s.Width >= 1 && s.Width <= 65535 && s.Height >= 1 && s.Height <= 65535
+}
+
+// withDefaults fills in unset options and checks the rest
+func (o Options) withDefaults() (Options, error) {
+	if o.Width == 0 {
+		o.Width = DefaultWidth
+	}
+	if o.Height == 0 {
+		o.Height = DefaultHeight
+	}
+	if o.Animation == "" {
+		o.Animation = DefaultAnimation
+	}
+	if o.FPS <= 0 {
+		o.FPS = DefaultFPS
+	}
+	if o.Speed == 0 {
+		o.Speed = DefaultSpeed
+	}
+	if o.Name == "" {
+		o.Name = DefaultName
+	}
+	if o.ClipboardEcho == "" {
+		o.ClipboardEcho = "off"
+	}
+	if len(o.ChaosFaults) == 0 {
+		o.ChaosFaults = Faults
+	}
+	if o.Logf == nil {
+		o.Logf = log.Printf
+	}
+
+	if size := (Size{o.Width, o.Height}); !size.valid() {
+		return o, fmt.Errorf("invalid framebuffer size %v: width and height must be between 1 and 65535", size)
+	}
+	if _, ok := clipboardTransforms[o.ClipboardEcho]; !ok && o.ClipboardEcho != "off" {
+		return o, fmt.Errorf("invalid clipboard echo mode %q: must be off, echo, upper or reverse", o.ClipboardEcho)
+	}
+	for _, size := range o.ResizeSizes {
+		if !size.valid() {
+			return o, fmt.Errorf("invalid resize size %v: width and height must be between 1 and 65535", size)
+		}
+	}
+	if len(o.ResizeSizes) > 0 && o.ResizeInterval <= 0 {
+		return o, fmt.Errorf("invalid resize interval %v: must be positive", o.ResizeInterval)
+	}
+	if o.Network.Latency < 0 || o.Network.Jitter < 0 || o.Network.Bandwidth < 0 {
+		return o, fmt.Errorf("invalid network conditions: latency, jitter and bandwidth must not be negative")
+	}
+	if o.MaxFPS < 0 {
+		return o, fmt.Errorf("invalid max FPS %d: must not be negative", o.MaxFPS)
+	}
+	if o.ChaosRate < 0 || o.ChaosRate > 1 {
+		return o, fmt.Errorf("invalid chaos rate %v: must be between 0 and 1", o.ChaosRate)
+	}
+	for _, fault := range o.ChaosFaults {
+		if !slices.Contains(Faults, fault) {
+			return o, fmt.Errorf("unknown fault %q: must be one of %s", fault, strings.Join(Faults, ", "))
+		}
+	}
+	if o.Scenario != nil {
+		sc, err := o.Scenario.sorted()
+		if err != nil {
+			return o, fmt.Errorf("invalid scenario: %v", err)
+		}
+		o.Scenario = sc
+	}
+	if (o.TLS || o.VeNCrypt) && o.TLSConfig == nil {
+		return o, fmt.Errorf("TLS and VeNCrypt need a TLSConfig")
+	}
+	if o.TLS && o.VeNCrypt {
+		return o, fmt.Errorf("TLS and VeNCrypt cannot be used together")
+	}
+	return o, nil
+}
@@ -0,0 +1,50 @@
+package mockvnc
+
+import (
+	"crypto/tls"
+	"testing"
+	"time"
+)
+
+func TestOptionsDefaults(t *testing.T) {
+	opts, err := Options{}.withDefaults()
+	if err != nil {
+		t.Fatalf("withDefaults() error = %v", err)
+	}
+	if opts.Width != DefaultWidth || opts.Height != DefaultHeight {
+		t.Errorf("Size = %dx%d, want %dx%d", opts.Width, opts.Height, DefaultWidth, DefaultHeight)
+	}
+	if opts.Animation != DefaultAnimation || opts.FPS != DefaultFPS || opts.Speed != DefaultSpeed {
+		t.Errorf("Animation, FPS, Speed = %q, %d, %d, want defaults", opts.Animation, opts.FPS, opts.Speed)
+	}
+	if len(opts.ChaosFaults) != len(Faults) || opts.Logf == nil {
+		t.Error("ChaosFaults and Logf should default to all faults and log.Printf")
+	}
+}
+
+func TestOptionsValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{"Width too large", Options{Width: 70000}},
+		{"Negative height", Options{Height: -1}},
+		{"Unknown clipboard mode", Options{ClipboardEcho: "shout"}},
+		{"Invalid resize size", Options{ResizeSizes: []Size{{0, 10}}, ResizeInterval: time.Second}},
+		{"Resize without interval", Options{ResizeSizes: []Size{{640, 480}}}},
+		{"Negative latency", Options{Network: NetworkConditions{Latency: -time.Second}}},
+		{"Chaos rate above 1", Options{ChaosRate: 1.5}},
+		{"Unknown fault", Options{ChaosFaults: []string{"meteor"}}},
+		{"VeNCrypt without certificate", Options{VeNCrypt: true}},
+		{"TLS and VeNCrypt", Options{TLS: true, VeNCrypt: true, TLSConfig: &tls.Config{}}},
+		{"Invalid scenario", Options{Scenario: &Scenario{Events: []ScenarioEvent{{Action: "explode"}}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(tt.opts); err == nil {
+				t.Error("Expected error, but got none")
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package mockvnc
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/coder/websockify/rfb"
+)
+
+// recordingConn copies everything written to the client into an FBS file
+type recordingConn struct {
+	net.Conn
+	path string
+
+	mutex  sync.Mutex
+	file   *os.File
+	buf    *bufio.Writer
+	fbs    *rfb.FBSWriter
+	err    error // First recording error; recording stops after it
+	closed bool
+}
+
+// startRecording creates the next session file in Options.RecordDir and wraps
+// conn to record into it. Existing files, such as those of another server
+// sharing the directory, are never overwritten.
+func (s *Server) startRecording(conn net.Conn) (*recordingConn, error) {
+	var path string
+	var file *os.File
+	var err error
+	for {
+		s.mutex.Lock()
+		s.sessions++
+		session := s.sessions
+		s.mutex.Unlock()
+
+		name := fmt.Sprintf("session-%s-%03d.fbs", time.Now().Format("20060102-150405"), session)
+		path = filepath.Join(s.opts.RecordDir, name)
+		file, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if !errors.Is(err, fs.ErrExist) {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	buf := bufio.NewWriter(file)
+	fbs, err := rfb.NewFBSWriter(buf)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &recordingConn{Conn: conn, path: path, file: file, buf: buf, fbs: fbs}, nil
+}
+
+// Write sends p to the client and records what was sent
+func (c *recordingConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	if n > 0 {
+		c.mutex.Lock()
+		if c.err == nil && !c.closed {
+			_, c.err = c.fbs.Write(p[:n])
+		}
+		c.mutex.Unlock()
+	}
+	return n, err
+}
+
+// Close closes the connection and finishes the recording
+func (c *recordingConn) Close() error {
+	err := c.Conn.Close()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !c.closed {
+		c.closed = true
+		if flushErr := c.buf.Flush(); c.err == nil {
+			c.err = flushErr
+		}
+		if closeErr := c.file.Close(); c.err == nil {
+			c.err = closeErr
+		}
+	}
+	return err
+}
+
+// recordError returns the first error writing the recording, once it is closed
+func (c *recordingConn) recordError() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.err
+}
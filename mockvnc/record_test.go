@@ -0,0 +1,57 @@
+package mockvnc
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/coder/websockify/rfb"
+)
+
+func TestRecordDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "recordings")
+	s := Start(t, Options{Width: 16, Height: 16, RecordDir: dir})
+	conn, _ := dialClient(t, s)
+	conn.Write(rfb.CreateFramebufferUpdateRequest(false, rfb.Rectangle{Width: 16, Height: 16}))
+	if _, err := io.ReadFull(conn, make([]byte, 4+12+16*16*4)); err != nil {
+		t.Fatalf("Reading update error = %v", err)
+	}
+	conn.Close()
+	s.Close()
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.fbs"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("Recordings = %v, %v, want one file", files, err)
+	}
+	f, err := os.Open(files[0])
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer f.Close()
+	r, err := rfb.NewFBSReader(f)
+	if err != nil {
+		t.Fatalf("NewFBSReader() error = %v", err)
+	}
+
+	var stream []byte
+	for {
+		block, err := r.ReadBlock()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("ReadBlock() error = %v", err)
+		}
+		stream = append(stream, block.Data...)
+	}
+
+	// Version, security types, security result, ServerInit with "Test", then the update
+	expected := 12 + 2 + 4 + 24 + 4 + 4 + 12 + 16*16*4
+	if len(stream) != expected {
+		t.Errorf("Recorded %d bytes, want %d", len(stream), expected)
+	}
+	if string(stream[:12]) != rfb.RFBVersion {
+		t.Errorf("Recording starts with %q, want %q", stream[:12], rfb.RFBVersion)
+	}
+}
@@ -0,0 +1,41 @@
+package mockvnc
+
+import (
+	"slices"
+
+	"github.com/coder/websockify/rfb"
+)
+
+// resizeNext moves the client to the next ResizeSizes size, returning to the
+// starting size after the last one. Callers must hold c.mutex.
+func (c *connection) resizeNext() {
+	sizes := c.server.opts.ResizeSizes
+	c.resizeIndex = (c.resizeIndex + 1) % (len(sizes) + 1)
+
+	next := Size{c.server.opts.Width, c.server.opts.Height}
+	if c.resizeIndex > 0 {
+		next = sizes[c.resizeIndex-1]
+	}
+	c.resize(next.Width, next.Height)
+}
+
+// resize changes the client's framebuffer size. The change is announced with
+// a DesktopSize rectangle at the start of the next update, followed by the
+// whole screen at the new size. Clients that did not list the DesktopSize
+// pseudo-encoding keep their size, as the protocol requires.
+// Callers must hold c.mutex.
+func (c *connection) resize(width, height int) {
+	if width == c.width && height == c.height {
+		return
+	}
+	if !slices.Contains(c.encodings, rfb.DesktopSizeEncoding) {
+		c.logf("Client does not support DesktopSize; staying at %dx%d instead of %dx%d", c.width, c.height, width, height)
+		return
+	}
+
+	c.logf("Resizing framebuffer from %dx%d to %dx%d", c.width, c.height, width, height)
+	c.width, c.height = width, height
+	c.sent = nil
+	c.desktopSizePending = true
+	c.pushRegion = rfb.Rectangle{Width: uint16(width), Height: uint16(height)}
+}
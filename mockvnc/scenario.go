@@ -0,0 +1,160 @@
+package mockvnc
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Actions a scenario event can perform
+const (
+	ActionAnimation  = "animation"  // Switch to another animation
+	ActionBell       = "bell"       // Ring the client's bell
+	ActionResize     = "resize"     // Change the framebuffer size via DesktopSize
+	ActionClipboard  = "clipboard"  // Send text to the client's clipboard
+	ActionDisconnect = "disconnect" // Close the connection
+)
+
+// Scenario is a timeline of events played against each client, usually
+// loaded from a JSON file with LoadScenario
+type Scenario struct {
+	Events []ScenarioEvent `json:"events"`
+}
+
+// ScenarioEvent is one step of a scenario. At is measured from the end of
+// the client's handshake; only the fields used by Action need to be set.
+type ScenarioEvent struct {
+	At        Duration `json:"at"`
+	Action    string   `json:"action"`
+	Animation string   `json:"animation,omitempty"`
+	Width     int      `json:"width,omitempty"`
+	Height    int      `json:"height,omitempty"`
+	Text      string   `json:"text,omitempty"`
+}
+
+// Duration is a time.Duration written in JSON as a string such as "5s"
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"5s\"")
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// LoadScenario reads and validates a scenario file, returning its events in time order
+func LoadScenario(path string) (*Scenario, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var sc Scenario
+	decoder := json.NewDecoder(f)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&sc); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	return sc.sorted()
+}
+
+// sorted validates the events and returns a copy of the scenario in time order
+func (sc *Scenario) sorted() (*Scenario, error) {
+	for i, ev := range sc.Events {
+		if err := ev.validate(); err != nil {
+			return nil, fmt.Errorf("event %d: %v", i+1, err)
+		}
+	}
+	events := slices.Clone(sc.Events)
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].At < events[j].At
+	})
+	return &Scenario{Events: events}, nil
+}
+
+// validate checks that an event's action is known and has the fields it needs
+func (ev ScenarioEvent) validate() error {
+	if ev.At < 0 {
+		return fmt.Errorf("at %v must not be negative", time.Duration(ev.At))
+	}
+
+	switch ev.Action {
+	case ActionAnimation:
+		if names := AnimationNames(); !slices.Contains(names, ev.Animation) {
+			return fmt.Errorf("unknown animation %q: must be one of %s", ev.Animation, strings.Join(names, ", "))
+		}
+	case ActionResize:
+		if ev.Width < 1 || ev.Width > 65535 || ev.Height < 1 || ev.Height > 65535 {
+			return fmt.Errorf("resize to %dx%d: width and height must be between 1 and 65535", ev.Width, ev.Height)
+		}
+	case ActionBell, ActionClipboard, ActionDisconnect:
+	default:
+		return fmt.Errorf("unknown action %q", ev.Action)
+	}
+	return nil
+}
+
+// String describes an event for logs
+func (ev ScenarioEvent) String() string {
+	at := time.Duration(ev.At)
+	switch ev.Action {
+	case ActionAnimation:
+		return fmt.Sprintf("%v %s %s", at, ev.Action, ev.Animation)
+	case ActionResize:
+		return fmt.Sprintf("%v %s %dx%d", at, ev.Action, ev.Width, ev.Height)
+	case ActionClipboard:
+		return fmt.Sprintf("%v %s %q", at, ev.Action, ev.Text)
+	default:
+		return fmt.Sprintf("%v %s", at, ev.Action)
+	}
+}
+
+// runScenario plays the scenario timeline against this client, stopping
+// early if the connection closes
+func (c *connection) runScenario(sc *Scenario) {
+	start := time.Now()
+	for i, ev := range sc.Events {
+		time.Sleep(time.Until(start.Add(time.Duration(ev.At))))
+
+		c.mutex.Lock()
+		if c.closed {
+			c.mutex.Unlock()
+			return
+		}
+		c.logf("Scenario: %v", ev)
+		c.applyEvent(ev)
+		if i == len(sc.Events)-1 {
+			c.logf("Scenario finished for %s", c.conn.RemoteAddr())
+		}
+		c.mutex.Unlock()
+	}
+}
+
+// applyEvent performs one scenario event. Callers must hold c.mutex.
+func (c *connection) applyEvent(ev ScenarioEvent) {
+	switch ev.Action {
+	case ActionAnimation:
+		c.animationType = ev.Animation
+	case ActionBell:
+		c.sendBell()
+	case ActionResize:
+		c.resize(ev.Width, ev.Height)
+	case ActionClipboard:
+		if err := c.sendServerCutText(ev.Text); err != nil {
+			c.logf("%v", err)
+		}
+	case ActionDisconnect:
+		c.conn.Close()
+	}
+}
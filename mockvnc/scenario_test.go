@@ -0,0 +1,85 @@
+package mockvnc
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadScenario(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scenario.json")
+	data := `{"events": [
+		{"at": "30s", "action": "disconnect"},
+		{"at": "5s", "action": "animation", "animation": "plasma"},
+		{"at": "15s", "action": "resize", "width": 1024, "height": 768}
+	]}`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	sc, err := LoadScenario(path)
+	if err != nil {
+		t.Fatalf("LoadScenario() error = %v", err)
+	}
+	expected := []struct {
+		at     time.Duration
+		action string
+	}{
+		{5 * time.Second, ActionAnimation},
+		{15 * time.Second, ActionResize},
+		{30 * time.Second, ActionDisconnect},
+	}
+	if len(sc.Events) != len(expected) {
+		t.Fatalf("Events = %d, want %d", len(sc.Events), len(expected))
+	}
+	for i, want := range expected {
+		ev := sc.Events[i]
+		if time.Duration(ev.At) != want.at || ev.Action != want.action {
+			t.Errorf("Event %d = %v, want %v %s", i, ev, want.at, want.action)
+		}
+	}
+}
+
+func TestLoadScenarioErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"Numeric time", `{"events": [{"at": 5, "action": "bell"}]}`},
+		{"Unknown field", `{"events": [{"at": "5s", "action": "bell", "volume": 11}]}`},
+		{"Unknown action", `{"events": [{"at": "5s", "action": "explode"}]}`},
+		{"Unknown animation", `{"events": [{"at": "5s", "action": "animation", "animation": "fire"}]}`},
+		{"Resize without size", `{"events": [{"at": "5s", "action": "resize"}]}`},
+		{"Negative time", `{"events": [{"at": "-5s", "action": "bell"}]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "scenario.json")
+			if err := os.WriteFile(path, []byte(tt.data), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := LoadScenario(path); err == nil {
+				t.Error("Expected error, but got none")
+			}
+		})
+	}
+}
+
+func TestScenarioSortedCopies(t *testing.T) {
+	sc := &Scenario{Events: []ScenarioEvent{
+		{At: Duration(2 * time.Second), Action: ActionBell},
+		{At: Duration(time.Second), Action: ActionBell},
+	}}
+	sorted, err := sc.sorted()
+	if err != nil {
+		t.Fatalf("sorted() error = %v", err)
+	}
+	if sorted.Events[0].At != Duration(time.Second) {
+		t.Errorf("First event at %v, want 1s", time.Duration(sorted.Events[0].At))
+	}
+	if sc.Events[0].At != Duration(2*time.Second) {
+		t.Error("sorted() should not reorder the original scenario")
+	}
+}
@@ -0,0 +1,926 @@
+// Package mockvnc is a deterministic VNC server for testing RFB clients and
+// proxies. It serves animations or fixed images and can be told to misbehave:
+// slow links, resizes, clipboard and bell traffic, scripted timelines and
+// protocol faults. The vncserver command is a thin wrapper around it; Go tests
+// can use Start to run one in-process.
+package mockvnc
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/coder/websockify/rfb"
+)
+
+// ErrServerClosed is returned by Serve after Close
+var ErrServerClosed = errors.New("mockvnc: server closed")
+
+// idleTimeout is how long a client that is not being streamed to may send
+// nothing before it is disconnected
+var idleTimeout = 30 * time.Second
+
+// Server is a mock VNC server. Its options are shared by all connections,
+// but each client has its own animation timeline and protocol state.
+type Server struct {
+	opts        Options
+	imageFrames [][]byte // BGRA framebuffer contents rendered from Options.Images
+	addr        net.Addr // Listener address when started by Start
+
+	mutex     sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]*connection // Accepted connections; nil until the handshake completes
+	closed    bool
+	wg        sync.WaitGroup // Running connection handlers
+	sessions  int            // Sessions recorded so far, numbering the RecordDir files
+
+	// Counters for Metrics
+	connections       atomic.Int64
+	handshakeFailures atomic.Int64
+	frames            atomic.Int64
+	bytes             atomic.Int64
+}
+
+// connection holds the per-client protocol and animation state
+type connection struct {
+	server        *Server
+	conn          net.Conn
+	frameNumber   int             // Frame number for 30fps animation
+	width         int             // Framebuffer width for this client
+	height        int             // Framebuffer height for this client
+	animationType string          // Type of animation to generate
+	buffer        []byte          // Message buffer for proper framing
+	pixelFormat   rfb.PixelFormat // Client's requested pixel format
+
+	mutex   sync.Mutex                           // Serializes updates from the reader and retry timer
+	sent    *rfb.Framebuffer                     // What the client has been sent so far
+	pending *rfb.FramebufferUpdateRequestMessage // Incremental request waiting for changes
+	closed  bool
+
+	pushing    bool          // Push mode stream has started
+	pushRegion rfb.Rectangle // Region most recently requested, streamed in push mode
+
+	continuousAnnounced bool // EndOfContinuousUpdates has told the client ContinuousUpdates is supported
+	continuousUpdates   bool // Client enabled ContinuousUpdates; pushRegion is streamed as in push mode
+
+	encodings []int32               // Client's SetEncodings list in preference order
+	encoders  map[int32]rfb.Encoder // Encoders in use, kept for stateful encodings like ZRLE
+
+	echo           inputEcho // Input drawn back onto the framebuffer in EchoInput mode
+	clipboardCount int       // ServerCutText messages sent for ClipboardInterval
+
+	resizeIndex        int  // Position in the ResizeSizes cycle; 0 is the starting size
+	desktopSizePending bool // The next update must announce a new size
+
+	chaos *chaos // Fault injection for ChaosRate; nil when disabled
+
+	counter   *countingConn // Counts bytes written to the client
+	connected time.Time     // When the client connected, for ClientStats
+	frames    int           // Non-empty FramebufferUpdates sent
+	lastFrame time.Time     // When the last of them was sent, for MaxFPS
+}
+
+// New creates a server with the given options, filling in defaults for unset fields
+func New(opts Options) (*Server, error) {
+	opts, err := opts.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.RecordDir != "" {
+		if err := os.MkdirAll(opts.RecordDir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create record directory: %v", err)
+		}
+	}
+
+	s := &Server{
+		opts:      opts,
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[net.Conn]*connection),
+	}
+	for _, img := range opts.Images {
+		s.imageFrames = append(s.imageFrames, imageToBGRA(img, opts.Width, opts.Height))
+	}
+	return s, nil
+}
+
+// Start runs a server on a random localhost port for the duration of a test.
+// Log output goes to t.Logf unless opts.Logf is set, and the server is closed
+// when the test finishes.
+func Start(t testing.TB, opts Options) *Server {
+	t.Helper()
+	if opts.Logf == nil {
+		opts.Logf = t.Logf
+	}
+	s, err := New(opts)
+	if err != nil {
+		t.Fatalf("mockvnc.New() error = %v", err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("mockvnc: failed to listen: %v", err)
+	}
+	s.addr = listener.Addr()
+	go s.Serve(listener)
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Addr returns the address of the listener opened by Start
+func (s *Server) Addr() string {
+	if s.addr == nil {
+		return ""
+	}
+	return s.addr.String()
+}
+
+// Serve accepts connections on listener until Close is called, returning
+// ErrServerClosed then. With Options.TLS the connections are wrapped in TLS,
+// and with Options.WebSocket they are expected to upgrade to WebSocket.
+func (s *Server) Serve(listener net.Listener) error {
+	if s.opts.TLS {
+		listener = tls.NewListener(listener, s.opts.TLSConfig)
+	}
+	if !s.trackListener(listener, true) {
+		listener.Close()
+		return ErrServerClosed
+	}
+	defer s.trackListener(listener, false)
+
+	if s.opts.WebSocket {
+		return s.serveWebSocket(listener)
+	}
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return s.serveError(err)
+			}
+			s.logf("Failed to accept connection: %v", err)
+			continue
+		}
+
+		go s.handleConnection(conn)
+	}
+}
+
+// ServeConn serves a single connection the caller has opened, such as a
+// reverse connection to a listening viewer, returning when it ends. Unlike
+// Serve, it does not apply Options.TLS or Options.WebSocket.
+func (s *Server) ServeConn(conn net.Conn) {
+	s.handleConnection(conn)
+}
+
+// serveError returns ErrServerClosed if the listener stopped because of
+// Close, otherwise err
+func (s *Server) serveError(err error) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return ErrServerClosed
+	}
+	return err
+}
+
+// Close stops all listeners, disconnects every client and waits for their
+// handlers to finish
+func (s *Server) Close() {
+	s.mutex.Lock()
+	s.closeListeners()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mutex.Unlock()
+
+	s.wg.Wait()
+}
+
+// Shutdown stops all listeners, then disconnects each client between
+// messages so none sees a partial update, and waits for the handlers to
+// finish. If ctx ends first the remaining connections are closed as with
+// Close and ctx's error is returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mutex.Lock()
+	s.closeListeners()
+	var clients []*connection
+	for conn, c := range s.conns {
+		if c == nil {
+			// Still in the handshake; nothing to finish
+			conn.Close()
+		} else {
+			clients = append(clients, c)
+		}
+	}
+	s.mutex.Unlock()
+
+	for _, c := range clients {
+		c.shutdown()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.Close()
+		return ctx.Err()
+	}
+}
+
+// closeListeners marks the server closed and stops accepting connections.
+// Callers must hold s.mutex.
+func (s *Server) closeListeners() {
+	s.closed = true
+	for listener := range s.listeners {
+		listener.Close()
+	}
+}
+
+// trackListener adds or removes a listener for Close. Adding fails once the server is closed.
+func (s *Server) trackListener(listener net.Listener, add bool) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !add {
+		delete(s.listeners, listener)
+		return true
+	}
+	if s.closed {
+		return false
+	}
+	s.listeners[listener] = struct{}{}
+	return true
+}
+
+// addConn registers an accepted connection. It fails once the server is closed.
+func (s *Server) addConn(conn net.Conn) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return false
+	}
+	s.conns[conn] = nil
+	s.wg.Add(1)
+	return true
+}
+
+// removeConn unregisters a connection whose handler is returning
+func (s *Server) removeConn(conn net.Conn) {
+	s.mutex.Lock()
+	delete(s.conns, conn)
+	s.mutex.Unlock()
+	s.wg.Done()
+}
+
+// logf writes to the configured logger
+func (s *Server) logf(format string, args ...any) {
+	s.opts.Logf(format, args...)
+}
+
+// logf writes to the server's logger
+func (c *connection) logf(format string, args ...any) {
+	c.server.logf(format, args...)
+}
+
+// Frame returns the BGRA contents of frame frameNumber of the server's own
+// animation or images at the configured size, as a newly connected client would see it
+func (s *Server) Frame(frameNumber int) []byte {
+	return s.generateFrame(s.opts.Animation, frameNumber, s.opts.Width, s.opts.Height)
+}
+
+// generateFrame returns the BGRA contents of the given frame: a copy of the
+// image frame when images were given, otherwise the animation
+func (s *Server) generateFrame(animationType string, frameNumber, width, height int) []byte {
+	if n := len(s.imageFrames); n > 0 {
+		frame := s.imageFrames[frameNumber%n]
+		if width != s.opts.Width || height != s.opts.Height {
+			// The client has been resized away from the size the images were loaded at
+			return fitFrame(frame, s.opts.Width, s.opts.Height, width, height)
+		}
+		return append([]byte(nil), frame...)
+	}
+	return generateAnimationFrame(animationType, frameNumber, width, height, s.opts.Speed)
+}
+
+func (s *Server) handleConnection(conn net.Conn) {
+	if !s.addConn(conn) {
+		conn.Close()
+		return
+	}
+	defer s.removeConn(conn)
+	raw := conn
+
+	clientAddr := conn.RemoteAddr().String()
+	s.logf("New VNC connection from %s", clientAddr)
+
+	s.connections.Add(1)
+	counter := &countingConn{Conn: conn, total: &s.bytes}
+	conn = counter
+	if s.opts.Network.enabled() {
+		conn = newShapedConn(conn, s.opts.Network, s.opts.Seed)
+	}
+	if s.opts.RecordDir != "" {
+		recorder, err := s.startRecording(conn)
+		if err != nil {
+			s.logf("Failed to start recording for %s: %v", clientAddr, err)
+		} else {
+			s.logf("Recording %s to %s", clientAddr, recorder.path)
+			conn = recorder
+			defer func() {
+				if err := recorder.recordError(); err != nil {
+					s.logf("Recording to %s failed: %v", recorder.path, err)
+				}
+			}()
+		}
+	}
+	defer conn.Close()
+
+	// Create VNC connection state with default pixel format (matches ServerInit)
+	vncConn := &connection{
+		server:        s,
+		conn:          conn,
+		frameNumber:   0,
+		width:         s.opts.Width,
+		height:        s.opts.Height,
+		animationType: s.opts.Animation,
+		pixelFormat:   rfb.DefaultPixelFormat(),
+		counter:       counter,
+		connected:     time.Now(),
+	}
+	if s.opts.ChaosRate > 0 {
+		vncConn.chaos = newChaos(s.opts.ChaosRate, s.opts.ChaosFaults, s.opts.Seed)
+	}
+
+	// RFB Protocol Handshake
+	if err := vncConn.doHandshake(); err != nil {
+		s.logf("VNC handshake failed for %s: %v", clientAddr, err)
+		s.handshakeFailures.Add(1)
+		return
+	}
+
+	s.logf("VNC handshake completed for %s", clientAddr)
+	defer vncConn.close()
+	s.mutex.Lock()
+	s.conns[raw] = vncConn
+	s.mutex.Unlock()
+	defer func() {
+		vncConn.mutex.Lock()
+		vncConn.logStats()
+		vncConn.mutex.Unlock()
+	}()
+
+	if s.opts.ClipboardInterval > 0 {
+		go vncConn.runPeriodic(s.opts.ClipboardInterval, vncConn.sendPeriodicClipboard)
+	}
+	if s.opts.BellInterval > 0 {
+		go vncConn.runPeriodic(s.opts.BellInterval, vncConn.sendBell)
+	}
+	if len(s.opts.ResizeSizes) > 0 {
+		go vncConn.runPeriodic(s.opts.ResizeInterval, vncConn.resizeNext)
+	}
+	if s.opts.Scenario != nil {
+		go vncConn.runScenario(s.opts.Scenario)
+	}
+	if s.opts.StatsInterval > 0 {
+		go vncConn.runPeriodic(s.opts.StatsInterval, vncConn.logStats)
+	}
+
+	// Keep connection alive and handle client messages with proper framing
+	readBuffer := make([]byte, 1024)
+	for {
+		// Clients being pushed or streamed to only watch, so they may send
+		// nothing for as long as they like
+		if s.opts.Push || vncConn.streaming() {
+			vncConn.conn.SetReadDeadline(time.Time{})
+		} else {
+			vncConn.conn.SetReadDeadline(time.Now().Add(idleTimeout))
+		}
+		n, err := vncConn.conn.Read(readBuffer)
+		if err != nil {
+			s.logf("VNC connection from %s ended: %v", clientAddr, err)
+			return
+		}
+
+		if n > 0 {
+			s.logf("VNC client %s sent %d bytes", clientAddr, n)
+			// Append new data to connection buffer
+			vncConn.buffer = append(vncConn.buffer, readBuffer[:n]...)
+
+			// Process complete messages from buffer
+			if err := vncConn.processCompleteMessages(); err != nil {
+				s.logf("VNC message processing failed for %s: %v", clientAddr, err)
+				return
+			}
+		}
+	}
+}
+
+func (c *connection) doHandshake() error {
+	conn := c.conn
+
+	// Step 1: Send RFB version
+	if err := rfb.SendRFBVersion(conn); err != nil {
+		return fmt.Errorf("failed to send RFB version: %v", err)
+	}
+
+	// Step 2: Read client version
+	clientVersion, err := rfb.ReadRFBVersion(conn)
+	if err != nil {
+		return fmt.Errorf("failed to read client version: %v", err)
+	}
+	c.logf("Client version: %s", clientVersion)
+
+	// Step 3: Send security types (19 = VeNCrypt when enabled, 2 = VNC Authentication
+	// when a password is set, else 1 = None)
+	securityType := uint8(rfb.SecurityNone)
+	switch {
+	case c.server.opts.VeNCrypt:
+		securityType = rfb.SecurityVeNCrypt
+	case c.server.opts.Password != "":
+		securityType = rfb.SecurityVNCAuth
+	}
+	if err := rfb.SendSecurityTypes(conn, []uint8{securityType}); err != nil {
+		return fmt.Errorf("failed to send security types: %v", err)
+	}
+
+	// Step 4: Read client security choice
+	securityChoice := make([]byte, 1)
+	if _, err := io.ReadFull(conn, securityChoice); err != nil {
+		return fmt.Errorf("failed to read security choice: %v", err)
+	}
+	if securityChoice[0] != securityType {
+		rfb.SendSecurityFailure(conn, "Unsupported security type")
+		return fmt.Errorf("client chose unsupported security type %d", securityChoice[0])
+	}
+
+	// Step 5: Upgrade to TLS for VeNCrypt, authenticate, then send security result (0 = OK)
+	if securityType == rfb.SecurityVeNCrypt {
+		if err := c.startVeNCrypt(); err != nil {
+			return err
+		}
+		conn = c.conn
+	}
+	if c.server.opts.Password != "" {
+		if err := c.authenticate(); err != nil {
+			return err
+		}
+	}
+	if err := rfb.SendSecurityResult(conn, rfb.SecurityResultOK); err != nil {
+		return fmt.Errorf("failed to send security result: %v", err)
+	}
+
+	// Step 6: Read ClientInit
+	clientInit := make([]byte, 1)
+	if _, err := conn.Read(clientInit); err != nil {
+		return fmt.Errorf("failed to read client init: %v", err)
+	}
+
+	// Step 7: Send ServerInit
+	serverInit := rfb.ServerInit{
+		Width:       uint16(c.width),
+		Height:      uint16(c.height),
+		PixelFormat: rfb.DefaultPixelFormat(),
+		Name:        c.server.opts.Name,
+	}
+
+	if err := rfb.SendServerInit(conn, serverInit); err != nil {
+		return fmt.Errorf("failed to send server init: %v", err)
+	}
+
+	return nil
+}
+
+// authenticate runs the VNC Authentication challenge-response, sending a
+// failure result and reason if the client's response is wrong
+func (c *connection) authenticate() error {
+	challenge, err := rfb.NewVNCAuthChallenge()
+	if err != nil {
+		return fmt.Errorf("failed to generate VNC auth challenge: %v", err)
+	}
+	if _, err := c.conn.Write(challenge); err != nil {
+		return fmt.Errorf("failed to send VNC auth challenge: %v", err)
+	}
+
+	response := make([]byte, rfb.VNCAuthChallengeLength)
+	if _, err := io.ReadFull(c.conn, response); err != nil {
+		return fmt.Errorf("failed to read VNC auth response: %v", err)
+	}
+
+	if !rfb.CheckVNCAuthResponse(c.server.opts.Password, challenge, response) {
+		rfb.SendSecurityFailure(c.conn, "Authentication failed")
+		return fmt.Errorf("VNC authentication failed: wrong password")
+	}
+	c.logf("VNC authentication succeeded")
+	return nil
+}
+
+// getMessageLength returns the expected length of a VNC client message based on its type
+func getMessageLength(messageType byte, data []byte) (int, error) {
+	length, err := rfb.GetMessageLength(messageType, data)
+	if err != nil {
+		return -1, err
+	}
+	if length == 0 && len(data) < 8 {
+		return -1, nil // Need more data to determine length
+	}
+	return length, nil
+}
+
+// processCompleteMessages processes all complete messages in the buffer
+func (c *connection) processCompleteMessages() error {
+	for len(c.buffer) > 0 {
+		messageType := c.buffer[0]
+		expectedLength, err := getMessageLength(messageType, c.buffer)
+		if err != nil {
+			return fmt.Errorf("invalid message type %d: %v", messageType, err)
+		}
+
+		// If expectedLength is -1, we need more data to determine the full message length
+		if expectedLength == -1 {
+			c.logf("Need more data to determine message length for type %d", messageType)
+			break
+		}
+
+		// Check if we have the complete message
+		if len(c.buffer) < expectedLength {
+			c.logf("Incomplete message: have %d bytes, need %d for type %d",
+				len(c.buffer), expectedLength, messageType)
+			break
+		}
+
+		// We have a complete message, process it
+		messageData := c.buffer[:expectedLength]
+		if err := c.handleMessage(messageData); err != nil {
+			return err
+		}
+
+		// Remove processed message from buffer
+		c.buffer = c.buffer[expectedLength:]
+		c.logf("Processed message type %d (%d bytes), %d bytes remaining in buffer",
+			messageType, expectedLength, len(c.buffer))
+	}
+
+	return nil
+}
+
+func (c *connection) handleMessage(data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+
+	messageType := data[0]
+	c.logf("Processing complete message type %d (%d bytes)", messageType, len(data))
+
+	switch messageType {
+	case rfb.SetPixelFormat: // SetPixelFormat (20 bytes total)
+		return c.handleSetPixelFormat(data)
+
+	case rfb.SetEncodings: // SetEncodings (variable length)
+		return c.handleSetEncodings(data)
+
+	case rfb.FramebufferUpdateRequest: // FramebufferUpdateRequest (10 bytes total)
+		req, err := rfb.ParseFramebufferUpdateRequest(data)
+		if err != nil {
+			return err
+		}
+		c.logf("Received FramebufferUpdateRequest: %dx%d at (%d,%d), incremental=%v",
+			req.Width, req.Height, req.X, req.Y, req.Incremental)
+		if c.server.opts.Push {
+			c.handlePushRequest(req)
+		} else if req.Incremental && c.streaming() {
+			c.logf("Ignoring incremental request during continuous updates")
+		} else {
+			c.handleUpdateRequest(req)
+		}
+		return nil
+
+	case rfb.KeyEvent: // KeyEvent (8 bytes total)
+		ev, err := rfb.ParseKeyEvent(data)
+		if err != nil {
+			return err
+		}
+		c.logf("Received KeyEvent: key=0x%04x down=%v", ev.Key, ev.Down)
+		if c.server.opts.EchoInput {
+			c.mutex.Lock()
+			c.echo.handleKey(ev)
+			c.mutex.Unlock()
+		}
+		return nil
+
+	case rfb.PointerEvent: // PointerEvent (6 bytes total)
+		ev, err := rfb.ParsePointerEvent(data)
+		if err != nil {
+			return err
+		}
+		c.logf("Received PointerEvent: (%d,%d) buttons=0x%02x", ev.X, ev.Y, ev.ButtonMask)
+		if c.server.opts.EchoInput {
+			c.mutex.Lock()
+			c.echo.handlePointer(ev)
+			c.mutex.Unlock()
+		}
+		return nil
+
+	case rfb.ClientCutText: // ClientCutText (variable length)
+		return c.handleClientCutText(data)
+
+	case rfb.EnableContinuousUpdates: // EnableContinuousUpdates (10 bytes total)
+		return c.handleEnableContinuousUpdates(data)
+
+	default:
+		c.logf("Received invalid message type: %d (0x%02X) - closing connection", messageType, messageType)
+		return fmt.Errorf("invalid message type: %d", messageType)
+	}
+}
+
+func (c *connection) handleSetPixelFormat(data []byte) error {
+	pf, err := rfb.ParseSetPixelFormat(data)
+	if err != nil {
+		return err
+	}
+
+	// Update connection's pixel format, which pushes and retries read under
+	// the same lock
+	c.mutex.Lock()
+	c.pixelFormat = pf
+	c.mutex.Unlock()
+
+	c.logf("SetPixelFormat: %d bpp, depth %d, %s-endian, true-color=%d",
+		pf.BitsPerPixel, pf.Depth,
+		map[uint8]string{0: "little", 1: "big"}[pf.BigEndianFlag],
+		pf.TrueColorFlag)
+	c.logf("Color maximums: R=%d G=%d B=%d, Shifts: R=%d G=%d B=%d",
+		pf.RedMax, pf.GreenMax, pf.BlueMax,
+		pf.RedShift, pf.GreenShift, pf.BlueShift)
+
+	return nil
+}
+
+func (c *connection) handleSetEncodings(data []byte) error {
+	encodings, err := rfb.ParseSetEncodings(data)
+	if err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	c.encodings = encodings
+	c.announceContinuousUpdates()
+	c.mutex.Unlock()
+
+	names := make([]string, len(encodings))
+	for i, enc := range encodings {
+		names[i] = rfb.EncodingName(enc)
+	}
+	selected := rfb.SelectEncoding(encodings, rfb.SupportedEncodings())
+	c.logf("Received SetEncodings message with %d encodings: %s (using %s)",
+		len(encodings), strings.Join(names, ", "), rfb.EncodingName(selected))
+	return nil
+}
+
+// encoder returns the encoder for the best encoding both sides support,
+// reusing it across updates since ZRLE keeps one zlib stream per connection.
+// Callers must hold c.mutex.
+func (c *connection) encoder() rfb.Encoder {
+	enc := rfb.SelectEncoding(c.encodings, rfb.SupportedEncodings())
+	if c.encoders == nil {
+		c.encoders = make(map[int32]rfb.Encoder)
+	}
+	e, ok := c.encoders[enc]
+	if !ok {
+		e = rfb.NewEncoder(enc)
+		c.encoders[enc] = e
+	}
+	return e
+}
+
+// frameInterval returns the time between animation frames at the configured rate
+func (s *Server) frameInterval() time.Duration {
+	if s.opts.FPS <= 0 {
+		return time.Second / 30
+	}
+	return time.Second / time.Duration(s.opts.FPS)
+}
+
+// handleUpdateRequest answers a FramebufferUpdateRequest. Incremental requests
+// for regions that have not changed are held until the next frame that differs,
+// as real servers do, rather than being answered with an empty update.
+func (c *connection) handleUpdateRequest(req rfb.FramebufferUpdateRequestMessage) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.pending = nil
+	c.answerRequest(req)
+}
+
+// answerRequest sends an update for req, or parks it until MaxFPS allows
+// another frame or, for incremental requests, until something changes.
+// Callers must hold c.mutex.
+func (c *connection) answerRequest(req rfb.FramebufferUpdateRequestMessage) {
+	if wait := c.throttleDelay(); wait > 0 {
+		c.pending = &req
+		time.AfterFunc(wait, c.retryPending)
+		return
+	}
+	if !c.sendFramebufferUpdate(req) {
+		c.deferRequest(req)
+	}
+}
+
+// deferRequest parks an incremental request and schedules a retry on the next frame
+func (c *connection) deferRequest(req rfb.FramebufferUpdateRequestMessage) {
+	c.pending = &req
+	time.AfterFunc(c.server.frameInterval(), c.retryPending)
+}
+
+// retryPending re-evaluates a parked incremental request
+func (c *connection) retryPending() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.closed || c.pending == nil {
+		return
+	}
+	req := *c.pending
+	c.pending = nil
+	c.answerRequest(req)
+}
+
+// handlePushRequest records the requested region for the push stream, starting
+// the stream on the first request. Full requests are still answered at once.
+func (c *connection) handlePushRequest(req rfb.FramebufferUpdateRequestMessage) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.pushRegion = req.Rectangle
+	if !req.Incremental {
+		c.pending = nil
+		c.answerRequest(req)
+	}
+	if !c.pushing {
+		c.pushing = true
+		c.logf("Starting push stream to %s at %d FPS", c.conn.RemoteAddr(), c.server.opts.FPS)
+		go c.pushFrames()
+	}
+}
+
+// streaming reports whether the client has continuous updates enabled
+func (c *connection) streaming() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.continuousUpdates
+}
+
+// pushFrames streams changed regions to the client at the configured frame
+// rate without waiting for further update requests, in push mode or while
+// continuous updates are enabled
+func (c *connection) pushFrames() {
+	ticker := time.NewTicker(c.server.frameInterval())
+	defer ticker.Stop()
+
+	for range ticker.C {
+		c.mutex.Lock()
+		if c.closed {
+			c.mutex.Unlock()
+			return
+		}
+		if (c.server.opts.Push || c.continuousUpdates) && c.throttleDelay() <= 0 {
+			c.sendFramebufferUpdate(rfb.FramebufferUpdateRequestMessage{Incremental: true, Rectangle: c.pushRegion})
+		}
+		c.mutex.Unlock()
+	}
+}
+
+// runPeriodic calls send under c.mutex every interval until the connection closes
+func (c *connection) runPeriodic(interval time.Duration, send func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		c.mutex.Lock()
+		if c.closed {
+			c.mutex.Unlock()
+			return
+		}
+		send()
+		c.mutex.Unlock()
+	}
+}
+
+// sendBell rings the client's bell. Callers must hold c.mutex.
+func (c *connection) sendBell() {
+	if _, err := c.conn.Write(rfb.CreateBell()); err != nil {
+		c.logf("Failed to send Bell: %v", err)
+		return
+	}
+	c.logf("Sent Bell")
+}
+
+// close stops any pending update retries and the push stream
+func (c *connection) close() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.closed = true
+	c.pending = nil
+}
+
+// shutdown stops the connection's timers and closes it. Holding c.mutex
+// while closing ensures no update is cut off part way through.
+func (c *connection) shutdown() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.closed = true
+	c.pending = nil
+	c.conn.Close()
+	c.logf("Disconnected %s for shutdown", c.conn.RemoteAddr())
+}
+
+// sendFramebufferUpdate sends the requested region of the next animation
+// frame, clipped to the screen bounds. Full requests send the whole region as
+// one Raw rectangle; incremental requests send only the tiles that changed
+// since the client's last update. It returns false when an incremental
+// request found nothing to send. Callers must hold c.mutex.
+func (c *connection) sendFramebufferUpdate(req rfb.FramebufferUpdateRequestMessage) bool {
+	screen := rfb.Rectangle{Width: uint16(c.width), Height: uint16(c.height)}
+	clip := req.Rectangle.Intersect(screen)
+	if c.desktopSizePending {
+		// The client's request refers to the old size; send the whole new screen
+		clip = screen
+	}
+
+	if clip.Empty() {
+		// Nothing of the request is on screen; reply with an empty update
+		if _, err := c.conn.Write(rfb.CreateFramebufferUpdateHeader(0)); err != nil {
+			c.logf("Failed to send empty framebuffer update: %v", err)
+		}
+		return true
+	}
+
+	// Generate animated pixel data in BGRA format
+	frame := &rfb.Framebuffer{
+		Width:  c.width,
+		Height: c.height,
+		Pix:    c.server.generateFrame(c.animationType, c.frameNumber, c.width, c.height),
+	}
+	if c.server.opts.EchoInput {
+		c.echo.draw(frame.Pix, c.width, c.height)
+	}
+
+	rects := []rfb.Rectangle{clip}
+	if req.Incremental && c.sent != nil {
+		rects = frame.Damage(c.sent, clip, rfb.DefaultDamageTileSize)
+		if len(rects) == 0 {
+			return false
+		}
+	}
+
+	encoder := c.encoder()
+	var update []byte
+	if c.desktopSizePending {
+		update = rfb.CreateFramebufferUpdateHeader(uint16(len(rects) + 1))
+		update = append(update, rfb.CreateDesktopSizeRectangle(uint16(c.width), uint16(c.height))...)
+	} else {
+		update = rfb.CreateFramebufferUpdateHeader(uint16(len(rects)))
+	}
+	for _, rect := range rects {
+		// Encode in the negotiated encoding and the client's requested pixel format
+		pixelData := encoder.Encode(frame.Region(rect), int(rect.Width), int(rect.Height), c.pixelFormat)
+		update = append(update, rfb.CreateRectangleHeader(rect, encoder.Type())...)
+		update = append(update, pixelData...)
+	}
+
+	if err := c.writeUpdate(update); err != nil {
+		c.logf("Failed to send framebuffer update: %v", err)
+		return true
+	}
+	c.logf("Sent FramebufferUpdate with %d %s rectangles (%d bytes) for %dx%d at (%d,%d)",
+		len(rects), rfb.EncodingName(encoder.Type()), len(update), clip.Width, clip.Height, clip.X, clip.Y)
+	c.desktopSizePending = false
+	c.frames++
+	c.server.frames.Add(1)
+	c.lastFrame = time.Now()
+
+	// Remember what the client now has
+	if c.sent == nil {
+		c.sent = rfb.NewFramebuffer(c.width, c.height)
+	}
+	for _, rect := range rects {
+		c.sent.CopyRegion(frame, rect)
+	}
+
+	// Increment frame number for next frame (30fps)
+	c.frameNumber++
+	return true
+}
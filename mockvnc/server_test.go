@@ -0,0 +1,191 @@
+package mockvnc
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/coder/websockify/rfb"
+)
+
+// dialClient connects to a test server and completes the handshake with no authentication
+func dialClient(t *testing.T, s *Server) (net.Conn, rfb.ServerInit) {
+	t.Helper()
+	conn, err := net.Dial("tcp", s.Addr())
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if _, err := rfb.ReadRFBVersion(conn); err != nil {
+		t.Fatalf("ReadRFBVersion() error = %v", err)
+	}
+	rfb.SendRFBVersion(conn)
+	if _, err := rfb.ReadSecurityTypes(conn); err != nil {
+		t.Fatalf("ReadSecurityTypes() error = %v", err)
+	}
+	conn.Write([]byte{rfb.SecurityNone})
+	if result, err := rfb.ReadSecurityResult(conn); err != nil || result != rfb.SecurityResultOK {
+		t.Fatalf("ReadSecurityResult() = %d, %v, want OK", result, err)
+	}
+	conn.Write([]byte{1})
+	init, err := rfb.ReadServerInit(conn)
+	if err != nil {
+		t.Fatalf("ReadServerInit() error = %v", err)
+	}
+	return conn, init
+}
+
+func TestStartServesFramebuffer(t *testing.T) {
+	s := Start(t, Options{Width: 64, Height: 48, Animation: "testcard"})
+	conn, init := dialClient(t, s)
+
+	if init.Width != 64 || init.Height != 48 {
+		t.Fatalf("ServerInit size = %dx%d, want 64x48", init.Width, init.Height)
+	}
+
+	conn.Write(rfb.CreateFramebufferUpdateRequest(false, rfb.Rectangle{Width: 64, Height: 48}))
+	header := make([]byte, 4+12)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		t.Fatalf("Reading update header error = %v", err)
+	}
+	if header[0] != rfb.FramebufferUpdate || header[3] != 1 {
+		t.Fatalf("Update header = %v, want one rectangle", header[:4])
+	}
+	pixels := make([]byte, 64*48*4)
+	if _, err := io.ReadFull(conn, pixels); err != nil {
+		t.Fatalf("Reading pixels error = %v", err)
+	}
+
+	expected := s.Frame(0)
+	for i := range expected {
+		if pixels[i] != expected[i] {
+			t.Fatalf("Pixel byte %d = %d, want %d", i, pixels[i], expected[i])
+		}
+	}
+}
+
+func TestServerControls(t *testing.T) {
+	s := Start(t, Options{Width: 32, Height: 32})
+	conn, _ := dialClient(t, s)
+
+	if !s.WaitForClients(1, 5*time.Second) {
+		t.Fatalf("Clients() = %d, want 1", s.Clients())
+	}
+
+	s.Bell()
+	s.SendClipboard("hello")
+
+	msg := make([]byte, 1)
+	if _, err := io.ReadFull(conn, msg); err != nil || msg[0] != rfb.Bell {
+		t.Errorf("First message = %v, %v, want Bell", msg, err)
+	}
+	cut := make([]byte, 8+5)
+	if _, err := io.ReadFull(conn, cut); err != nil {
+		t.Fatalf("Reading ServerCutText error = %v", err)
+	}
+	if text, err := rfb.ParseServerCutText(cut); err != nil || text != "hello" {
+		t.Errorf("ParseServerCutText() = %q, %v, want %q", text, err, "hello")
+	}
+
+	if err := s.SetAnimation("nonexistent"); err == nil {
+		t.Error("Expected error for unknown animation, but got none")
+	}
+	if err := s.Resize(0, 10); err == nil {
+		t.Error("Expected error for invalid size, but got none")
+	}
+
+	s.DisconnectAll()
+	if _, err := conn.Read(msg); err == nil {
+		t.Error("Expected connection to be closed after DisconnectAll()")
+	}
+}
+
+func TestServerClose(t *testing.T) {
+	s, err := New(Options{Logf: t.Logf})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- s.Serve(listener) }()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer conn.Close()
+	rfb.ReadRFBVersion(conn)
+
+	s.Close()
+	if err := <-done; err != ErrServerClosed {
+		t.Errorf("Serve() = %v, want ErrServerClosed", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Error("Expected client connection to be closed by Close()")
+	}
+	if err := s.Serve(listener); err != ErrServerClosed {
+		t.Errorf("Serve() after Close() = %v, want ErrServerClosed", err)
+	}
+}
+
+func TestServerShutdown(t *testing.T) {
+	s, err := New(Options{Width: 16, Height: 16, Push: true, FPS: 100, Logf: t.Logf})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	s.addr = listener.Addr()
+
+	done := make(chan error, 1)
+	go func() { done <- s.Serve(listener) }()
+
+	conn, _ := dialClient(t, s)
+	conn.Write(rfb.CreateFramebufferUpdateRequest(false, rfb.Rectangle{Width: 16, Height: 16}))
+	if _, err := io.ReadFull(conn, make([]byte, 4+12+16*16*4)); err != nil {
+		t.Fatalf("Reading update error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Errorf("Shutdown() error = %v", err)
+	}
+	if err := <-done; err != ErrServerClosed {
+		t.Errorf("Serve() = %v, want ErrServerClosed", err)
+	}
+	if _, err := io.Copy(io.Discard, conn); err != nil {
+		t.Errorf("Expected clean EOF after Shutdown(), got %v", err)
+	}
+	if n := s.Clients(); n != 0 {
+		t.Errorf("Clients() after Shutdown() = %d, want 0", n)
+	}
+}
+
+func TestSetPixelFormatWhilePushing(t *testing.T) {
+	s := Start(t, Options{Width: 16, Height: 16, Animation: "plasma", Push: true, FPS: 200})
+	conn, _ := dialClient(t, s)
+	go io.Copy(io.Discard, conn)
+
+	conn.Write(rfb.CreateFramebufferUpdateRequest(false, rfb.Rectangle{Width: 16, Height: 16}))
+	formats := []rfb.PixelFormat{rfb.DefaultPixelFormat(), rfb.DefaultPixelFormat()}
+	formats[1].BigEndianFlag = 1
+	deadline := time.Now().Add(200 * time.Millisecond)
+	for i := 0; time.Now().Before(deadline); i++ {
+		if _, err := conn.Write(rfb.CreateSetPixelFormat(formats[i%2])); err != nil {
+			t.Fatalf("Write(SetPixelFormat) error = %v", err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,74 @@
+package mockvnc
+
+import (
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// ClientStats summarizes what has been sent to one client
+type ClientStats struct {
+	Addr     string        // Client's remote address
+	Frames   int           // FramebufferUpdates with at least one rectangle
+	Bytes    int64         // Bytes written to the client, including the handshake
+	Duration time.Duration // Time since the client connected
+}
+
+// FPS returns the client's average frame rate since it connected
+func (cs ClientStats) FPS() float64 {
+	if cs.Duration <= 0 {
+		return 0
+	}
+	return float64(cs.Frames) / cs.Duration.Seconds()
+}
+
+// countingConn counts the bytes written to a client, adding them to the server's total as well
+type countingConn struct {
+	net.Conn
+	bytes atomic.Int64
+	total *atomic.Int64
+}
+
+func (c *countingConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.bytes.Add(int64(n))
+	c.total.Add(int64(n))
+	return n, err
+}
+
+// Stats returns the statistics of every connected client that has completed the handshake
+func (s *Server) Stats() []ClientStats {
+	var stats []ClientStats
+	for _, c := range s.clients() {
+		c.mutex.Lock()
+		stats = append(stats, c.stats())
+		c.mutex.Unlock()
+	}
+	return stats
+}
+
+// stats returns the client's statistics so far. Callers must hold c.mutex.
+func (c *connection) stats() ClientStats {
+	return ClientStats{
+		Addr:     c.conn.RemoteAddr().String(),
+		Frames:   c.frames,
+		Bytes:    c.counter.bytes.Load(),
+		Duration: time.Since(c.connected),
+	}
+}
+
+// logStats logs the client's statistics as key=value pairs. Callers must hold c.mutex.
+func (c *connection) logStats() {
+	st := c.stats()
+	c.logf("Stats client=%s frames=%d bytes=%d duration=%s fps=%.1f",
+		st.Addr, st.Frames, st.Bytes, st.Duration.Round(time.Millisecond), st.FPS())
+}
+
+// throttleDelay returns how long the next framebuffer update must wait to
+// keep the client under Options.MaxFPS. Callers must hold c.mutex.
+func (c *connection) throttleDelay() time.Duration {
+	if c.server.opts.MaxFPS <= 0 || c.lastFrame.IsZero() {
+		return 0
+	}
+	return time.Until(c.lastFrame.Add(time.Second / time.Duration(c.server.opts.MaxFPS)))
+}
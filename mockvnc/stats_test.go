@@ -0,0 +1,42 @@
+package mockvnc
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/coder/websockify/rfb"
+)
+
+func TestMaxFPSAndStats(t *testing.T) {
+	s := Start(t, Options{Width: 8, Height: 8, MaxFPS: 20})
+	conn, _ := dialClient(t, s)
+
+	const updates = 5
+	start := time.Now()
+	for i := 0; i < updates; i++ {
+		conn.Write(rfb.CreateFramebufferUpdateRequest(false, rfb.Rectangle{Width: 8, Height: 8}))
+		if _, err := io.ReadFull(conn, make([]byte, 4+12+8*8*4)); err != nil {
+			t.Fatalf("Reading update %d error = %v", i, err)
+		}
+	}
+
+	// The first update is immediate, then one every 50ms
+	if elapsed := time.Since(start); elapsed < (updates-1)*50*time.Millisecond {
+		t.Errorf("%d updates took %v, want at least %v at MaxFPS 20", updates, elapsed, (updates-1)*50*time.Millisecond)
+	}
+
+	stats := s.Stats()
+	if len(stats) != 1 {
+		t.Fatalf("Stats() returned %d clients, want 1", len(stats))
+	}
+	if stats[0].Frames != updates {
+		t.Errorf("Frames = %d, want %d", stats[0].Frames, updates)
+	}
+	if minBytes := int64(updates * (4 + 12 + 8*8*4)); stats[0].Bytes < minBytes {
+		t.Errorf("Bytes = %d, want at least %d", stats[0].Bytes, minBytes)
+	}
+	if stats[0].FPS() <= 0 {
+		t.Errorf("FPS() = %v, want positive", stats[0].FPS())
+	}
+}
@@ -0,0 +1,79 @@
+package mockvnc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"time"
+
+	"github.com/coder/websockify/rfb"
+)
+
+// SelfSignedCertificate creates a certificate for localhost valid for one year
+func SelfSignedCertificate() (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to generate key: %v", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to generate serial number: %v", err)
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "vncserver"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.AddDate(1, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to create certificate: %v", err)
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
+
+// startVeNCrypt negotiates a VeNCrypt X509 subtype and upgrades the connection
+// to TLS. X509Vnc is offered when a password is set, so VNC Authentication
+// then runs inside the TLS session; otherwise X509None is offered.
+func (c *connection) startVeNCrypt() error {
+	subtype := uint32(rfb.VeNCryptX509None)
+	if c.server.opts.Password != "" {
+		subtype = rfb.VeNCryptX509Vnc
+	}
+
+	if _, err := rfb.VeNCryptServerHandshake(c.conn, []uint32{subtype}); err != nil {
+		return err
+	}
+
+	// A recording keeps capturing the plaintext RFB stream inside the TLS session
+	transport := c.conn
+	recorder, recording := c.conn.(*recordingConn)
+	if recording {
+		transport = recorder.Conn
+	}
+
+	tlsConn := tls.Server(transport, c.server.opts.TLSConfig)
+	if err := tlsConn.Handshake(); err != nil {
+		return fmt.Errorf("VeNCrypt TLS handshake failed: %v", err)
+	}
+	c.logf("VeNCrypt %s negotiated (%s)", rfb.VeNCryptSubtypeName(subtype), tls.VersionName(tlsConn.ConnectionState().Version))
+	if recording {
+		recorder.Conn = tlsConn
+	} else {
+		c.conn = tlsConn
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package mockvnc
+
+import (
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/coder/websockify/rfb"
+	"github.com/gorilla/websocket"
+)
+
+// wsUpgrader accepts RFB over WebSocket from any origin, offering the
+// "binary" subprotocol to clients that ask for it
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	Subprotocols:    []string{"binary"},
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
+}
+
+// serveWebSocket answers WebSocket upgrades on any path and runs the RFB
+// protocol over each one, as websockify's clients would see it
+func (s *Server) serveWebSocket(listener net.Listener) error {
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ws, err := wsUpgrader.Upgrade(w, r, nil)
+			if err != nil {
+				s.logf("WebSocket upgrade from %s failed: %v", r.RemoteAddr, err)
+				return
+			}
+			s.handleConnection(rfb.NewWebSocketConn(ws))
+		}),
+	}
+
+	err := server.Serve(listener)
+	if errors.Is(err, net.ErrClosed) {
+		return s.serveError(err)
+	}
+	return err
+}
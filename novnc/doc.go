@@ -0,0 +1,11 @@
+// Package novnc bundles a noVNC build, so the websockify binary can serve a
+// complete browser VNC client itself through Config.WebFS.
+//
+// The files are downloaded into dist by scripts/fetch-novnc.sh and embedded
+// only when building with the novnc tag:
+//
+//	scripts/fetch-novnc.sh
+//	go build -tags novnc ./cmd/websockify
+//
+// Without the tag the package embeds nothing and FS returns an error.
+package novnc
@@ -0,0 +1,24 @@
+//go:build novnc
+
+package novnc
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+)
+
+//go:embed all:dist
+var dist embed.FS
+
+// FS returns the bundled noVNC files, with vnc.html at the root.
+func FS() (fs.FS, error) {
+	files, err := fs.Sub(dist, "dist")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fs.Stat(files, "vnc.html"); err != nil {
+		return nil, fmt.Errorf("novnc/dist has no noVNC build; run scripts/fetch-novnc.sh and build again")
+	}
+	return files, nil
+}
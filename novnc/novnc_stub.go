@@ -0,0 +1,13 @@
+//go:build !novnc
+
+package novnc
+
+import (
+	"fmt"
+	"io/fs"
+)
+
+// FS returns an error, since this build does not bundle noVNC.
+func FS() (fs.FS, error) {
+	return nil, fmt.Errorf("this build does not bundle noVNC; run scripts/fetch-novnc.sh and build with -tags novnc")
+}
@@ -0,0 +1,102 @@
+package rfb
+
+import (
+	"crypto/des"
+	"crypto/rand"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"net"
+)
+
+const (
+	// VNCAuthChallengeLength is the size of the VNC Authentication challenge and response
+	VNCAuthChallengeLength = 16
+
+	// maxSecurityReasonLength bounds the failure reason a client will read
+	maxSecurityReasonLength = 64 << 10
+)
+
+// NewVNCAuthChallenge returns a random challenge for VNC Authentication
+func NewVNCAuthChallenge() ([]byte, error) {
+	challenge := make([]byte, VNCAuthChallengeLength)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+// EncryptVNCAuthChallenge computes the VNC Authentication response to a challenge.
+// The password is truncated or zero-padded to 8 bytes and, as in the reference
+// implementation, each key byte is bit-reversed before use as a DES key.
+func EncryptVNCAuthChallenge(password string, challenge []byte) ([]byte, error) {
+	if len(challenge) != VNCAuthChallengeLength {
+		return nil, fmt.Errorf("VNC auth challenge must be %d bytes, got %d", VNCAuthChallengeLength, len(challenge))
+	}
+
+	key := make([]byte, 8)
+	copy(key, password)
+	for i, b := range key {
+		key[i] = reverseBits(b)
+	}
+
+	block, err := des.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	response := make([]byte, VNCAuthChallengeLength)
+	block.Encrypt(response[:8], challenge[:8])
+	block.Encrypt(response[8:], challenge[8:])
+	return response, nil
+}
+
+// CheckVNCAuthResponse reports whether response answers challenge for password
+func CheckVNCAuthResponse(password string, challenge, response []byte) bool {
+	expected, err := EncryptVNCAuthChallenge(password, challenge)
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(expected, response) == 1
+}
+
+// SendSecurityFailure sends a failed security result followed by the RFB 3.8 reason string
+func SendSecurityFailure(conn net.Conn, reason string) error {
+	msg := make([]byte, 8+len(reason))
+	msg[3] = SecurityResultFailed
+	msg[4] = uint8(len(reason) >> 24)
+	msg[5] = uint8(len(reason) >> 16)
+	msg[6] = uint8(len(reason) >> 8)
+	msg[7] = uint8(len(reason))
+	copy(msg[8:], reason)
+	_, err := conn.Write(msg)
+	return err
+}
+
+// ReadSecurityFailureReason reads the reason string that follows a failed security result
+func ReadSecurityFailureReason(conn net.Conn) (string, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return "", err
+	}
+	length := uint32(header[0])<<24 | uint32(header[1])<<16 | uint32(header[2])<<8 | uint32(header[3])
+	if length > maxSecurityReasonLength {
+		return "", fmt.Errorf("security failure reason too long: %d bytes", length)
+	}
+
+	reason := make([]byte, length)
+	if _, err := io.ReadFull(conn, reason); err != nil {
+		return "", err
+	}
+	return string(reason), nil
+}
+
+// reverseBits mirrors the bit order of a byte
+func reverseBits(b byte) byte {
+	var r byte
+	for i := 0; i < 8; i++ {
+		r = r<<1 | b&1
+		b >>= 1
+	}
+	return r
+}
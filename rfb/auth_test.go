@@ -0,0 +1,107 @@
+package rfb
+
+import (
+	"bytes"
+	"net"
+	"testing"
+)
+
+func TestVNCAuthChallengeResponse(t *testing.T) {
+	challenge, err := NewVNCAuthChallenge()
+	if err != nil {
+		t.Fatalf("NewVNCAuthChallenge() error = %v", err)
+	}
+	if len(challenge) != VNCAuthChallengeLength {
+		t.Fatalf("Challenge length = %d, want %d", len(challenge), VNCAuthChallengeLength)
+	}
+
+	response, err := EncryptVNCAuthChallenge("secret", challenge)
+	if err != nil {
+		t.Fatalf("EncryptVNCAuthChallenge() error = %v", err)
+	}
+	if bytes.Equal(response, challenge) {
+		t.Error("Response should differ from the challenge")
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		expected bool
+	}{
+		{"Correct password", "secret", true},
+		{"Wrong password", "Secret", false},
+		{"Empty password", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CheckVNCAuthResponse(tt.password, challenge, response); got != tt.expected {
+				t.Errorf("CheckVNCAuthResponse() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+
+	if CheckVNCAuthResponse("secret", challenge, response[:8]) {
+		t.Error("CheckVNCAuthResponse() accepted a truncated response")
+	}
+}
+
+func TestEncryptVNCAuthChallengeTruncatesPassword(t *testing.T) {
+	challenge := bytes.Repeat([]byte{0x5A}, VNCAuthChallengeLength)
+
+	long, err := EncryptVNCAuthChallenge("password123", challenge)
+	if err != nil {
+		t.Fatalf("EncryptVNCAuthChallenge() error = %v", err)
+	}
+	short, err := EncryptVNCAuthChallenge("password", challenge)
+	if err != nil {
+		t.Fatalf("EncryptVNCAuthChallenge() error = %v", err)
+	}
+	if !bytes.Equal(long, short) {
+		t.Error("Only the first 8 password bytes should be significant")
+	}
+
+	if _, err := EncryptVNCAuthChallenge("password", challenge[:8]); err == nil {
+		t.Error("Expected error for short challenge, but got none")
+	}
+}
+
+func TestReverseBits(t *testing.T) {
+	tests := []struct {
+		in, expected byte
+	}{
+		{0x00, 0x00},
+		{0x01, 0x80},
+		{0x0F, 0xF0},
+		{0x61, 0x86}, // 'a'
+		{0xFF, 0xFF},
+	}
+	for _, tt := range tests {
+		if got := reverseBits(tt.in); got != tt.expected {
+			t.Errorf("reverseBits(%#x) = %#x, want %#x", tt.in, got, tt.expected)
+		}
+	}
+}
+
+func TestSecurityFailureRoundTrip(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	go SendSecurityFailure(server, "Authentication failed")
+
+	result, err := ReadSecurityResult(client)
+	if err != nil {
+		t.Fatalf("ReadSecurityResult() error = %v", err)
+	}
+	if result != SecurityResultFailed {
+		t.Errorf("Security result = %d, want %d", result, SecurityResultFailed)
+	}
+
+	reason, err := ReadSecurityFailureReason(client)
+	if err != nil {
+		t.Fatalf("ReadSecurityFailureReason() error = %v", err)
+	}
+	if reason != "Authentication failed" {
+		t.Errorf("Reason = %q, want %q", reason, "Authentication failed")
+	}
+}
@@ -0,0 +1,249 @@
+package rfb
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"testing"
+)
+
+// benchmarkSizes covers a small update rectangle through a full HD framebuffer
+var benchmarkSizes = []struct {
+	width  int
+	height int
+}{
+	{64, 64},
+	{800, 600},
+	{1920, 1080},
+}
+
+// benchmarkFormats are the pixel formats commonly requested by clients
+var benchmarkFormats = []struct {
+	name   string
+	format PixelFormat
+}{
+	{"32bpp", DefaultPixelFormat()},
+	{"32bpp-BE", PixelFormat{
+		BitsPerPixel: 32, Depth: 24, BigEndianFlag: 1, TrueColorFlag: 1,
+		RedMax: 255, GreenMax: 255, BlueMax: 255,
+		RedShift: 0, GreenShift: 8, BlueShift: 16,
+	}},
+	{"24bpp", PixelFormat{
+		BitsPerPixel: 24, Depth: 24, TrueColorFlag: 1,
+		RedMax: 255, GreenMax: 255, BlueMax: 255,
+		RedShift: 16, GreenShift: 8, BlueShift: 0,
+	}},
+	{"16bpp", RGB565PixelFormat()},
+	{"8bpp", PixelFormat{
+		BitsPerPixel: 8, Depth: 8, TrueColorFlag: 1,
+		RedMax: 7, GreenMax: 7, BlueMax: 3,
+		RedShift: 5, GreenShift: 2, BlueShift: 0,
+	}},
+}
+
+// benchmarkFrame returns deterministic BGRA test data with some variation
+func benchmarkFrame(width, height int) []byte {
+	data := make([]byte, width*height*4)
+	for i := 0; i < len(data); i += 4 {
+		pixel := i / 4
+		data[i] = uint8(pixel % width)
+		data[i+1] = uint8(pixel / width)
+		data[i+2] = uint8(pixel * 7)
+		data[i+3] = 255
+	}
+	return data
+}
+
+// BenchmarkConvertPixelFormat measures producing a Raw rectangle payload in the client's format
+func BenchmarkConvertPixelFormat(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		frame := benchmarkFrame(size.width, size.height)
+		for _, f := range benchmarkFormats {
+			b.Run(fmt.Sprintf("%s/%dx%d", f.name, size.width, size.height), func(b *testing.B) {
+				b.ReportAllocs()
+				b.SetBytes(int64(len(frame)))
+				for i := 0; i < b.N; i++ {
+					ConvertPixelFormat(frame, size.width, size.height, f.format)
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkConvertPixelToRGBA(b *testing.B) {
+	for _, f := range benchmarkFormats {
+		bpp := int(f.format.BitsPerPixel) / 8
+		pixel := ConvertPixelFormat([]byte{0x10, 0x80, 0xF0, 0xFF}, 1, 1, f.format)[:bpp]
+		b.Run(f.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				ConvertPixelToRGBA(pixel, f.format)
+			}
+		})
+	}
+}
+
+// BenchmarkRawDecode measures decoding a Raw rectangle into an RGBA image the way clients do
+func BenchmarkRawDecode(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		frame := benchmarkFrame(size.width, size.height)
+		for _, f := range benchmarkFormats {
+			data := ConvertPixelFormat(frame, size.width, size.height, f.format)
+			bpp := int(f.format.BitsPerPixel) / 8
+			b.Run(fmt.Sprintf("%s/%dx%d", f.name, size.width, size.height), func(b *testing.B) {
+				img := image.NewRGBA(image.Rect(0, 0, size.width, size.height))
+				b.ReportAllocs()
+				b.SetBytes(int64(len(data)))
+				for i := 0; i < b.N; i++ {
+					for p := 0; p < size.width*size.height; p++ {
+						img.SetRGBA(p%size.width, p/size.width, ConvertPixelToRGBA(data[p*bpp:(p+1)*bpp], f.format))
+					}
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkReadPixelValue(b *testing.B) {
+	for _, bpp := range []int{1, 2, 3, 4} {
+		buf := make([]byte, bpp)
+		b.Run(fmt.Sprintf("%dbytes", bpp), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				ReadPixelValue(buf, 0)
+			}
+		})
+	}
+}
+
+func BenchmarkWritePixelValue(b *testing.B) {
+	for _, bpp := range []int{1, 2, 3, 4} {
+		buf := make([]byte, bpp)
+		b.Run(fmt.Sprintf("%dbytes", bpp), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				WritePixelValue(buf, uint32(i), 1)
+			}
+		})
+	}
+}
+
+// BenchmarkEncode measures each server-side encoder on the same frames
+func BenchmarkEncode(b *testing.B) {
+	for _, enc := range SupportedEncodings() {
+		for _, size := range benchmarkSizes {
+			frame := benchmarkFrame(size.width, size.height)
+			b.Run(fmt.Sprintf("%s/%dx%d", EncodingName(enc), size.width, size.height), func(b *testing.B) {
+				e := NewEncoder(enc)
+				b.ReportAllocs()
+				b.SetBytes(int64(len(frame)))
+				for i := 0; i < b.N; i++ {
+					e.Encode(frame, size.width, size.height, DefaultPixelFormat())
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkDecode measures each client-side decoder on the output of its
+// encoder, for the encodings the package can also produce
+func BenchmarkDecode(b *testing.B) {
+	for _, enc := range SupportedEncodings() {
+		for _, size := range benchmarkSizes {
+			data := NewEncoder(enc).Encode(benchmarkFrame(size.width, size.height), size.width, size.height, DefaultPixelFormat())
+			b.Run(fmt.Sprintf("%s/%dx%d", EncodingName(enc), size.width, size.height), func(b *testing.B) {
+				d := NewDecoder(enc)
+				b.ReportAllocs()
+				b.SetBytes(int64(size.width * size.height * 4))
+				for i := 0; i < b.N; i++ {
+					if _, err := d.Decode(bytes.NewReader(data), size.width, size.height, DefaultPixelFormat()); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+// tightBenchmarkRect encodes frame as one Tight rectangle of the given kind.
+// Rectangles sent through zlib reset stream 0 so each decode starts afresh.
+func tightBenchmarkRect(b *testing.B, kind string, frame []byte, width, height int) []byte {
+	rgb := make([]byte, 0, width*height*3)
+	for i := 0; i < len(frame); i += 4 {
+		rgb = append(rgb, frame[i+2], frame[i+1], frame[i])
+	}
+	compressed := func(data []byte) []byte {
+		var buf bytes.Buffer
+		zw := zlib.NewWriter(&buf)
+		zw.Write(data)
+		zw.Close()
+		return append(appendTightLength(nil, buf.Len()), buf.Bytes()...)
+	}
+
+	switch kind {
+	case "fill":
+		return []byte{TightFill << 4, rgb[0], rgb[1], rgb[2]}
+	case "copy":
+		return append([]byte{0x01}, compressed(rgb)...)
+	case "palette":
+		// Two colours, one bit per pixel
+		rowBytes := (width + 7) / 8
+		bits := make([]byte, rowBytes*height)
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				if (x/8+y/8)%2 == 0 {
+					bits[y*rowBytes+x/8] |= 0x80 >> (x % 8)
+				}
+			}
+		}
+		rect := []byte{TightExplicitFilter<<4 | 0x01, TightFilterPalette, 1, 0, 0, 0, 255, 255, 255}
+		return append(rect, compressed(bits)...)
+	case "gradient":
+		// Each component minus its prediction from its neighbours
+		component := func(x, y, c int) int {
+			if x < 0 || y < 0 {
+				return 0
+			}
+			return int(rgb[(y*width+x)*3+c])
+		}
+		data := make([]byte, 0, len(rgb))
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				for c := 0; c < 3; c++ {
+					prediction := min(max(component(x-1, y, c)+component(x, y-1, c)-component(x-1, y-1, c), 0), 255)
+					data = append(data, byte(component(x, y, c)-prediction))
+				}
+			}
+		}
+		return append([]byte{TightExplicitFilter<<4 | 0x01, TightFilterGradient}, compressed(data)...)
+	case "jpeg":
+		img := &image.RGBA{Pix: frame, Stride: width * 4, Rect: image.Rect(0, 0, width, height)}
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 75}); err != nil {
+			b.Fatal(err)
+		}
+		return append(appendTightLength([]byte{TightJPEG << 4}, buf.Len()), buf.Bytes()...)
+	}
+	b.Fatalf("unknown Tight rectangle kind %q", kind)
+	return nil
+}
+
+// BenchmarkTightDecode measures the Tight decoder, which the package has no
+// encoder for, on rectangles encoded once up front with each compression
+func BenchmarkTightDecode(b *testing.B) {
+	for _, kind := range []string{"fill", "copy", "palette", "gradient", "jpeg"} {
+		for _, size := range benchmarkSizes {
+			data := tightBenchmarkRect(b, kind, benchmarkFrame(size.width, size.height), size.width, size.height)
+			b.Run(fmt.Sprintf("%s/%dx%d", kind, size.width, size.height), func(b *testing.B) {
+				d := NewTightDecoder()
+				b.ReportAllocs()
+				b.SetBytes(int64(size.width * size.height * 4))
+				for i := 0; i < b.N; i++ {
+					if _, err := d.Decode(bytes.NewReader(data), size.width, size.height, DefaultPixelFormat()); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package rfb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+)
+
+// ColorMap holds the colours a server has set with SetColorMapEntries. Pixels
+// in a pixel format without true colour are indices into it.
+type ColorMap []color.RGBA
+
+// Set stores colors from index first onwards, growing the map as needed
+func (m *ColorMap) Set(first int, colors []color.RGBA) {
+	if end := first + len(colors); end > len(*m) {
+		*m = append(*m, make(ColorMap, end-len(*m))...)
+	}
+	copy((*m)[first:], colors)
+}
+
+// Apply replaces the pixels of rect in img, decoded with IndexPixelFormat,
+// with the colours they index. Transparent pixels, such as those outside a
+// cursor's mask, and indices the server has not set are left as they are.
+func (m ColorMap) Apply(img *image.RGBA, rect image.Rectangle) {
+	rect = rect.Intersect(img.Rect)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			c := img.RGBAAt(x, y)
+			if c.A == 0 {
+				continue
+			}
+			if index := int(c.G)<<8 | int(c.R); index < len(m) {
+				img.SetRGBA(x, y, m[index])
+			}
+		}
+	}
+}
+
+// IndexPixelFormat returns a true colour stand-in for a colour map pixel
+// format, so the decoders return each pixel's index in the red (low byte) and
+// green (high byte) components for ColorMap.Apply to look up
+func IndexPixelFormat(pf PixelFormat) PixelFormat {
+	pf.TrueColorFlag = 1
+	pf.RedMax, pf.RedShift = 255, 0
+	pf.GreenMax, pf.GreenShift = 255, 8
+	pf.BlueMax, pf.BlueShift = 0, 0
+	switch pf.BitsPerPixel {
+	case 8:
+		pf.GreenMax = 0
+	case 32:
+		// ZRLE and Tight only send 3-byte pixels for true colour
+		// formats of depth 24 or less
+		pf.Depth = 32
+	}
+	return pf
+}
+
+// CreateSetColorMapEntries creates a SetColorMapEntries message setting the
+// colour map from index first onwards
+func CreateSetColorMapEntries(first uint16, colors []color.RGBA) []byte {
+	msg := make([]byte, 6, 6+len(colors)*6)
+	msg[0] = SetColorMapEntries
+	binary.BigEndian.PutUint16(msg[2:], first)
+	binary.BigEndian.PutUint16(msg[4:], uint16(len(colors)))
+	for _, c := range colors {
+		// Components are 16 bits on the wire
+		msg = binary.BigEndian.AppendUint16(msg, uint16(c.R)*257)
+		msg = binary.BigEndian.AppendUint16(msg, uint16(c.G)*257)
+		msg = binary.BigEndian.AppendUint16(msg, uint16(c.B)*257)
+	}
+	return msg
+}
+
+// ReadSetColorMapEntries reads the rest of a SetColorMapEntries message after
+// its message type
+func ReadSetColorMapEntries(r io.Reader) (first uint16, colors []color.RGBA, err error) {
+	header := make([]byte, 5) // Padding, first colour and number of colours
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, nil, err
+	}
+	first = binary.BigEndian.Uint16(header[1:])
+	count := int(binary.BigEndian.Uint16(header[3:]))
+	if int(first)+count > 1<<16 {
+		return 0, nil, fmt.Errorf("colour map entries %d to %d exceed 65536 colours", first, int(first)+count-1)
+	}
+
+	data := make([]byte, count*6)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return 0, nil, err
+	}
+	colors = make([]color.RGBA, count)
+	for i := range colors {
+		entry := data[i*6:]
+		colors[i] = color.RGBA{
+			R: entry[0],
+			G: entry[2],
+			B: entry[4],
+			A: 255,
+		}
+	}
+	return first, colors, nil
+}
@@ -0,0 +1,85 @@
+package rfb
+
+import (
+	"bytes"
+	"image/color"
+	"testing"
+)
+
+func TestSetColorMapEntriesRoundTrip(t *testing.T) {
+	colors := []color.RGBA{{R: 255, A: 255}, {G: 128, A: 255}, {R: 1, G: 2, B: 3, A: 255}}
+	msg := CreateSetColorMapEntries(10, colors)
+	if msg[0] != SetColorMapEntries {
+		t.Fatalf("message type = %d, want %d", msg[0], SetColorMapEntries)
+	}
+
+	first, got, err := ReadSetColorMapEntries(bytes.NewReader(msg[1:]))
+	if err != nil {
+		t.Fatalf("ReadSetColorMapEntries() error = %v", err)
+	}
+	if first != 10 {
+		t.Errorf("first = %d, want 10", first)
+	}
+	if len(got) != len(colors) {
+		t.Fatalf("got %d colors, want %d", len(got), len(colors))
+	}
+	for i := range colors {
+		if got[i] != colors[i] {
+			t.Errorf("color %d = %v, want %v", i, got[i], colors[i])
+		}
+	}
+
+	if _, _, err := ReadSetColorMapEntries(bytes.NewReader([]byte{0, 0xFF, 0xFF, 0, 2})); err == nil {
+		t.Error("ReadSetColorMapEntries() past index 65535 succeeded, want error")
+	}
+}
+
+func TestColorMapDecode(t *testing.T) {
+	var colorMap ColorMap
+	colorMap.Set(0, []color.RGBA{{R: 255, A: 255}, {G: 255, A: 255}})
+	colorMap.Set(300, []color.RGBA{{B: 255, A: 255}})
+	if len(colorMap) != 301 {
+		t.Fatalf("len(ColorMap) = %d after setting index 300, want 301", len(colorMap))
+	}
+	red, green, blue := colorMap[0], colorMap[1], colorMap[300]
+
+	tests := []struct {
+		name string
+		pf   PixelFormat
+		data []byte
+		want []color.RGBA
+	}{
+		{
+			name: "8bpp",
+			pf:   PixelFormat{BitsPerPixel: 8, Depth: 8},
+			data: []byte{0, 1, 1, 0},
+			want: []color.RGBA{red, green, green, red},
+		},
+		{
+			name: "16bpp big-endian",
+			pf:   PixelFormat{BitsPerPixel: 16, Depth: 16, BigEndianFlag: 1},
+			data: []byte{0x01, 0x2C, 0, 1, 0, 0, 0x01, 0x2C},
+			want: []color.RGBA{blue, green, red, blue},
+		},
+		{
+			name: "32bpp little-endian",
+			pf:   PixelFormat{BitsPerPixel: 32, Depth: 32},
+			data: []byte{0x2C, 0x01, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0},
+			want: []color.RGBA{blue, green, red, green},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, err := RawDecoder{}.Decode(bytes.NewReader(tt.data), 2, 2, IndexPixelFormat(tt.pf))
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			colorMap.Apply(img, img.Rect)
+			for i, want := range tt.want {
+				if got := img.RGBAAt(i%2, i/2); got != want {
+					t.Errorf("pixel %d = %v, want %v", i, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package rfb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+)
+
+const (
+	// MaxClientCutTextLength bounds the ClientCutText payload accepted by ReadMessage
+	MaxClientCutTextLength = 16 << 20
+
+	// MaxServerCutTextLength bounds the ServerCutText text a client will read
+	MaxServerCutTextLength = 16 << 20
+
+	// clientMessageHeaderLength is the longest fixed header needed to size a client message
+	clientMessageHeaderLength = 8
+)
+
+// aLongTimeAgo is a non-zero time in the past, used to unblock pending I/O immediately
+var aLongTimeAgo = time.Unix(1, 0)
+
+// NewConnection wraps conn with the default pixel format and no I/O deadline
+func NewConnection(conn net.Conn) *Connection {
+	return &Connection{
+		Conn:        conn,
+		PixelFormat: DefaultPixelFormat(),
+	}
+}
+
+// ReadMessage reads one complete client-to-server message. It returns early
+// with ctx.Err() when the context is cancelled, and with an error wrapping
+// os.ErrDeadlineExceeded when the per-message Timeout elapses.
+func (c *Connection) ReadMessage(ctx context.Context) ([]byte, error) {
+	var msg []byte
+	err := c.withDeadline(ctx, c.Conn.SetReadDeadline, func() error {
+		var err error
+		msg, err = readClientMessage(c.Conn)
+		return err
+	})
+	return msg, err
+}
+
+// WriteMessage writes msg in full, honoring context cancellation and the per-message Timeout
+func (c *Connection) WriteMessage(ctx context.Context, msg []byte) error {
+	return c.withDeadline(ctx, c.Conn.SetWriteDeadline, func() error {
+		_, err := c.Conn.Write(msg)
+		return err
+	})
+}
+
+// ReadFull reads exactly len(buf) bytes, honoring context cancellation and the per-message Timeout
+func (c *Connection) ReadFull(ctx context.Context, buf []byte) error {
+	return c.withDeadline(ctx, c.Conn.SetReadDeadline, func() error {
+		_, err := io.ReadFull(c.Conn, buf)
+		return err
+	})
+}
+
+// withDeadline runs op with a deadline derived from c.Timeout and the context,
+// interrupting it by moving the deadline into the past if ctx is cancelled.
+// A net.Conn such as a TCP connection can be used again after that, but over
+// a WebSocketConn a timed out or interrupted read ends the stream for good.
+func (c *Connection) withDeadline(ctx context.Context, setDeadline func(time.Time) error, op func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	var deadline time.Time
+	if c.Timeout > 0 {
+		deadline = time.Now().Add(c.Timeout)
+	}
+	fromContext := false
+	if d, ok := ctx.Deadline(); ok && (deadline.IsZero() || d.Before(deadline)) {
+		deadline = d
+		fromContext = true
+	}
+	if err := setDeadline(deadline); err != nil {
+		return err
+	}
+
+	stop := context.AfterFunc(ctx, func() {
+		setDeadline(aLongTimeAgo)
+	})
+	err := op()
+	if !stop() && err != nil {
+		// The context fired while op was blocked; report why
+		return ctx.Err()
+	}
+	if err != nil && errors.Is(err, os.ErrDeadlineExceeded) {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if fromContext {
+			// The I/O deadline can fire just before the context's own timer
+			return context.DeadlineExceeded
+		}
+		return fmt.Errorf("message deadline exceeded: %w", err)
+	}
+	return err
+}
+
+// readClientMessage reads a single framed client-to-server message from r
+func readClientMessage(r io.Reader) ([]byte, error) {
+	header := make([]byte, clientMessageHeaderLength)
+	if _, err := io.ReadFull(r, header[:1]); err != nil {
+		return nil, err
+	}
+
+	// Variable-length messages carry their payload size in a fixed header
+	headerLen := 1
+	switch header[0] {
+	case SetEncodings:
+		headerLen = 4
+	case ClientCutText:
+		headerLen = 8
+	}
+	if _, err := io.ReadFull(r, header[1:headerLen]); err != nil {
+		return nil, err
+	}
+
+	length, err := GetMessageLength(header[0], header[:headerLen])
+	if err != nil {
+		return nil, err
+	}
+	if header[0] == ClientCutText && length-8 > MaxClientCutTextLength {
+		return nil, fmt.Errorf("ClientCutText of %d bytes exceeds limit of %d", length-8, MaxClientCutTextLength)
+	}
+
+	msg := make([]byte, length)
+	copy(msg, header[:headerLen])
+	if _, err := io.ReadFull(r, msg[headerLen:]); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
@@ -0,0 +1,133 @@
+package rfb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestConnectionReadMessage(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	setEncodings := []byte{SetEncodings, 0, 0, 2, 0, 0, 0, 0, 0xFF, 0xFF, 0xFF, 0x21}
+	cutText := append([]byte{ClientCutText, 0, 0, 0, 0, 0, 0, 5}, []byte("hello")...)
+	messages := [][]byte{
+		CreateSetPixelFormat(RGB565PixelFormat()),
+		setEncodings,
+		{FramebufferUpdateRequest, 1, 0, 0, 0, 0, 0, 10, 0, 10},
+		{KeyEvent, 1, 0, 0, 0, 0, 0, 0x61},
+		CreatePointerEvent(ButtonLeft, 1, 2),
+		cutText,
+	}
+
+	go func() {
+		for _, msg := range messages {
+			client.Write(msg)
+		}
+	}()
+
+	conn := NewConnection(server)
+	for i, want := range messages {
+		got, err := conn.ReadMessage(context.Background())
+		if err != nil {
+			t.Fatalf("ReadMessage() %d error = %v", i, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("ReadMessage() %d = %v, want %v", i, got, want)
+		}
+	}
+}
+
+func TestConnectionReadMessageRejectsUnknownType(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	go client.Write([]byte{200})
+
+	if _, err := NewConnection(server).ReadMessage(context.Background()); err == nil {
+		t.Error("Expected error for unknown message type, but got none")
+	}
+}
+
+func TestConnectionReadMessageCancel(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+
+	start := time.Now()
+	_, err := NewConnection(server).ReadMessage(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("ReadMessage() error = %v, want %v", err, context.Canceled)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("ReadMessage() took %v to observe cancellation", elapsed)
+	}
+
+	// Further calls fail immediately with the same error
+	if _, err := NewConnection(server).ReadMessage(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("ReadMessage() after cancel error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestConnectionTimeout(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	conn := NewConnection(server)
+	conn.Timeout = 20 * time.Millisecond
+
+	_, err := conn.ReadMessage(context.Background())
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("ReadMessage() error = %v, want deadline exceeded", err)
+	}
+
+	// Nobody reads the other end, so the write must time out too
+	err = conn.WriteMessage(context.Background(), CreatePointerEvent(0, 0, 0))
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("WriteMessage() error = %v, want deadline exceeded", err)
+	}
+}
+
+func TestConnectionWriteMessageContextDeadline(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	err := NewConnection(server).WriteMessage(ctx, []byte{Bell})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("WriteMessage() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestConnectionReadFull(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	go client.Write([]byte("RFB 003.008\n"))
+
+	buf := make([]byte, len(RFBVersion))
+	if err := NewConnection(server).ReadFull(context.Background(), buf); err != nil {
+		t.Fatalf("ReadFull() error = %v", err)
+	}
+	if string(buf) != RFBVersion {
+		t.Errorf("ReadFull() = %q, want %q", buf, RFBVersion)
+	}
+}
@@ -10,18 +10,36 @@ const (
 	KeyEvent              = 4
 	PointerEvent          = 5
 	ClientCutText         = 6
+	EnableContinuousUpdates = 150
 
 	// Server-to-client message types
 	FramebufferUpdate     = 0
 	SetColorMapEntries    = 1
 	Bell                  = 2
 	ServerCutText         = 3
+	EndOfContinuousUpdates = 150
 
 	// Encoding types
-	RawEncoding = 0
+	RawEncoding      = 0
+	CopyRectEncoding = 1
+	HextileEncoding  = 5
+	TightEncoding    = 7
+	ZRLEEncoding     = 16
+
+	// Pseudo-encodings
+	DesktopSizeEncoding = -223
+	CursorEncoding      = -239
+	PointerPosEncoding  = -232
+	ContinuousUpdatesEncoding = -313
 
 	// Security types
-	SecurityNone = 1
+	SecurityNone     = 1
+	SecurityVNCAuth  = 2
+	SecurityVeNCrypt = 19
+
+	// Security results
+	SecurityResultOK     = 0
+	SecurityResultFailed = 1
 
 	// Message lengths
 	SetPixelFormatLength = 20
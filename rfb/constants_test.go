@@ -56,10 +56,20 @@ func TestRFBConstants(t *testing.T) {
 		t.Errorf("RawEncoding = %d, want %d", RawEncoding, 0)
 	}
 
+	if DesktopSizeEncoding != -223 {
+		t.Errorf("DesktopSizeEncoding = %d, want %d", DesktopSizeEncoding, -223)
+	}
+
 	// Test security types per RFC 6143
 	if SecurityNone != 1 {
 		t.Errorf("SecurityNone = %d, want %d", SecurityNone, 1)
 	}
+	if SecurityVNCAuth != 2 {
+		t.Errorf("SecurityVNCAuth = %d, want %d", SecurityVNCAuth, 2)
+	}
+	if SecurityVeNCrypt != 19 {
+		t.Errorf("SecurityVeNCrypt = %d, want %d", SecurityVeNCrypt, 19)
+	}
 
 	// Test message length constants
 	if SetPixelFormatLength != 20 {
@@ -0,0 +1,59 @@
+package rfb
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// EnableContinuousUpdatesLength is the length of an EnableContinuousUpdates message
+const EnableContinuousUpdatesLength = 10
+
+// EnableContinuousUpdatesMessage represents a decoded EnableContinuousUpdates message
+type EnableContinuousUpdatesMessage struct {
+	Enable bool
+	Rectangle
+}
+
+// CreateEnableContinuousUpdates creates an EnableContinuousUpdates message.
+// While enabled, the server sends updates for r as it changes without waiting
+// for FramebufferUpdateRequests. Clients may only send it once the server has
+// announced support with EndOfContinuousUpdates.
+func CreateEnableContinuousUpdates(enable bool, r Rectangle) []byte {
+	msg := make([]byte, EnableContinuousUpdatesLength)
+	msg[0] = EnableContinuousUpdates
+	if enable {
+		msg[1] = 1
+	}
+	binary.BigEndian.PutUint16(msg[2:4], r.X)
+	binary.BigEndian.PutUint16(msg[4:6], r.Y)
+	binary.BigEndian.PutUint16(msg[6:8], r.Width)
+	binary.BigEndian.PutUint16(msg[8:10], r.Height)
+	return msg
+}
+
+// ParseEnableContinuousUpdates parses an EnableContinuousUpdates message from raw bytes
+func ParseEnableContinuousUpdates(data []byte) (EnableContinuousUpdatesMessage, error) {
+	if len(data) != EnableContinuousUpdatesLength {
+		return EnableContinuousUpdatesMessage{}, fmt.Errorf("EnableContinuousUpdates message must be exactly %d bytes, got %d", EnableContinuousUpdatesLength, len(data))
+	}
+	if data[0] != EnableContinuousUpdates {
+		return EnableContinuousUpdatesMessage{}, fmt.Errorf("not an EnableContinuousUpdates message: type %d", data[0])
+	}
+
+	return EnableContinuousUpdatesMessage{
+		Enable: data[1] != 0,
+		Rectangle: Rectangle{
+			X:      binary.BigEndian.Uint16(data[2:4]),
+			Y:      binary.BigEndian.Uint16(data[4:6]),
+			Width:  binary.BigEndian.Uint16(data[6:8]),
+			Height: binary.BigEndian.Uint16(data[8:10]),
+		},
+	}, nil
+}
+
+// CreateEndOfContinuousUpdates creates an EndOfContinuousUpdates message. A
+// server sends it when a client first lists the ContinuousUpdates
+// pseudo-encoding, to announce support, and whenever it stops continuous updates.
+func CreateEndOfContinuousUpdates() []byte {
+	return []byte{EndOfContinuousUpdates}
+}
@@ -0,0 +1,42 @@
+package rfb
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEnableContinuousUpdatesRoundTrip(t *testing.T) {
+	rect := Rectangle{X: 1, Y: 2, Width: 300, Height: 400}
+	msg := CreateEnableContinuousUpdates(true, rect)
+
+	expected := []byte{EnableContinuousUpdates, 1, 0, 1, 0, 2, 0x01, 0x2C, 0x01, 0x90}
+	if !bytes.Equal(msg, expected) {
+		t.Errorf("CreateEnableContinuousUpdates() = %v, want %v", msg, expected)
+	}
+
+	got, err := ParseEnableContinuousUpdates(msg)
+	if err != nil {
+		t.Fatalf("ParseEnableContinuousUpdates() error = %v", err)
+	}
+	if !got.Enable || got.Rectangle != rect {
+		t.Errorf("ParseEnableContinuousUpdates() = %+v, want enabled %+v", got, rect)
+	}
+
+	got, err = ParseEnableContinuousUpdates(CreateEnableContinuousUpdates(false, rect))
+	if err != nil || got.Enable {
+		t.Errorf("ParseEnableContinuousUpdates() = %+v, %v, want disabled", got, err)
+	}
+
+	if _, err := ParseEnableContinuousUpdates(msg[:9]); err == nil {
+		t.Error("Expected error for short message, but got none")
+	}
+	if _, err := ParseEnableContinuousUpdates(CreateFramebufferUpdateRequest(true, rect)); err == nil {
+		t.Error("Expected error for wrong message type, but got none")
+	}
+}
+
+func TestCreateEndOfContinuousUpdates(t *testing.T) {
+	if msg := CreateEndOfContinuousUpdates(); !bytes.Equal(msg, []byte{150}) {
+		t.Errorf("CreateEndOfContinuousUpdates() = %v, want [150]", msg)
+	}
+}
@@ -0,0 +1,51 @@
+package rfb
+
+import (
+	"image"
+	"image/color"
+	"io"
+)
+
+// CreateCursorRectangle creates a Cursor pseudo-rectangle carrying a cursor
+// shape with its hotspot at (hotX, hotY). Pixels of the BGRA image with zero
+// alpha are left out of the bitmask and so are transparent.
+func CreateCursorRectangle(hotX, hotY uint16, width, height int, bgraData []byte, pf PixelFormat) []byte {
+	r := Rectangle{X: hotX, Y: hotY, Width: uint16(width), Height: uint16(height)}
+	msg := CreateRectangleHeader(r, CursorEncoding)
+	msg = append(msg, ConvertPixelFormat(bgraData, width, height, pf)...)
+
+	rowBytes := (width + 7) / 8
+	mask := make([]byte, rowBytes*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if bgraData[(y*width+x)*4+3] != 0 {
+				mask[y*rowBytes+x/8] |= 0x80 >> (x % 8)
+			}
+		}
+	}
+	return append(msg, mask...)
+}
+
+// ReadCursor reads the pixels and bitmask of a width x height Cursor
+// pseudo-rectangle, which follow its header. Pixels outside the mask are
+// transparent in the returned image.
+func ReadCursor(r io.Reader, width, height int, pf PixelFormat) (*image.RGBA, error) {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	if err := readPixels(r, img, img.Rect, pf); err != nil {
+		return nil, err
+	}
+
+	rowBytes := (width + 7) / 8
+	mask := make([]byte, rowBytes*height)
+	if _, err := io.ReadFull(r, mask); err != nil {
+		return nil, err
+	}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if mask[y*rowBytes+x/8]&(0x80>>(x%8)) == 0 {
+				img.SetRGBA(x, y, color.RGBA{})
+			}
+		}
+	}
+	return img, nil
+}
@@ -0,0 +1,44 @@
+package rfb
+
+import (
+	"bytes"
+	"image/color"
+	"testing"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	// A 10x2 cursor, wider than one mask byte, with a transparent first column
+	const width, height = 10, 2
+	bgra := make([]byte, width*height*4)
+	for i := 0; i < width*height; i++ {
+		if i%width != 0 {
+			copy(bgra[i*4:], []byte{0, 255, 0, 255})
+		}
+	}
+
+	for _, f := range benchmarkFormats {
+		t.Run(f.name, func(t *testing.T) {
+			msg := CreateCursorRectangle(3, 1, width, height, bgra, f.format)
+			r := bytes.NewReader(msg[RectangleHeaderLength:])
+			cursor, err := ReadCursor(r, width, height, f.format)
+			if err != nil {
+				t.Fatalf("ReadCursor() error = %v", err)
+			}
+			if r.Len() != 0 {
+				t.Errorf("ReadCursor() left %d bytes unread", r.Len())
+			}
+
+			if got := cursor.RGBAAt(0, 1); got != (color.RGBA{}) {
+				t.Errorf("Masked pixel = %v, want transparent", got)
+			}
+			if got, want := cursor.RGBAAt(9, 1), (color.RGBA{G: 255, A: 255}); got != want {
+				t.Errorf("Pixel (9,1) = %v, want %v", got, want)
+			}
+		})
+	}
+
+	msg := CreateCursorRectangle(0, 0, width, height, bgra, DefaultPixelFormat())
+	if _, err := ReadCursor(bytes.NewReader(msg[RectangleHeaderLength:len(msg)-1]), width, height, DefaultPixelFormat()); err == nil {
+		t.Error("ReadCursor() of a truncated mask succeeded, want error")
+	}
+}
@@ -0,0 +1,80 @@
+package rfb
+
+import (
+	"fmt"
+	"strings"
+)
+
+// cutTextHeaderLength is the length of the ClientCutText and ServerCutText header
+const cutTextHeaderLength = 8
+
+// CreateClientCutText creates a ClientCutText message. The protocol carries
+// Latin-1 text, so characters outside it are sent as '?'.
+func CreateClientCutText(text string) []byte {
+	return createCutText(ClientCutText, text)
+}
+
+// CreateServerCutText creates a ServerCutText message. The protocol carries
+// Latin-1 text, so characters outside it are sent as '?'.
+func CreateServerCutText(text string) []byte {
+	return createCutText(ServerCutText, text)
+}
+
+// ParseClientCutText returns the text of a ClientCutText message
+func ParseClientCutText(data []byte) (string, error) {
+	return parseCutText(ClientCutText, "ClientCutText", data)
+}
+
+// ParseServerCutText returns the text of a ServerCutText message
+func ParseServerCutText(data []byte) (string, error) {
+	return parseCutText(ServerCutText, "ServerCutText", data)
+}
+
+// EncodeLatin1 converts text to Latin-1, replacing characters outside it with '?'
+func EncodeLatin1(text string) []byte {
+	out := make([]byte, 0, len(text))
+	for _, r := range text {
+		if r > 0xff {
+			r = '?'
+		}
+		out = append(out, byte(r))
+	}
+	return out
+}
+
+// DecodeLatin1 converts Latin-1 bytes to a string
+func DecodeLatin1(data []byte) string {
+	var b strings.Builder
+	b.Grow(len(data))
+	for _, c := range data {
+		b.WriteRune(rune(c))
+	}
+	return b.String()
+}
+
+func createCutText(messageType uint8, text string) []byte {
+	latin1 := EncodeLatin1(text)
+	msg := make([]byte, cutTextHeaderLength, cutTextHeaderLength+len(latin1))
+	msg[0] = messageType
+	// 3 bytes of padding (bytes 1-3)
+	msg[4] = uint8(len(latin1) >> 24)
+	msg[5] = uint8(len(latin1) >> 16)
+	msg[6] = uint8(len(latin1) >> 8)
+	msg[7] = uint8(len(latin1))
+	return append(msg, latin1...)
+}
+
+func parseCutText(messageType uint8, name string, data []byte) (string, error) {
+	if len(data) < cutTextHeaderLength {
+		return "", fmt.Errorf("%s message too short: %d bytes", name, len(data))
+	}
+	if data[0] != messageType {
+		return "", fmt.Errorf("not a %s message: type %d", name, data[0])
+	}
+
+	length := uint32(data[4])<<24 | uint32(data[5])<<16 | uint32(data[6])<<8 | uint32(data[7])
+	if uint64(len(data)-cutTextHeaderLength) != uint64(length) {
+		return "", fmt.Errorf("%s length %d does not match %d bytes of text", name, length, len(data)-cutTextHeaderLength)
+	}
+	return DecodeLatin1(data[cutTextHeaderLength:]), nil
+}
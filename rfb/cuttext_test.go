@@ -0,0 +1,72 @@
+package rfb
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCutTextRoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		expected string
+	}{
+		{"ASCII", "hello, clipboard", "hello, clipboard"},
+		{"Empty", "", ""},
+		{"Latin-1", "café", "café"},
+		{"Outside Latin-1", "€5", "?5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := CreateClientCutText(tt.text)
+			length, err := GetMessageLength(client[0], client)
+			if err != nil || length != len(client) {
+				t.Errorf("GetMessageLength() = %d, %v, want %d", length, err, len(client))
+			}
+			got, err := ParseClientCutText(client)
+			if err != nil {
+				t.Fatalf("ParseClientCutText() error = %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("ParseClientCutText() = %q, want %q", got, tt.expected)
+			}
+
+			server := CreateServerCutText(tt.text)
+			if server[0] != ServerCutText {
+				t.Errorf("Message type = %d, want %d", server[0], ServerCutText)
+			}
+			got, err = ParseServerCutText(server)
+			if err != nil {
+				t.Fatalf("ParseServerCutText() error = %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("ParseServerCutText() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseCutTextErrors(t *testing.T) {
+	msg := CreateServerCutText("abc")
+
+	if _, err := ParseClientCutText(msg); err == nil {
+		t.Error("Expected error for wrong message type, but got none")
+	}
+	if _, err := ParseServerCutText(msg[:len(msg)-1]); err == nil {
+		t.Error("Expected error for truncated text, but got none")
+	}
+	if _, err := ParseServerCutText(msg[:4]); err == nil {
+		t.Error("Expected error for truncated header, but got none")
+	}
+}
+
+func TestLatin1(t *testing.T) {
+	encoded := EncodeLatin1("ÿes")
+	if !bytes.Equal(encoded, []byte{0xff, 'e', 's'}) {
+		t.Errorf("EncodeLatin1() = %v, want [255 101 115]", encoded)
+	}
+	if got := DecodeLatin1(encoded); got != "ÿes" {
+		t.Errorf("DecodeLatin1() = %q, want %q", got, "ÿes")
+	}
+}
@@ -0,0 +1,212 @@
+package rfb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+)
+
+// Encoder produces the wire format of one rectangle in a particular encoding.
+// Input is always BGRA pixel data; output is in the client's pixel format.
+// Encoders may keep state across rectangles (ZRLE keeps one zlib stream per
+// connection), so each connection needs its own instances.
+type Encoder interface {
+	Type() int32
+	Encode(bgraData []byte, width, height int, pf PixelFormat) []byte
+}
+
+// Decoder reads one rectangle of a particular encoding from the server and
+// returns it as RGBA, the reverse of Encoder. Decoders may keep state across
+// rectangles like their encoders, so each connection needs its own instances.
+type Decoder interface {
+	Type() int32
+	Decode(r io.Reader, width, height int, pf PixelFormat) (*image.RGBA, error)
+}
+
+// NewDecoder returns a fresh decoder for the given encoding type, or nil if it is not supported
+func NewDecoder(encoding int32) Decoder {
+	switch encoding {
+	case RawEncoding:
+		return RawDecoder{}
+	case HextileEncoding:
+		return &HextileDecoder{}
+	case TightEncoding:
+		return NewTightDecoder()
+	case ZRLEEncoding:
+		return NewZRLEDecoder()
+	default:
+		return nil
+	}
+}
+
+// SupportedDecodings lists the encodings NewDecoder can read, in client preference order
+func SupportedDecodings() []int32 {
+	return []int32{TightEncoding, ZRLEEncoding, HextileEncoding, RawEncoding}
+}
+
+// NewEncoder returns a fresh encoder for the given encoding type, or nil if it is not supported
+func NewEncoder(encoding int32) Encoder {
+	switch encoding {
+	case RawEncoding:
+		return RawEncoder{}
+	case HextileEncoding:
+		return &HextileEncoder{}
+	case ZRLEEncoding:
+		return NewZRLEEncoder()
+	default:
+		return nil
+	}
+}
+
+// SupportedEncodings lists the encodings NewEncoder can produce, in server preference order
+func SupportedEncodings() []int32 {
+	return []int32{ZRLEEncoding, HextileEncoding, RawEncoding}
+}
+
+// SelectEncoding picks the first encoding in the client's preference list that the
+// server also supports. Pseudo-encodings are skipped. Raw is returned when nothing
+// matches, since every client must accept it.
+func SelectEncoding(clientEncodings, serverEncodings []int32) int32 {
+	for _, enc := range clientEncodings {
+		for _, supported := range serverEncodings {
+			if enc == supported {
+				return enc
+			}
+		}
+	}
+	return RawEncoding
+}
+
+// EncodingName returns a human-readable name for an encoding type
+func EncodingName(encoding int32) string {
+	switch encoding {
+	case RawEncoding:
+		return "Raw"
+	case CopyRectEncoding:
+		return "CopyRect"
+	case HextileEncoding:
+		return "Hextile"
+	case TightEncoding:
+		return "Tight"
+	case ZRLEEncoding:
+		return "ZRLE"
+	case DesktopSizeEncoding:
+		return "DesktopSize"
+	case CursorEncoding:
+		return "Cursor"
+	case PointerPosEncoding:
+		return "PointerPos"
+	case ContinuousUpdatesEncoding:
+		return "ContinuousUpdates"
+	default:
+		return fmt.Sprintf("Encoding(%d)", encoding)
+	}
+}
+
+// CreateSetEncodings creates a SetEncodings message
+func CreateSetEncodings(encodings []int32) []byte {
+	msg := make([]byte, 4+len(encodings)*4)
+	msg[0] = SetEncodings
+	binary.BigEndian.PutUint16(msg[2:4], uint16(len(encodings)))
+	for i, enc := range encodings {
+		binary.BigEndian.PutUint32(msg[4+i*4:], uint32(enc))
+	}
+	return msg
+}
+
+// ParseSetEncodings parses a SetEncodings message from raw bytes
+func ParseSetEncodings(data []byte) ([]int32, error) {
+	if len(data) < 4 || data[0] != SetEncodings {
+		return nil, fmt.Errorf("invalid SetEncodings message")
+	}
+	count := int(binary.BigEndian.Uint16(data[2:4]))
+	if len(data) != 4+count*4 {
+		return nil, fmt.Errorf("SetEncodings message with %d encodings must be %d bytes, got %d", count, 4+count*4, len(data))
+	}
+
+	encodings := make([]int32, count)
+	for i := range encodings {
+		encodings[i] = int32(binary.BigEndian.Uint32(data[4+i*4:]))
+	}
+	return encodings, nil
+}
+
+// RawEncoder sends pixels uncompressed in the client's pixel format
+type RawEncoder struct{}
+
+// Type returns RawEncoding
+func (RawEncoder) Type() int32 {
+	return RawEncoding
+}
+
+// Encode converts the rectangle to the client's pixel format
+func (RawEncoder) Encode(bgraData []byte, width, height int, pf PixelFormat) []byte {
+	return ConvertPixelFormat(bgraData, width, height, pf)
+}
+
+// RawDecoder reads uncompressed pixels in the server's pixel format
+type RawDecoder struct{}
+
+// Type returns RawEncoding
+func (RawDecoder) Type() int32 {
+	return RawEncoding
+}
+
+// Decode reads width*height pixels
+func (RawDecoder) Decode(r io.Reader, width, height int, pf PixelFormat) (*image.RGBA, error) {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	if err := readPixels(r, img, img.Rect, pf); err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+// pixelValues converts BGRA data into pixel values in the target format
+func pixelValues(bgraData []byte, pf PixelFormat) []uint32 {
+	values := make([]uint32, len(bgraData)/4)
+	for i := range values {
+		values[i] = BGRAToPixelValue(bgraData[i*4:i*4+4], pf)
+	}
+	return values
+}
+
+// appendPixel appends a pixel value in the target format's size and byte order
+func appendPixel(dst []byte, value uint32, pf PixelFormat) []byte {
+	var buf [4]byte
+	n := int(pf.BitsPerPixel) / 8
+	WritePixelValue(buf[:n], value, pf.BigEndianFlag)
+	return append(dst, buf[:n]...)
+}
+
+// readPixel reads one pixel in the server's format, using buf of the pixel's size
+func readPixel(r io.Reader, buf []byte, pf PixelFormat) (color.RGBA, error) {
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return color.RGBA{}, err
+	}
+	return pixelValueToRGBA(ReadPixelValue(buf, pf.BigEndianFlag), pf), nil
+}
+
+// readPixels reads the pixels of rect, row by row, into img
+func readPixels(r io.Reader, img *image.RGBA, rect image.Rectangle, pf PixelFormat) error {
+	bytesPerPixel := int(pf.BitsPerPixel) / 8
+	data := make([]byte, rect.Dx()*rect.Dy()*bytesPerPixel)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return err
+	}
+	i := 0
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			img.SetRGBA(x, y, ConvertPixelToRGBA(data[i:i+bytesPerPixel], pf))
+			i += bytesPerPixel
+		}
+	}
+	return nil
+}
+
+// fillRect sets every pixel of rect in img to c
+func fillRect(img *image.RGBA, rect image.Rectangle, c color.RGBA) {
+	draw.Draw(img, rect, &image.Uniform{C: c}, image.Point{}, draw.Src)
+}
@@ -0,0 +1,100 @@
+package rfb
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSetEncodingsRoundTrip(t *testing.T) {
+	encodings := []int32{ZRLEEncoding, HextileEncoding, RawEncoding, -223}
+	msg := CreateSetEncodings(encodings)
+
+	length, err := GetMessageLength(msg[0], msg)
+	if err != nil || length != len(msg) {
+		t.Errorf("GetMessageLength() = %d, %v, want %d", length, err, len(msg))
+	}
+
+	parsed, err := ParseSetEncodings(msg)
+	if err != nil {
+		t.Fatalf("ParseSetEncodings() error = %v", err)
+	}
+	if len(parsed) != len(encodings) {
+		t.Fatalf("ParseSetEncodings() = %v, want %v", parsed, encodings)
+	}
+	for i := range encodings {
+		if parsed[i] != encodings[i] {
+			t.Errorf("Encoding %d = %d, want %d", i, parsed[i], encodings[i])
+		}
+	}
+
+	if _, err := ParseSetEncodings(msg[:len(msg)-1]); err == nil {
+		t.Error("Expected error for truncated message, but got none")
+	}
+}
+
+func TestSelectEncoding(t *testing.T) {
+	server := SupportedEncodings()
+
+	tests := []struct {
+		name     string
+		client   []int32
+		expected int32
+	}{
+		{"Client prefers Hextile", []int32{HextileEncoding, ZRLEEncoding, RawEncoding}, HextileEncoding},
+		{"Client prefers ZRLE", []int32{ZRLEEncoding, HextileEncoding}, ZRLEEncoding},
+		{"Unsupported first", []int32{7, -223, HextileEncoding}, HextileEncoding},
+		{"Nothing in common", []int32{7, 2}, RawEncoding},
+		{"Empty list", nil, RawEncoding},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SelectEncoding(tt.client, server); got != tt.expected {
+				t.Errorf("SelectEncoding() = %d, want %d", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestNewEncoder(t *testing.T) {
+	for _, enc := range SupportedEncodings() {
+		e := NewEncoder(enc)
+		if e == nil {
+			t.Fatalf("NewEncoder(%d) = nil", enc)
+		}
+		if e.Type() != enc {
+			t.Errorf("NewEncoder(%d).Type() = %d", enc, e.Type())
+		}
+	}
+	if NewEncoder(-1) != nil {
+		t.Error("NewEncoder() for unsupported encoding should be nil")
+	}
+}
+
+func TestNewDecoder(t *testing.T) {
+	for _, enc := range SupportedDecodings() {
+		d := NewDecoder(enc)
+		if d == nil {
+			t.Fatalf("NewDecoder(%d) = nil", enc)
+		}
+		if d.Type() != enc {
+			t.Errorf("NewDecoder(%d).Type() = %d", enc, d.Type())
+		}
+	}
+	if NewDecoder(-1) != nil {
+		t.Error("NewDecoder() for unsupported encoding should be nil")
+	}
+}
+
+func TestRawEncoder(t *testing.T) {
+	bgra := []byte{1, 2, 3, 255, 4, 5, 6, 255}
+	out := RawEncoder{}.Encode(bgra, 2, 1, DefaultPixelFormat())
+	if !bytes.Equal(out, bgra) {
+		t.Errorf("Encode() = %v, want %v", out, bgra)
+	}
+
+	out = RawEncoder{}.Encode(bgra, 2, 1, RGB565PixelFormat())
+	if len(out) != 4 {
+		t.Errorf("Encode() to RGB565 length = %d, want 4", len(out))
+	}
+}
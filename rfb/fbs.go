@@ -0,0 +1,187 @@
+package rfb
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FBSVersion is the header written at the start of FrameBuffer Stream files.
+// The format is the one produced by rfbproxy and vncrec: a 12-byte version
+// line followed by blocks of server-to-client data, each stored as a 32-bit
+// big-endian length, the data padded to a multiple of 4 bytes, and a 32-bit
+// big-endian timestamp in milliseconds since the start of the recording.
+const FBSVersion = "FBS 001.000\n"
+
+// MaxFBSBlockSize bounds the data of a block read from or written to a
+// recording, well above a full framebuffer update in one block
+const MaxFBSBlockSize = 64 << 20
+
+// FBSBlock is a single chunk of recorded server output
+type FBSBlock struct {
+	Data      []byte
+	Timestamp time.Duration
+}
+
+// FBSWriter records a server-to-client byte stream in FBS format
+type FBSWriter struct {
+	mutex sync.Mutex
+	w     io.Writer
+	start time.Time
+	now   func() time.Time
+}
+
+// NewFBSWriter writes the FBS header to w and starts the recording clock
+func NewFBSWriter(w io.Writer) (*FBSWriter, error) {
+	if _, err := io.WriteString(w, FBSVersion); err != nil {
+		return nil, err
+	}
+	return &FBSWriter{
+		w:     w,
+		start: time.Now(),
+		now:   time.Now,
+	}, nil
+}
+
+// Write records p as one block timestamped with the time elapsed since the
+// writer was created, so an FBSWriter can be used with io.TeeReader or io.MultiWriter.
+func (f *FBSWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if err := f.WriteBlock(FBSBlock{Data: p, Timestamp: f.now().Sub(f.start)}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// WriteBlock records a block with an explicit timestamp
+func (f *FBSWriter) WriteBlock(block FBSBlock) error {
+	if len(block.Data) > MaxFBSBlockSize {
+		return fmt.Errorf("FBS block of %d bytes exceeds limit of %d", len(block.Data), MaxFBSBlockSize)
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	padded := (len(block.Data) + 3) &^ 3
+	buf := make([]byte, 4+padded+4)
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(block.Data)))
+	copy(buf[4:], block.Data)
+	binary.BigEndian.PutUint32(buf[4+padded:], uint32(block.Timestamp/time.Millisecond))
+
+	_, err := f.w.Write(buf)
+	return err
+}
+
+// FBSReader reads blocks from an FBS recording
+type FBSReader struct {
+	r       io.Reader
+	Version string
+}
+
+// NewFBSReader validates the FBS header at the start of r
+func NewFBSReader(r io.Reader) (*FBSReader, error) {
+	header := make([]byte, len(FBSVersion))
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("failed to read FBS header: %v", err)
+	}
+	version := string(header)
+	if !strings.HasPrefix(version, "FBS 001.") || version[len(version)-1] != '\n' {
+		return nil, fmt.Errorf("not an FBS file: header %q", version)
+	}
+	return &FBSReader{r: r, Version: version}, nil
+}
+
+// ReadBlock returns the next recorded block, or io.EOF at the end of the recording
+func (f *FBSReader) ReadBlock() (FBSBlock, error) {
+	var length uint32
+	if err := binary.Read(f.r, binary.BigEndian, &length); err != nil {
+		return FBSBlock{}, err
+	}
+	if length > MaxFBSBlockSize {
+		return FBSBlock{}, fmt.Errorf("FBS block of %d bytes exceeds limit of %d", length, MaxFBSBlockSize)
+	}
+
+	padded := (int(length) + 3) &^ 3
+	data := make([]byte, padded+4)
+	if _, err := io.ReadFull(f.r, data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return FBSBlock{}, fmt.Errorf("truncated FBS block: %v", err)
+	}
+
+	timestamp := binary.BigEndian.Uint32(data[padded:])
+	return FBSBlock{
+		Data:      data[:length],
+		Timestamp: time.Duration(timestamp) * time.Millisecond,
+	}, nil
+}
+
+// FBSPlayer replays a recording as a byte stream. When Speed is greater
+// than zero, blocks are released according to their timestamps scaled by
+// Speed (1 is real time); otherwise data is returned as fast as it is read.
+type FBSPlayer struct {
+	reader  *FBSReader
+	ctx     context.Context
+	Speed   float64
+	start   time.Time
+	pending []byte
+}
+
+// NewFBSPlayer creates a player reading blocks from r. The context bounds
+// any waiting between blocks.
+func NewFBSPlayer(ctx context.Context, r *FBSReader, speed float64) *FBSPlayer {
+	return &FBSPlayer{
+		reader: r,
+		ctx:    ctx,
+		Speed:  speed,
+	}
+}
+
+// Read implements io.Reader over the recorded stream
+func (p *FBSPlayer) Read(buf []byte) (int, error) {
+	for len(p.pending) == 0 {
+		block, err := p.reader.ReadBlock()
+		if err != nil {
+			return 0, err
+		}
+		if err := p.wait(block.Timestamp); err != nil {
+			return 0, err
+		}
+		p.pending = block.Data
+	}
+
+	n := copy(buf, p.pending)
+	p.pending = p.pending[n:]
+	return n, nil
+}
+
+// wait blocks until the given recording offset is due
+func (p *FBSPlayer) wait(offset time.Duration) error {
+	if p.Speed <= 0 {
+		return p.ctx.Err()
+	}
+	if p.start.IsZero() {
+		p.start = time.Now()
+	}
+
+	due := p.start.Add(time.Duration(float64(offset) / p.Speed))
+	delay := time.Until(due)
+	if delay <= 0 {
+		return p.ctx.Err()
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-p.ctx.Done():
+		return p.ctx.Err()
+	}
+}
@@ -0,0 +1,165 @@
+package rfb
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFBSWriterFormat(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewFBSWriter(&buf)
+	if err != nil {
+		t.Fatalf("NewFBSWriter() error = %v", err)
+	}
+
+	if err := w.WriteBlock(FBSBlock{Data: []byte("RFB"), Timestamp: 1500 * time.Millisecond}); err != nil {
+		t.Fatalf("WriteBlock() error = %v", err)
+	}
+
+	expected := append([]byte(FBSVersion),
+		0, 0, 0, 3, // length
+		'R', 'F', 'B', 0, // data padded to 4 bytes
+		0, 0, 0x05, 0xDC, // timestamp 1500ms
+	)
+	if !bytes.Equal(buf.Bytes(), expected) {
+		t.Errorf("FBS output = %v, want %v", buf.Bytes(), expected)
+	}
+}
+
+func TestFBSRoundTrip(t *testing.T) {
+	blocks := []FBSBlock{
+		{Data: []byte(RFBVersion), Timestamp: 0},
+		{Data: []byte{1, 1}, Timestamp: 20 * time.Millisecond},
+		{Data: bytes.Repeat([]byte{0xAB}, 1001), Timestamp: 40 * time.Millisecond},
+	}
+
+	var buf bytes.Buffer
+	w, err := NewFBSWriter(&buf)
+	if err != nil {
+		t.Fatalf("NewFBSWriter() error = %v", err)
+	}
+	for _, b := range blocks {
+		if err := w.WriteBlock(b); err != nil {
+			t.Fatalf("WriteBlock() error = %v", err)
+		}
+	}
+
+	r, err := NewFBSReader(&buf)
+	if err != nil {
+		t.Fatalf("NewFBSReader() error = %v", err)
+	}
+	if r.Version != FBSVersion {
+		t.Errorf("Version = %q, want %q", r.Version, FBSVersion)
+	}
+
+	for i, want := range blocks {
+		got, err := r.ReadBlock()
+		if err != nil {
+			t.Fatalf("ReadBlock() %d error = %v", i, err)
+		}
+		if !bytes.Equal(got.Data, want.Data) {
+			t.Errorf("Block %d data length %d, want %d", i, len(got.Data), len(want.Data))
+		}
+		if got.Timestamp != want.Timestamp {
+			t.Errorf("Block %d timestamp = %v, want %v", i, got.Timestamp, want.Timestamp)
+		}
+	}
+
+	if _, err := r.ReadBlock(); err != io.EOF {
+		t.Errorf("ReadBlock() at end error = %v, want %v", err, io.EOF)
+	}
+}
+
+func TestFBSWriterAsWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, _ := NewFBSWriter(&buf)
+	clock := w.start
+	w.now = func() time.Time { return clock }
+
+	clock = clock.Add(250 * time.Millisecond)
+	if _, err := io.WriteString(w, "hello"); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	r, _ := NewFBSReader(&buf)
+	block, err := r.ReadBlock()
+	if err != nil {
+		t.Fatalf("ReadBlock() error = %v", err)
+	}
+	if string(block.Data) != "hello" || block.Timestamp != 250*time.Millisecond {
+		t.Errorf("Block = %q at %v, want \"hello\" at 250ms", block.Data, block.Timestamp)
+	}
+}
+
+func TestFBSReaderErrors(t *testing.T) {
+	if _, err := NewFBSReader(bytes.NewReader([]byte("RFB 003.008\n"))); err == nil {
+		t.Error("Expected error for non-FBS header, but got none")
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr string
+	}{
+		{"truncated data", []byte{0, 0, 0, 8, 1, 2}, "truncated FBS block"},
+		{"truncated padding", []byte{0, 0, 0, 3, 'R', 'F', 'B'}, "truncated FBS block"},
+		{"truncated timestamp", []byte{0, 0, 0, 3, 'R', 'F', 'B', 0, 0, 0}, "truncated FBS block"},
+		{"truncated length", []byte{0, 0}, "unexpected EOF"},
+		{"oversized", []byte{0xFF, 0xFF, 0xFF, 0xFF, 1, 2, 3, 4}, "exceeds limit"},
+		{"just over the limit", []byte{byte(MaxFBSBlockSize >> 24), 0, 0, 1}, "exceeds limit"},
+	}
+	for _, tt := range tests {
+		r, err := NewFBSReader(bytes.NewReader(append([]byte(FBSVersion), tt.data...)))
+		if err != nil {
+			t.Fatalf("NewFBSReader() error = %v", err)
+		}
+		if _, err := r.ReadBlock(); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("ReadBlock() with %s error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+
+	w, _ := NewFBSWriter(io.Discard)
+	if err := w.WriteBlock(FBSBlock{Data: make([]byte, MaxFBSBlockSize+1)}); err == nil {
+		t.Error("WriteBlock() of an oversized block succeeded, want error")
+	}
+}
+
+func TestFBSPlayer(t *testing.T) {
+	var buf bytes.Buffer
+	w, _ := NewFBSWriter(&buf)
+	w.WriteBlock(FBSBlock{Data: []byte("abc"), Timestamp: 0})
+	w.WriteBlock(FBSBlock{Data: []byte("defg"), Timestamp: 30 * time.Millisecond})
+
+	r, _ := NewFBSReader(&buf)
+	player := NewFBSPlayer(context.Background(), r, 1)
+
+	start := time.Now()
+	data, err := io.ReadAll(player)
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	if string(data) != "abcdefg" {
+		t.Errorf("Replayed data = %q, want %q", data, "abcdefg")
+	}
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Errorf("Real-time replay took %v, want at least 30ms", elapsed)
+	}
+}
+
+func TestFBSPlayerCancel(t *testing.T) {
+	var buf bytes.Buffer
+	w, _ := NewFBSWriter(&buf)
+	w.WriteBlock(FBSBlock{Data: []byte("late"), Timestamp: time.Hour})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	r, _ := NewFBSReader(&buf)
+	if _, err := NewFBSPlayer(ctx, r, 1).Read(make([]byte, 4)); err != context.Canceled {
+		t.Errorf("Read() error = %v, want %v", err, context.Canceled)
+	}
+}
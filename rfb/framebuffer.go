@@ -0,0 +1,119 @@
+package rfb
+
+import "bytes"
+
+// DefaultDamageTileSize is the tile edge length used when comparing framebuffers
+const DefaultDamageTileSize = 16
+
+// Framebuffer is a screen-sized BGRA pixel buffer (4 bytes per pixel, row-major).
+// Servers keep one per client holding what that client has been sent, and
+// compare it against the next frame to find the regions that need updating.
+type Framebuffer struct {
+	Width  int
+	Height int
+	Pix    []byte
+}
+
+// NewFramebuffer allocates a zeroed framebuffer
+func NewFramebuffer(width, height int) *Framebuffer {
+	return &Framebuffer{
+		Width:  width,
+		Height: height,
+		Pix:    make([]byte, width*height*4),
+	}
+}
+
+// Bounds returns the rectangle covering the whole framebuffer
+func (fb *Framebuffer) Bounds() Rectangle {
+	return Rectangle{Width: uint16(fb.Width), Height: uint16(fb.Height)}
+}
+
+// Region copies the pixels of r out of the framebuffer
+func (fb *Framebuffer) Region(r Rectangle) []byte {
+	return ExtractRegion(fb.Pix, fb.Width, r)
+}
+
+// CopyRegion copies the pixels of r from src, which must have the same dimensions
+func (fb *Framebuffer) CopyRegion(src *Framebuffer, r Rectangle) {
+	r = r.Intersect(fb.Bounds())
+	rowBytes := int(r.Width) * 4
+	for row := int(r.Y); row < int(r.Y)+int(r.Height); row++ {
+		offset := (row*fb.Width + int(r.X)) * 4
+		copy(fb.Pix[offset:offset+rowBytes], src.Pix[offset:offset+rowBytes])
+	}
+}
+
+// Damage returns the parts of clip where fb differs from prev, as a list of
+// non-overlapping rectangles aligned to tileSize. Adjacent changed tiles in a
+// row are merged, and identical spans in consecutive tile rows are merged
+// into taller rectangles, which keeps the count low for typical updates.
+// A nil prev, or one of a different size, makes the whole clip region damaged.
+func (fb *Framebuffer) Damage(prev *Framebuffer, clip Rectangle, tileSize int) []Rectangle {
+	clip = clip.Intersect(fb.Bounds())
+	if clip.Empty() {
+		return nil
+	}
+	if prev == nil || prev.Width != fb.Width || prev.Height != fb.Height {
+		return []Rectangle{clip}
+	}
+	if tileSize <= 0 {
+		tileSize = DefaultDamageTileSize
+	}
+
+	var rects []Rectangle
+	var previousRow []Rectangle
+
+	x1 := int(clip.X) + int(clip.Width)
+	y1 := int(clip.Y) + int(clip.Height)
+	for ty := int(clip.Y); ty < y1; ty += tileSize {
+		th := min(tileSize, y1-ty)
+
+		// Collect runs of changed tiles in this tile row
+		var row []Rectangle
+		for tx := int(clip.X); tx < x1; tx += tileSize {
+			tw := min(tileSize, x1-tx)
+			if !fb.tileEqual(prev, tx, ty, tw, th) {
+				if n := len(row); n > 0 && int(row[n-1].X)+int(row[n-1].Width) == tx {
+					row[n-1].Width += uint16(tw)
+				} else {
+					row = append(row, Rectangle{X: uint16(tx), Y: uint16(ty), Width: uint16(tw), Height: uint16(th)})
+				}
+			}
+		}
+
+		// Extend spans from the row above that line up exactly
+		var next []Rectangle
+		for _, r := range row {
+			merged := false
+			for i := range previousRow {
+				p := &previousRow[i]
+				if p.X == r.X && p.Width == r.Width && int(p.Y)+int(p.Height) == ty {
+					p.Height += r.Height
+					next = append(next, *p)
+					previousRow = append(previousRow[:i], previousRow[i+1:]...)
+					merged = true
+					break
+				}
+			}
+			if !merged {
+				next = append(next, r)
+			}
+		}
+		rects = append(rects, previousRow...)
+		previousRow = next
+	}
+
+	return append(rects, previousRow...)
+}
+
+// tileEqual compares one tile of fb against the same tile of other
+func (fb *Framebuffer) tileEqual(other *Framebuffer, x, y, width, height int) bool {
+	rowBytes := width * 4
+	for row := y; row < y+height; row++ {
+		offset := (row*fb.Width + x) * 4
+		if !bytes.Equal(fb.Pix[offset:offset+rowBytes], other.Pix[offset:offset+rowBytes]) {
+			return false
+		}
+	}
+	return true
+}
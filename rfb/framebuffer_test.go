@@ -0,0 +1,103 @@
+package rfb
+
+import "testing"
+
+// setPixel writes an opaque BGRA pixel into the framebuffer
+func setPixel(fb *Framebuffer, x, y int, b byte) {
+	offset := (y*fb.Width + x) * 4
+	fb.Pix[offset] = b
+	fb.Pix[offset+3] = 255
+}
+
+func TestFramebufferDamageNoChange(t *testing.T) {
+	a := NewFramebuffer(64, 64)
+	b := NewFramebuffer(64, 64)
+
+	if rects := a.Damage(b, a.Bounds(), 16); len(rects) != 0 {
+		t.Errorf("Damage() = %v, want none", rects)
+	}
+}
+
+func TestFramebufferDamageWithoutPrevious(t *testing.T) {
+	fb := NewFramebuffer(64, 48)
+	clip := Rectangle{X: 10, Y: 10, Width: 100, Height: 100}
+
+	rects := fb.Damage(nil, clip, 16)
+	want := Rectangle{X: 10, Y: 10, Width: 54, Height: 38}
+	if len(rects) != 1 || rects[0] != want {
+		t.Errorf("Damage(nil) = %v, want [%+v]", rects, want)
+	}
+
+	if rects := fb.Damage(NewFramebuffer(32, 32), fb.Bounds(), 16); len(rects) != 1 || rects[0] != fb.Bounds() {
+		t.Errorf("Damage() with mismatched size = %v, want whole screen", rects)
+	}
+}
+
+func TestFramebufferDamageSingleTile(t *testing.T) {
+	prev := NewFramebuffer(64, 64)
+	cur := NewFramebuffer(64, 64)
+	setPixel(cur, 20, 40, 1)
+
+	rects := cur.Damage(prev, cur.Bounds(), 16)
+	want := Rectangle{X: 16, Y: 32, Width: 16, Height: 16}
+	if len(rects) != 1 || rects[0] != want {
+		t.Errorf("Damage() = %v, want [%+v]", rects, want)
+	}
+}
+
+func TestFramebufferDamageMerges(t *testing.T) {
+	prev := NewFramebuffer(64, 64)
+	cur := NewFramebuffer(64, 64)
+
+	// A 2x2 block of tiles changes
+	setPixel(cur, 0, 0, 1)
+	setPixel(cur, 16, 0, 1)
+	setPixel(cur, 0, 16, 1)
+	setPixel(cur, 31, 31, 1)
+	// And an isolated tile elsewhere
+	setPixel(cur, 63, 63, 1)
+
+	rects := cur.Damage(prev, cur.Bounds(), 16)
+	want := []Rectangle{
+		{X: 0, Y: 0, Width: 32, Height: 32},
+		{X: 48, Y: 48, Width: 16, Height: 16},
+	}
+	if len(rects) != len(want) {
+		t.Fatalf("Damage() = %v, want %v", rects, want)
+	}
+	for i := range want {
+		if rects[i] != want[i] {
+			t.Errorf("Damage()[%d] = %+v, want %+v", i, rects[i], want[i])
+		}
+	}
+}
+
+func TestFramebufferDamageClipped(t *testing.T) {
+	prev := NewFramebuffer(64, 64)
+	cur := NewFramebuffer(64, 64)
+	setPixel(cur, 5, 5, 1)
+	setPixel(cur, 50, 50, 1)
+
+	// Only the change inside the clip region is reported
+	rects := cur.Damage(prev, Rectangle{X: 40, Y: 40, Width: 24, Height: 24}, 16)
+	want := Rectangle{X: 40, Y: 40, Width: 16, Height: 16}
+	if len(rects) != 1 || rects[0] != want {
+		t.Errorf("Damage() = %v, want [%+v]", rects, want)
+	}
+}
+
+func TestFramebufferCopyRegion(t *testing.T) {
+	src := NewFramebuffer(8, 8)
+	dst := NewFramebuffer(8, 8)
+	setPixel(src, 1, 1, 7)
+	setPixel(src, 6, 6, 9)
+
+	dst.CopyRegion(src, Rectangle{X: 0, Y: 0, Width: 4, Height: 4})
+
+	if rects := dst.Damage(src, Rectangle{X: 0, Y: 0, Width: 4, Height: 4}, 4); len(rects) != 0 {
+		t.Errorf("Copied region still differs: %v", rects)
+	}
+	if rects := dst.Damage(src, dst.Bounds(), 4); len(rects) != 1 {
+		t.Errorf("Uncopied region should differ, got %v", rects)
+	}
+}
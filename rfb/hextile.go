@@ -0,0 +1,243 @@
+package rfb
+
+import (
+	"image"
+	"image/color"
+	"io"
+)
+
+// Hextile subencoding mask bits (RFC 6143 section 7.7.4)
+const (
+	HextileRaw                 = 1
+	HextileBackgroundSpecified = 2
+	HextileForegroundSpecified = 4
+	HextileAnySubrects         = 8
+	HextileSubrectsColoured    = 16
+
+	// hextileTileSize is the edge length of Hextile tiles
+	hextileTileSize = 16
+)
+
+// HextileEncoder encodes rectangles as 16x16 tiles. Solid tiles are sent as a
+// background colour, two-colour tiles as a background plus foreground
+// subrectangles, and anything else as raw pixels.
+type HextileEncoder struct{}
+
+// Type returns HextileEncoding
+func (*HextileEncoder) Type() int32 {
+	return HextileEncoding
+}
+
+// Encode produces Hextile data for a BGRA rectangle
+func (*HextileEncoder) Encode(bgraData []byte, width, height int, pf PixelFormat) []byte {
+	pixels := pixelValues(bgraData, pf)
+	bytesPerPixel := int(pf.BitsPerPixel) / 8
+
+	var out []byte
+	var bg, fg uint32
+	bgValid, fgValid := false, false
+	tile := make([]uint32, 0, hextileTileSize*hextileTileSize)
+
+	for ty := 0; ty < height; ty += hextileTileSize {
+		th := min(hextileTileSize, height-ty)
+		for tx := 0; tx < width; tx += hextileTileSize {
+			tw := min(hextileTileSize, width-tx)
+
+			tile = tile[:0]
+			for y := ty; y < ty+th; y++ {
+				tile = append(tile, pixels[y*width+tx:y*width+tx+tw]...)
+			}
+
+			tileBG, tileFG, numColors := tileColors(tile)
+			switch numColors {
+			case 1:
+				mask := byte(0)
+				if !bgValid || bg != tileBG {
+					mask |= HextileBackgroundSpecified
+				}
+				out = append(out, mask)
+				if mask&HextileBackgroundSpecified != 0 {
+					out = appendPixel(out, tileBG, pf)
+				}
+				bg, bgValid = tileBG, true
+				continue
+
+			case 2:
+				subrects := hextileSubrects(tile, tw, th, tileFG)
+				numSubrects := len(subrects) / 2
+				size := 2 + len(subrects) + 2*bytesPerPixel
+				if size < tw*th*bytesPerPixel && numSubrects <= 255 {
+					mask := byte(HextileAnySubrects)
+					if !bgValid || bg != tileBG {
+						mask |= HextileBackgroundSpecified
+					}
+					if !fgValid || fg != tileFG {
+						mask |= HextileForegroundSpecified
+					}
+					out = append(out, mask)
+					if mask&HextileBackgroundSpecified != 0 {
+						out = appendPixel(out, tileBG, pf)
+					}
+					if mask&HextileForegroundSpecified != 0 {
+						out = appendPixel(out, tileFG, pf)
+					}
+					out = append(out, byte(numSubrects))
+					out = append(out, subrects...)
+					bg, bgValid = tileBG, true
+					fg, fgValid = tileFG, true
+					continue
+				}
+			}
+
+			// Raw tile; background and foreground are undefined afterwards
+			out = append(out, HextileRaw)
+			for _, p := range tile {
+				out = appendPixel(out, p, pf)
+			}
+			bgValid, fgValid = false, false
+		}
+	}
+
+	return out
+}
+
+// tileColors returns the most common colour, one other colour, and the number
+// of distinct colours (capped at 3, meaning "more than two")
+func tileColors(tile []uint32) (bg, fg uint32, count int) {
+	first := tile[0]
+	firstCount := 0
+	var second uint32
+	secondCount := 0
+	for _, p := range tile {
+		switch {
+		case p == first:
+			firstCount++
+		case secondCount == 0 || p == second:
+			second = p
+			secondCount++
+		default:
+			return first, second, 3
+		}
+	}
+	if secondCount == 0 {
+		return first, 0, 1
+	}
+	if secondCount > firstCount {
+		return second, first, 2
+	}
+	return first, second, 2
+}
+
+// hextileSubrects encodes horizontal runs of the foreground colour as subrectangles,
+// extending a run downwards while the rows below repeat it exactly
+func hextileSubrects(tile []uint32, width, height int, fg uint32) []byte {
+	covered := make([]bool, len(tile))
+	var out []byte
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if tile[y*width+x] != fg || covered[y*width+x] {
+				continue
+			}
+
+			w := 1
+			for x+w < width && tile[y*width+x+w] == fg && !covered[y*width+x+w] {
+				w++
+			}
+			h := 1
+			for y+h < height && hextileRowMatches(tile, covered, width, x, y+h, w, fg) {
+				h++
+			}
+			for dy := 0; dy < h; dy++ {
+				for dx := 0; dx < w; dx++ {
+					covered[(y+dy)*width+x+dx] = true
+				}
+			}
+
+			out = append(out, byte(x<<4|y), byte((w-1)<<4|(h-1)))
+			x += w - 1
+		}
+	}
+	return out
+}
+
+// hextileRowMatches reports whether row y holds an uncovered foreground span at [x, x+w)
+func hextileRowMatches(tile []uint32, covered []bool, width, x, y, w int, fg uint32) bool {
+	for dx := 0; dx < w; dx++ {
+		i := y*width + x + dx
+		if tile[i] != fg || covered[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// HextileDecoder reads rectangles sent as 16x16 Hextile tiles
+type HextileDecoder struct{}
+
+// Type returns HextileEncoding
+func (*HextileDecoder) Type() int32 {
+	return HextileEncoding
+}
+
+// Decode reads the tiles of a width x height rectangle. Background and
+// foreground colours carry over from one tile to the next.
+func (*HextileDecoder) Decode(r io.Reader, width, height int, pf PixelFormat) (*image.RGBA, error) {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	pixel := make([]byte, int(pf.BitsPerPixel)/8)
+	var bg, fg color.RGBA
+	var err error
+	buf := make([]byte, 2)
+
+	for ty := 0; ty < height; ty += hextileTileSize {
+		th := min(hextileTileSize, height-ty)
+		for tx := 0; tx < width; tx += hextileTileSize {
+			tw := min(hextileTileSize, width-tx)
+			tile := image.Rect(tx, ty, tx+tw, ty+th)
+
+			if _, err := io.ReadFull(r, buf[:1]); err != nil {
+				return nil, err
+			}
+			mask := buf[0]
+			if mask&HextileRaw != 0 {
+				if err := readPixels(r, img, tile, pf); err != nil {
+					return nil, err
+				}
+				continue
+			}
+
+			if mask&HextileBackgroundSpecified != 0 {
+				if bg, err = readPixel(r, pixel, pf); err != nil {
+					return nil, err
+				}
+			}
+			if mask&HextileForegroundSpecified != 0 {
+				if fg, err = readPixel(r, pixel, pf); err != nil {
+					return nil, err
+				}
+			}
+			fillRect(img, tile, bg)
+			if mask&HextileAnySubrects == 0 {
+				continue
+			}
+
+			if _, err := io.ReadFull(r, buf[:1]); err != nil {
+				return nil, err
+			}
+			for n := int(buf[0]); n > 0; n-- {
+				c := fg
+				if mask&HextileSubrectsColoured != 0 {
+					if c, err = readPixel(r, pixel, pf); err != nil {
+						return nil, err
+					}
+				}
+				if _, err := io.ReadFull(r, buf); err != nil {
+					return nil, err
+				}
+				x, y := tx+int(buf[0]>>4), ty+int(buf[0]&0x0F)
+				w, h := int(buf[1]>>4)+1, int(buf[1]&0x0F)+1
+				fillRect(img, image.Rect(x, y, x+w, y+h).Intersect(tile), c)
+			}
+		}
+	}
+	return img, nil
+}
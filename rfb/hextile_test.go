@@ -0,0 +1,152 @@
+package rfb
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// solidBGRA returns width*height copies of one BGRA pixel
+func solidBGRA(width, height int, b, g, r byte) []byte {
+	return bytes.Repeat([]byte{b, g, r, 255}, width*height)
+}
+
+func TestHextileEncodeSolid(t *testing.T) {
+	pf := DefaultPixelFormat()
+	// 32x16 is two tiles; the second reuses the background
+	out := (&HextileEncoder{}).Encode(solidBGRA(32, 16, 10, 20, 30), 32, 16, pf)
+
+	expected := []byte{
+		HextileBackgroundSpecified, 10, 20, 30, 0,
+		0,
+	}
+	if !bytes.Equal(out, expected) {
+		t.Errorf("Encode() = %v, want %v", out, expected)
+	}
+}
+
+func TestHextileEncodeTwoColours(t *testing.T) {
+	pf := DefaultPixelFormat()
+	data := solidBGRA(16, 16, 0, 0, 0)
+	// A 3x2 white block at (4,5)
+	for y := 5; y < 7; y++ {
+		for x := 4; x < 7; x++ {
+			copy(data[(y*16+x)*4:], []byte{255, 255, 255})
+		}
+	}
+
+	out := (&HextileEncoder{}).Encode(data, 16, 16, pf)
+	expected := []byte{
+		HextileBackgroundSpecified | HextileForegroundSpecified | HextileAnySubrects,
+		0, 0, 0, 0, // background
+		255, 255, 255, 0, // foreground
+		1,                  // one subrect
+		4<<4 | 5, 2<<4 | 1, // x=4 y=5, w=3 h=2
+	}
+	if !bytes.Equal(out, expected) {
+		t.Errorf("Encode() = %v, want %v", out, expected)
+	}
+}
+
+func TestHextileEncodeRaw(t *testing.T) {
+	pf := RGB565PixelFormat()
+	data := make([]byte, 4*4*4)
+	for i := 0; i < 16; i++ {
+		data[i*4] = byte(i * 16) // 16 distinct blues
+	}
+
+	out := (&HextileEncoder{}).Encode(data, 4, 4, pf)
+	if out[0] != HextileRaw {
+		t.Fatalf("Subencoding = %d, want raw", out[0])
+	}
+	if len(out) != 1+4*4*2 {
+		t.Errorf("Encoded length = %d, want %d", len(out), 1+4*4*2)
+	}
+}
+
+func TestHextileTileColors(t *testing.T) {
+	bg, fg, n := tileColors([]uint32{1, 2, 2, 2})
+	if n != 2 || bg != 2 || fg != 1 {
+		t.Errorf("tileColors() = %d, %d, %d, want 2, 1, 2", bg, fg, n)
+	}
+	if _, _, n := tileColors([]uint32{1, 2, 3}); n != 3 {
+		t.Errorf("tileColors() count = %d, want 3", n)
+	}
+}
+
+// decodeRaw returns what a client sees for BGRA data sent as Raw in pf
+func decodeRaw(t *testing.T, bgra []byte, width, height int, pf PixelFormat) *image.RGBA {
+	t.Helper()
+	img, err := RawDecoder{}.Decode(bytes.NewReader(RawEncoder{}.Encode(bgra, width, height, pf)), width, height, pf)
+	if err != nil {
+		t.Fatalf("RawDecoder.Decode() error = %v", err)
+	}
+	return img
+}
+
+func TestHextileDecodeRoundTrip(t *testing.T) {
+	// A two-colour pattern next to noisy tiles, across partial edge tiles
+	const width, height = 37, 21
+	frame := solidBGRA(width, height, 0, 0, 0)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			switch {
+			case x >= 20:
+				copy(frame[(y*width+x)*4:], []byte{byte(x * 9), byte(y * 11), byte(x * y)})
+			case (x/3+y/2)%2 == 0:
+				copy(frame[(y*width+x)*4:], []byte{200, 100, 50})
+			}
+		}
+	}
+
+	for _, f := range benchmarkFormats {
+		t.Run(f.name, func(t *testing.T) {
+			r := bytes.NewReader((&HextileEncoder{}).Encode(frame, width, height, f.format))
+			got, err := (&HextileDecoder{}).Decode(r, width, height, f.format)
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if r.Len() != 0 {
+				t.Errorf("Decode() left %d bytes unread", r.Len())
+			}
+			if want := decodeRaw(t, frame, width, height, f.format); !bytes.Equal(got.Pix, want.Pix) {
+				t.Errorf("Decode() pixels differ from the Raw encoding of the same frame")
+			}
+		})
+	}
+}
+
+func TestHextileDecodeColouredSubrects(t *testing.T) {
+	pf := DefaultPixelFormat()
+	data := []byte{
+		HextileBackgroundSpecified | HextileAnySubrects | HextileSubrectsColoured,
+		0, 0, 0, 0, // background
+		2,                     // two subrects
+		0, 0, 255, 0, 0, 0x00, // red pixel at (0,0)
+		255, 0, 0, 0, 1<<4 | 1, 1<<4 | 0, // blue 2x1 at (1,1)
+	}
+
+	img, err := (&HextileDecoder{}).Decode(bytes.NewReader(data), 4, 4, pf)
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	tests := []struct {
+		x, y int
+		want color.RGBA
+	}{
+		{0, 0, color.RGBA{255, 0, 0, 255}},
+		{1, 1, color.RGBA{0, 0, 255, 255}},
+		{2, 1, color.RGBA{0, 0, 255, 255}},
+		{3, 3, color.RGBA{0, 0, 0, 255}},
+	}
+	for _, tt := range tests {
+		if got := img.RGBAAt(tt.x, tt.y); got != tt.want {
+			t.Errorf("Pixel (%d,%d) = %v, want %v", tt.x, tt.y, got, tt.want)
+		}
+	}
+
+	if _, err := (&HextileDecoder{}).Decode(bytes.NewReader(data[:8]), 4, 4, pf); err == nil {
+		t.Error("Decode() of a truncated tile succeeded, want error")
+	}
+}
@@ -0,0 +1,103 @@
+package rfb
+
+import "fmt"
+
+// Commonly used X11 keysyms (RFC 6143 section 7.5.4). Printable Latin-1
+// characters use their character code as the keysym.
+const (
+	KeyBackSpace uint32 = 0xff08
+	KeyTab       uint32 = 0xff09
+	KeyReturn    uint32 = 0xff0d
+	KeyEscape    uint32 = 0xff1b
+	KeyHome      uint32 = 0xff50
+	KeyLeft      uint32 = 0xff51
+	KeyUp        uint32 = 0xff52
+	KeyRight     uint32 = 0xff53
+	KeyDown      uint32 = 0xff54
+	KeyPageUp    uint32 = 0xff55
+	KeyPageDown  uint32 = 0xff56
+	KeyEnd       uint32 = 0xff57
+	KeyInsert    uint32 = 0xff63
+	KeyF1        uint32 = 0xffbe // F2-F12 follow consecutively
+	KeyShiftL    uint32 = 0xffe1
+	KeyShiftR    uint32 = 0xffe2
+	KeyControlL  uint32 = 0xffe3
+	KeyControlR  uint32 = 0xffe4
+	KeyMetaL     uint32 = 0xffe7
+	KeyMetaR     uint32 = 0xffe8
+	KeyAltL      uint32 = 0xffe9
+	KeyAltR      uint32 = 0xffea
+	KeySuperL    uint32 = 0xffeb
+	KeySuperR    uint32 = 0xffec
+	KeyDelete    uint32 = 0xffff
+
+	// keysymUnicodeOffset marks keysyms that carry a Unicode code point directly;
+	// code points below 0x100 use their Latin-1 keysyms instead
+	keysymUnicodeOffset uint32 = 0x01000000
+
+	// KeyEventLength is the length of a KeyEvent message
+	KeyEventLength = 8
+)
+
+// KeyEventMessage represents a decoded KeyEvent message
+type KeyEventMessage struct {
+	Down bool
+	Key  uint32
+}
+
+// CreateKeyEvent creates a KeyEvent message
+func CreateKeyEvent(down bool, key uint32) []byte {
+	msg := make([]byte, KeyEventLength)
+	msg[0] = KeyEvent
+	if down {
+		msg[1] = 1
+	}
+	// 2 bytes of padding (bytes 2-3)
+	msg[4] = uint8(key >> 24)
+	msg[5] = uint8(key >> 16)
+	msg[6] = uint8(key >> 8)
+	msg[7] = uint8(key)
+	return msg
+}
+
+// ParseKeyEvent parses a KeyEvent message from raw bytes
+func ParseKeyEvent(data []byte) (KeyEventMessage, error) {
+	if len(data) != KeyEventLength {
+		return KeyEventMessage{}, fmt.Errorf("KeyEvent message must be exactly %d bytes, got %d", KeyEventLength, len(data))
+	}
+	if data[0] != KeyEvent {
+		return KeyEventMessage{}, fmt.Errorf("not a KeyEvent message: type %d", data[0])
+	}
+
+	return KeyEventMessage{
+		Down: data[1] != 0,
+		Key:  uint32(data[4])<<24 | uint32(data[5])<<16 | uint32(data[6])<<8 | uint32(data[7]),
+	}, nil
+}
+
+// KeysymToRune returns the character a keysym types, for Latin-1 and Unicode
+// keysyms. It reports false for function and modifier keys.
+func KeysymToRune(key uint32) (rune, bool) {
+	switch {
+	case key >= 0x20 && key <= 0x7e, key >= 0xa0 && key <= 0xff:
+		return rune(key), true
+	case key >= keysymUnicodeOffset+0x100 && key <= keysymUnicodeOffset+0x10ffff:
+		return rune(key - keysymUnicodeOffset), true
+	default:
+		return 0, false
+	}
+}
+
+// RuneToKeysym returns the keysym that types r
+func RuneToKeysym(r rune) uint32 {
+	switch {
+	case r == '\n':
+		return KeyReturn
+	case r == '\t':
+		return KeyTab
+	case r <= 0xff:
+		return uint32(r)
+	default:
+		return keysymUnicodeOffset + uint32(r)
+	}
+}
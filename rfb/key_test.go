@@ -0,0 +1,83 @@
+package rfb
+
+import "testing"
+
+func TestCreateAndParseKeyEvent(t *testing.T) {
+	tests := []struct {
+		name string
+		down bool
+		key  uint32
+	}{
+		{"Letter down", true, 'a'},
+		{"Return up", false, KeyReturn},
+		{"Unicode keysym", true, 0x010020ac},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := CreateKeyEvent(tt.down, tt.key)
+			if len(msg) != KeyEventLength {
+				t.Fatalf("Message length = %d, want %d", len(msg), KeyEventLength)
+			}
+
+			length, err := GetMessageLength(msg[0], msg)
+			if err != nil || length != len(msg) {
+				t.Errorf("GetMessageLength() = %d, %v, want %d", length, err, len(msg))
+			}
+
+			parsed, err := ParseKeyEvent(msg)
+			if err != nil {
+				t.Fatalf("ParseKeyEvent() error = %v", err)
+			}
+			if parsed.Down != tt.down || parsed.Key != tt.key {
+				t.Errorf("ParseKeyEvent() = %+v, want Down=%v Key=%#x", parsed, tt.down, tt.key)
+			}
+		})
+	}
+}
+
+func TestParseKeyEventErrors(t *testing.T) {
+	if _, err := ParseKeyEvent(make([]byte, 7)); err == nil {
+		t.Error("Expected error for short message, but got none")
+	}
+	msg := CreateKeyEvent(true, 'a')
+	msg[0] = PointerEvent
+	if _, err := ParseKeyEvent(msg); err == nil {
+		t.Error("Expected error for wrong message type, but got none")
+	}
+}
+
+func TestKeysymRuneConversion(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     uint32
+		r       rune
+		typable bool
+	}{
+		{"ASCII letter", 'Q', 'Q', true},
+		{"Space", ' ', ' ', true},
+		{"Latin-1", 0xe9, 'é', true},
+		{"Unicode", 0x010020ac, '€', true},
+		{"Return", KeyReturn, 0, false},
+		{"Shift", KeyShiftL, 0, false},
+		{"Unicode control character", 0x01000008, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, ok := KeysymToRune(tt.key)
+			if ok != tt.typable || r != tt.r {
+				t.Errorf("KeysymToRune(%#x) = %q, %v, want %q, %v", tt.key, r, ok, tt.r, tt.typable)
+			}
+			if tt.typable {
+				if got := RuneToKeysym(tt.r); got != tt.key {
+					t.Errorf("RuneToKeysym(%q) = %#x, want %#x", tt.r, got, tt.key)
+				}
+			}
+		})
+	}
+
+	if got := RuneToKeysym('\n'); got != KeyReturn {
+		t.Errorf("RuneToKeysym('\\n') = %#x, want %#x", got, KeyReturn)
+	}
+}
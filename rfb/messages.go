@@ -29,6 +29,8 @@ func GetMessageLength(messageType byte, data []byte) (int, error) {
 		}
 		textLength := (int(data[4]) << 24) | (int(data[5]) << 16) | (int(data[6]) << 8) | int(data[7])
 		return 8 + textLength, nil
+	case EnableContinuousUpdates:
+		return EnableContinuousUpdatesLength, nil
 	default:
 		return 0, fmt.Errorf("unknown message type: %d", messageType)
 	}
@@ -162,6 +164,12 @@ func ReadSecurityResult(conn net.Conn) (uint32, error) {
 
 // SendServerInit sends the server initialization message
 func SendServerInit(conn net.Conn, init ServerInit) error {
+	_, err := conn.Write(CreateServerInit(init))
+	return err
+}
+
+// CreateServerInit creates a ServerInit message
+func CreateServerInit(init ServerInit) []byte {
 	msg := make([]byte, 24+len(init.Name))
 	
 	// Width and height (big-endian 16-bit)
@@ -198,8 +206,7 @@ func SendServerInit(conn net.Conn, init ServerInit) error {
 	// Name
 	copy(msg[24:], init.Name)
 	
-	_, err := conn.Write(msg)
-	return err
+	return msg
 }
 
 // ReadServerInit reads the server initialization message
@@ -246,6 +253,11 @@ func ReadServerInit(conn net.Conn) (ServerInit, error) {
 	return init, nil
 }
 
+// CreateBell creates a Bell message
+func CreateBell() []byte {
+	return []byte{Bell}
+}
+
 // Helper function to read a single byte
 func readByte(conn net.Conn, b *uint8) error {
 	buf := make([]byte, 1)
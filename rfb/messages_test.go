@@ -69,6 +69,13 @@ func TestGetMessageLength(t *testing.T) {
 			expected:    0,
 			expectError: true,
 		},
+		{
+			name:        "EnableContinuousUpdates",
+			messageType: EnableContinuousUpdates,
+			data:        make([]byte, 10),
+			expected:    EnableContinuousUpdatesLength,
+			expectError: false,
+		},
 		{
 			name:        "Unknown message type",
 			messageType: 255,
@@ -334,37 +341,20 @@ func TestServerInitHandshake(t *testing.T) {
 	}
 }
 
+func TestCreateBell(t *testing.T) {
+	msg := CreateBell()
+	if len(msg) != 1 || msg[0] != Bell {
+		t.Errorf("CreateBell() = %v, want [%d]", msg, Bell)
+	}
+}
+
 // Test unimplemented message types that should be added later
 func TestUnimplementedMessages(t *testing.T) {
-	t.Run("CopyRect encoding", func(t *testing.T) {
-		t.Skip("CopyRect encoding not yet implemented")
-	})
-
 	t.Run("RRE encoding", func(t *testing.T) {
 		t.Skip("RRE encoding not yet implemented")
 	})
 
-	t.Run("Hextile encoding", func(t *testing.T) {
-		t.Skip("Hextile encoding not yet implemented")
-	})
-
 	t.Run("TRLE encoding", func(t *testing.T) {
 		t.Skip("TRLE encoding not yet implemented")
 	})
-
-	t.Run("ZRLE encoding", func(t *testing.T) {
-		t.Skip("ZRLE encoding not yet implemented")
-	})
-
-	t.Run("VNC Authentication", func(t *testing.T) {
-		t.Skip("VNC Authentication not yet implemented")
-	})
-
-	t.Run("Cursor pseudo-encoding", func(t *testing.T) {
-		t.Skip("Cursor pseudo-encoding not yet implemented")
-	})
-
-	t.Run("DesktopSize pseudo-encoding", func(t *testing.T) {
-		t.Skip("DesktopSize pseudo-encoding not yet implemented")
-	})
 }
\ No newline at end of file
@@ -14,22 +14,9 @@ func ConvertPixelFormat(bgraData []byte, width, height int, targetFormat PixelFo
 	outputData := make([]byte, pixelCount*bytesPerPixel)
 
 	for i := 0; i < pixelCount; i++ {
-		// Extract BGRA components from input
+		// Extract BGRA components from input (alpha is not used in conversion)
 		srcOffset := i * 4
-		b := uint16(bgraData[srcOffset])
-		g := uint16(bgraData[srcOffset+1])
-		r := uint16(bgraData[srcOffset+2])
-		// a := uint16(bgraData[srcOffset+3]) // Alpha not used in conversion
-
-		// Scale color components to target maximums
-		scaledR := (r * uint16(targetFormat.RedMax)) / 255
-		scaledG := (g * uint16(targetFormat.GreenMax)) / 255
-		scaledB := (b * uint16(targetFormat.BlueMax)) / 255
-
-		// Combine into target pixel value
-		pixelValue := uint32(scaledR)<<targetFormat.RedShift |
-			uint32(scaledG)<<targetFormat.GreenShift |
-			uint32(scaledB)<<targetFormat.BlueShift
+		pixelValue := BGRAToPixelValue(bgraData[srcOffset:srcOffset+4], targetFormat)
 
 		// Write pixel in target format
 		dstOffset := i * bytesPerPixel
@@ -39,6 +26,23 @@ func ConvertPixelFormat(bgraData []byte, width, height int, targetFormat PixelFo
 	return outputData
 }
 
+// BGRAToPixelValue converts one BGRA pixel to a pixel value in the target format
+func BGRAToPixelValue(bgra []byte, targetFormat PixelFormat) uint32 {
+	b := uint32(bgra[0])
+	g := uint32(bgra[1])
+	r := uint32(bgra[2])
+
+	// Scale color components to target maximums
+	scaledR := (r * uint32(targetFormat.RedMax)) / 255
+	scaledG := (g * uint32(targetFormat.GreenMax)) / 255
+	scaledB := (b * uint32(targetFormat.BlueMax)) / 255
+
+	// Combine into target pixel value
+	return scaledR<<targetFormat.RedShift |
+		scaledG<<targetFormat.GreenShift |
+		scaledB<<targetFormat.BlueShift
+}
+
 // WritePixelValue writes a pixel value to the buffer in the specified endianness
 func WritePixelValue(buffer []byte, value uint32, bigEndian uint8) {
 	switch len(buffer) {
@@ -108,8 +112,11 @@ func ReadPixelValue(buffer []byte, bigEndian uint8) uint32 {
 // ConvertPixelToRGBA converts a pixel from the server's format to RGBA
 func ConvertPixelToRGBA(pixelBytes []byte, pf PixelFormat) color.RGBA {
 	// Read pixel value from bytes considering endianness
-	pixelValue := ReadPixelValue(pixelBytes, pf.BigEndianFlag)
+	return pixelValueToRGBA(ReadPixelValue(pixelBytes, pf.BigEndianFlag), pf)
+}
 
+// pixelValueToRGBA converts a pixel value in the server's format to RGBA
+func pixelValueToRGBA(pixelValue uint32, pf PixelFormat) color.RGBA {
 	// Extract color components using shifts and maximums
 	redBits := (pixelValue >> pf.RedShift) & uint32(pf.RedMax)
 	greenBits := (pixelValue >> pf.GreenShift) & uint32(pf.GreenMax)
@@ -0,0 +1,86 @@
+package rfb
+
+import "fmt"
+
+// Pointer button mask bits as carried in PointerEvent messages (RFC 6143 section 7.5.5).
+// Buttons 4 and 5 are conventionally used for vertical wheel scrolling, and
+// buttons 6 and 7 for horizontal scrolling.
+const (
+	ButtonLeft       uint8 = 1 << 0
+	ButtonMiddle     uint8 = 1 << 1
+	ButtonRight      uint8 = 1 << 2
+	ButtonWheelUp    uint8 = 1 << 3
+	ButtonWheelDown  uint8 = 1 << 4
+	ButtonWheelLeft  uint8 = 1 << 5
+	ButtonWheelRight uint8 = 1 << 6
+
+	// PointerEventLength is the length of a PointerEvent message
+	PointerEventLength = 6
+)
+
+// PointerEventMessage represents a decoded PointerEvent message
+type PointerEventMessage struct {
+	ButtonMask uint8
+	X          uint16
+	Y          uint16
+}
+
+// Pressed reports whether the given button is held in this event
+func (p PointerEventMessage) Pressed(button uint8) bool {
+	return p.ButtonMask&button != 0
+}
+
+// CreatePointerEvent creates a PointerEvent message
+func CreatePointerEvent(buttonMask uint8, x, y uint16) []byte {
+	msg := make([]byte, PointerEventLength)
+	msg[0] = PointerEvent
+	msg[1] = buttonMask
+	msg[2] = uint8(x >> 8)
+	msg[3] = uint8(x & 0xFF)
+	msg[4] = uint8(y >> 8)
+	msg[5] = uint8(y & 0xFF)
+	return msg
+}
+
+// ParsePointerEvent parses a PointerEvent message from raw bytes
+func ParsePointerEvent(data []byte) (PointerEventMessage, error) {
+	if len(data) != PointerEventLength {
+		return PointerEventMessage{}, fmt.Errorf("PointerEvent message must be exactly %d bytes, got %d", PointerEventLength, len(data))
+	}
+	if data[0] != PointerEvent {
+		return PointerEventMessage{}, fmt.Errorf("not a PointerEvent message: type %d", data[0])
+	}
+
+	return PointerEventMessage{
+		ButtonMask: data[1],
+		X:          uint16(data[2])<<8 | uint16(data[3]),
+		Y:          uint16(data[4])<<8 | uint16(data[5]),
+	}, nil
+}
+
+// ClickSequence returns the PointerEvent messages for a single click of button
+// at (x, y): a press followed by a release. Buttons in heldMask stay pressed
+// throughout, which allows modified clicks such as a right click while dragging.
+func ClickSequence(heldMask, button uint8, x, y uint16) [][]byte {
+	return [][]byte{
+		CreatePointerEvent(heldMask|button, x, y),
+		CreatePointerEvent(heldMask&^button, x, y),
+	}
+}
+
+// ScrollSequence returns the PointerEvent messages for scrolling at (x, y).
+// Positive steps scroll down (button 5) and negative steps scroll up (button 4);
+// each step is a separate press/release pair as produced by real mouse wheels.
+func ScrollSequence(heldMask uint8, x, y uint16, steps int) [][]byte {
+	button := ButtonWheelDown
+	if steps < 0 {
+		button = ButtonWheelUp
+		steps = -steps
+	}
+
+	msgs := make([][]byte, 0, steps*2)
+	for i := 0; i < steps; i++ {
+		msgs = append(msgs, ClickSequence(heldMask, button, x, y)...)
+	}
+	return msgs
+}
@@ -0,0 +1,119 @@
+package rfb
+
+import "testing"
+
+func TestButtonMaskBits(t *testing.T) {
+	tests := []struct {
+		name     string
+		button   uint8
+		expected uint8
+	}{
+		{"ButtonLeft", ButtonLeft, 1},
+		{"ButtonMiddle", ButtonMiddle, 2},
+		{"ButtonRight", ButtonRight, 4},
+		{"ButtonWheelUp", ButtonWheelUp, 8},
+		{"ButtonWheelDown", ButtonWheelDown, 16},
+		{"ButtonWheelLeft", ButtonWheelLeft, 32},
+		{"ButtonWheelRight", ButtonWheelRight, 64},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.button != tt.expected {
+				t.Errorf("%s = %d, want %d", tt.name, tt.button, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCreateAndParsePointerEvent(t *testing.T) {
+	msg := CreatePointerEvent(ButtonLeft|ButtonRight, 640, 480)
+
+	if len(msg) != PointerEventLength {
+		t.Fatalf("Message length = %d, want %d", len(msg), PointerEventLength)
+	}
+	if msg[0] != PointerEvent {
+		t.Errorf("Message type = %d, want %d", msg[0], PointerEvent)
+	}
+
+	length, err := GetMessageLength(msg[0], msg)
+	if err != nil || length != len(msg) {
+		t.Errorf("GetMessageLength() = %d, %v, want %d", length, err, len(msg))
+	}
+
+	ev, err := ParsePointerEvent(msg)
+	if err != nil {
+		t.Fatalf("ParsePointerEvent() error = %v", err)
+	}
+	if ev.X != 640 || ev.Y != 480 {
+		t.Errorf("Position = (%d,%d), want (640,480)", ev.X, ev.Y)
+	}
+	if !ev.Pressed(ButtonLeft) || !ev.Pressed(ButtonRight) || ev.Pressed(ButtonMiddle) {
+		t.Errorf("ButtonMask = %08b, want left and right pressed", ev.ButtonMask)
+	}
+
+	if _, err := ParsePointerEvent(msg[:5]); err == nil {
+		t.Error("Expected error for short message, but got none")
+	}
+	if _, err := ParsePointerEvent([]byte{KeyEvent, 0, 0, 0, 0, 0}); err == nil {
+		t.Error("Expected error for wrong message type, but got none")
+	}
+}
+
+func TestClickSequence(t *testing.T) {
+	msgs := ClickSequence(ButtonMiddle, ButtonLeft, 10, 20)
+	if len(msgs) != 2 {
+		t.Fatalf("ClickSequence() returned %d messages, want 2", len(msgs))
+	}
+
+	press, _ := ParsePointerEvent(msgs[0])
+	release, _ := ParsePointerEvent(msgs[1])
+
+	if press.ButtonMask != ButtonMiddle|ButtonLeft {
+		t.Errorf("Press mask = %08b, want %08b", press.ButtonMask, ButtonMiddle|ButtonLeft)
+	}
+	if release.ButtonMask != ButtonMiddle {
+		t.Errorf("Release mask = %08b, want %08b", release.ButtonMask, ButtonMiddle)
+	}
+	if press.X != 10 || press.Y != 20 || release.X != 10 || release.Y != 20 {
+		t.Errorf("Click moved the pointer: press (%d,%d), release (%d,%d)", press.X, press.Y, release.X, release.Y)
+	}
+}
+
+func TestScrollSequence(t *testing.T) {
+	tests := []struct {
+		name   string
+		steps  int
+		button uint8
+	}{
+		{"Scroll down", 3, ButtonWheelDown},
+		{"Scroll up", -2, ButtonWheelUp},
+		{"No scroll", 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msgs := ScrollSequence(0, 5, 5, tt.steps)
+			want := tt.steps * 2
+			if want < 0 {
+				want = -want
+			}
+			if len(msgs) != want {
+				t.Fatalf("ScrollSequence() returned %d messages, want %d", len(msgs), want)
+			}
+
+			for i, msg := range msgs {
+				ev, err := ParsePointerEvent(msg)
+				if err != nil {
+					t.Fatalf("ParsePointerEvent() error = %v", err)
+				}
+				if i%2 == 0 && ev.ButtonMask != tt.button {
+					t.Errorf("Message %d mask = %08b, want %08b", i, ev.ButtonMask, tt.button)
+				}
+				if i%2 == 1 && ev.ButtonMask != 0 {
+					t.Errorf("Message %d mask = %08b, want release", i, ev.ButtonMask)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,282 @@
+package rfb
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"io"
+)
+
+// Tight compression types, the high four bits of a rectangle's compression
+// control byte. Types 0-7 are basic compression, where bits 0-1 pick the zlib
+// stream and TightExplicitFilter says a filter byte follows.
+const (
+	TightExplicitFilter = 0x4
+	TightFill           = 0x8
+	TightJPEG           = 0x9
+
+	// Filters for basic compression
+	TightFilterCopy     = 0
+	TightFilterPalette  = 1
+	TightFilterGradient = 2
+
+	// tightMinToCompress is the data size below which basic compression sends data uncompressed
+	tightMinToCompress = 12
+)
+
+// TightDecoder reads Tight rectangles: a solid fill, a JPEG image, or pixel
+// data sent through one of four zlib streams that persist for the connection
+type TightDecoder struct {
+	streams [4]zlibStream
+}
+
+// NewTightDecoder creates a decoder with fresh zlib streams
+func NewTightDecoder() *TightDecoder {
+	return &TightDecoder{}
+}
+
+// Type returns TightEncoding
+func (*TightDecoder) Type() int32 {
+	return TightEncoding
+}
+
+// Decode reads one Tight rectangle, resetting the zlib streams its control byte names
+func (d *TightDecoder) Decode(r io.Reader, width, height int, pf PixelFormat) (*image.RGBA, error) {
+	var control [1]byte
+	if _, err := io.ReadFull(r, control[:]); err != nil {
+		return nil, err
+	}
+	for i := range d.streams {
+		if control[0]&(1<<i) != 0 {
+			d.streams[i] = zlibStream{}
+		}
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	switch compression := control[0] >> 4; {
+	case compression == TightFill:
+		c, err := readTPixels(r, 1, pf)
+		if err != nil {
+			return nil, err
+		}
+		fillRect(img, img.Rect, c[0])
+
+	case compression == TightJPEG:
+		length, err := readTightLength(r)
+		if err != nil {
+			return nil, err
+		}
+		data := make([]byte, length)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		src, err := jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("invalid Tight JPEG data: %v", err)
+		}
+		if src.Bounds().Dx() != width || src.Bounds().Dy() != height {
+			return nil, fmt.Errorf("Tight JPEG image is %dx%d, want %dx%d", src.Bounds().Dx(), src.Bounds().Dy(), width, height)
+		}
+		draw.Draw(img, img.Rect, src, src.Bounds().Min, draw.Src)
+
+	case compression < TightFill:
+		if err := d.decodeBasic(r, img, compression, pf); err != nil {
+			return nil, err
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported Tight compression type %d", compression)
+	}
+	return img, nil
+}
+
+// decodeBasic reads a filter and its pixel data from the zlib stream chosen by compression
+func (d *TightDecoder) decodeBasic(r io.Reader, img *image.RGBA, compression byte, pf PixelFormat) error {
+	width, height := img.Rect.Dx(), img.Rect.Dy()
+	filter := byte(TightFilterCopy)
+	if compression&TightExplicitFilter != 0 {
+		var b [1]byte
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return err
+		}
+		filter = b[0]
+	}
+
+	var palette []color.RGBA
+	rowBytes := width * tpixelSize(pf)
+	switch filter {
+	case TightFilterCopy, TightFilterGradient:
+	case TightFilterPalette:
+		var size [1]byte
+		if _, err := io.ReadFull(r, size[:]); err != nil {
+			return err
+		}
+		var err error
+		if palette, err = readTPixels(r, int(size[0])+1, pf); err != nil {
+			return err
+		}
+		rowBytes = width
+		if len(palette) == 2 {
+			rowBytes = (width + 7) / 8
+		}
+	default:
+		return fmt.Errorf("invalid Tight filter %d", filter)
+	}
+
+	data, err := d.readData(r, int(compression&3), rowBytes*height)
+	if err != nil {
+		return err
+	}
+
+	switch filter {
+	case TightFilterCopy:
+		size := tpixelSize(pf)
+		for i := 0; i < width*height; i++ {
+			img.SetRGBA(i%width, i/width, tpixelRGBA(data[i*size:(i+1)*size], pf))
+		}
+	case TightFilterPalette:
+		for i := 0; i < width*height; i++ {
+			x, y := i%width, i/width
+			var index int
+			if len(palette) == 2 {
+				index = int(data[y*rowBytes+x/8]>>(7-x%8)) & 1
+			} else {
+				index = int(data[y*rowBytes+x])
+			}
+			if index >= len(palette) {
+				return fmt.Errorf("Tight palette index %d out of range", index)
+			}
+			img.SetRGBA(x, y, palette[index])
+		}
+	case TightFilterGradient:
+		tightGradient(img, data, pf)
+	}
+	return nil
+}
+
+// readData reads n bytes of filtered pixel data, which is sent as is when
+// shorter than tightMinToCompress and through a zlib stream otherwise
+func (d *TightDecoder) readData(r io.Reader, stream, n int) ([]byte, error) {
+	data := make([]byte, n)
+	if n < tightMinToCompress {
+		_, err := io.ReadFull(r, data)
+		return data, err
+	}
+
+	length, err := readTightLength(r)
+	if err != nil {
+		return nil, err
+	}
+	zr, err := d.streams[stream].feed(r, int64(length))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(zr, data); err != nil {
+		return nil, fmt.Errorf("failed to inflate Tight stream %d: %v", stream, err)
+	}
+	return data, nil
+}
+
+// tightGradient undoes the gradient filter, which sends each colour
+// component as its difference from left + above - above-left
+func tightGradient(img *image.RGBA, data []byte, pf PixelFormat) {
+	width, height := img.Rect.Dx(), img.Rect.Dy()
+	size, compact := tpixelSize(pf), compactTPixels(pf)
+	maxes := [3]int{int(pf.RedMax), int(pf.GreenMax), int(pf.BlueMax)}
+	shifts := [3]uint8{pf.RedShift, pf.GreenShift, pf.BlueShift}
+
+	above := make([][3]int, width)
+	row := make([][3]int, width)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			pixel := data[(y*width+x)*size : (y*width+x+1)*size]
+			var diff [3]int
+			if compact {
+				diff = [3]int{int(pixel[0]), int(pixel[1]), int(pixel[2])}
+			} else {
+				value := ReadPixelValue(pixel, pf.BigEndianFlag)
+				for c := range diff {
+					diff[c] = int(value>>shifts[c]) & maxes[c]
+				}
+			}
+
+			var value uint32
+			for c := range diff {
+				var left, aboveLeft int
+				if x > 0 {
+					left, aboveLeft = row[x-1][c], above[x-1][c]
+				}
+				prediction := min(max(left+above[x][c]-aboveLeft, 0), maxes[c])
+				row[x][c] = (prediction + diff[c]) % (maxes[c] + 1)
+				value |= uint32(row[x][c]) << shifts[c]
+			}
+
+			if compact {
+				img.SetRGBA(x, y, color.RGBA{uint8(row[x][0]), uint8(row[x][1]), uint8(row[x][2]), 255})
+			} else {
+				img.SetRGBA(x, y, pixelValueToRGBA(value, pf))
+			}
+		}
+		above, row = row, above
+	}
+}
+
+// readTightLength reads a compact length of one to three bytes, seven bits
+// per byte with the high bit marking that another byte follows
+func readTightLength(r io.Reader) (int, error) {
+	var b [1]byte
+	length := 0
+	for i := 0; i < 3; i++ {
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return 0, err
+		}
+		if i == 2 {
+			return length | int(b[0])<<14, nil
+		}
+		length |= int(b[0]&0x7F) << (7 * i)
+		if b[0]&0x80 == 0 {
+			break
+		}
+	}
+	return length, nil
+}
+
+// compactTPixels reports whether Tight pixels in the format are sent as 3
+// bytes of red, green and blue rather than as full pixels
+func compactTPixels(pf PixelFormat) bool {
+	return pf.TrueColorFlag != 0 && pf.BitsPerPixel == 32 && pf.Depth == 24 &&
+		pf.RedMax == 255 && pf.GreenMax == 255 && pf.BlueMax == 255
+}
+
+// tpixelSize returns the size in bytes of a Tight pixel in the given format
+func tpixelSize(pf PixelFormat) int {
+	if compactTPixels(pf) {
+		return 3
+	}
+	return int(pf.BitsPerPixel) / 8
+}
+
+// tpixelRGBA converts one Tight pixel
+func tpixelRGBA(pixel []byte, pf PixelFormat) color.RGBA {
+	if compactTPixels(pf) {
+		return color.RGBA{pixel[0], pixel[1], pixel[2], 255}
+	}
+	return ConvertPixelToRGBA(pixel, pf)
+}
+
+// readTPixels reads n Tight pixels
+func readTPixels(r io.Reader, n int, pf PixelFormat) ([]color.RGBA, error) {
+	size := tpixelSize(pf)
+	data := make([]byte, n*size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	pixels := make([]color.RGBA, n)
+	for i := range pixels {
+		pixels[i] = tpixelRGBA(data[i*size:(i+1)*size], pf)
+	}
+	return pixels, nil
+}
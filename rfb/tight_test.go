@@ -0,0 +1,211 @@
+package rfb
+
+import (
+	"bytes"
+	"compress/zlib"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+// appendTightLength appends a Tight compact length
+func appendTightLength(dst []byte, n int) []byte {
+	for i := 0; i < 2 && n >= 0x80; i++ {
+		dst = append(dst, byte(n)|0x80)
+		n >>= 7
+	}
+	return append(dst, byte(n))
+}
+
+// tightZlib compresses data on a stream shared by the rectangles of a test,
+// returning it with its compact length
+func tightZlib(zw *zlib.Writer, buf *bytes.Buffer, data []byte) []byte {
+	buf.Reset()
+	zw.Write(data)
+	zw.Flush()
+	return append(appendTightLength(nil, buf.Len()), buf.Bytes()...)
+}
+
+// decodeTight decodes one rectangle and checks that all of it was consumed
+func decodeTight(t *testing.T, d *TightDecoder, data []byte, width, height int, pf PixelFormat) *image.RGBA {
+	t.Helper()
+	r := bytes.NewReader(data)
+	img, err := d.Decode(r, width, height, pf)
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if r.Len() != 0 {
+		t.Errorf("Decode() left %d bytes unread", r.Len())
+	}
+	return img
+}
+
+// checkPixels compares every pixel of img with want(x, y)
+func checkPixels(t *testing.T, img *image.RGBA, want func(x, y int) color.RGBA) {
+	t.Helper()
+	for y := img.Rect.Min.Y; y < img.Rect.Max.Y; y++ {
+		for x := img.Rect.Min.X; x < img.Rect.Max.X; x++ {
+			if got := img.RGBAAt(x, y); got != want(x, y) {
+				t.Fatalf("Pixel (%d,%d) = %v, want %v", x, y, got, want(x, y))
+			}
+		}
+	}
+}
+
+func TestTightLength(t *testing.T) {
+	tests := []struct {
+		length  int
+		encoded []byte
+	}{
+		{10, []byte{10}},
+		{200, []byte{0xC8, 0x01}},
+		{4194303, []byte{0xFF, 0xFF, 0xFF}},
+	}
+	for _, tt := range tests {
+		if got := appendTightLength(nil, tt.length); !bytes.Equal(got, tt.encoded) {
+			t.Fatalf("appendTightLength(%d) = %v, want %v", tt.length, got, tt.encoded)
+		}
+		if got, err := readTightLength(bytes.NewReader(tt.encoded)); err != nil || got != tt.length {
+			t.Errorf("readTightLength(%v) = %d, %v, want %d", tt.encoded, got, err, tt.length)
+		}
+	}
+}
+
+func TestTightFill(t *testing.T) {
+	red := color.RGBA{255, 0, 0, 255}
+
+	img := decodeTight(t, NewTightDecoder(), []byte{TightFill << 4, 255, 0, 0}, 5, 3, DefaultPixelFormat())
+	checkPixels(t, img, func(x, y int) color.RGBA { return red })
+
+	// Other formats send full pixels
+	pf := RGB565PixelFormat()
+	img = decodeTight(t, NewTightDecoder(), []byte{TightFill << 4, 0x00, 0xF8}, 5, 3, pf)
+	checkPixels(t, img, func(x, y int) color.RGBA { return red })
+}
+
+func TestTightCopyFilter(t *testing.T) {
+	pf := DefaultPixelFormat()
+	pixel := func(x, y int) color.RGBA { return color.RGBA{byte(x * 40), byte(y * 40), byte(x + y), 255} }
+	rgb := func(width, height int) []byte {
+		var data []byte
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				c := pixel(x, y)
+				data = append(data, c.R, c.G, c.B)
+			}
+		}
+		return data
+	}
+
+	d := NewTightDecoder()
+
+	// Under 12 bytes of data is sent uncompressed
+	img := decodeTight(t, d, append([]byte{0x00}, rgb(3, 1)...), 3, 1, pf)
+	checkPixels(t, img, pixel)
+
+	// Larger data goes through the zlib stream chosen by the control byte,
+	// which persists across rectangles until a reset
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	for i := 0; i < 2; i++ {
+		img = decodeTight(t, d, append([]byte{0x20}, tightZlib(zw, &buf, rgb(6, 5))...), 6, 5, pf)
+		checkPixels(t, img, pixel)
+	}
+
+	zw = zlib.NewWriter(&buf)
+	img = decodeTight(t, d, append([]byte{0x20 | 1<<2}, tightZlib(zw, &buf, rgb(6, 5))...), 6, 5, pf)
+	checkPixels(t, img, pixel)
+}
+
+func TestTightPaletteFilter(t *testing.T) {
+	pf := DefaultPixelFormat()
+	black, white, blue := color.RGBA{0, 0, 0, 255}, color.RGBA{255, 255, 255, 255}, color.RGBA{0, 0, 255, 255}
+
+	// Two colours are packed one bit per pixel, rows padded to a byte
+	two := []byte{TightExplicitFilter << 4, TightFilterPalette, 1, 0, 0, 0, 255, 255, 255, 0b10100000, 0b01000000}
+	img := decodeTight(t, NewTightDecoder(), two, 3, 2, pf)
+	checkPixels(t, img, func(x, y int) color.RGBA {
+		if (x+y)%2 == 0 {
+			return white
+		}
+		return black
+	})
+
+	// More colours use a byte per pixel
+	three := []byte{TightExplicitFilter << 4, TightFilterPalette, 2, 0, 0, 0, 255, 255, 255, 0, 0, 255, 0, 1, 2}
+	img = decodeTight(t, NewTightDecoder(), three, 3, 1, pf)
+	checkPixels(t, img, func(x, y int) color.RGBA { return []color.RGBA{black, white, blue}[x] })
+
+	bad := []byte{TightExplicitFilter << 4, TightFilterPalette, 2, 0, 0, 0, 255, 255, 255, 0, 0, 255, 0, 1, 3}
+	if _, err := NewTightDecoder().Decode(bytes.NewReader(bad), 3, 1, pf); err == nil {
+		t.Error("Decode() with a palette index out of range succeeded, want error")
+	}
+}
+
+func TestTightGradientFilter(t *testing.T) {
+	const width, height = 5, 4
+	pixel := func(x, y int) color.RGBA { return color.RGBA{byte(x * 50), byte(200 - y*30), byte(x * y * 9), 255} }
+
+	// Apply the filter: each component minus its prediction from the left,
+	// above and above-left neighbours
+	component := func(x, y, c int) int {
+		if x < 0 || y < 0 {
+			return 0
+		}
+		p := pixel(x, y)
+		return int([]byte{p.R, p.G, p.B}[c])
+	}
+	var data []byte
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			for c := 0; c < 3; c++ {
+				prediction := min(max(component(x-1, y, c)+component(x, y-1, c)-component(x-1, y-1, c), 0), 255)
+				data = append(data, byte(component(x, y, c)-prediction))
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	rect := append([]byte{TightExplicitFilter << 4, TightFilterGradient}, tightZlib(zlib.NewWriter(&buf), &buf, data)...)
+	img := decodeTight(t, NewTightDecoder(), rect, width, height, DefaultPixelFormat())
+	checkPixels(t, img, pixel)
+}
+
+func TestTightJPEG(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 16, 8))
+	fillRect(src, src.Rect, color.RGBA{200, 100, 50, 255})
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, src, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatalf("jpeg.Encode() error = %v", err)
+	}
+
+	rect := append(appendTightLength([]byte{TightJPEG << 4}, encoded.Len()), encoded.Bytes()...)
+	img := decodeTight(t, NewTightDecoder(), rect, 16, 8, DefaultPixelFormat())
+	got := img.RGBAAt(7, 3)
+	if diff := func(a, b uint8) int { return max(int(a)-int(b), int(b)-int(a)) }; diff(got.R, 200) > 4 || diff(got.G, 100) > 4 || diff(got.B, 50) > 4 {
+		t.Errorf("Pixel = %v, want close to {200 100 50 255}", got)
+	}
+
+	if _, err := NewTightDecoder().Decode(bytes.NewReader(rect), 8, 8, DefaultPixelFormat()); err == nil {
+		t.Error("Decode() of a JPEG of the wrong size succeeded, want error")
+	}
+}
+
+func TestTightInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"PNG compression", []byte{0xA0}},
+		{"unknown filter", []byte{TightExplicitFilter << 4, 3}},
+		{"truncated fill", []byte{TightFill << 4, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewTightDecoder().Decode(bytes.NewReader(tt.data), 2, 2, DefaultPixelFormat()); err == nil {
+				t.Error("Decode() succeeded, want error")
+			}
+		})
+	}
+}
@@ -1,6 +1,9 @@
 package rfb
 
-import "net"
+import (
+	"net"
+	"time"
+)
 
 // PixelFormat represents the RFB pixel format structure
 type PixelFormat struct {
@@ -32,6 +35,7 @@ type Connection struct {
 	PixelFormat PixelFormat
 	Width       int
 	Height      int
+	Timeout     time.Duration // Per-message I/O deadline, zero means no deadline
 }
 
 // DefaultPixelFormat returns the standard 32bpp BGRA pixel format
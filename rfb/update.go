@@ -0,0 +1,134 @@
+package rfb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const (
+	// FramebufferUpdateRequestLength is the length of a FramebufferUpdateRequest message
+	FramebufferUpdateRequestLength = 10
+
+	// RectangleHeaderLength is the length of a rectangle header in a FramebufferUpdate
+	RectangleHeaderLength = 12
+)
+
+// Rectangle describes a region of the framebuffer
+type Rectangle struct {
+	X      uint16
+	Y      uint16
+	Width  uint16
+	Height uint16
+}
+
+// Empty reports whether the rectangle covers no pixels
+func (r Rectangle) Empty() bool {
+	return r.Width == 0 || r.Height == 0
+}
+
+// Intersect returns the largest rectangle contained in both r and o
+func (r Rectangle) Intersect(o Rectangle) Rectangle {
+	x0 := max(int(r.X), int(o.X))
+	y0 := max(int(r.Y), int(o.Y))
+	x1 := min(int(r.X)+int(r.Width), int(o.X)+int(o.Width))
+	y1 := min(int(r.Y)+int(r.Height), int(o.Y)+int(o.Height))
+	if x1 <= x0 || y1 <= y0 {
+		return Rectangle{}
+	}
+	return Rectangle{X: uint16(x0), Y: uint16(y0), Width: uint16(x1 - x0), Height: uint16(y1 - y0)}
+}
+
+// FramebufferUpdateRequestMessage represents a decoded FramebufferUpdateRequest message
+type FramebufferUpdateRequestMessage struct {
+	Incremental bool
+	Rectangle
+}
+
+// CreateFramebufferUpdateRequest creates a FramebufferUpdateRequest message
+func CreateFramebufferUpdateRequest(incremental bool, r Rectangle) []byte {
+	msg := make([]byte, FramebufferUpdateRequestLength)
+	msg[0] = FramebufferUpdateRequest
+	if incremental {
+		msg[1] = 1
+	}
+	binary.BigEndian.PutUint16(msg[2:4], r.X)
+	binary.BigEndian.PutUint16(msg[4:6], r.Y)
+	binary.BigEndian.PutUint16(msg[6:8], r.Width)
+	binary.BigEndian.PutUint16(msg[8:10], r.Height)
+	return msg
+}
+
+// ParseFramebufferUpdateRequest parses a FramebufferUpdateRequest message from raw bytes
+func ParseFramebufferUpdateRequest(data []byte) (FramebufferUpdateRequestMessage, error) {
+	if len(data) != FramebufferUpdateRequestLength {
+		return FramebufferUpdateRequestMessage{}, fmt.Errorf("FramebufferUpdateRequest message must be exactly %d bytes, got %d", FramebufferUpdateRequestLength, len(data))
+	}
+	if data[0] != FramebufferUpdateRequest {
+		return FramebufferUpdateRequestMessage{}, fmt.Errorf("not a FramebufferUpdateRequest message: type %d", data[0])
+	}
+
+	return FramebufferUpdateRequestMessage{
+		Incremental: data[1] != 0,
+		Rectangle: Rectangle{
+			X:      binary.BigEndian.Uint16(data[2:4]),
+			Y:      binary.BigEndian.Uint16(data[4:6]),
+			Width:  binary.BigEndian.Uint16(data[6:8]),
+			Height: binary.BigEndian.Uint16(data[8:10]),
+		},
+	}, nil
+}
+
+// CreateFramebufferUpdateHeader creates the 4-byte header that precedes the rectangles of a FramebufferUpdate
+func CreateFramebufferUpdateHeader(numRects uint16) []byte {
+	msg := make([]byte, 4)
+	msg[0] = FramebufferUpdate
+	binary.BigEndian.PutUint16(msg[2:4], numRects)
+	return msg
+}
+
+// CreateRectangleHeader creates the header for one rectangle of a FramebufferUpdate
+func CreateRectangleHeader(r Rectangle, encoding int32) []byte {
+	msg := make([]byte, RectangleHeaderLength)
+	binary.BigEndian.PutUint16(msg[0:2], r.X)
+	binary.BigEndian.PutUint16(msg[2:4], r.Y)
+	binary.BigEndian.PutUint16(msg[4:6], r.Width)
+	binary.BigEndian.PutUint16(msg[6:8], r.Height)
+	binary.BigEndian.PutUint32(msg[8:12], uint32(encoding))
+	return msg
+}
+
+// ExtractRegion copies the pixels of r out of a BGRA frame that is frameWidth pixels wide
+func ExtractRegion(bgraData []byte, frameWidth int, r Rectangle) []byte {
+	rowBytes := int(r.Width) * 4
+	region := make([]byte, rowBytes*int(r.Height))
+	for row := 0; row < int(r.Height); row++ {
+		src := ((int(r.Y)+row)*frameWidth + int(r.X)) * 4
+		copy(region[row*rowBytes:(row+1)*rowBytes], bgraData[src:src+rowBytes])
+	}
+	return region
+}
+
+// CreateCopyRect creates a CopyRect rectangle telling the client to copy r
+// from (srcX, srcY) in its own framebuffer
+func CreateCopyRect(r Rectangle, srcX, srcY uint16) []byte {
+	msg := CreateRectangleHeader(r, CopyRectEncoding)
+	msg = binary.BigEndian.AppendUint16(msg, srcX)
+	return binary.BigEndian.AppendUint16(msg, srcY)
+}
+
+// ReadCopyRect reads the source position of a CopyRect rectangle, which
+// follows its header
+func ReadCopyRect(r io.Reader) (srcX, srcY uint16, err error) {
+	var data [4]byte
+	if _, err := io.ReadFull(r, data[:]); err != nil {
+		return 0, 0, err
+	}
+	return binary.BigEndian.Uint16(data[0:2]), binary.BigEndian.Uint16(data[2:4]), nil
+}
+
+// CreateDesktopSizeRectangle creates the DesktopSize pseudo-rectangle announcing
+// a new framebuffer size. It carries no pixel data.
+func CreateDesktopSizeRectangle(width, height uint16) []byte {
+	return CreateRectangleHeader(Rectangle{Width: width, Height: height}, DesktopSizeEncoding)
+}
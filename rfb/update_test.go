@@ -0,0 +1,115 @@
+package rfb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestRectangleIntersect(t *testing.T) {
+	screen := Rectangle{X: 0, Y: 0, Width: 800, Height: 600}
+
+	tests := []struct {
+		name     string
+		rect     Rectangle
+		expected Rectangle
+	}{
+		{"Inside", Rectangle{10, 20, 100, 50}, Rectangle{10, 20, 100, 50}},
+		{"Overlapping right edge", Rectangle{750, 0, 100, 10}, Rectangle{750, 0, 50, 10}},
+		{"Overlapping bottom edge", Rectangle{0, 590, 10, 100}, Rectangle{0, 590, 10, 10}},
+		{"Outside", Rectangle{900, 700, 10, 10}, Rectangle{}},
+		{"Whole screen", Rectangle{0, 0, 65535, 65535}, screen},
+		{"Zero size", Rectangle{10, 10, 0, 10}, Rectangle{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.rect.Intersect(screen)
+			if got != tt.expected {
+				t.Errorf("Intersect() = %+v, want %+v", got, tt.expected)
+			}
+			if got.Empty() != (tt.expected == Rectangle{}) {
+				t.Errorf("Empty() = %v for %+v", got.Empty(), got)
+			}
+		})
+	}
+}
+
+func TestFramebufferUpdateRequestRoundTrip(t *testing.T) {
+	rect := Rectangle{X: 1, Y: 2, Width: 300, Height: 400}
+	msg := CreateFramebufferUpdateRequest(true, rect)
+
+	expected := []byte{FramebufferUpdateRequest, 1, 0, 1, 0, 2, 0x01, 0x2C, 0x01, 0x90}
+	if !bytes.Equal(msg, expected) {
+		t.Errorf("CreateFramebufferUpdateRequest() = %v, want %v", msg, expected)
+	}
+
+	req, err := ParseFramebufferUpdateRequest(msg)
+	if err != nil {
+		t.Fatalf("ParseFramebufferUpdateRequest() error = %v", err)
+	}
+	if !req.Incremental || req.Rectangle != rect {
+		t.Errorf("ParseFramebufferUpdateRequest() = %+v, want incremental %+v", req, rect)
+	}
+
+	if _, err := ParseFramebufferUpdateRequest(msg[:9]); err == nil {
+		t.Error("Expected error for short message, but got none")
+	}
+}
+
+func TestCreateRectangleHeader(t *testing.T) {
+	header := CreateRectangleHeader(Rectangle{X: 16, Y: 32, Width: 640, Height: 480}, -223)
+	expected := []byte{0, 16, 0, 32, 0x02, 0x80, 0x01, 0xE0, 0xFF, 0xFF, 0xFF, 0x21}
+	if !bytes.Equal(header, expected) {
+		t.Errorf("CreateRectangleHeader() = %v, want %v", header, expected)
+	}
+
+	desktopSize := CreateDesktopSizeRectangle(1024, 768)
+	expected = []byte{0, 0, 0, 0, 0x04, 0x00, 0x03, 0x00, 0xFF, 0xFF, 0xFF, 0x21}
+	if !bytes.Equal(desktopSize, expected) {
+		t.Errorf("CreateDesktopSizeRectangle() = %v, want %v", desktopSize, expected)
+	}
+
+	update := CreateFramebufferUpdateHeader(3)
+	if !bytes.Equal(update, []byte{FramebufferUpdate, 0, 0, 3}) {
+		t.Errorf("CreateFramebufferUpdateHeader() = %v", update)
+	}
+}
+
+func TestExtractRegion(t *testing.T) {
+	// 3x2 frame where each pixel's blue channel holds its index
+	frame := make([]byte, 3*2*4)
+	for i := 0; i < 6; i++ {
+		frame[i*4] = byte(i)
+	}
+
+	region := ExtractRegion(frame, 3, Rectangle{X: 1, Y: 0, Width: 2, Height: 2})
+	if len(region) != 2*2*4 {
+		t.Fatalf("Region length = %d, want %d", len(region), 16)
+	}
+
+	want := []byte{1, 2, 4, 5}
+	for i, w := range want {
+		if region[i*4] != w {
+			t.Errorf("Region pixel %d = %d, want %d", i, region[i*4], w)
+		}
+	}
+}
+
+func TestCopyRectRoundTrip(t *testing.T) {
+	msg := CreateCopyRect(Rectangle{X: 10, Y: 20, Width: 30, Height: 40}, 300, 400)
+	if len(msg) != RectangleHeaderLength+4 {
+		t.Fatalf("CreateCopyRect() length = %d, want %d", len(msg), RectangleHeaderLength+4)
+	}
+	if encoding := int32(binary.BigEndian.Uint32(msg[8:12])); encoding != CopyRectEncoding {
+		t.Errorf("Encoding = %d, want %d", encoding, CopyRectEncoding)
+	}
+
+	srcX, srcY, err := ReadCopyRect(bytes.NewReader(msg[RectangleHeaderLength:]))
+	if err != nil || srcX != 300 || srcY != 400 {
+		t.Errorf("ReadCopyRect() = %d, %d, %v, want 300, 400", srcX, srcY, err)
+	}
+	if _, _, err := ReadCopyRect(bytes.NewReader(msg[RectangleHeaderLength+1:])); err == nil {
+		t.Error("ReadCopyRect() of a truncated rectangle succeeded, want error")
+	}
+}
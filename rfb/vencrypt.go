@@ -0,0 +1,143 @@
+package rfb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+)
+
+// VeNCrypt subtypes offered after security type 19 is chosen. The TLS
+// subtypes use anonymous Diffie-Hellman; the X509 subtypes use a certificate.
+const (
+	VeNCryptPlain     = 256
+	VeNCryptTLSNone   = 257
+	VeNCryptTLSVnc    = 258
+	VeNCryptTLSPlain  = 259
+	VeNCryptX509None  = 260
+	VeNCryptX509Vnc   = 261
+	VeNCryptX509Plain = 262
+
+	// maxVeNCryptSubtypes is the most subtypes the one-byte count can announce
+	maxVeNCryptSubtypes = 255
+)
+
+// VeNCryptSubtypeName returns a human-readable name for a VeNCrypt subtype
+func VeNCryptSubtypeName(subtype uint32) string {
+	switch subtype {
+	case VeNCryptPlain:
+		return "Plain"
+	case VeNCryptTLSNone:
+		return "TLSNone"
+	case VeNCryptTLSVnc:
+		return "TLSVnc"
+	case VeNCryptTLSPlain:
+		return "TLSPlain"
+	case VeNCryptX509None:
+		return "X509None"
+	case VeNCryptX509Vnc:
+		return "X509Vnc"
+	case VeNCryptX509Plain:
+		return "X509Plain"
+	default:
+		return fmt.Sprintf("Unknown(%d)", subtype)
+	}
+}
+
+// VeNCryptServerHandshake negotiates VeNCrypt version 0.2 with a client that
+// chose security type 19, offering subtypes in preference order. It returns
+// the subtype the client accepted; for TLS and X509 subtypes the TLS handshake
+// starts immediately afterwards.
+func VeNCryptServerHandshake(conn net.Conn, subtypes []uint32) (uint32, error) {
+	if len(subtypes) == 0 || len(subtypes) > maxVeNCryptSubtypes {
+		return 0, fmt.Errorf("VeNCrypt needs 1 to %d subtypes, got %d", maxVeNCryptSubtypes, len(subtypes))
+	}
+
+	if _, err := conn.Write([]byte{0, 2}); err != nil {
+		return 0, fmt.Errorf("failed to send VeNCrypt version: %v", err)
+	}
+	version := make([]byte, 2)
+	if _, err := io.ReadFull(conn, version); err != nil {
+		return 0, fmt.Errorf("failed to read VeNCrypt version: %v", err)
+	}
+	if version[0] != 0 || version[1] != 2 {
+		conn.Write([]byte{1})
+		return 0, fmt.Errorf("unsupported VeNCrypt version %d.%d", version[0], version[1])
+	}
+
+	msg := make([]byte, 2+4*len(subtypes))
+	msg[1] = uint8(len(subtypes))
+	for i, subtype := range subtypes {
+		binary.BigEndian.PutUint32(msg[2+4*i:], subtype)
+	}
+	if _, err := conn.Write(msg); err != nil {
+		return 0, fmt.Errorf("failed to send VeNCrypt subtypes: %v", err)
+	}
+
+	choice := make([]byte, 4)
+	if _, err := io.ReadFull(conn, choice); err != nil {
+		return 0, fmt.Errorf("failed to read VeNCrypt subtype: %v", err)
+	}
+	subtype := binary.BigEndian.Uint32(choice)
+	if !slices.Contains(subtypes, subtype) {
+		conn.Write([]byte{0})
+		return 0, fmt.Errorf("client chose unoffered VeNCrypt subtype %s", VeNCryptSubtypeName(subtype))
+	}
+	if _, err := conn.Write([]byte{1}); err != nil {
+		return 0, fmt.Errorf("failed to accept VeNCrypt subtype: %v", err)
+	}
+	return subtype, nil
+}
+
+// VeNCryptClientHandshake negotiates VeNCrypt version 0.2 with a server after
+// choosing security type 19. It picks the first subtype the server offers that
+// appears in supported and returns it once the server has accepted it.
+func VeNCryptClientHandshake(conn net.Conn, supported []uint32) (uint32, error) {
+	version := make([]byte, 2)
+	if _, err := io.ReadFull(conn, version); err != nil {
+		return 0, fmt.Errorf("failed to read VeNCrypt version: %v", err)
+	}
+	if version[0] != 0 || version[1] < 2 {
+		return 0, fmt.Errorf("unsupported VeNCrypt version %d.%d", version[0], version[1])
+	}
+	if _, err := conn.Write([]byte{0, 2}); err != nil {
+		return 0, fmt.Errorf("failed to send VeNCrypt version: %v", err)
+	}
+
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return 0, fmt.Errorf("failed to read VeNCrypt version result: %v", err)
+	}
+	if header[0] != 0 {
+		return 0, fmt.Errorf("server rejected VeNCrypt version 0.2")
+	}
+
+	offered := make([]byte, 4*int(header[1]))
+	if _, err := io.ReadFull(conn, offered); err != nil {
+		return 0, fmt.Errorf("failed to read VeNCrypt subtypes: %v", err)
+	}
+	var subtype uint32
+	found := false
+	for i := 0; i < len(offered) && !found; i += 4 {
+		subtype = binary.BigEndian.Uint32(offered[i:])
+		found = slices.Contains(supported, subtype)
+	}
+	if !found {
+		return 0, fmt.Errorf("no supported VeNCrypt subtype offered")
+	}
+
+	choice := make([]byte, 4)
+	binary.BigEndian.PutUint32(choice, subtype)
+	if _, err := conn.Write(choice); err != nil {
+		return 0, fmt.Errorf("failed to send VeNCrypt subtype: %v", err)
+	}
+	ack := make([]byte, 1)
+	if _, err := io.ReadFull(conn, ack); err != nil {
+		return 0, fmt.Errorf("failed to read VeNCrypt subtype result: %v", err)
+	}
+	if ack[0] != 1 {
+		return 0, fmt.Errorf("server rejected VeNCrypt subtype %s", VeNCryptSubtypeName(subtype))
+	}
+	return subtype, nil
+}
@@ -0,0 +1,96 @@
+package rfb
+
+import (
+	"net"
+	"testing"
+)
+
+func TestVeNCryptHandshake(t *testing.T) {
+	tests := []struct {
+		name      string
+		offered   []uint32
+		supported []uint32
+		expected  uint32
+	}{
+		{"Server preference wins", []uint32{VeNCryptX509Vnc, VeNCryptX509None}, []uint32{VeNCryptX509None, VeNCryptX509Vnc}, VeNCryptX509Vnc},
+		{"Skips unsupported", []uint32{VeNCryptTLSNone, VeNCryptX509None}, []uint32{VeNCryptX509None}, VeNCryptX509None},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, client := net.Pipe()
+			defer server.Close()
+			defer client.Close()
+
+			type result struct {
+				subtype uint32
+				err     error
+			}
+			done := make(chan result, 1)
+			go func() {
+				subtype, err := VeNCryptServerHandshake(server, tt.offered)
+				done <- result{subtype, err}
+			}()
+
+			got, err := VeNCryptClientHandshake(client, tt.supported)
+			if err != nil {
+				t.Fatalf("VeNCryptClientHandshake() error = %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("VeNCryptClientHandshake() = %s, want %s", VeNCryptSubtypeName(got), VeNCryptSubtypeName(tt.expected))
+			}
+			r := <-done
+			if r.err != nil || r.subtype != tt.expected {
+				t.Errorf("VeNCryptServerHandshake() = %d, %v, want %d", r.subtype, r.err, tt.expected)
+			}
+		})
+	}
+}
+
+func TestVeNCryptServerRejectsUnofferedSubtype(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := VeNCryptServerHandshake(server, []uint32{VeNCryptX509None})
+		done <- err
+	}()
+
+	// Version, then the status, count and one subtype
+	buf := make([]byte, 6)
+	client.Read(buf[:2])
+	client.Write([]byte{0, 2})
+	client.Read(buf)
+	client.Write([]byte{0, 0, 1, 0}) // Plain
+	client.Read(buf[:1])
+
+	if buf[0] != 0 {
+		t.Errorf("Subtype result = %d, want 0", buf[0])
+	}
+	if err := <-done; err == nil {
+		t.Error("Expected error for unoffered subtype, but got none")
+	}
+}
+
+func TestVeNCryptClientNoCommonSubtype(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	go VeNCryptServerHandshake(server, []uint32{VeNCryptTLSNone})
+
+	if _, err := VeNCryptClientHandshake(client, []uint32{VeNCryptX509None}); err == nil {
+		t.Error("Expected error when no subtype is supported, but got none")
+	}
+}
+
+func TestVeNCryptSubtypeName(t *testing.T) {
+	if got := VeNCryptSubtypeName(VeNCryptX509Vnc); got != "X509Vnc" {
+		t.Errorf("VeNCryptSubtypeName() = %q, want %q", got, "X509Vnc")
+	}
+	if got := VeNCryptSubtypeName(1); got != "Unknown(1)" {
+		t.Errorf("VeNCryptSubtypeName() = %q, want %q", got, "Unknown(1)")
+	}
+}
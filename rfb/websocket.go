@@ -0,0 +1,217 @@
+package rfb
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/coder/websockify/version"
+	"github.com/gorilla/websocket"
+)
+
+// WebSocketConn adapts a *websocket.Conn to net.Conn so the RFB helpers can run
+// over a WebSocket. RFB is a byte stream, so message boundaries are ignored:
+// reads drain each binary message in turn (supporting partial reads), and each
+// write is sent as one binary message.
+//
+// Unlike a TCP connection, a WebSocket cannot be read from again once a read
+// fails, even if only its deadline passed: a message may have been left half
+// read. So a read timeout, including a Connection's per-message Timeout or a
+// cancelled context, ends the stream, and every later read returns the same
+// error at once. The same holds for writes.
+type WebSocketConn struct {
+	ws      *websocket.Conn
+	readMu  sync.Mutex
+	reader  io.Reader // Remainder of the message currently being read
+	readErr error     // Why reading stopped, returned by every later read
+	writeMu sync.Mutex
+}
+
+// NewWebSocketConn wraps an established WebSocket connection
+func NewWebSocketConn(ws *websocket.Conn) *WebSocketConn {
+	return &WebSocketConn{ws: ws}
+}
+
+// DialWebSocket connects to a websockify-style endpoint (ws:// or wss://) and
+// returns the connection as a net.Conn. An Origin header derived from the URL
+// is added when header does not supply one, since websockify rejects upgrade
+// requests without it, and so is a User-Agent naming this build.
+func DialWebSocket(ctx context.Context, rawURL string, header http.Header) (*WebSocketConn, error) {
+	return DialWebSocketTLS(ctx, rawURL, header, nil)
+}
+
+// DialWebSocketTLS is DialWebSocket with the TLS configuration used for wss://
+// URLs. The system roots verify the server when config is nil.
+func DialWebSocketTLS(ctx context.Context, rawURL string, header http.Header, config *tls.Config) (*WebSocketConn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid WebSocket URL %q: %v", rawURL, err)
+	}
+
+	if header == nil {
+		header = http.Header{}
+	}
+	if header.Get("Origin") == "" {
+		scheme := "http"
+		if u.Scheme == "wss" {
+			scheme = "https"
+		}
+		header.Set("Origin", scheme+"://"+u.Host)
+	}
+	if header.Get("User-Agent") == "" {
+		header.Set("User-Agent", version.UserAgent())
+	}
+
+	dialer := websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: 10 * time.Second,
+		Subprotocols:     []string{"binary"},
+		TLSClientConfig:  config,
+	}
+	ws, resp, err := dialer.DialContext(ctx, u.String(), header)
+	if err != nil {
+		if resp != nil {
+			return nil, fmt.Errorf("WebSocket handshake failed with status %s: %v", resp.Status, err)
+		}
+		return nil, err
+	}
+	return NewWebSocketConn(ws), nil
+}
+
+// Read reads stream data from successive WebSocket messages
+func (c *WebSocketConn) Read(p []byte) (int, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+
+	if c.readErr != nil {
+		return 0, c.readErr
+	}
+	for {
+		if c.reader == nil {
+			messageType, r, err := c.ws.NextReader()
+			if err != nil {
+				return 0, c.readFailed(err)
+			}
+			if messageType != websocket.BinaryMessage && messageType != websocket.TextMessage {
+				continue
+			}
+			c.reader = r
+		}
+
+		n, err := c.reader.Read(p)
+		if err == io.EOF {
+			c.reader = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		if err != nil {
+			return n, c.readFailed(err)
+		}
+		return n, nil
+	}
+}
+
+// readFailed records why reading stopped. The WebSocket keeps failing after a
+// read error, and panics if read from too many times after one, so later reads
+// return the error without touching it. Callers must hold c.readMu.
+func (c *WebSocketConn) readFailed(err error) error {
+	err = c.translateError(err)
+	if err == io.EOF {
+		c.readErr = err
+	} else {
+		c.readErr = fmt.Errorf("WebSocket read failed earlier: %w", err)
+	}
+	return err
+}
+
+// Write sends p as a single binary WebSocket message
+func (c *WebSocketConn) Write(p []byte) (int, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if err := c.ws.WriteMessage(websocket.BinaryMessage, p); err != nil {
+		return 0, c.translateError(err)
+	}
+	return len(p), nil
+}
+
+// Close sends a normal closure frame and closes the underlying connection
+func (c *WebSocketConn) Close() error {
+	c.writeMu.Lock()
+	msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	c.ws.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+	c.writeMu.Unlock()
+	return c.ws.Close()
+}
+
+// LocalAddr returns the local network address
+func (c *WebSocketConn) LocalAddr() net.Addr {
+	return c.ws.LocalAddr()
+}
+
+// RemoteAddr returns the remote network address
+func (c *WebSocketConn) RemoteAddr() net.Addr {
+	return c.ws.RemoteAddr()
+}
+
+// SetDeadline sets both the read and write deadlines
+func (c *WebSocketConn) SetDeadline(t time.Time) error {
+	if err := c.ws.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.ws.SetWriteDeadline(t)
+}
+
+// SetReadDeadline sets the read deadline
+func (c *WebSocketConn) SetReadDeadline(t time.Time) error {
+	return c.ws.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the write deadline
+func (c *WebSocketConn) SetWriteDeadline(t time.Time) error {
+	return c.ws.SetWriteDeadline(t)
+}
+
+// UnderlyingConn returns the wrapped WebSocket connection
+func (c *WebSocketConn) UnderlyingConn() *websocket.Conn {
+	return c.ws
+}
+
+// translateError maps a clean WebSocket close to io.EOF so stream readers see
+// a normal end of data, and a timeout to an error matching
+// os.ErrDeadlineExceeded as a net.Conn's would
+func (c *WebSocketConn) translateError(err error) error {
+	var closeErr *websocket.CloseError
+	if errors.As(err, &closeErr) {
+		switch closeErr.Code {
+		case websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseNoStatusReceived:
+			return io.EOF
+		}
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() && !errors.Is(err, os.ErrDeadlineExceeded) {
+		return timeoutError{err}
+	}
+	return err
+}
+
+// timeoutError is a timeout the WebSocket reported without wrapping
+// os.ErrDeadlineExceeded
+type timeoutError struct {
+	error
+}
+
+func (e timeoutError) Is(target error) bool { return target == os.ErrDeadlineExceeded }
+func (e timeoutError) Timeout() bool        { return true }
+func (e timeoutError) Temporary() bool      { return false }
+func (e timeoutError) Unwrap() error        { return e.error }
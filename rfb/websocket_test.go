@@ -0,0 +1,194 @@
+package rfb
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websockify/version"
+	"github.com/gorilla/websocket"
+)
+
+// newWebSocketTestServer starts a server that runs handler on each upgraded connection
+func newWebSocketTestServer(t *testing.T, handler func(net.Conn)) string {
+	upgrader := websocket.Upgrader{
+		Subprotocols: []string{"binary"},
+		CheckOrigin: func(r *http.Request) bool {
+			return r.Header.Get("Origin") != ""
+		},
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		conn := NewWebSocketConn(ws)
+		defer conn.Close()
+		handler(conn)
+	}))
+	t.Cleanup(srv.Close)
+
+	return "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+func TestWebSocketConnHandshake(t *testing.T) {
+	url := newWebSocketTestServer(t, func(conn net.Conn) {
+		// Split the version across messages to exercise reassembly
+		conn.Write([]byte(RFBVersion[:4]))
+		conn.Write([]byte(RFBVersion[4:]))
+		SendSecurityTypes(conn, []uint8{SecurityNone})
+		ReadRFBVersion(conn)
+	})
+
+	conn, err := DialWebSocket(context.Background(), url, nil)
+	if err != nil {
+		t.Fatalf("DialWebSocket() error = %v", err)
+	}
+	defer conn.Close()
+
+	version, err := ReadRFBVersion(conn)
+	if err != nil {
+		t.Fatalf("ReadRFBVersion() error = %v", err)
+	}
+	if version != RFBVersion {
+		t.Errorf("ReadRFBVersion() = %q, want %q", version, RFBVersion)
+	}
+
+	types, err := ReadSecurityTypes(conn)
+	if err != nil {
+		t.Fatalf("ReadSecurityTypes() error = %v", err)
+	}
+	if len(types) != 1 || types[0] != SecurityNone {
+		t.Errorf("ReadSecurityTypes() = %v, want [%d]", types, SecurityNone)
+	}
+
+	if err := SendRFBVersion(conn); err != nil {
+		t.Errorf("SendRFBVersion() error = %v", err)
+	}
+}
+
+func TestWebSocketConnPartialReads(t *testing.T) {
+	payload := []byte("0123456789abcdef")
+	url := newWebSocketTestServer(t, func(conn net.Conn) {
+		conn.Write(payload)
+	})
+
+	conn, err := DialWebSocket(context.Background(), url, nil)
+	if err != nil {
+		t.Fatalf("DialWebSocket() error = %v", err)
+	}
+	defer conn.Close()
+
+	var got []byte
+	buf := make([]byte, 3)
+	for len(got) < len(payload) {
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatalf("Read() error = %v", err)
+		}
+		if n > len(buf) {
+			t.Fatalf("Read() = %d, exceeds buffer", n)
+		}
+		got = append(got, buf[:n]...)
+	}
+	if string(got) != string(payload) {
+		t.Errorf("Read data = %q, want %q", got, payload)
+	}
+
+	// Server closes normally after writing, which reads as end of stream
+	if _, err := conn.Read(buf); err != io.EOF {
+		t.Errorf("Read() after close error = %v, want %v", err, io.EOF)
+	}
+}
+
+func TestWebSocketConnAfterTimeout(t *testing.T) {
+	release := make(chan struct{})
+	url := newWebSocketTestServer(t, func(conn net.Conn) {
+		<-release
+		conn.Write([]byte(RFBVersion))
+		conn.Read(make([]byte, 1))
+	})
+
+	ws, err := DialWebSocket(context.Background(), url, nil)
+	if err != nil {
+		t.Fatalf("DialWebSocket() error = %v", err)
+	}
+	defer ws.Close()
+	defer close(release)
+
+	conn := NewConnection(ws)
+	conn.Timeout = 50 * time.Millisecond
+	buf := make([]byte, len(RFBVersion))
+	if err := conn.ReadFull(context.Background(), buf); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("ReadFull() error = %v, want a deadline error", err)
+	}
+
+	// Data arriving later cannot be read: the timeout ended the stream, and
+	// each later read fails at once with the same cause instead of touching
+	// the WebSocket, which panics when read from repeatedly after a failure
+	release <- struct{}{}
+	conn.Timeout = 0
+	for i := 0; i < 1100; i++ {
+		err := conn.ReadFull(context.Background(), buf)
+		if !errors.Is(err, os.ErrDeadlineExceeded) || !strings.Contains(err.Error(), "failed earlier") {
+			t.Fatalf("ReadFull() %d after a timeout error = %v, want the earlier deadline error", i, err)
+		}
+	}
+}
+
+func TestDialWebSocketRequiresOrigin(t *testing.T) {
+	url := newWebSocketTestServer(t, func(conn net.Conn) {})
+
+	// An explicit Origin is preserved
+	header := http.Header{}
+	header.Set("Origin", "http://example.com")
+	conn, err := DialWebSocket(context.Background(), url, header)
+	if err != nil {
+		t.Fatalf("DialWebSocket() with Origin error = %v", err)
+	}
+	conn.Close()
+
+	if _, err := DialWebSocket(context.Background(), "://bad", nil); err == nil {
+		t.Error("Expected error for invalid URL, but got none")
+	}
+}
+
+func TestDialWebSocketUserAgent(t *testing.T) {
+	agents := make(chan string, 2)
+	upgrader := websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		agents <- r.Header.Get("User-Agent")
+		if ws, err := upgrader.Upgrade(w, r, nil); err == nil {
+			ws.Close()
+		}
+	}))
+	defer srv.Close()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	tests := []struct {
+		name   string
+		header http.Header
+		want   string
+	}{
+		{"default", nil, version.UserAgent()},
+		{"explicit", http.Header{"User-Agent": {"custom/1.0"}}, "custom/1.0"},
+	}
+	for _, tt := range tests {
+		conn, err := DialWebSocket(context.Background(), url, tt.header)
+		if err != nil {
+			t.Fatalf("DialWebSocket() %s error = %v", tt.name, err)
+		}
+		conn.Close()
+		if got := <-agents; got != tt.want {
+			t.Errorf("DialWebSocket() %s User-Agent = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
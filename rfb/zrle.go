@@ -0,0 +1,440 @@
+package rfb
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+)
+
+// ZRLE tile subencodings (RFC 6143 section 7.7.6)
+const (
+	ZRLERaw        = 0
+	ZRLESolid      = 1
+	ZRLEPlainRLE   = 128
+	ZRLEPaletteRLE = 130 // 130-255: palette RLE with (subencoding - 128) colours
+
+	// zrleTileSize is the edge length of ZRLE tiles
+	zrleTileSize = 64
+)
+
+// ZRLEEncoder encodes rectangles as zlib-compressed 64x64 tiles. The zlib
+// stream persists for the lifetime of the connection, as the protocol requires.
+type ZRLEEncoder struct {
+	buf bytes.Buffer
+	zw  *zlib.Writer
+}
+
+// NewZRLEEncoder creates an encoder with a fresh zlib stream
+func NewZRLEEncoder() *ZRLEEncoder {
+	e := &ZRLEEncoder{}
+	e.zw = zlib.NewWriter(&e.buf)
+	return e
+}
+
+// Type returns ZRLEEncoding
+func (*ZRLEEncoder) Type() int32 {
+	return ZRLEEncoding
+}
+
+// Encode produces ZRLE data for a BGRA rectangle: a 32-bit length followed by
+// the zlib data, flushed so the client can decode it without further input
+func (e *ZRLEEncoder) Encode(bgraData []byte, width, height int, pf PixelFormat) []byte {
+	pixels := pixelValues(bgraData, pf)
+	tile := make([]uint32, 0, zrleTileSize*zrleTileSize)
+
+	var raw []byte
+	for ty := 0; ty < height; ty += zrleTileSize {
+		th := min(zrleTileSize, height-ty)
+		for tx := 0; tx < width; tx += zrleTileSize {
+			tw := min(zrleTileSize, width-tx)
+
+			tile = tile[:0]
+			for y := ty; y < ty+th; y++ {
+				tile = append(tile, pixels[y*width+tx:y*width+tx+tw]...)
+			}
+			raw = append(raw, encodeZRLETile(tile, tw, th, pf)...)
+		}
+	}
+
+	e.buf.Reset()
+	e.zw.Write(raw)
+	e.zw.Flush()
+
+	out := make([]byte, 4, 4+e.buf.Len())
+	binary.BigEndian.PutUint32(out, uint32(e.buf.Len()))
+	return append(out, e.buf.Bytes()...)
+}
+
+// encodeZRLETile returns the smallest of the applicable subencodings for one tile
+func encodeZRLETile(tile []uint32, width, height int, pf PixelFormat) []byte {
+	palette, index := zrlePalette(tile, 127)
+	if len(palette) == 1 {
+		return appendCPixel([]byte{ZRLESolid}, palette[0], pf)
+	}
+
+	best := []byte{ZRLERaw}
+	for _, p := range tile {
+		best = appendCPixel(best, p, pf)
+	}
+
+	candidates := [][]byte{encodeZRLEPlainRLE(tile, pf)}
+	if len(palette) > 0 && len(palette) <= 16 {
+		candidates = append(candidates, encodeZRLEPackedPalette(tile, width, height, palette, index, pf))
+	}
+	if len(palette) > 0 {
+		candidates = append(candidates, encodeZRLEPaletteRLE(tile, palette, index, pf))
+	}
+	for _, c := range candidates {
+		if len(c) < len(best) {
+			best = c
+		}
+	}
+	return best
+}
+
+// zrlePalette collects up to limit distinct colours in order of appearance.
+// It returns a nil palette if the tile has more colours than that.
+func zrlePalette(tile []uint32, limit int) ([]uint32, map[uint32]int) {
+	index := make(map[uint32]int)
+	var palette []uint32
+	for _, p := range tile {
+		if _, ok := index[p]; ok {
+			continue
+		}
+		if len(palette) == limit {
+			return nil, nil
+		}
+		index[p] = len(palette)
+		palette = append(palette, p)
+	}
+	return palette, index
+}
+
+// encodeZRLEPackedPalette packs palette indices into 1, 2 or 4 bits per pixel, rows padded to a byte
+func encodeZRLEPackedPalette(tile []uint32, width, height int, palette []uint32, index map[uint32]int, pf PixelFormat) []byte {
+	out := []byte{byte(len(palette))}
+	for _, p := range palette {
+		out = appendCPixel(out, p, pf)
+	}
+
+	bits := zrlePackedBits(len(palette))
+	for y := 0; y < height; y++ {
+		var current byte
+		used := 0
+		for x := 0; x < width; x++ {
+			current = current<<bits | byte(index[tile[y*width+x]])
+			used += bits
+			if used == 8 {
+				out = append(out, current)
+				current, used = 0, 0
+			}
+		}
+		if used > 0 {
+			out = append(out, current<<(8-used))
+		}
+	}
+	return out
+}
+
+// zrlePackedBits returns the index width used for a packed palette of the given size
+func zrlePackedBits(paletteSize int) int {
+	switch {
+	case paletteSize <= 2:
+		return 1
+	case paletteSize <= 4:
+		return 2
+	default:
+		return 4
+	}
+}
+
+// encodeZRLEPlainRLE encodes runs as a colour followed by the run length
+func encodeZRLEPlainRLE(tile []uint32, pf PixelFormat) []byte {
+	out := []byte{ZRLEPlainRLE}
+	for i := 0; i < len(tile); {
+		run := zrleRunLength(tile, i)
+		out = appendCPixel(out, tile[i], pf)
+		out = appendZRLERunLength(out, run)
+		i += run
+	}
+	return out
+}
+
+// encodeZRLEPaletteRLE encodes runs as palette indices, with lengths only for runs longer than one
+func encodeZRLEPaletteRLE(tile []uint32, palette []uint32, index map[uint32]int, pf PixelFormat) []byte {
+	out := []byte{byte(128 + len(palette))}
+	for _, p := range palette {
+		out = appendCPixel(out, p, pf)
+	}
+	for i := 0; i < len(tile); {
+		run := zrleRunLength(tile, i)
+		if run == 1 {
+			out = append(out, byte(index[tile[i]]))
+		} else {
+			out = append(out, byte(index[tile[i]])|128)
+			out = appendZRLERunLength(out, run)
+		}
+		i += run
+	}
+	return out
+}
+
+// zrleRunLength counts identical pixels starting at i
+func zrleRunLength(tile []uint32, i int) int {
+	run := 1
+	for i+run < len(tile) && tile[i+run] == tile[i] {
+		run++
+	}
+	return run
+}
+
+// appendZRLERunLength encodes run-1 as a series of 255 bytes followed by the remainder
+func appendZRLERunLength(out []byte, run int) []byte {
+	run--
+	for run >= 255 {
+		out = append(out, 255)
+		run -= 255
+	}
+	return append(out, byte(run))
+}
+
+// cpixelLayout reports whether the pixel format uses 3-byte compressed pixels
+// and, if so, whether they hold the most significant 3 bytes of the pixel
+func cpixelLayout(pf PixelFormat) (compressed, mostSignificant bool) {
+	if pf.TrueColorFlag == 0 || pf.BitsPerPixel != 32 || pf.Depth > 24 {
+		return false, false
+	}
+	used := uint32(pf.RedMax)<<pf.RedShift | uint32(pf.GreenMax)<<pf.GreenShift | uint32(pf.BlueMax)<<pf.BlueShift
+	switch {
+	case used <= 0xFFFFFF:
+		return true, false
+	case used&0xFF == 0:
+		return true, true
+	default:
+		return false, false
+	}
+}
+
+// CPixelSize returns the size in bytes of a ZRLE compressed pixel in the given format
+func CPixelSize(pf PixelFormat) int {
+	if compressed, _ := cpixelLayout(pf); compressed {
+		return 3
+	}
+	return int(pf.BitsPerPixel) / 8
+}
+
+// appendCPixel appends a pixel value as a ZRLE compressed pixel
+func appendCPixel(dst []byte, value uint32, pf PixelFormat) []byte {
+	compressed, mostSignificant := cpixelLayout(pf)
+	if !compressed {
+		return appendPixel(dst, value, pf)
+	}
+	if mostSignificant {
+		value >>= 8
+	}
+	var buf [3]byte
+	WritePixelValue(buf[:], value, pf.BigEndianFlag)
+	return append(dst, buf[:]...)
+}
+
+// ZRLEDecoder reads zlib-compressed 64x64 tiles. Like the encoder it keeps one
+// zlib stream for the lifetime of the connection.
+type ZRLEDecoder struct {
+	stream zlibStream
+}
+
+// NewZRLEDecoder creates a decoder for a fresh zlib stream
+func NewZRLEDecoder() *ZRLEDecoder {
+	return &ZRLEDecoder{}
+}
+
+// Type returns ZRLEEncoding
+func (*ZRLEDecoder) Type() int32 {
+	return ZRLEEncoding
+}
+
+// Decode reads the length-prefixed zlib data of one rectangle and inflates
+// its tiles
+func (d *ZRLEDecoder) Decode(r io.Reader, width, height int, pf PixelFormat) (*image.RGBA, error) {
+	var length [4]byte
+	if _, err := io.ReadFull(r, length[:]); err != nil {
+		return nil, err
+	}
+	zr, err := d.stream.feed(r, int64(binary.BigEndian.Uint32(length[:])))
+	if err != nil {
+		return nil, err
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for ty := 0; ty < height; ty += zrleTileSize {
+		th := min(zrleTileSize, height-ty)
+		for tx := 0; tx < width; tx += zrleTileSize {
+			tw := min(zrleTileSize, width-tx)
+			if err := decodeZRLETile(zr, img, image.Rect(tx, ty, tx+tw, ty+th), pf); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return img, nil
+}
+
+// decodeZRLETile reads one tile's subencoding and pixels into img
+func decodeZRLETile(r io.Reader, img *image.RGBA, tile image.Rectangle, pf PixelFormat) error {
+	var subencoding [1]byte
+	if _, err := io.ReadFull(r, subencoding[:]); err != nil {
+		return err
+	}
+	width, count := tile.Dx(), tile.Dx()*tile.Dy()
+	set := func(i int, c color.RGBA) {
+		img.SetRGBA(tile.Min.X+i%width, tile.Min.Y+i/width, c)
+	}
+
+	switch n := int(subencoding[0]); {
+	case n == ZRLERaw:
+		pixels, err := readCPixels(r, count, pf)
+		if err != nil {
+			return err
+		}
+		for i, c := range pixels {
+			set(i, c)
+		}
+
+	case n == ZRLESolid:
+		pixels, err := readCPixels(r, 1, pf)
+		if err != nil {
+			return err
+		}
+		fillRect(img, tile, pixels[0])
+
+	case n <= 16:
+		palette, err := readCPixels(r, n, pf)
+		if err != nil {
+			return err
+		}
+		bits := zrlePackedBits(n)
+		rowBytes := (width*bits + 7) / 8
+		packed := make([]byte, rowBytes*tile.Dy())
+		if _, err := io.ReadFull(r, packed); err != nil {
+			return err
+		}
+		for i := 0; i < count; i++ {
+			x, y := i%width, i/width
+			bit := x * bits
+			index := int(packed[y*rowBytes+bit/8]>>(8-bits-bit%8)) & (1<<bits - 1)
+			if index >= n {
+				return fmt.Errorf("ZRLE palette index %d out of range", index)
+			}
+			set(i, palette[index])
+		}
+
+	case n == ZRLEPlainRLE:
+		for i := 0; i < count; {
+			pixels, err := readCPixels(r, 1, pf)
+			if err != nil {
+				return err
+			}
+			run, err := readZRLERunLength(r, count-i)
+			if err != nil {
+				return err
+			}
+			for end := i + run; i < end; i++ {
+				set(i, pixels[0])
+			}
+		}
+
+	case n >= ZRLEPaletteRLE:
+		palette, err := readCPixels(r, n-128, pf)
+		if err != nil {
+			return err
+		}
+		var entry [1]byte
+		for i := 0; i < count; {
+			if _, err := io.ReadFull(r, entry[:]); err != nil {
+				return err
+			}
+			index := int(entry[0] & 127)
+			if index >= len(palette) {
+				return fmt.Errorf("ZRLE palette index %d out of range", index)
+			}
+			run := 1
+			if entry[0]&128 != 0 {
+				if run, err = readZRLERunLength(r, count-i); err != nil {
+					return err
+				}
+			}
+			for end := i + run; i < end; i++ {
+				set(i, palette[index])
+			}
+		}
+
+	default:
+		return fmt.Errorf("invalid ZRLE subencoding %d", n)
+	}
+	return nil
+}
+
+// zlibStream inflates a zlib stream that arrives in pieces, one per rectangle,
+// as ZRLE and Tight send it
+type zlibStream struct {
+	compressed bytes.Buffer // Received zlib data not yet inflated
+	zr         io.ReadCloser
+}
+
+// feed appends n bytes of compressed data from r and returns the inflating
+// reader. The data is buffered first, so inflating never waits on r.
+func (z *zlibStream) feed(r io.Reader, n int64) (io.Reader, error) {
+	if _, err := io.CopyN(&z.compressed, r, n); err != nil {
+		return nil, err
+	}
+	if z.zr == nil {
+		zr, err := zlib.NewReader(&z.compressed)
+		if err != nil {
+			return nil, fmt.Errorf("invalid zlib stream: %v", err)
+		}
+		z.zr = zr
+	}
+	return z.zr, nil
+}
+
+// readZRLERunLength reads a run length encoded as a series of 255 bytes plus
+// the remainder, which must not exceed the pixels left in the tile
+func readZRLERunLength(r io.Reader, remaining int) (int, error) {
+	var b [1]byte
+	run := 1
+	for {
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return 0, err
+		}
+		run += int(b[0])
+		if run > remaining {
+			return 0, fmt.Errorf("ZRLE run of %d overruns the tile", run)
+		}
+		if b[0] != 255 {
+			return run, nil
+		}
+	}
+}
+
+// readCPixels reads n ZRLE compressed pixels
+func readCPixels(r io.Reader, n int, pf PixelFormat) ([]color.RGBA, error) {
+	size := CPixelSize(pf)
+	data := make([]byte, n*size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+
+	_, mostSignificant := cpixelLayout(pf)
+	pixels := make([]color.RGBA, n)
+	for i := range pixels {
+		value := ReadPixelValue(data[i*size:(i+1)*size], pf.BigEndianFlag)
+		if size == 3 && mostSignificant {
+			value <<= 8
+		}
+		pixels[i] = pixelValueToRGBA(value, pf)
+	}
+	return pixels, nil
+}
@@ -0,0 +1,218 @@
+package rfb
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"io"
+	"testing"
+)
+
+// inflateZRLE strips the length prefix from ZRLE output and feeds it to the shared stream
+func inflateZRLE(t *testing.T, stream *bytes.Buffer, out []byte) {
+	t.Helper()
+	if len(out) < 4 {
+		t.Fatalf("ZRLE output too short: %d bytes", len(out))
+	}
+	length := binary.BigEndian.Uint32(out[:4])
+	if int(length) != len(out)-4 {
+		t.Fatalf("ZRLE length prefix = %d, want %d", length, len(out)-4)
+	}
+	stream.Write(out[4:])
+}
+
+func TestZRLEEncodeSolid(t *testing.T) {
+	e := NewZRLEEncoder()
+	var compressed bytes.Buffer
+
+	inflateZRLE(t, &compressed, e.Encode(solidBGRA(64, 64, 1, 2, 3), 64, 64, DefaultPixelFormat()))
+	// A second rectangle continues the same zlib stream
+	inflateZRLE(t, &compressed, e.Encode(solidBGRA(10, 10, 4, 5, 6), 10, 10, DefaultPixelFormat()))
+
+	zr, err := zlib.NewReader(&compressed)
+	if err != nil {
+		t.Fatalf("zlib.NewReader() error = %v", err)
+	}
+	tiles := make([]byte, 8)
+	if _, err := io.ReadFull(zr, tiles); err != nil {
+		t.Fatalf("Reading tiles error = %v", err)
+	}
+
+	// Solid tiles with 3-byte CPIXELs
+	expected := []byte{ZRLESolid, 1, 2, 3, ZRLESolid, 4, 5, 6}
+	if !bytes.Equal(tiles, expected) {
+		t.Errorf("Tiles = %v, want %v", tiles, expected)
+	}
+}
+
+func TestZRLETileSubencodings(t *testing.T) {
+	pf := DefaultPixelFormat()
+
+	// Two colours in a checkerboard favour a packed palette
+	checker := make([]uint32, 16)
+	for i := range checker {
+		checker[i] = uint32((i + i/4) % 2)
+	}
+	out := encodeZRLETile(checker, 4, 4, pf)
+	if out[0] != 2 {
+		t.Errorf("Checkerboard subencoding = %d, want packed palette of 2", out[0])
+	}
+	// 1 + 2 palette entries + 4 rows of 1 byte each
+	if len(out) != 1+2*3+4 {
+		t.Errorf("Checkerboard length = %d, want %d", len(out), 1+2*3+4)
+	}
+
+	// Many colours in long runs favour plain RLE
+	runs := make([]uint32, 64*64)
+	for i := range runs {
+		runs[i] = uint32(i / 32)
+	}
+	if out := encodeZRLETile(runs, 64, 64, pf); out[0] != ZRLEPlainRLE {
+		t.Errorf("Long runs subencoding = %d, want plain RLE", out[0])
+	}
+
+	// Few colours in runs favour palette RLE
+	stripes := make([]uint32, 64*64)
+	for i := range stripes {
+		stripes[i] = uint32(i/256) % 3
+	}
+	if out := encodeZRLETile(stripes, 64, 64, pf); out[0] != 128+3 {
+		t.Errorf("Stripes subencoding = %d, want palette RLE of 3", out[0])
+	}
+
+	// Noise is sent raw
+	noise := make([]uint32, 16)
+	for i := range noise {
+		noise[i] = uint32(i * 7919)
+	}
+	if out := encodeZRLETile(noise, 4, 4, pf); out[0] != ZRLERaw || len(out) != 1+16*3 {
+		t.Errorf("Noise subencoding = %d length %d, want raw", out[0], len(out))
+	}
+}
+
+func TestZRLERunLength(t *testing.T) {
+	tests := []struct {
+		run      int
+		expected []byte
+	}{
+		{1, []byte{0}},
+		{255, []byte{254}},
+		{256, []byte{255, 0}},
+		{600, []byte{255, 255, 89}},
+	}
+	for _, tt := range tests {
+		if got := appendZRLERunLength(nil, tt.run); !bytes.Equal(got, tt.expected) {
+			t.Errorf("appendZRLERunLength(%d) = %v, want %v", tt.run, got, tt.expected)
+		}
+	}
+}
+
+func TestCPixelSize(t *testing.T) {
+	bigEndianHigh := PixelFormat{
+		BitsPerPixel: 32, Depth: 24, BigEndianFlag: 1, TrueColorFlag: 1,
+		RedMax: 255, GreenMax: 255, BlueMax: 255,
+		RedShift: 24, GreenShift: 16, BlueShift: 8,
+	}
+
+	tests := []struct {
+		name     string
+		format   PixelFormat
+		expected int
+	}{
+		{"32bpp depth 24", DefaultPixelFormat(), 3},
+		{"32bpp high bytes", bigEndianHigh, 3},
+		{"16bpp", RGB565PixelFormat(), 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CPixelSize(tt.format); got != tt.expected {
+				t.Errorf("CPixelSize() = %d, want %d", got, tt.expected)
+			}
+		})
+	}
+
+	// High-byte CPIXELs drop the unused low byte
+	got := appendCPixel(nil, 0x11223300, bigEndianHigh)
+	if !bytes.Equal(got, []byte{0x11, 0x22, 0x33}) {
+		t.Errorf("appendCPixel() = %v, want [17 34 51]", got)
+	}
+}
+
+// patternBGRA returns a width x height frame coloured by pixel(x, y)
+func patternBGRA(width, height int, pixel func(x, y int) [3]byte) []byte {
+	data := make([]byte, width*height*4)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			p := pixel(x, y)
+			copy(data[(y*width+x)*4:], []byte{p[0], p[1], p[2], 255})
+		}
+	}
+	return data
+}
+
+func TestZRLEDecodeRoundTrip(t *testing.T) {
+	const width, height = 100, 70 // Partial tiles on both edges
+	frames := []struct {
+		name string
+		data []byte
+	}{
+		{"solid", solidBGRA(width, height, 1, 2, 3)},
+		{"noise", benchmarkFrame(width, height)},
+		{"checkerboard", patternBGRA(width, height, func(x, y int) [3]byte {
+			return [3]byte{byte((x + y) % 2 * 255), 0, 0}
+		})},
+		{"long runs", patternBGRA(width, height, func(x, y int) [3]byte {
+			return [3]byte{byte(y), byte(x / 40), 9}
+		})},
+		{"stripes", patternBGRA(width, height, func(x, y int) [3]byte {
+			return [3]byte{byte(y / 8 % 3 * 60), 0, 200}
+		})},
+	}
+
+	for _, f := range benchmarkFormats {
+		t.Run(f.name, func(t *testing.T) {
+			// One encoder and decoder for every frame, as on a connection
+			e, d := NewZRLEEncoder(), NewZRLEDecoder()
+			for _, frame := range frames {
+				r := bytes.NewReader(e.Encode(frame.data, width, height, f.format))
+				got, err := d.Decode(r, width, height, f.format)
+				if err != nil {
+					t.Fatalf("Decode(%s) error = %v", frame.name, err)
+				}
+				if r.Len() != 0 {
+					t.Errorf("Decode(%s) left %d bytes unread", frame.name, r.Len())
+				}
+				if want := decodeRaw(t, frame.data, width, height, f.format); !bytes.Equal(got.Pix, want.Pix) {
+					t.Errorf("Decode(%s) pixels differ from the Raw encoding of the same frame", frame.name)
+				}
+			}
+		})
+	}
+}
+
+func TestZRLEDecodeInvalid(t *testing.T) {
+	pf := DefaultPixelFormat()
+	tests := []struct {
+		name string
+		tile []byte
+	}{
+		{"unused subencoding", []byte{17}},
+		{"run overruns tile", []byte{ZRLEPlainRLE, 1, 2, 3, 255, 255}},
+		{"palette index out of range", []byte{ZRLEPaletteRLE, 1, 2, 3, 4, 5, 6, 5}},
+		{"truncated", []byte{ZRLERaw, 1, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var compressed bytes.Buffer
+			zw := zlib.NewWriter(&compressed)
+			zw.Write(tt.tile)
+			zw.Flush()
+			data := binary.BigEndian.AppendUint32(nil, uint32(compressed.Len()))
+			data = append(data, compressed.Bytes()...)
+
+			if _, err := NewZRLEDecoder().Decode(bytes.NewReader(data), 4, 4, pf); err == nil {
+				t.Errorf("Decode() succeeded, want error")
+			}
+		})
+	}
+}
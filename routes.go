@@ -0,0 +1,117 @@
+package websockify
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Route proxies WebSocket connections to one path to a target of their own.
+type Route struct {
+	Path   string // Such as /vnc/desk1
+	Target string // host:port
+}
+
+func (r Route) String() string {
+	return r.Path + "=" + r.Target
+}
+
+// ParseRoute parses a route written as /path=host:port.
+func ParseRoute(s string) (Route, error) {
+	path, target, ok := strings.Cut(s, "=")
+	if !ok {
+		return Route{}, fmt.Errorf("invalid route %q: want /path=host:port", s)
+	}
+	route := Route{Path: strings.TrimSpace(path), Target: strings.TrimSpace(target)}
+	if err := route.validate(); err != nil {
+		return Route{}, err
+	}
+	return route, nil
+}
+
+// validate checks the route's path and target.
+func (r Route) validate() error {
+	if !strings.HasPrefix(r.Path, "/") {
+		return fmt.Errorf("invalid route %q: path must start with /", r)
+	}
+	if _, _, err := net.SplitHostPort(r.Target); err != nil {
+		return fmt.Errorf("invalid route %q: %v", r, err)
+	}
+	return nil
+}
+
+// ReadRouteList reads routes from a file with one /path=host:port per line.
+// Blank lines and lines starting with # are skipped.
+func ReadRouteList(path string) ([]Route, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read target list: %v", err)
+	}
+	defer file.Close()
+
+	var routes []Route
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		route, err := ParseRoute(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+		routes = append(routes, route)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read target list: %v", err)
+	}
+	return routes, nil
+}
+
+// checkRoutes checks each route, and that http.ServeMux accepts its path
+// alongside the others and those the server serves itself, reserved maps
+// to what serves them, rather than panicking.
+func checkRoutes(routes []Route, reserved map[string]string) error {
+	mux := http.NewServeMux()
+	for path := range reserved {
+		mux.Handle(path, http.NotFoundHandler())
+	}
+	paths := make(map[string]bool)
+	for _, route := range routes {
+		if err := route.validate(); err != nil {
+			return err
+		}
+		if paths[route.Path] {
+			return fmt.Errorf("duplicate route for %s", route.Path)
+		}
+		if what, ok := reserved[route.Path]; ok {
+			return fmt.Errorf("route %s conflicts with %s", route, what)
+		}
+		if err := handlePattern(mux, route.Path); err != nil {
+			return fmt.Errorf("invalid route %q: %v", route, err)
+		}
+		paths[route.Path] = true
+	}
+	return nil
+}
+
+// registeredAt is the location ServeMux adds to the patterns in its panics
+var registeredAt = regexp.MustCompile(` \(registered at [^)]*\)`)
+
+// handlePattern registers pattern on mux, returning the reason ServeMux
+// panics with if it is invalid or conflicts with one already registered.
+func handlePattern(mux *http.ServeMux, pattern string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			message, _, _ := strings.Cut(fmt.Sprint(r), "\n")
+			err = errors.New(strings.TrimSuffix(registeredAt.ReplaceAllString(message, ""), ":"))
+		}
+	}()
+	mux.Handle(pattern, http.NotFoundHandler())
+	return nil
+}
@@ -0,0 +1,283 @@
+package websockify
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestParseRoute(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Route
+		wantErr bool
+	}{
+		{"/vnc=localhost:5900", Route{Path: "/vnc", Target: "localhost:5900"}, false},
+		{" /ssh = 10.0.0.2:22 ", Route{Path: "/ssh", Target: "10.0.0.2:22"}, false},
+		{"/v6=[::1]:5901", Route{Path: "/v6", Target: "[::1]:5901"}, false},
+		{"vnc=localhost:5900", Route{}, true},
+		{"/vnc=localhost", Route{}, true},
+		{"/vnc", Route{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseRoute(tt.in)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("ParseRoute(%q) = %+v, %v, want %+v (error %v)", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestReadRouteList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "targets")
+	content := "# Desktops\n/desk1=10.0.0.1:5900\n\n/desk2=10.0.0.2:5900\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	routes, err := ReadRouteList(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Route{{"/desk1", "10.0.0.1:5900"}, {"/desk2", "10.0.0.2:5900"}}
+	if len(routes) != len(want) || routes[0] != want[0] || routes[1] != want[1] {
+		t.Errorf("ReadRouteList() = %v, want %v", routes, want)
+	}
+
+	if err := os.WriteFile(path, []byte("/desk1=10.0.0.1:5900\ndesk2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadRouteList(path); err == nil || !strings.Contains(err.Error(), ":2:") {
+		t.Errorf("ReadRouteList() with a bad line error = %v, want its line number", err)
+	}
+}
+
+func TestServeRejectsBadRoutes(t *testing.T) {
+	files := fstest.MapFS{"vnc.html": {Data: []byte("noVNC")}}
+	pick := func(r *http.Request) (string, error) { return "", nil }
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr string
+	}{
+		{
+			name:    "duplicate of the target",
+			config:  Config{Target: "localhost:5900", Routes: []Route{{"/websockify", "localhost:5901"}}},
+			wantErr: "duplicate route for /websockify",
+		},
+		{
+			name:    "duplicate",
+			config:  Config{Routes: []Route{{"/a", "localhost:5901"}, {"/a", "localhost:5902"}}},
+			wantErr: "duplicate route for /a",
+		},
+		{
+			name:    "token endpoint",
+			config:  Config{TokenResolver: &TokenExec{Command: "true"}, Routes: []Route{{"/websockify", "localhost:5901"}}},
+			wantErr: "conflicts with the token connections",
+		},
+		{
+			name:    "TargetFunc endpoint",
+			config:  Config{TargetFunc: pick, Routes: []Route{{"/websockify", "localhost:5901"}}},
+			wantErr: "conflicts with the TargetFunc's connections",
+		},
+		{
+			name:    "web root",
+			config:  Config{WebRoot: t.TempDir(), Routes: []Route{{"/", "localhost:5901"}}},
+			wantErr: "conflicts with the web files",
+		},
+		{
+			name:    "web files",
+			config:  Config{WebFS: files, Routes: []Route{{"/", "localhost:5901"}}},
+			wantErr: "conflicts with the web files",
+		},
+		{
+			name:    "conflicting wildcards",
+			config:  Config{Routes: []Route{{"/{desk}/vnc", "localhost:5901"}, {"/vnc/{desk}", "localhost:5902"}}},
+			wantErr: `pattern "/vnc/{desk}" conflicts with pattern "/{desk}/vnc"`,
+		},
+		{
+			name:    "space",
+			config:  Config{Routes: []Route{{"/a b", "localhost:5901"}}},
+			wantErr: `invalid route "/a b=localhost:5901"`,
+		},
+		{
+			name:    "unterminated wildcard",
+			config:  Config{Routes: []Route{{"/vnc/{desk", "localhost:5901"}}},
+			wantErr: "bad wildcard segment",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.Listener = "127.0.0.1:0"
+			tt.config.Logger = &NoOpLogger{}
+			err := New(tt.config).Serve(context.Background())
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Serve() = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// echoListener accepts TCP connections and writes back what it reads,
+// prefixed with name
+func echoListener(t *testing.T, name string) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				buf := make([]byte, 1024)
+				for {
+					n, err := conn.Read(buf)
+					if err != nil {
+						return
+					}
+					conn.Write(append([]byte(name+":"), buf[:n]...))
+				}
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestRoutesProxyToTheirTargets(t *testing.T) {
+	server := New(Config{Logger: &NoOpLogger{}})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/a", server.routeHandler(echoListener(t, "a")))
+	mux.HandleFunc("/b", server.routeHandler(echoListener(t, "b")))
+	web := httptest.NewServer(mux)
+	defer web.Close()
+
+	for _, name := range []string{"a", "b"} {
+		url := "ws" + strings.TrimPrefix(web.URL, "http") + "/" + name
+		conn, _, err := websocket.DefaultDialer.Dial(url, http.Header{"Origin": {web.URL}})
+		if err != nil {
+			t.Fatalf("Dial(%s) = %v", url, err)
+		}
+		if err := conn.WriteMessage(websocket.BinaryMessage, []byte("ping")); err != nil {
+			t.Fatal(err)
+		}
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		_, reply, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := string(reply), name+":ping"; got != want {
+			t.Errorf("reply on /%s = %q, want %q", name, got, want)
+		}
+		conn.Close()
+	}
+}
+
+func TestTargetFunc(t *testing.T) {
+	targets := map[string]string{"a": echoListener(t, "a"), "b": echoListener(t, "b")}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	server := New(Config{
+		Listener: addr,
+		Target:   echoListener(t, "default"),
+		TargetFunc: func(r *http.Request) (string, error) {
+			desk := r.Header.Get("X-Desk")
+			if desk == "locked" {
+				return "", errors.New("desk is locked")
+			}
+			return targets[desk], nil
+		},
+		Logger: &NoOpLogger{},
+	})
+	go server.Serve(ctx)
+
+	url := "ws://" + addr + "/websockify"
+	tests := []struct {
+		desk     string
+		want     string
+		wantCode int
+	}{
+		{"a", "a:ping", 0},
+		{"b", "b:ping", 0},
+		{"", "default:ping", 0},
+		{"locked", "", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		header := http.Header{"Origin": {"http://" + addr}, "X-Desk": {tt.desk}}
+		var conn *websocket.Conn
+		var resp *http.Response
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			conn, resp, err = websocket.DefaultDialer.Dial(url, header)
+			if resp != nil || time.Now().After(deadline) {
+				break
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		if tt.wantCode != 0 {
+			if err == nil || resp == nil || resp.StatusCode != tt.wantCode {
+				t.Errorf("Dial() with desk %q = %v, want status %d", tt.desk, err, tt.wantCode)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Dial() with desk %q = %v", tt.desk, err)
+		}
+		if err := conn.WriteMessage(websocket.BinaryMessage, []byte("ping")); err != nil {
+			t.Fatal(err)
+		}
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		_, reply, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(reply); got != tt.want {
+			t.Errorf("reply with desk %q = %q, want %q", tt.desk, got, tt.want)
+		}
+		conn.Close()
+	}
+}
+
+func TestTargetFuncWithoutFallback(t *testing.T) {
+	// With no Target or TokenResolver, a request the TargetFunc picks no
+	// target for is refused rather than upgraded and dialled to ""
+	server := New(Config{
+		TargetFunc: func(r *http.Request) (string, error) { return "", nil },
+		Logger:     &NoOpLogger{},
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/websockify", nil)
+	r.Header.Set("Connection", "Upgrade")
+	r.Header.Set("Upgrade", "websocket")
+	r.Header.Set("Sec-WebSocket-Version", "13")
+	r.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	r.Header.Set("Origin", "http://example.com")
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("ServeHTTP() = %d, want %d", w.Code, http.StatusForbidden)
+	}
+	if got := server.Metrics().Refused; got != 1 {
+		t.Errorf("Refused = %d, want 1", got)
+	}
+}
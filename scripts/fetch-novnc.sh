@@ -0,0 +1,41 @@
+#!/usr/bin/env bash
+
+# This script downloads a noVNC release into novnc/dist, to be embedded in
+# builds with -tags novnc. Set NOVNC_VERSION to choose the release.
+
+set -euo pipefail
+
+# Change to the root of the git repository
+cd "$(dirname "${BASH_SOURCE[0]}")/.."
+
+version="${NOVNC_VERSION:-1.5.0}"
+dist=novnc/dist
+url="https://github.com/novnc/noVNC/archive/refs/tags/v${version}.tar.gz"
+
+tmp=$(mktemp -d)
+trap 'rm -rf "${tmp}"' EXIT
+
+echo "Fetching noVNC ${version} from ${url}"
+curl -fsSL "${url}" | tar -xz -C "${tmp}"
+src="${tmp}/noVNC-${version}"
+
+# Keep only what the browser loads, and the license
+find "${dist}" -mindepth 1 -maxdepth 1 ! -name .gitkeep -exec rm -rf {} +
+cp -R "${src}/app" "${src}/core" "${src}/vendor" "${src}/vnc.html" "${src}/vnc_lite.html" "${src}/LICENSE.txt" "${dist}/"
+echo "${version}" > "${dist}/VERSION"
+
+# Opening the server's address connects straight away; noVNC's default path
+# is /websockify, where websockify serves -target
+cat > "${dist}/index.html" <<'EOF'
+<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="0; url=vnc.html?autoconnect=true&amp;resize=scale">
+<title>noVNC</title>
+</head>
+<body><a href="vnc.html?autoconnect=true&amp;resize=scale">noVNC</a></body>
+</html>
+EOF
+
+echo "noVNC ${version} is in ${dist}; build with -tags novnc to bundle it"
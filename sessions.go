@@ -0,0 +1,125 @@
+package websockify
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Metrics are server-wide counters. Counters cover every connection since the
+// server was created.
+type Metrics struct {
+	Sessions       int   `json:"sessions"`              // Connections being proxied
+	Connections    int64 `json:"connections_total"`     // Connections proxied to their target
+	Refused        int64 `json:"refused_total"`         // Requests refused by authentication, token lookup or limits
+	TargetFailures int64 `json:"target_failures_total"` // Connections whose target could not be reached
+	BytesToTarget  int64 `json:"bytes_to_target_total"` // Bytes forwarded from clients to targets
+	BytesToClient  int64 `json:"bytes_to_client_total"` // Bytes forwarded from targets to clients
+}
+
+// Session describes a connection being proxied.
+type Session struct {
+	ID            uint64    `json:"id"`
+	Client        string    `json:"client"` // Address the WebSocket came from
+	Path          string    `json:"path"`
+	Target        string    `json:"target"`
+	Started       time.Time `json:"started"`
+	LastActive    time.Time `json:"last_active"` // When data last passed either way
+	BytesToTarget int64     `json:"bytes_to_target"`
+	BytesToClient int64     `json:"bytes_to_client"`
+}
+
+// session is the live state of a connection being proxied.
+type session struct {
+	id      uint64
+	client  string
+	path    string
+	target  string
+	started time.Time
+
+	activity
+	toTarget atomic.Int64
+	toClient atomic.Int64
+}
+
+// sessionTable holds the server's sessions and the counters for Metrics.
+type sessionTable struct {
+	mutex    sync.Mutex
+	sessions map[uint64]*session
+	nextID   uint64
+
+	connections    atomic.Int64
+	refused        atomic.Int64
+	targetFailures atomic.Int64
+	// Bytes of sessions that have ended; live ones are added in Metrics
+	toTarget atomic.Int64
+	toClient atomic.Int64
+}
+
+// start records a new session for a request proxied to target.
+func (t *sessionTable) start(r *http.Request, target string) *session {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.sessions == nil {
+		t.sessions = make(map[uint64]*session)
+	}
+	t.nextID++
+	sess := &session{id: t.nextID, client: r.RemoteAddr, path: r.URL.Path, target: target, started: time.Now()}
+	sess.touch()
+	t.sessions[sess.id] = sess
+	t.connections.Add(1)
+	return sess
+}
+
+// end removes a session, keeping its byte counts.
+func (t *sessionTable) end(sess *session) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	delete(t.sessions, sess.id)
+	t.toTarget.Add(sess.toTarget.Load())
+	t.toClient.Add(sess.toClient.Load())
+}
+
+// Metrics returns the server's current counters.
+func (s *Server) Metrics() Metrics {
+	t := &s.sessions
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	m := Metrics{
+		Sessions:       len(t.sessions),
+		Connections:    t.connections.Load(),
+		Refused:        t.refused.Load(),
+		TargetFailures: t.targetFailures.Load(),
+		BytesToTarget:  t.toTarget.Load(),
+		BytesToClient:  t.toClient.Load(),
+	}
+	for _, sess := range t.sessions {
+		m.BytesToTarget += sess.toTarget.Load()
+		m.BytesToClient += sess.toClient.Load()
+	}
+	return m
+}
+
+// Sessions returns the connections being proxied, oldest first.
+func (s *Server) Sessions() []Session {
+	t := &s.sessions
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	sessions := make([]Session, 0, len(t.sessions))
+	for _, sess := range t.sessions {
+		sessions = append(sessions, Session{
+			ID:            sess.id,
+			Client:        sess.client,
+			Path:          sess.path,
+			Target:        sess.target,
+			Started:       sess.started,
+			LastActive:    time.Unix(0, sess.last.Load()),
+			BytesToTarget: sess.toTarget.Load(),
+			BytesToClient: sess.toClient.Load(),
+		})
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].ID < sessions[j].ID })
+	return sessions
+}
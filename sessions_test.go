@@ -0,0 +1,68 @@
+package websockify
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestSessionsAndMetrics(t *testing.T) {
+	// A port nothing listens on, for a target that cannot be reached
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unreachable := closed.Addr().String()
+	closed.Close()
+
+	server := New(Config{Logger: &NoOpLogger{}, Limits: Limits{MaxConnections: 1}})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/echo", server.routeHandler(echoListener(t, "echo")))
+	mux.HandleFunc("/down", server.routeHandler(unreachable))
+	web := httptest.NewServer(mux)
+	defer web.Close()
+
+	conn, _, err := dialEcho(t, web.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	echo(t, conn)
+	if _, _, err := dialEcho(t, web.URL); err == nil {
+		t.Errorf("Dial() over MaxConnections succeeded, want it refused")
+	}
+
+	sessions := server.Sessions()
+	if len(sessions) != 1 {
+		t.Fatalf("Sessions() = %+v, want 1 session", sessions)
+	}
+	if got := sessions[0]; got.Path != "/echo" || got.BytesToTarget != 4 || got.BytesToClient != 9 {
+		t.Errorf("Sessions()[0] = %+v, want /echo with 4 bytes to the target and 9 back", got)
+	}
+
+	conn.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(server.Sessions()) > 0 || server.limiter.open() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("session still open after the client closed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The target's failure closes the WebSocket after it is upgraded
+	url := "ws" + strings.TrimPrefix(web.URL, "http") + "/down"
+	down, _, err := websocket.DefaultDialer.Dial(url, http.Header{"Origin": {web.URL}})
+	if err == nil {
+		down.ReadMessage()
+		down.Close()
+	}
+
+	want := Metrics{Connections: 1, Refused: 1, TargetFailures: 1, BytesToTarget: 4, BytesToClient: 9}
+	if got := server.Metrics(); got != want {
+		t.Errorf("Metrics() = %+v, want %+v", got, want)
+	}
+}
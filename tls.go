@@ -0,0 +1,155 @@
+package websockify
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// AutoCert configures certificates obtained automatically from an ACME CA
+// such as Let's Encrypt. The CA checks each domain by connecting to it on
+// port 443, so the listener must be reachable there.
+type AutoCert struct {
+	// Domains lists the names certificates are obtained for. Handshakes
+	// for other names fail.
+	Domains []string
+	// CacheDir keeps the account key and certificates across restarts,
+	// which Let's Encrypt's rate limits make all but required.
+	CacheDir string
+	// Email, if set, is given to the CA for expiry notices.
+	Email string
+	// DirectoryURL defaults to Let's Encrypt's production directory.
+	DirectoryURL string
+}
+
+// manager returns the autocert.Manager obtaining the certificates. Its
+// TLS-ALPN-01 challenges are answered on the listener itself.
+func (a *AutoCert) manager() (*autocert.Manager, error) {
+	if len(a.Domains) == 0 {
+		return nil, fmt.Errorf("no domains to obtain certificates for")
+	}
+	if a.CacheDir == "" {
+		return nil, fmt.Errorf("no cache directory for certificates")
+	}
+	domains := make([]string, len(a.Domains))
+	for i, domain := range a.Domains {
+		domains[i] = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(domain), "."))
+		if domains[i] == "" || strings.ContainsAny(domains[i], `/\*`) {
+			return nil, fmt.Errorf("invalid domain %q", domain)
+		}
+	}
+	return &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		Cache:      autocert.DirCache(a.CacheDir),
+		HostPolicy: autocert.HostWhitelist(domains...),
+		Email:      a.Email,
+		Client:     &acme.Client{DirectoryURL: a.DirectoryURL},
+	}, nil
+}
+
+// certReloader serves a certificate from files, loading it again whenever the
+// certificate file changes so renewed certificates are used without a restart.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// newCertReloader loads the certificate in certFile and keyFile. The key is
+// read from certFile too if keyFile is empty.
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	if keyFile == "" {
+		keyFile = certFile
+	}
+	c := &certReloader{certFile: certFile, keyFile: keyFile}
+	if _, err := c.load(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// load returns the current certificate, reading the files again if the
+// certificate file has changed since it was last read.
+func (c *certReloader) load() (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	info, err := os.Stat(c.certFile)
+	if err != nil {
+		if c.cert != nil {
+			return c.cert, nil
+		}
+		return nil, fmt.Errorf("failed to read the TLS certificate: %v", err)
+	}
+	if c.cert != nil && info.ModTime().Equal(c.modTime) {
+		return c.cert, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		// Keep serving the last good certificate while the files are
+		// half written
+		if c.cert != nil {
+			return c.cert, nil
+		}
+		return nil, fmt.Errorf("failed to load the TLS certificate: %v", err)
+	}
+	c.cert = &cert
+	c.modTime = info.ModTime()
+	return c.cert, nil
+}
+
+func (c *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return c.load()
+}
+
+// tlsConfig returns the configuration to terminate TLS with, or nil if the
+// server speaks plain HTTP.
+func (s *Server) tlsConfig() (*tls.Config, error) {
+	if s.autoCert != nil {
+		if s.certFile != "" || s.keyFile != "" {
+			return nil, fmt.Errorf("CertFile and AutoCert cannot both be set")
+		}
+		manager, err := s.autoCert.manager()
+		if err != nil {
+			return nil, fmt.Errorf("AutoCert: %v", err)
+		}
+		s.logger.Printf("Obtaining certificates for %s automatically", strings.Join(s.autoCert.Domains, ", "))
+		// The manager's own configuration offers HTTP/2, which WebSocket
+		// upgrades cannot use, so only its certificates and its challenge
+		// protocol are taken
+		config := &tls.Config{MinVersion: tls.VersionTLS12}
+		if s.tls != nil {
+			config = s.tls.Clone()
+		}
+		config.GetCertificate = manager.TLSConfig().GetCertificate
+		config.NextProtos = append(config.NextProtos, acme.ALPNProto)
+		return config, nil
+	}
+	if s.certFile == "" {
+		if s.keyFile != "" {
+			return nil, fmt.Errorf("KeyFile needs a CertFile")
+		}
+		return s.tls, nil
+	}
+
+	certs, err := newCertReloader(s.certFile, s.keyFile)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if s.tls != nil {
+		config = s.tls.Clone()
+	}
+	config.GetCertificate = certs.getCertificate
+	return config, nil
+}
@@ -0,0 +1,196 @@
+package websockify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websockify/mockvnc"
+	"github.com/gorilla/websocket"
+	"golang.org/x/crypto/acme"
+)
+
+// writeCertificate writes a new self-signed certificate for localhost to
+// certFile and its key to keyFile, appending to certFile if they are the same
+func writeCertificate(t *testing.T, certFile, keyFile string) *x509.Certificate {
+	t.Helper()
+	cert, err := mockvnc.SelfSignedCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key})
+	if certFile == keyFile {
+		certPEM = append(certPEM, keyPEM...)
+	}
+	if err := os.WriteFile(certFile, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if certFile != keyFile {
+		if err := os.WriteFile(keyFile, keyPEM, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf
+}
+
+func TestServeTLS(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	leaf := writeCertificate(t, certFile, keyFile)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	server := New(Config{
+		Listener: addr,
+		Target:   echoListener(t, "tls"),
+		CertFile: certFile,
+		KeyFile:  keyFile,
+		Logger:   &NoOpLogger{},
+	})
+	go server.Serve(ctx)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(leaf)
+	dialer := websocket.Dialer{TLSClientConfig: &tls.Config{RootCAs: roots}, HandshakeTimeout: time.Second}
+	url := "wss://localhost:" + strings.Split(addr, ":")[1] + "/websockify"
+
+	var conn *websocket.Conn
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		conn, _, err = dialer.Dial(url, http.Header{"Origin": {"https://localhost"}})
+		if err == nil || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("Dial(%s) = %v", url, err)
+	}
+	defer conn.Close()
+
+	if err := conn.WriteMessage(websocket.BinaryMessage, []byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, reply, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(reply), "tls:ping"; got != want {
+		t.Errorf("reply = %q, want %q", got, want)
+	}
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	combined := filepath.Join(dir, "self.pem")
+	first := writeCertificate(t, combined, combined)
+
+	certs, err := newCertReloader(combined, "")
+	if err != nil {
+		t.Fatalf("newCertReloader() with a combined file = %v", err)
+	}
+	cert, err := certs.getCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(cert.Certificate[0], first.Raw) {
+		t.Errorf("getCertificate() did not return the certificate in %s", combined)
+	}
+
+	second := writeCertificate(t, combined, combined)
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(combined, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if cert, _ = certs.getCertificate(nil); !bytes.Equal(cert.Certificate[0], second.Raw) {
+		t.Errorf("getCertificate() after a renewal did not return the new certificate")
+	}
+
+	if err := os.WriteFile(combined, []byte("half written"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(combined, later.Add(time.Minute), later.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if cert, err = certs.getCertificate(nil); err != nil || !bytes.Equal(cert.Certificate[0], second.Raw) {
+		t.Errorf("getCertificate() with a bad file = %v, want the last good certificate", err)
+	}
+}
+
+func TestServeTLSErrors(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name   string
+		config Config
+		want   string
+	}{
+		{"key without cert", Config{KeyFile: filepath.Join(dir, "key.pem")}, "KeyFile needs a CertFile"},
+		{"missing cert", Config{CertFile: filepath.Join(dir, "missing.pem")}, "failed to read the TLS certificate"},
+		{"cert and autocert", Config{CertFile: filepath.Join(dir, "cert.pem"), AutoCert: &AutoCert{Domains: []string{"example.test"}, CacheDir: dir}}, "cannot both be set"},
+		{"autocert without domains", Config{AutoCert: &AutoCert{CacheDir: dir}}, "no domains"},
+		{"autocert without cache", Config{AutoCert: &AutoCert{Domains: []string{"example.test"}}}, "no cache directory"},
+		{"autocert wildcard", Config{AutoCert: &AutoCert{Domains: []string{"*.example.test"}, CacheDir: dir}}, "invalid domain"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.Listener = "127.0.0.1:0"
+			tt.config.Logger = &NoOpLogger{}
+			err := New(tt.config).Serve(context.Background())
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Serve() = %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAutoCertConfig(t *testing.T) {
+	s := New(Config{
+		AutoCert:  &AutoCert{Domains: []string{"VNC.example.test."}, CacheDir: t.TempDir()},
+		TLSConfig: &tls.Config{MinVersion: tls.VersionTLS13, NextProtos: []string{"http/1.1"}},
+		Logger:    &NoOpLogger{},
+	})
+	config, err := s.tlsConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.MinVersion != tls.VersionTLS13 {
+		t.Errorf("MinVersion = %x, want the TLS config's", config.MinVersion)
+	}
+	if want := []string{"http/1.1", acme.ALPNProto}; strings.Join(config.NextProtos, ",") != strings.Join(want, ",") {
+		t.Errorf("NextProtos = %q, want %q", config.NextProtos, want)
+	}
+
+	// Names not listed are refused before the CA is asked
+	for _, name := range []string{"other.example.test", ""} {
+		if _, err := config.GetCertificate(&tls.ClientHelloInfo{ServerName: name}); err == nil {
+			t.Errorf("GetCertificate(%q) succeeded, want an error", name)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package websockify
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tokenReloadInterval is how often TokenConfig checks its files for changes
+// unless its Interval is set.
+const tokenReloadInterval = 2 * time.Second
+
+// tokenWatcher is a TokenResolver that Serve keeps up to date while it runs.
+type tokenWatcher interface {
+	Watch(ctx context.Context, logger Logger)
+}
+
+// TokenConfig resolves tokens from a file, or every file of a directory,
+// held in memory. Files hold "token: host:port" lines as for TokenFile, or
+// a JSON object whose values are "host:port" or {"host", "port"}. Files in
+// a directory whose names start with a dot, such as editors' swap files,
+// are skipped. A Server using it checks the files for changes and reloads
+// them, keeping the previous tokens if they fail to parse.
+type TokenConfig struct {
+	Path string
+	// Interval is how often the files are checked for changes, every two
+	// seconds if zero.
+	Interval time.Duration
+
+	mu     sync.RWMutex
+	tokens map[string]string
+	stamp  string
+}
+
+// LoadTokenConfig reads the tokens in a file or directory.
+func LoadTokenConfig(path string) (*TokenConfig, error) {
+	t := &TokenConfig{Path: path}
+	if _, err := t.Reload(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Resolve returns the target of token as last loaded.
+func (t *TokenConfig) Resolve(token string) (string, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	target, ok := t.tokens[token]
+	if !ok {
+		return "", ErrUnknownToken
+	}
+	return target, nil
+}
+
+// Len returns how many tokens are loaded.
+func (t *TokenConfig) Len() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return len(t.tokens)
+}
+
+// Reload reads the files again if any was added, removed or modified since
+// they were last loaded, and reports whether they were. On error the
+// previous tokens are kept.
+func (t *TokenConfig) Reload() (bool, error) {
+	files, stamp, err := tokenConfigFiles(t.Path)
+	if err != nil {
+		return false, err
+	}
+	t.mu.RLock()
+	same := t.tokens != nil && stamp == t.stamp
+	t.mu.RUnlock()
+	if same {
+		return false, nil
+	}
+
+	tokens := make(map[string]string)
+	for _, name := range files {
+		if err := parseTokenConfig(name, tokens); err != nil {
+			return false, err
+		}
+	}
+	t.mu.Lock()
+	t.tokens = tokens
+	t.stamp = stamp
+	t.mu.Unlock()
+	return true, nil
+}
+
+// Watch reloads the tokens whenever their files change, until ctx is done,
+// logging each reload and failure.
+func (t *TokenConfig) Watch(ctx context.Context, logger Logger) {
+	interval := t.Interval
+	if interval <= 0 {
+		interval = tokenReloadInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var failed string
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		changed, err := t.Reload()
+		switch {
+		case err != nil:
+			// Log a failure once, not on every check until it is fixed
+			if err.Error() != failed {
+				logger.Printf("Keeping the previous tokens: %v", err)
+				failed = err.Error()
+			}
+		case changed:
+			logger.Printf("Reloaded %d tokens from %s", t.Len(), t.Path)
+			failed = ""
+		}
+	}
+}
+
+// tokenConfigFiles returns the token files in path, and a stamp of their
+// names, sizes and modification times that changes when any of them does.
+func tokenConfigFiles(path string) ([]string, string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read tokens: %v", err)
+	}
+	if !info.IsDir() {
+		return []string{path}, fmt.Sprintf("%d %d", info.Size(), info.ModTime().UnixNano()), nil
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read tokens: %v", err)
+	}
+	var files []string
+	var stamp strings.Builder
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read tokens: %v", err)
+		}
+		files = append(files, filepath.Join(path, entry.Name()))
+		fmt.Fprintf(&stamp, "%s %d %d\n", entry.Name(), info.Size(), info.ModTime().UnixNano())
+	}
+	return files, stamp.String(), nil
+}
+
+// parseTokenConfig adds the tokens in a file to tokens. As with TokenFile,
+// the first target given for a token wins.
+func parseTokenConfig(name string, tokens map[string]string) error {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return fmt.Errorf("failed to read tokens: %v", err)
+	}
+
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		var values map[string]json.RawMessage
+		if err := json.Unmarshal(data, &values); err != nil {
+			return fmt.Errorf("invalid tokens in %s: %v", name, err)
+		}
+		for token, value := range values {
+			// Values are strings of host:port, or objects
+			var raw string
+			if err := json.Unmarshal(value, &raw); err != nil {
+				raw = string(value)
+			}
+			target, err := parseTokenTarget(raw)
+			if err != nil {
+				return fmt.Errorf("invalid token %q in %s: %v", token, name, err)
+			}
+			if _, ok := tokens[token]; !ok {
+				tokens[token] = target
+			}
+		}
+		return nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		token, target, ok := strings.Cut(line, ":")
+		token, target = strings.TrimSpace(token), strings.TrimSpace(target)
+		if _, _, err := net.SplitHostPort(target); !ok || token == "" || err != nil {
+			return fmt.Errorf("%s:%d: want token: host:port", name, n)
+		}
+		if _, ok := tokens[token]; !ok {
+			tokens[token] = target
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read tokens from %s: %v", name, err)
+	}
+	return nil
+}
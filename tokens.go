@@ -0,0 +1,312 @@
+package websockify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TokenResolver maps the token a client connects with to the host:port of
+// the target to proxy it to, as python-websockify's token plugins do.
+type TokenResolver interface {
+	Resolve(token string) (string, error)
+}
+
+// ErrUnknownToken is returned by resolvers for a token they have no target for.
+var ErrUnknownToken = errors.New("unknown token")
+
+// tokenTimeout bounds how long a TokenRedis or TokenExec lookup may take.
+const tokenTimeout = 5 * time.Second
+
+// NewTokenResolver returns the resolver for a token plugin and its source:
+//
+//   - "file": a file of "token: host:port" lines, read again for every lookup
+//   - "directory": every file in a directory, in the same format
+//   - "redis": a Redis server as "host[:port[:db[:password[:namespace]]]]",
+//     whose keys are tokens and values "host:port" or JSON {"host", "port"}
+//   - "exec": a command run with the token as its last argument, which
+//     prints host:port
+//   - "config": a file or directory of "token: host:port" lines or JSON,
+//     held in memory and reloaded when it changes (see TokenConfig)
+//
+// python-websockify's plugin names TokenFile, ReadOnlyTokenFile and
+// TokenRedis are accepted too, so existing command lines keep working.
+func NewTokenResolver(plugin, source string) (TokenResolver, error) {
+	if source == "" {
+		return nil, fmt.Errorf("token plugin %s needs a source", plugin)
+	}
+	switch strings.ToLower(plugin) {
+	case "file", "tokenfile", "readonlytokenfile":
+		return &TokenFile{Path: source}, nil
+	case "directory":
+		info, err := os.Stat(source)
+		if err != nil {
+			return nil, fmt.Errorf("token directory: %v", err)
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("token directory: %s is not a directory", source)
+		}
+		return &TokenFile{Path: source}, nil
+	case "config":
+		return LoadTokenConfig(source)
+	case "redis", "tokenredis":
+		return ParseTokenRedis(source)
+	case "exec":
+		args := strings.Fields(source)
+		if len(args) == 0 {
+			return nil, fmt.Errorf("token plugin %s needs a command", plugin)
+		}
+		return &TokenExec{Command: args[0], Args: args[1:]}, nil
+	}
+	return nil, fmt.Errorf("unknown token plugin %q (want file, directory, config, redis or exec)", plugin)
+}
+
+// TokenFile resolves tokens from "token: host:port" lines in a file, or in
+// every file of a directory. Blank lines and lines starting with # are
+// skipped. The files are read for every lookup, so they can be edited while
+// the server runs.
+type TokenFile struct {
+	Path string
+}
+
+// Resolve returns the target of token in the file or directory.
+func (t *TokenFile) Resolve(token string) (string, error) {
+	files := []string{t.Path}
+	if info, err := os.Stat(t.Path); err != nil {
+		return "", fmt.Errorf("failed to read tokens: %v", err)
+	} else if info.IsDir() {
+		entries, err := os.ReadDir(t.Path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read tokens: %v", err)
+		}
+		files = files[:0]
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				files = append(files, filepath.Join(t.Path, entry.Name()))
+			}
+		}
+	}
+
+	for _, name := range files {
+		target, err := lookupTokenFile(name, token)
+		if err != nil {
+			return "", err
+		}
+		if target != "" {
+			return target, nil
+		}
+	}
+	return "", ErrUnknownToken
+}
+
+// lookupTokenFile returns the target of token in one file, or "" if it has none.
+func lookupTokenFile(name, token string) (string, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return "", fmt.Errorf("failed to read tokens: %v", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		tok, target, ok := strings.Cut(line, ":")
+		if ok && strings.TrimSpace(tok) == token {
+			return strings.TrimSpace(target), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("failed to read tokens from %s: %v", name, err)
+	}
+	return "", nil
+}
+
+// TokenRedis resolves tokens with GET on a Redis server. Values are either
+// "host:port" or JSON such as {"host": "10.0.0.5", "port": "5900"}.
+type TokenRedis struct {
+	Addr      string // host:port of the Redis server
+	DB        int
+	Password  string
+	Namespace string // Prefixed to tokens to make keys
+}
+
+// ParseTokenRedis parses python-websockify's redis source,
+// "host[:port[:db[:password[:namespace]]]]", where empty fields take their
+// defaults.
+func ParseTokenRedis(source string) (*TokenRedis, error) {
+	fields := strings.SplitN(source, ":", 5)
+	for len(fields) < 5 {
+		fields = append(fields, "")
+	}
+	host, port := fields[0], fields[1]
+	if host == "" {
+		host = "localhost"
+	}
+	if port == "" {
+		port = "6379"
+	}
+	t := &TokenRedis{Addr: net.JoinHostPort(host, port), Password: fields[3], Namespace: fields[4]}
+	if fields[2] != "" {
+		db, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("invalid redis database %q", fields[2])
+		}
+		t.DB = db
+	}
+	return t, nil
+}
+
+// Resolve looks token up on the Redis server, over a new connection.
+func (t *TokenRedis) Resolve(token string) (string, error) {
+	conn, err := net.DialTimeout("tcp", t.Addr, tokenTimeout)
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to redis: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(tokenTimeout))
+	r := bufio.NewReader(conn)
+
+	if t.Password != "" {
+		if _, err := redisCommand(conn, r, "AUTH", t.Password); err != nil {
+			return "", err
+		}
+	}
+	if t.DB != 0 {
+		if _, err := redisCommand(conn, r, "SELECT", strconv.Itoa(t.DB)); err != nil {
+			return "", err
+		}
+	}
+	value, err := redisCommand(conn, r, "GET", t.Namespace+token)
+	if err != nil {
+		return "", err
+	}
+	if value == nil {
+		return "", ErrUnknownToken
+	}
+	return parseTokenTarget(*value)
+}
+
+// redisCommand sends a command and reads its reply, which is nil for a
+// missing key.
+func redisCommand(w io.Writer, r *bufio.Reader, args ...string) (*string, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return nil, fmt.Errorf("failed to send redis %s: %v", args[0], err)
+	}
+
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("failed to read redis %s reply: %v", args[0], err)
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return nil, fmt.Errorf("empty redis %s reply", args[0])
+	}
+	switch line[0] {
+	case '+', ':':
+		value := line[1:]
+		return &value, nil
+	case '-':
+		return nil, fmt.Errorf("redis %s: %s", args[0], line[1:])
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid redis %s reply %q", args[0], line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, fmt.Errorf("failed to read redis %s reply: %v", args[0], err)
+		}
+		value := string(data[:n])
+		return &value, nil
+	}
+	return nil, fmt.Errorf("unexpected redis %s reply %q", args[0], line)
+}
+
+// parseTokenTarget returns the host:port of a token's value in redis or a
+// TokenConfig file, either host:port itself or JSON {"host", "port"}.
+func parseTokenTarget(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if !strings.HasPrefix(value, "{") {
+		return value, nil
+	}
+	var target struct {
+		Host string      `json:"host"`
+		Port json.Number `json:"port"`
+	}
+	if err := json.Unmarshal([]byte(value), &target); err != nil {
+		return "", fmt.Errorf("invalid token value: %v", err)
+	}
+	if target.Host == "" || target.Port == "" {
+		return "", fmt.Errorf("token value %s needs a host and port", value)
+	}
+	return net.JoinHostPort(target.Host, target.Port.String()), nil
+}
+
+// TokenExec resolves tokens by running a command with the token as its last
+// argument. The command prints the target's host:port on the first line of
+// its output, or exits with a non-zero status for an unknown token. Tokens
+// starting with "-" are unknown without running the command, so a client
+// cannot pass it an option.
+type TokenExec struct {
+	Command string
+	Args    []string
+}
+
+// Resolve runs the command for token.
+func (t *TokenExec) Resolve(token string) (string, error) {
+	if strings.HasPrefix(token, "-") {
+		return "", ErrUnknownToken
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), tokenTimeout)
+	defer cancel()
+
+	args := append(append([]string(nil), t.Args...), token)
+	out, err := exec.CommandContext(ctx, t.Command, args...).Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && ctx.Err() == nil {
+		return "", ErrUnknownToken
+	}
+	if err != nil {
+		return "", fmt.Errorf("token command failed: %v", err)
+	}
+	target, _, _ := strings.Cut(string(out), "\n")
+	target = strings.TrimSpace(target)
+	if target == "" {
+		return "", ErrUnknownToken
+	}
+	return target, nil
+}
+
+// requestToken returns the token a client connects with, from the token query
+// parameter or else the token cookie, as noVNC sends it.
+func requestToken(r *http.Request) string {
+	if token := r.URL.Query().Get("token"); token != "" {
+		return token
+	}
+	if cookie, err := r.Cookie("token"); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
@@ -0,0 +1,353 @@
+package websockify
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTokenFile(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("a.conf", "# Desktops\nalpha: 10.0.0.1:5900\n\nbeta:10.0.0.2:5901\n")
+	write("b.conf", "gamma: [::1]:5902\n")
+
+	tests := []struct {
+		path  string
+		token string
+		want  string
+		err   error
+	}{
+		{filepath.Join(dir, "a.conf"), "alpha", "10.0.0.1:5900", nil},
+		{filepath.Join(dir, "a.conf"), "beta", "10.0.0.2:5901", nil},
+		{filepath.Join(dir, "a.conf"), "gamma", "", ErrUnknownToken},
+		{dir, "gamma", "[::1]:5902", nil},
+		{dir, "alpha", "10.0.0.1:5900", nil},
+		{dir, "# Desktops", "", ErrUnknownToken},
+	}
+	for _, tt := range tests {
+		got, err := (&TokenFile{Path: tt.path}).Resolve(tt.token)
+		if got != tt.want || !errors.Is(err, tt.err) {
+			t.Errorf("Resolve(%q) in %s = %q, %v, want %q, %v", tt.token, filepath.Base(tt.path), got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestNewTokenResolver(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "tokens")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		plugin, source string
+		wantErr        bool
+	}{
+		{"file", file, false},
+		{"TokenFile", file, false},
+		{"ReadOnlyTokenFile", file, false},
+		{"directory", dir, false},
+		{"directory", file, true},
+		{"redis", "localhost:6379", false},
+		{"TokenRedis", "localhost", false},
+		{"exec", "lookup-target --json", false},
+		{"exec", "   ", true},
+		{"config", file, false},
+		{"config", filepath.Join(dir, "missing"), true},
+		{"file", "", true},
+		{"ldap", "localhost", true},
+	}
+	for _, tt := range tests {
+		_, err := NewTokenResolver(tt.plugin, tt.source)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NewTokenResolver(%q, %q) error = %v, want error %v", tt.plugin, tt.source, err, tt.wantErr)
+		}
+	}
+}
+
+func TestParseTokenRedis(t *testing.T) {
+	tests := []struct {
+		source string
+		want   TokenRedis
+	}{
+		{"localhost", TokenRedis{Addr: "localhost:6379"}},
+		{"redis.internal:6380", TokenRedis{Addr: "redis.internal:6380"}},
+		{"localhost:6379:2:secret:websockify:", TokenRedis{Addr: "localhost:6379", DB: 2, Password: "secret", Namespace: "websockify:"}},
+		{":::secret", TokenRedis{Addr: "localhost:6379", Password: "secret"}},
+	}
+	for _, tt := range tests {
+		got, err := ParseTokenRedis(tt.source)
+		if err != nil || *got != tt.want {
+			t.Errorf("ParseTokenRedis(%q) = %+v, %v, want %+v", tt.source, got, err, tt.want)
+		}
+	}
+	if _, err := ParseTokenRedis("localhost:6379:zero"); err == nil {
+		t.Errorf("ParseTokenRedis() with a bad database succeeded, want error")
+	}
+}
+
+// fakeRedis serves GET from values, and checks AUTH against password
+func fakeRedis(t *testing.T, password string, values map[string]string) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					var args []string
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+					for range n {
+						r.ReadString('\n') // Length
+						arg, _ := r.ReadString('\n')
+						args = append(args, strings.TrimSpace(arg))
+					}
+					switch {
+					case args[0] == "AUTH" && args[1] == password:
+						conn.Write([]byte("+OK\r\n"))
+					case args[0] == "AUTH":
+						conn.Write([]byte("-WRONGPASS invalid password\r\n"))
+					case args[0] == "GET":
+						if value, ok := values[args[1]]; ok {
+							conn.Write([]byte("$" + strconv.Itoa(len(value)) + "\r\n" + value + "\r\n"))
+						} else {
+							conn.Write([]byte("$-1\r\n"))
+						}
+					default:
+						conn.Write([]byte("+OK\r\n"))
+					}
+				}
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestTokenRedis(t *testing.T) {
+	addr := fakeRedis(t, "secret", map[string]string{
+		"vnc/plain": "10.0.0.1:5900",
+		"vnc/json":  `{"host": "10.0.0.2", "port": "5901"}`,
+		"vnc/num":   `{"host": "10.0.0.3", "port": 5902}`,
+		"vnc/bad":   `{"host": "10.0.0.4"}`,
+	})
+	resolver := &TokenRedis{Addr: addr, Password: "secret", Namespace: "vnc/"}
+
+	tests := []struct {
+		token   string
+		want    string
+		wantErr bool
+	}{
+		{"plain", "10.0.0.1:5900", false},
+		{"json", "10.0.0.2:5901", false},
+		{"num", "10.0.0.3:5902", false},
+		{"bad", "", true},
+		{"missing", "", true},
+	}
+	for _, tt := range tests {
+		got, err := resolver.Resolve(tt.token)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("Resolve(%q) = %q, %v, want %q (error %v)", tt.token, got, err, tt.want, tt.wantErr)
+		}
+	}
+	if _, err := resolver.Resolve("missing"); !errors.Is(err, ErrUnknownToken) {
+		t.Errorf("Resolve(missing) error = %v, want ErrUnknownToken", err)
+	}
+
+	resolver.Password = "wrong"
+	if _, err := resolver.Resolve("plain"); err == nil || !strings.Contains(err.Error(), "WRONGPASS") {
+		t.Errorf("Resolve() with the wrong password error = %v, want WRONGPASS", err)
+	}
+}
+
+func TestTokenExec(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "lookup")
+	content := "#!/bin/sh\n[ \"$2\" = desk ] || exit 1\necho \"$1:5900\"\necho ignored\n"
+	if err := os.WriteFile(script, []byte(content), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	resolver := &TokenExec{Command: script, Args: []string{"10.0.0.9"}}
+
+	if got, err := resolver.Resolve("desk"); got != "10.0.0.9:5900" || err != nil {
+		t.Errorf("Resolve(desk) = %q, %v, want 10.0.0.9:5900", got, err)
+	}
+	if _, err := resolver.Resolve("other"); !errors.Is(err, ErrUnknownToken) {
+		t.Errorf("Resolve(other) error = %v, want ErrUnknownToken", err)
+	}
+
+	// A token must not become an option of the command, though this one
+	// would resolve any argument it is given
+	options := &TokenExec{Command: "sh", Args: []string{"-c", `echo "$0:5900"`}}
+	for _, token := range []string{"-e", "--config=/etc/x", "-"} {
+		if got, err := options.Resolve(token); !errors.Is(err, ErrUnknownToken) {
+			t.Errorf("Resolve(%q) = %q, %v, want ErrUnknownToken", token, got, err)
+		}
+	}
+}
+
+func TestRequestToken(t *testing.T) {
+	r := httptest.NewRequest("GET", "/websockify?token=query", nil)
+	r.Header.Set("Cookie", "token=cookie")
+	if got := requestToken(r); got != "query" {
+		t.Errorf("requestToken() = %q, want the query parameter", got)
+	}
+	r = httptest.NewRequest("GET", "/websockify", nil)
+	r.Header.Set("Cookie", "token=cookie")
+	if got := requestToken(r); got != "cookie" {
+		t.Errorf("requestToken() = %q, want the cookie", got)
+	}
+}
+
+func TestTokenConfig(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("a.conf", "# Desktops\nalpha: 10.0.0.1:5900\nbeta: 10.0.0.2:5901\n")
+	write("b.json", `{"gamma": "[::1]:5902", "delta": {"host": "10.0.0.4", "port": 5903}, "alpha": "10.9.9.9:1"}`)
+	write(".a.conf.swp", "not tokens")
+
+	config, err := LoadTokenConfig(dir)
+	if err != nil {
+		t.Fatalf("LoadTokenConfig() = %v", err)
+	}
+	tests := []struct {
+		token string
+		want  string
+		err   error
+	}{
+		{"alpha", "10.0.0.1:5900", nil},
+		{"beta", "10.0.0.2:5901", nil},
+		{"gamma", "[::1]:5902", nil},
+		{"delta", "10.0.0.4:5903", nil},
+		{"epsilon", "", ErrUnknownToken},
+	}
+	for _, tt := range tests {
+		got, err := config.Resolve(tt.token)
+		if got != tt.want || !errors.Is(err, tt.err) {
+			t.Errorf("Resolve(%q) = %q, %v, want %q, %v", tt.token, got, err, tt.want, tt.err)
+		}
+	}
+
+	for name, content := range map[string]string{
+		"bad.conf": "alpha 10.0.0.1:5900\n",
+		"bad.json": `{"alpha": {"host": "10.0.0.1"}}`,
+		"cut.json": `{"alpha": "10.0.0.1:5900"`,
+	} {
+		path := filepath.Join(t.TempDir(), name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadTokenConfig(path); err == nil {
+			t.Errorf("LoadTokenConfig(%s) = nil, want an error", name)
+		}
+	}
+}
+
+// logRecorder collects log messages
+type logRecorder struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *logRecorder) Printf(format string, v ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
+
+func (l *logRecorder) Println(v ...interface{}) {
+	l.Printf("%s", fmt.Sprintln(v...))
+}
+
+func (l *logRecorder) contains(s string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, line := range l.lines {
+		if strings.Contains(line, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestTokenConfigWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens")
+	write := func(content string, age time.Duration) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		// Modification times may be too coarse to tell quick writes apart
+		when := time.Now().Add(age)
+		if err := os.Chtimes(path, when, when); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("alpha: 10.0.0.1:5900\n", -time.Hour)
+	config, err := LoadTokenConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Interval = 10 * time.Millisecond
+	logger := &logRecorder{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go config.Watch(ctx, logger)
+
+	waitFor := func(what string, done func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for !done() {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", what)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	write("alpha: 10.0.0.1:5900\nbeta: 10.0.0.2:5901\n", -time.Minute)
+	waitFor("the new token", func() bool {
+		target, _ := config.Resolve("beta")
+		return target == "10.0.0.2:5901"
+	})
+	waitFor("the reload to be logged", func() bool { return logger.contains("Reloaded 2 tokens") })
+
+	// A broken edit keeps the tokens loaded before it
+	write("alpha 10.0.0.1:5900\n", 0)
+	waitFor("the failure to be logged", func() bool { return logger.contains("Keeping the previous tokens") })
+	if target, err := config.Resolve("beta"); err != nil || target != "10.0.0.2:5901" {
+		t.Errorf("Resolve(beta) after a broken edit = %q, %v, want the previous target", target, err)
+	}
+}
@@ -0,0 +1,35 @@
+package version
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+)
+
+// info is the build information served by Handler
+type info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	Date      string `json:"date"`
+	GoVersion string `json:"go_version"`
+}
+
+// Handler returns an HTTP handler that reports the build as JSON, for
+// mounting on admin endpoints such as /version.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(info{
+			Version:   Version(),
+			Commit:    Commit(),
+			Date:      Date(),
+			GoVersion: runtime.Version(),
+		})
+	})
+}
+
+// UserAgent returns the User-Agent header value for outbound requests,
+// e.g. "websockify/v1.2.3 (go1.24.0; linux/amd64)".
+func UserAgent() string {
+	return "websockify/" + Version() + " (" + runtime.Version() + "; " + runtime.GOOS + "/" + runtime.GOARCH + ")"
+}
@@ -0,0 +1,58 @@
+package version
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+)
+
+// setBuild sets the values injected with ldflags for the length of a test
+func setBuild(t *testing.T, newTag, newCommit, newDate string) {
+	oldTag, oldCommit, oldDate := tag, commit, date
+	tag, commit, date = newTag, newCommit, newDate
+	t.Cleanup(func() { tag, commit, date = oldTag, oldCommit, oldDate })
+}
+
+func TestHandler(t *testing.T) {
+	setBuild(t, "1.2.3", "0123456789abcdef", "2024-05-01T10:00:00Z")
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/version", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("Status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want %q", got, "application/json")
+	}
+
+	var got map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("Body %q is not JSON: %v", rec.Body.String(), err)
+	}
+	want := map[string]string{
+		"version":    "v1.2.3",
+		"commit":     "0123456789abcdef",
+		"date":       "2024-05-01T10:00:00Z",
+		"go_version": runtime.Version(),
+	}
+	if len(got) != len(want) {
+		t.Errorf("Body = %v, want %v", got, want)
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("%s = %q, want %q", key, got[key], value)
+		}
+	}
+}
+
+func TestUserAgent(t *testing.T) {
+	setBuild(t, "v1.2.3", "", "")
+
+	want := "websockify/v1.2.3 (" + runtime.Version() + "; " + runtime.GOOS + "/" + runtime.GOARCH + ")"
+	if got := UserAgent(); got != want {
+		t.Errorf("UserAgent() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,28 @@
+package viewer
+
+import "time"
+
+// clipboardPollInterval is how often the viewer window checks the host
+// clipboard for text copied in other applications
+const clipboardPollInterval = 500 * time.Millisecond
+
+// clipboardState tracks the host clipboard text last seen, so that only
+// changes are sent to the server and text from the server is not echoed back
+type clipboardState struct {
+	last string
+}
+
+// changed reports whether text read from the host clipboard is new. Empty
+// text is never new, so the server's clipboard is not cleared.
+func (c *clipboardState) changed(text string) bool {
+	if text == "" || text == c.last {
+		return false
+	}
+	c.last = text
+	return true
+}
+
+// set records text the viewer put on the host clipboard
+func (c *clipboardState) set(text string) {
+	c.last = text
+}
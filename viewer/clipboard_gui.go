@@ -0,0 +1,54 @@
+//go:build gui
+
+package viewer
+
+import "time"
+
+// SetClipboard puts text on the host clipboard, where checkClipboard will
+// not send it back
+func (v *FramebufferViewer) SetClipboard(text string) {
+	if v.window == nil {
+		return
+	}
+	v.mutex.Lock()
+	v.clipboard.set(text)
+	v.mutex.Unlock()
+	v.window.Clipboard().SetContent(text)
+}
+
+// checkClipboard passes text newly copied to the host clipboard to Events and
+// Input.Clipboard. It runs when the mouse enters the window, as it does
+// when switching back from another application, and every
+// clipboardPollInterval.
+func (v *FramebufferViewer) checkClipboard() {
+	if v.window == nil {
+		return
+	}
+	text := v.window.Clipboard().Content()
+	v.mutex.Lock()
+	changed := v.clipboard.changed(text)
+	input := v.input
+	v.mutex.Unlock()
+	if !changed {
+		return
+	}
+	sendEvent(v.events, Event{Type: EventClipboard, Text: text})
+	if input.Clipboard != nil {
+		input.Clipboard(text)
+	}
+}
+
+// pollClipboard runs checkClipboard every clipboardPollInterval until the
+// viewer stops
+func (v *FramebufferViewer) pollClipboard() {
+	ticker := time.NewTicker(clipboardPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			v.checkClipboard()
+		case <-v.done:
+			return
+		}
+	}
+}
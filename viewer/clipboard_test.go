@@ -0,0 +1,29 @@
+package viewer
+
+import "testing"
+
+func TestClipboardStateChanged(t *testing.T) {
+	var c clipboardState
+	steps := []struct {
+		read   string
+		server string // Set from the server before reading, if not empty
+		want   bool
+	}{
+		{read: "", want: false},
+		{read: "hello", want: true},
+		{read: "hello", want: false},
+		{read: "world", want: true},
+		{server: "remote", read: "remote", want: false},
+		{read: "hello", want: true},
+		{read: "", want: false},
+		{read: "hello", want: false},
+	}
+	for i, step := range steps {
+		if step.server != "" {
+			c.set(step.server)
+		}
+		if got := c.changed(step.read); got != step.want {
+			t.Errorf("step %d: changed(%q) = %v, want %v", i, step.read, got, step.want)
+		}
+	}
+}
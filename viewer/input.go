@@ -0,0 +1,82 @@
+package viewer
+
+import (
+	"strings"
+
+	"github.com/coder/websockify/rfb"
+)
+
+// Input receives the keyboard, mouse and clipboard input of the viewer
+// window, as callbacks run before Viewer.Events delivers the same input
+type Input struct {
+	Key       func(keysym uint32, down bool) // Called with X11 keysyms
+	Pointer   func(x, y int, buttons uint8)  // Called in framebuffer pixels with rfb.Button* bits
+	Clipboard func(text string)              // Called with new host clipboard text, as for ClientCutText
+}
+
+// namedKeys maps the names of keys that do not type a character, as Fyne
+// reports them, to their keysyms
+var namedKeys = map[string]uint32{
+	"BackSpace":    rfb.KeyBackSpace,
+	"Tab":          rfb.KeyTab,
+	"Return":       rfb.KeyReturn,
+	"KP_Enter":     rfb.KeyReturn,
+	"Escape":       rfb.KeyEscape,
+	"Home":         rfb.KeyHome,
+	"Left":         rfb.KeyLeft,
+	"Up":           rfb.KeyUp,
+	"Right":        rfb.KeyRight,
+	"Down":         rfb.KeyDown,
+	"Prior":        rfb.KeyPageUp,
+	"Next":         rfb.KeyPageDown,
+	"End":          rfb.KeyEnd,
+	"Insert":       rfb.KeyInsert,
+	"Delete":       rfb.KeyDelete,
+	"LeftShift":    rfb.KeyShiftL,
+	"RightShift":   rfb.KeyShiftR,
+	"LeftControl":  rfb.KeyControlL,
+	"RightControl": rfb.KeyControlR,
+	"LeftAlt":      rfb.KeyAltL,
+	"RightAlt":     rfb.KeyAltR,
+	"LeftSuper":    rfb.KeySuperL,
+	"RightSuper":   rfb.KeySuperR,
+}
+
+// keysymForName returns the keysym of a named key, or with withChars of a
+// letter or digit key too. Characters otherwise arrive as typed runes, which
+// account for the keyboard layout and shift state, but those are not typed
+// while Control or Alt is held.
+func keysymForName(name string, withChars bool) (uint32, bool) {
+	if key, ok := namedKeys[name]; ok {
+		return key, true
+	}
+	if n, ok := strings.CutPrefix(name, "F"); ok && len(n) > 0 {
+		var f uint32
+		for _, r := range n {
+			if r < '0' || r > '9' {
+				return 0, false
+			}
+			f = f*10 + uint32(r-'0')
+		}
+		if f >= 1 && f <= 12 {
+			return rfb.KeyF1 + f - 1, true
+		}
+		return 0, false
+	}
+	if withChars && len(name) == 1 {
+		if r := rune(name[0]); r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return rfb.RuneToKeysym(rune(strings.ToLower(name)[0])), true
+		}
+	}
+	return 0, false
+}
+
+// isModifier reports whether a keysym is Control or Alt, which stop Fyne
+// from reporting typed runes
+func isModifier(key uint32) bool {
+	switch key {
+	case rfb.KeyControlL, rfb.KeyControlR, rfb.KeyAltL, rfb.KeyAltR:
+		return true
+	}
+	return false
+}
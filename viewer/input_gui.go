@@ -0,0 +1,174 @@
+//go:build gui
+
+package viewer
+
+import (
+	"image"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/driver/desktop"
+	"fyne.io/fyne/v2/widget"
+
+	"github.com/coder/websockify/rfb"
+)
+
+// inputImage shows the framebuffer and passes mouse input over it to the
+// viewer's Events and Input in framebuffer pixels
+type inputImage struct {
+	widget.BaseWidget
+	image   *canvas.Image
+	viewer  *FramebufferViewer
+	buttons uint8 // rfb.Button* bits held
+}
+
+func newInputImage(img *canvas.Image, viewer *FramebufferViewer) *inputImage {
+	w := &inputImage{image: img, viewer: viewer}
+	w.ExtendBaseWidget(w)
+	return w
+}
+
+func (w *inputImage) CreateRenderer() fyne.WidgetRenderer {
+	return &imageRenderer{widget: w}
+}
+
+func (w *inputImage) MouseDown(ev *desktop.MouseEvent) {
+	w.buttons |= mouseButton(ev.Button)
+	w.pointer(ev.Position, w.buttons)
+}
+
+func (w *inputImage) MouseUp(ev *desktop.MouseEvent) {
+	w.buttons &^= mouseButton(ev.Button)
+	w.pointer(ev.Position, w.buttons)
+}
+
+func (w *inputImage) MouseIn(ev *desktop.MouseEvent) {
+	w.viewer.checkClipboard()
+	w.pointer(ev.Position, w.buttons)
+}
+
+func (w *inputImage) MouseMoved(ev *desktop.MouseEvent) {
+	w.pointer(ev.Position, w.buttons)
+}
+
+func (w *inputImage) MouseOut() {}
+
+func (w *inputImage) Dragged(ev *fyne.DragEvent) {
+	w.pointer(ev.Position, w.buttons)
+}
+
+func (w *inputImage) DragEnd() {}
+
+// Scrolled sends a press and release of the wheel button for the direction
+func (w *inputImage) Scrolled(ev *fyne.ScrollEvent) {
+	var button uint8
+	switch {
+	case ev.Scrolled.DY > 0:
+		button = rfb.ButtonWheelUp
+	case ev.Scrolled.DY < 0:
+		button = rfb.ButtonWheelDown
+	default:
+		return
+	}
+	w.pointer(ev.Position, w.buttons|button)
+	w.pointer(ev.Position, w.buttons)
+}
+
+// pointer passes a position over the widget to Events and Input.Pointer
+func (w *inputImage) pointer(pos fyne.Position, buttons uint8) {
+	input, _ := w.viewer.inputState()
+	view, size := w.displayView()
+	area := w.Size()
+	p, ok := view.ToFramebuffer(pos.X, pos.Y, area.Width, area.Height, size)
+	if !ok {
+		return
+	}
+	sendEvent(w.viewer.events, Event{Type: EventPointer, X: p.X, Y: p.Y, Buttons: buttons})
+	if input.Pointer != nil {
+		input.Pointer(p.X, p.Y, buttons)
+	}
+}
+
+// mouseButton returns the rfb.Button* bit of a Fyne mouse button
+func mouseButton(button desktop.MouseButton) uint8 {
+	switch button {
+	case desktop.MouseButtonPrimary:
+		return rfb.ButtonLeft
+	case desktop.MouseButtonSecondary:
+		return rfb.ButtonRight
+	case desktop.MouseButtonTertiary:
+		return rfb.ButtonMiddle
+	}
+	return 0
+}
+
+// SetInput sets where keyboard and mouse input in the window is sent
+func (v *FramebufferViewer) SetInput(input Input) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	v.input = input
+}
+
+// inputState returns the Input and the size of the framebuffer shown
+func (v *FramebufferViewer) inputState() (Input, image.Point) {
+	v.mutex.RLock()
+	defer v.mutex.RUnlock()
+	return v.input, v.frame.size()
+}
+
+// watchKeys passes the window's key presses and releases and typed
+// characters to Events and Input.Key
+func (v *FramebufferViewer) watchKeys(window fyne.Window) {
+	v.pressed = make(map[fyne.KeyName]uint32)
+	if dc, ok := window.Canvas().(desktop.Canvas); ok {
+		dc.SetOnKeyDown(func(ev *fyne.KeyEvent) { v.keyDown(ev.Name) })
+		dc.SetOnKeyUp(func(ev *fyne.KeyEvent) { v.keyUp(ev.Name) })
+	}
+	window.Canvas().SetOnTypedRune(v.typedRune)
+}
+
+func (v *FramebufferViewer) keyDown(name fyne.KeyName) {
+	key, ok := keysymForName(string(name), v.modifiers > 0)
+	if !ok {
+		return
+	}
+	if _, held := v.pressed[name]; !held {
+		v.pressed[name] = key
+		if isModifier(key) {
+			v.modifiers++
+		}
+	}
+	v.sendKey(key, true)
+}
+
+// keyUp releases a key sent by keyDown, even if the modifiers held have
+// changed since
+func (v *FramebufferViewer) keyUp(name fyne.KeyName) {
+	key, held := v.pressed[name]
+	if !held {
+		return
+	}
+	delete(v.pressed, name)
+	if isModifier(key) {
+		v.modifiers--
+	}
+	v.sendKey(key, false)
+}
+
+// typedRune sends a typed character as a press and release. While Control or
+// Alt is held keyDown sends the key itself.
+func (v *FramebufferViewer) typedRune(r rune) {
+	if v.modifiers > 0 {
+		return
+	}
+	key := rfb.RuneToKeysym(r)
+	v.sendKey(key, true)
+	v.sendKey(key, false)
+}
+
+func (v *FramebufferViewer) sendKey(key uint32, down bool) {
+	sendEvent(v.events, Event{Type: EventKey, Key: key, Down: down})
+	if input, _ := v.inputState(); input.Key != nil {
+		input.Key(key, down)
+	}
+}
@@ -0,0 +1,34 @@
+package viewer
+
+import (
+	"testing"
+
+	"github.com/coder/websockify/rfb"
+)
+
+func TestKeysymForName(t *testing.T) {
+	tests := []struct {
+		name      string
+		withChars bool
+		want      uint32
+		wantOK    bool
+	}{
+		{"Return", false, rfb.KeyReturn, true},
+		{"Prior", false, rfb.KeyPageUp, true},
+		{"LeftControl", false, rfb.KeyControlL, true},
+		{"F1", false, rfb.KeyF1, true},
+		{"F12", false, rfb.KeyF1 + 11, true},
+		{"F13", false, 0, false},
+		{"A", false, 0, false},
+		{"A", true, 'a', true},
+		{"F", true, 'f', true},
+		{"7", true, '7', true},
+		{"Space", true, 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := keysymForName(tt.name, tt.withChars)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("keysymForName(%q, %v) = 0x%x, %v, want 0x%x, %v", tt.name, tt.withChars, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
@@ -0,0 +1,9 @@
+package viewer
+
+// Manager opens viewers in windows of one GUI app, so a process can show
+// several framebuffers at once, such as each display of a server or a server
+// beside a client. RunWindows provides one.
+type Manager interface {
+	// NewViewer opens a window, which is shown until it or the app closes
+	NewViewer(title string, width, height int) Viewer
+}
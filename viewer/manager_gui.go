@@ -0,0 +1,35 @@
+//go:build gui
+
+package viewer
+
+import (
+	"log"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/app"
+)
+
+// appManager opens windows of one Fyne app
+type appManager struct {
+	app fyne.App
+}
+
+func (m appManager) NewViewer(title string, width, height int) Viewer {
+	return newWindowViewer(m.app, title, width, height)
+}
+
+// RunWindows runs the GUI on the calling goroutine, which must be the main
+// one on macOS, and calls fn on another to open windows. It returns when the
+// last window is closed.
+func RunWindows(fn func(Manager)) {
+	a := app.New()
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("Viewer panic: %v", r)
+			}
+		}()
+		fn(appManager{app: a})
+	}()
+	a.Run()
+}
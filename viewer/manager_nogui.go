@@ -0,0 +1,22 @@
+//go:build !gui
+
+package viewer
+
+import "log"
+
+// noopManager opens no-op viewers when GUI is disabled
+type noopManager struct{}
+
+func (noopManager) NewViewer(title string, width, height int) Viewer {
+	log.Printf("GUI viewer disabled (built without 'gui' tag). Title: %s, Size: %dx%d", title, width, height)
+	return &FramebufferViewer{
+		initialized: true,
+		running:     true,
+		events:      make(chan Event, eventBuffer),
+	}
+}
+
+// RunWindows calls fn with no-op viewers when GUI is disabled
+func RunWindows(fn func(Manager)) {
+	fn(noopManager{})
+}
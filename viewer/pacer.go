@@ -0,0 +1,99 @@
+package viewer
+
+import (
+	"image"
+	"sync"
+	"time"
+)
+
+// displayRefreshInterval is how often a window is redrawn at most. Fyne does
+// not report the display's refresh rate, so this assumes the usual 60Hz.
+const displayRefreshInterval = time.Second / 60
+
+// FrameStats counts the frames given to a viewer
+type FrameStats struct {
+	Received  uint64 // Frames passed to UpdateFramebuffer or UpdateRegion
+	Shown     uint64 // Times the window was drawn
+	Coalesced uint64 // Frames merged into a later one before the window was drawn
+}
+
+// framePacer hands the latest frame submitted to a render function, at most
+// once an interval. Frames arriving faster are coalesced, keeping only the
+// newest, so a burst never queues up stale frames, and nothing is rendered
+// while no frames arrive. A coalesced frame is not necessarily lost: region
+// updates all submit the same retained image, so each is drawn with the next.
+type framePacer struct {
+	interval time.Duration
+	wake     chan struct{}
+	done     <-chan struct{}
+
+	mutex   sync.Mutex
+	pending image.Image
+	stats   FrameStats
+}
+
+// newFramePacer returns a framePacer whose run returns once done is closed
+func newFramePacer(interval time.Duration, done <-chan struct{}) *framePacer {
+	return &framePacer{
+		interval: interval,
+		wake:     make(chan struct{}, 1),
+		done:     done,
+	}
+}
+
+// submit queues img to be rendered, replacing any frame not yet rendered
+func (p *framePacer) submit(img image.Image) {
+	p.mutex.Lock()
+	p.stats.Received++
+	if p.pending != nil {
+		p.stats.Coalesced++
+	}
+	p.pending = img
+	p.mutex.Unlock()
+
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run renders submitted frames until done is closed
+func (p *framePacer) run(render func(img image.Image)) {
+	var last time.Time
+	for {
+		select {
+		case <-p.wake:
+		case <-p.done:
+			return
+		}
+		if wait := p.interval - time.Since(last); wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-p.done:
+				timer.Stop()
+				return
+			}
+		}
+
+		p.mutex.Lock()
+		img := p.pending
+		p.pending = nil
+		if img != nil {
+			p.stats.Shown++
+		}
+		p.mutex.Unlock()
+		if img == nil {
+			continue
+		}
+		render(img)
+		last = time.Now()
+	}
+}
+
+// frameStats returns the frames counted so far
+func (p *framePacer) frameStats() FrameStats {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.stats
+}
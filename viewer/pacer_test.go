@@ -0,0 +1,61 @@
+package viewer
+
+import (
+	"image"
+	"testing"
+	"time"
+)
+
+func TestFramePacerCoalesces(t *testing.T) {
+	done := make(chan struct{})
+	p := newFramePacer(time.Millisecond, done)
+	frames := []image.Image{
+		image.NewRGBA(image.Rect(0, 0, 1, 1)),
+		image.NewRGBA(image.Rect(0, 0, 2, 2)),
+		image.NewRGBA(image.Rect(0, 0, 3, 3)),
+	}
+	for _, img := range frames {
+		p.submit(img)
+	}
+
+	rendered := make(chan image.Image, len(frames))
+	go p.run(func(img image.Image) { rendered <- img })
+	defer close(done)
+
+	select {
+	case img := <-rendered:
+		if img != frames[2] {
+			t.Errorf("rendered %v, want the last frame submitted", img.Bounds())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no frame rendered")
+	}
+	select {
+	case img := <-rendered:
+		t.Errorf("rendered %v as well, want only the last frame", img.Bounds())
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	want := FrameStats{Received: 3, Shown: 1, Coalesced: 2}
+	if got := p.frameStats(); got != want {
+		t.Errorf("frameStats() = %+v, want %+v", got, want)
+	}
+}
+
+func TestFramePacerPaces(t *testing.T) {
+	const interval = 30 * time.Millisecond
+	done := make(chan struct{})
+	p := newFramePacer(interval, done)
+	rendered := make(chan time.Time, 2)
+	go p.run(func(image.Image) { rendered <- time.Now() })
+	defer close(done)
+
+	img := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	p.submit(img)
+	first := <-rendered
+	p.submit(img)
+	second := <-rendered
+	if gap := second.Sub(first); gap < interval {
+		t.Errorf("frames rendered %v apart, want at least %v", gap, interval)
+	}
+}
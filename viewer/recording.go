@@ -0,0 +1,212 @@
+package viewer
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/png"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// RecordingIndex is the file a RecordingViewer lists its frames in
+	RecordingIndex = "frames.ffconcat"
+	// DefaultRecordingInterval saves up to ten frames a second
+	DefaultRecordingInterval = 100 * time.Millisecond
+)
+
+// RecordingViewer implements Viewer by saving the frames it would show as
+// PNG files, so what a viewer would have shown can be kept where there is no
+// display. Frames are saved at most every interval, as frame-000001.png and
+// so on, and listed with how long each was shown in an ffconcat file that
+// ffmpeg can turn into a video:
+//
+//	ffmpeg -f concat -i frames.ffconcat -pix_fmt yuv420p view.mp4
+type RecordingViewer struct {
+	dir      string
+	interval time.Duration
+
+	mutex  sync.Mutex
+	frame  retainedFrame
+	dirty  bool
+	closed bool
+	events chan Event
+	done   chan struct{}
+	wg     sync.WaitGroup
+
+	// Used by the save loop, and Close once it has stopped
+	index    *bufio.Writer
+	file     *os.File
+	count    int
+	lastSave time.Time
+	failed   bool
+}
+
+// NewRecordingViewer returns a RecordingViewer saving frames to dir, which is
+// created if needed, at most every interval
+func NewRecordingViewer(dir string, interval time.Duration) (*RecordingViewer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	file, err := os.Create(filepath.Join(dir, RecordingIndex))
+	if err != nil {
+		return nil, err
+	}
+	v := &RecordingViewer{
+		dir:      dir,
+		interval: interval,
+		events:   make(chan Event, eventBuffer),
+		done:     make(chan struct{}),
+		file:     file,
+		index:    bufio.NewWriter(file),
+	}
+	v.index.WriteString("ffconcat version 1.0\n")
+	v.wg.Add(1)
+	go v.saveLoop()
+	return v, nil
+}
+
+// Init saves a blank frame of the size before the first. There is no title
+// to set.
+func (v *RecordingViewer) Init(title string, width, height int) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if v.frame.img == nil {
+		v.frame.set(image.NewRGBA(image.Rect(0, 0, width, height)))
+		v.dirty = true
+	}
+}
+
+func (v *RecordingViewer) UpdateFramebuffer(img image.Image) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	v.frame.set(img)
+	v.dirty = true
+}
+
+func (v *RecordingViewer) UpdateRegion(img image.Image, r image.Rectangle) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if !v.frame.update(img, r).Empty() {
+		v.dirty = true
+	}
+}
+
+func (v *RecordingViewer) SetTitle(title string) {}
+
+// SetView does nothing, as frames are saved at framebuffer size
+func (v *RecordingViewer) SetView(view View) {}
+
+// SetClipboard does nothing, as recordings only keep frames
+func (v *RecordingViewer) SetClipboard(text string) {}
+
+func (v *RecordingViewer) Screenshot() image.Image {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	return v.frame.snapshot()
+}
+
+// Close saves the last frame if it has not been, finishes the index and
+// sends EventClosed
+func (v *RecordingViewer) Close() {
+	v.mutex.Lock()
+	if v.closed {
+		v.mutex.Unlock()
+		return
+	}
+	v.closed = true
+	v.mutex.Unlock()
+
+	close(v.done)
+	v.wg.Wait()
+	v.save(time.Now())
+	if v.count > 0 {
+		// ffmpeg ignores the duration of the last file unless it is repeated
+		fmt.Fprintf(v.index, "duration %.3f\nfile '%s'\n", time.Since(v.lastSave).Seconds(), frameName(v.count))
+	}
+	if err := v.index.Flush(); err != nil {
+		log.Printf("Failed to write %s: %v", RecordingIndex, err)
+	}
+	v.file.Close()
+	sendEvent(v.events, Event{Type: EventClosed})
+}
+
+// Events returns a channel that only receives EventClosed from Close
+func (v *RecordingViewer) Events() <-chan Event {
+	return v.events
+}
+
+// Frames returns how many frames have been saved
+func (v *RecordingViewer) Frames() int {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	return v.count
+}
+
+func (v *RecordingViewer) saveLoop() {
+	defer v.wg.Done()
+	ticker := time.NewTicker(v.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			v.save(now)
+		case <-v.done:
+			return
+		}
+	}
+}
+
+// save saves the frame if it has changed since the last, and gives the last
+// its duration in the index. After an error nothing more is saved.
+func (v *RecordingViewer) save(now time.Time) {
+	if v.failed {
+		return
+	}
+	v.mutex.Lock()
+	if !v.dirty || v.frame.img == nil {
+		v.mutex.Unlock()
+		return
+	}
+	v.dirty = false
+	img := v.frame.snapshot()
+	v.mutex.Unlock()
+
+	name := frameName(v.count + 1)
+	if err := savePNG(filepath.Join(v.dir, name), img); err != nil {
+		log.Printf("Failed to save %s, stopping the recording: %v", name, err)
+		v.failed = true
+		return
+	}
+	if v.count > 0 {
+		fmt.Fprintf(v.index, "duration %.3f\n", now.Sub(v.lastSave).Seconds())
+	}
+	fmt.Fprintf(v.index, "# %s\nfile '%s'\n", now.Format(time.RFC3339Nano), name)
+
+	v.mutex.Lock()
+	v.count++
+	v.mutex.Unlock()
+	v.lastSave = now
+}
+
+func frameName(n int) string {
+	return fmt.Sprintf("frame-%06d.png", n)
+}
+
+func savePNG(name string, img image.Image) error {
+	file, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(file, img); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+var _ Viewer = (*RecordingViewer)(nil)
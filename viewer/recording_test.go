@@ -0,0 +1,72 @@
+package viewer
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecordingViewer(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "view")
+	v, err := NewRecordingViewer(dir, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("NewRecordingViewer() error = %v", err)
+	}
+
+	v.UpdateFramebuffer(filled(image.Rect(0, 0, 4, 4), color.RGBA{R: 255, A: 255}))
+	deadline := time.Now().Add(2 * time.Second)
+	for v.Frames() < 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("first frame not saved")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	region := image.Rect(0, 0, 2, 2)
+	v.UpdateRegion(filled(region, color.RGBA{B: 255, A: 255}), region)
+	v.Close()
+
+	if got := v.Frames(); got != 2 {
+		t.Errorf("Frames() = %d, want 2", got)
+	}
+	file, err := os.Open(filepath.Join(dir, "frame-000002.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	img, err := png.Decode(file)
+	if err != nil {
+		t.Fatalf("png.Decode() error = %v", err)
+	}
+	if _, _, b, _ := img.At(1, 1).RGBA(); b != 0xffff {
+		t.Errorf("second frame pixel in region blue = 0x%x, want 0xffff", b)
+	}
+
+	index, err := os.ReadFile(filepath.Join(dir, RecordingIndex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files, durations int
+	for _, line := range strings.Split(string(index), "\n") {
+		switch {
+		case strings.HasPrefix(line, "file "):
+			files++
+		case strings.HasPrefix(line, "duration "):
+			durations++
+		}
+	}
+	if !strings.HasPrefix(string(index), "ffconcat version 1.0\n") || !strings.Contains(string(index), "file 'frame-000001.png'") {
+		t.Errorf("index does not list the first frame:\n%s", index)
+	}
+	// The last file is listed again after its duration
+	if files != 3 || durations != 2 {
+		t.Errorf("index has %d files and %d durations, want 3 and 2:\n%s", files, durations, index)
+	}
+	if ev := <-v.Events(); ev.Type != EventClosed {
+		t.Errorf("event after Close() = %v, want closed", ev)
+	}
+}
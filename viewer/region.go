@@ -0,0 +1,66 @@
+package viewer
+
+import (
+	"image"
+	"image/draw"
+)
+
+// retainedFrame is the frame a viewer shows. UpdateRegion draws into it, so
+// after UpdateFramebuffer it copies the caller's image once before the first
+// region rather than drawing into an image the caller may still hold.
+type retainedFrame struct {
+	img   *image.RGBA
+	owned bool // img was allocated here rather than passed to set
+}
+
+// set shows img as the whole frame
+func (f *retainedFrame) set(img image.Image) {
+	if rgba, ok := img.(*image.RGBA); ok {
+		f.img, f.owned = rgba, false
+		return
+	}
+	f.img = image.NewRGBA(img.Bounds())
+	draw.Draw(f.img, f.img.Rect, img, img.Bounds().Min, draw.Src)
+	f.owned = true
+}
+
+// update copies r of src into the frame, growing it to cover r, and returns
+// the area drawn. src need only cover r, such as a rectangle's own pixels
+// with bounds r.
+func (f *retainedFrame) update(src image.Image, r image.Rectangle) image.Rectangle {
+	r = r.Intersect(src.Bounds())
+	if r.Empty() {
+		return r
+	}
+	if f.img == nil || !f.owned || !r.In(f.img.Rect) {
+		bounds := image.Rect(0, 0, r.Max.X, r.Max.Y)
+		if f.img != nil {
+			bounds = bounds.Union(f.img.Rect)
+		}
+		img := image.NewRGBA(bounds)
+		if f.img != nil {
+			draw.Draw(img, f.img.Rect, f.img, f.img.Rect.Min, draw.Src)
+		}
+		f.img, f.owned = img, true
+	}
+	draw.Draw(f.img, r, src, r.Min, draw.Src)
+	return r
+}
+
+// size returns the size of the frame, which is empty before the first
+func (f *retainedFrame) size() image.Point {
+	if f.img == nil {
+		return image.Point{}
+	}
+	return f.img.Rect.Size()
+}
+
+// snapshot returns a copy of the frame, or nil before the first
+func (f *retainedFrame) snapshot() image.Image {
+	if f.img == nil {
+		return nil
+	}
+	img := image.NewRGBA(f.img.Rect)
+	draw.Draw(img, img.Rect, f.img, f.img.Rect.Min, draw.Src)
+	return img
+}
@@ -0,0 +1,69 @@
+package viewer
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func filled(r image.Rectangle, c color.RGBA) *image.RGBA {
+	img := image.NewRGBA(r)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			img.SetRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestRetainedFrameUpdate(t *testing.T) {
+	red := color.RGBA{R: 255, A: 255}
+	blue := color.RGBA{B: 255, A: 255}
+
+	var f retainedFrame
+	full := filled(image.Rect(0, 0, 8, 6), red)
+	f.set(full)
+	if f.size() != image.Pt(8, 6) {
+		t.Fatalf("size() = %v, want (8,6)", f.size())
+	}
+
+	// A rectangle's own pixels, with bounds where it goes
+	region := image.Rect(2, 1, 4, 3)
+	if got := f.update(filled(region, blue), region); got != region {
+		t.Errorf("update() = %v, want %v", got, region)
+	}
+	if got := f.img.RGBAAt(3, 2); got != blue {
+		t.Errorf("pixel in region = %v, want %v", got, blue)
+	}
+	if got := f.img.RGBAAt(5, 2); got != red {
+		t.Errorf("pixel outside region = %v, want %v", got, red)
+	}
+	if got := full.RGBAAt(3, 2); got != red {
+		t.Errorf("image passed to set() was drawn into: %v", got)
+	}
+
+	// Regions clip to the source and grow the frame
+	if got := f.update(filled(image.Rect(6, 4, 10, 8), blue), image.Rect(6, 4, 12, 12)); got != image.Rect(6, 4, 10, 8) {
+		t.Errorf("update() past the source = %v, want %v", got, image.Rect(6, 4, 10, 8))
+	}
+	if f.size() != image.Pt(10, 8) {
+		t.Errorf("size() after growing = %v, want (10,8)", f.size())
+	}
+	if got := f.update(full, image.Rect(20, 20, 30, 30)); !got.Empty() {
+		t.Errorf("update() outside the source = %v, want empty", got)
+	}
+}
+
+func TestRetainedFrameSnapshot(t *testing.T) {
+	var f retainedFrame
+	if f.snapshot() != nil {
+		t.Error("snapshot() before a frame is not nil")
+	}
+	region := image.Rect(0, 0, 2, 2)
+	f.update(filled(region, color.RGBA{G: 255, A: 255}), region)
+	snap := f.snapshot().(*image.RGBA)
+	f.update(filled(region, color.RGBA{A: 255}), region)
+	if got := snap.RGBAAt(1, 1); got.G != 255 {
+		t.Errorf("snapshot() changed with the frame: %v", got)
+	}
+}
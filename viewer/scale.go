@@ -0,0 +1,176 @@
+package viewer
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"slices"
+)
+
+// ScaleMode is how a viewer sizes the framebuffer to its window
+type ScaleMode int
+
+const (
+	ScaleFit     ScaleMode = iota // Scaled to fit the window, keeping its aspect ratio
+	ScaleStretch                  // Stretched to fill the window
+	ScaleNative                   // Drawn at View.Zoom times its size, panned when larger than the window
+	ScaleInteger                  // Scaled by the largest whole number of display pixels that fits, for sharp pixels
+)
+
+var scaleModeNames = map[ScaleMode]string{
+	ScaleFit:     "fit",
+	ScaleStretch: "stretch",
+	ScaleNative:  "1:1",
+	ScaleInteger: "integer",
+}
+
+func (m ScaleMode) String() string {
+	if name, ok := scaleModeNames[m]; ok {
+		return name
+	}
+	return fmt.Sprintf("ScaleMode(%d)", int(m))
+}
+
+// ParseScaleMode returns the ScaleMode named fit, stretch, 1:1 or integer
+func ParseScaleMode(name string) (ScaleMode, error) {
+	for mode, n := range scaleModeNames {
+		if n == name {
+			return mode, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown scale mode %q, want fit, stretch, 1:1 or integer", name)
+}
+
+// zoomSteps are the zoom levels ZoomIn and ZoomOut step through
+var zoomSteps = []float32{0.25, 0.5, 0.75, 1, 1.5, 2, 3, 4}
+
+// View is how a viewer draws the framebuffer in its window. Its methods map
+// between positions in the window area and framebuffer pixels.
+//
+// Window areas are measured in the units the backend lays out in, which on a
+// HiDPI display are larger than its pixels. The backend passes the number of
+// display pixels per unit to OnDisplay, so ScaleInteger can scale by whole
+// display pixels and the framebuffer is placed on pixel boundaries rather than
+// drawn blurred across them.
+type View struct {
+	Mode ScaleMode
+	Zoom float32 // Scale of ScaleNative, where 0 means 1
+
+	// DevicePixels draws ScaleNative in display pixels rather than units, so
+	// 1:1 is one framebuffer pixel to each pixel of a HiDPI display rather
+	// than to a block of them
+	DevicePixels bool
+
+	deviceScale float32 // Display pixels per unit, where 0 means 1
+}
+
+// OnDisplay returns the view for a display with scale pixels per unit
+func (v View) OnDisplay(scale float32) View {
+	v.deviceScale = scale
+	return v
+}
+
+func (v View) pixelsPerUnit() float32 {
+	if v.deviceScale <= 0 {
+		return 1
+	}
+	return v.deviceScale
+}
+
+// nativeScale returns the units per framebuffer pixel of ScaleNative
+func (v View) nativeScale() float32 {
+	if v.DevicePixels {
+		return v.zoom() / v.pixelsPerUnit()
+	}
+	return v.zoom()
+}
+
+func (v View) zoom() float32 {
+	if v.Zoom <= 0 {
+		return 1
+	}
+	return v.Zoom
+}
+
+// ZoomIn returns the view at the next zoom level, drawn with ScaleNative
+func (v View) ZoomIn() View {
+	zoom := v.zoom()
+	i, _ := slices.BinarySearch(zoomSteps, zoom)
+	if i < len(zoomSteps) && zoomSteps[i] == zoom {
+		i++
+	}
+	v.Mode, v.Zoom = ScaleNative, zoomSteps[min(i, len(zoomSteps)-1)]
+	return v
+}
+
+// ZoomOut returns the view at the previous zoom level, drawn with
+// ScaleNative
+func (v View) ZoomOut() View {
+	i, _ := slices.BinarySearch(zoomSteps, v.zoom())
+	v.Mode, v.Zoom = ScaleNative, zoomSteps[max(i-1, 0)]
+	return v
+}
+
+// MinSize returns the area the view needs to show all of a size framebuffer,
+// which is only more than nothing for ScaleNative. A window smaller than
+// that pans over it.
+func (v View) MinSize(size image.Point) (width, height float32) {
+	if v.Mode != ScaleNative {
+		return 0, 0
+	}
+	return float32(size.X) * v.nativeScale(), float32(size.Y) * v.nativeScale()
+}
+
+// Layout returns where in an area a size framebuffer is drawn. It is centred
+// when smaller than the area, on a display pixel boundary.
+func (v View) Layout(areaWidth, areaHeight float32, size image.Point) (x, y, width, height float32, ok bool) {
+	if size.X <= 0 || size.Y <= 0 || areaWidth <= 0 || areaHeight <= 0 {
+		return 0, 0, 0, 0, false
+	}
+	fit := min(areaWidth/float32(size.X), areaHeight/float32(size.Y))
+	scaleX, scaleY := v.nativeScale(), v.nativeScale()
+	switch v.Mode {
+	case ScaleFit:
+		scaleX, scaleY = fit, fit
+	case ScaleStretch:
+		scaleX, scaleY = areaWidth/float32(size.X), areaHeight/float32(size.Y)
+	case ScaleInteger:
+		// A framebuffer too large to fit at one display pixel a pixel is
+		// scaled down to fit instead
+		scaleX = fit
+		if n := math.Floor(float64(fit*v.pixelsPerUnit()) + 1e-4); n >= 1 {
+			scaleX = float32(n) / v.pixelsPerUnit()
+		}
+		scaleY = scaleX
+	}
+	width, height = float32(size.X)*scaleX, float32(size.Y)*scaleY
+	return v.snap(max(0, (areaWidth-width)/2)), v.snap(max(0, (areaHeight-height)/2)), width, height, true
+}
+
+// snap rounds a position down to a display pixel boundary
+func (v View) snap(pos float32) float32 {
+	return float32(math.Floor(float64(pos*v.pixelsPerUnit()))) / v.pixelsPerUnit()
+}
+
+// ToFramebuffer maps a position in an area to the pixel of a size
+// framebuffer drawn there. Positions outside the framebuffer are moved to
+// its nearest edge.
+func (v View) ToFramebuffer(x, y, areaWidth, areaHeight float32, size image.Point) (image.Point, bool) {
+	left, top, width, height, ok := v.Layout(areaWidth, areaHeight, size)
+	if !ok {
+		return image.Point{}, false
+	}
+	px := int((x - left) * float32(size.X) / width)
+	py := int((y - top) * float32(size.Y) / height)
+	return image.Pt(max(0, min(px, size.X-1)), max(0, min(py, size.Y-1))), true
+}
+
+// FromFramebuffer maps a framebuffer pixel to the centre of where it is drawn
+// in an area
+func (v View) FromFramebuffer(p image.Point, areaWidth, areaHeight float32, size image.Point) (x, y float32, ok bool) {
+	left, top, width, height, ok := v.Layout(areaWidth, areaHeight, size)
+	if !ok {
+		return 0, 0, false
+	}
+	return left + (float32(p.X)+0.5)*width/float32(size.X), top + (float32(p.Y)+0.5)*height/float32(size.Y), true
+}
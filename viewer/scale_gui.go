@@ -0,0 +1,130 @@
+//go:build gui
+
+package viewer
+
+import (
+	"image"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+)
+
+// imageRenderer draws the framebuffer where the viewer's View places it in
+// the widget
+type imageRenderer struct {
+	widget *inputImage
+}
+
+func (r *imageRenderer) Layout(size fyne.Size) {
+	view, frame := r.widget.displayView()
+	x, y, width, height, ok := view.Layout(size.Width, size.Height, frame)
+	if !ok {
+		x, y, width, height = 0, 0, size.Width, size.Height
+	}
+	r.widget.image.Move(fyne.NewPos(x, y))
+	r.widget.image.Resize(fyne.NewSize(width, height))
+}
+
+func (r *imageRenderer) MinSize() fyne.Size {
+	view, frame := r.widget.displayView()
+	return fyne.NewSize(view.MinSize(frame))
+}
+
+func (r *imageRenderer) Refresh() {
+	r.Layout(r.widget.Size())
+	canvas.Refresh(r.widget.image)
+}
+
+func (r *imageRenderer) Objects() []fyne.CanvasObject {
+	return []fyne.CanvasObject{r.widget.image}
+}
+
+func (r *imageRenderer) Destroy() {}
+
+// displayView returns the viewer's View for the scale of the display the
+// widget is on, and the size of the framebuffer shown
+func (w *inputImage) displayView() (View, image.Point) {
+	view, size := w.viewer.viewState()
+	if c := fyne.CurrentApp().Driver().CanvasForObject(w); c != nil {
+		view = view.OnDisplay(c.Scale())
+	}
+	return view, size
+}
+
+// newDisplay returns the window content showing img, scrolled to pan over
+// the framebuffer when the view is larger than the window, which sends
+// EventResized as the window is resized
+func (v *FramebufferViewer) newDisplay(img *canvas.Image) fyne.CanvasObject {
+	img.FillMode = canvas.ImageFillStretch
+	img.ScaleMode = canvas.ImageScalePixels
+	v.display = newInputImage(img, v)
+	v.scroll = container.NewScroll(v.display)
+	return container.New(&resizeLayout{viewer: v}, v.scroll)
+}
+
+// SetView sets how the framebuffer is sized to the window
+func (v *FramebufferViewer) SetView(view View) {
+	v.mutex.Lock()
+	v.view = view
+	v.mutex.Unlock()
+	if v.devicePixelsItem != nil {
+		v.devicePixelsItem.Checked = view.DevicePixels
+		v.menu.Refresh()
+	}
+	v.refresh()
+}
+
+// viewState returns the View and the size of the framebuffer shown
+func (v *FramebufferViewer) viewState() (View, image.Point) {
+	v.mutex.RLock()
+	defer v.mutex.RUnlock()
+	return v.view, v.frame.size()
+}
+
+// refresh lays out and redraws the framebuffer, whose size or view may have
+// changed
+func (v *FramebufferViewer) refresh() {
+	if v.display == nil {
+		return
+	}
+	v.display.Refresh()
+	v.scroll.Refresh()
+}
+
+// viewMenu returns the menu that switches between scale modes, zooms and
+// saves screenshots
+func (v *FramebufferViewer) viewMenu() *fyne.Menu {
+	mode := func(mode ScaleMode) func() {
+		return func() {
+			view, _ := v.viewState()
+			v.SetView(View{Mode: mode, DevicePixels: view.DevicePixels})
+		}
+	}
+	zoom := func(next func(View) View) func() {
+		return func() {
+			view, _ := v.viewState()
+			v.SetView(next(view))
+		}
+	}
+	screenshot := fyne.NewMenuItem("Save Screenshot", v.saveScreenshot)
+	screenshot.Shortcut = screenshotShortcut
+	v.devicePixelsItem = fyne.NewMenuItem("Actual Size in Display Pixels", func() {
+		view, _ := v.viewState()
+		view.DevicePixels = !view.DevicePixels
+		v.SetView(view)
+	})
+	v.menu = fyne.NewMenu("View",
+		fyne.NewMenuItem("Fit to Window", mode(ScaleFit)),
+		fyne.NewMenuItem("Stretch to Window", mode(ScaleStretch)),
+		fyne.NewMenuItem("Actual Size", mode(ScaleNative)),
+		fyne.NewMenuItem("Whole Multiple to Fit", mode(ScaleInteger)),
+		v.devicePixelsItem,
+		fyne.NewMenuItemSeparator(),
+		fyne.NewMenuItem("Zoom In", zoom(View.ZoomIn)),
+		fyne.NewMenuItem("Zoom Out", zoom(View.ZoomOut)),
+		fyne.NewMenuItemSeparator(),
+		screenshot,
+	)
+	return v.menu
+}
@@ -0,0 +1,109 @@
+package viewer
+
+import (
+	"image"
+	"testing"
+)
+
+func TestParseScaleMode(t *testing.T) {
+	for _, mode := range []ScaleMode{ScaleFit, ScaleStretch, ScaleNative, ScaleInteger} {
+		got, err := ParseScaleMode(mode.String())
+		if err != nil || got != mode {
+			t.Errorf("ParseScaleMode(%q) = %v, %v, want %v", mode.String(), got, err, mode)
+		}
+	}
+	if _, err := ParseScaleMode("zoom"); err == nil {
+		t.Error("ParseScaleMode(\"zoom\") succeeded")
+	}
+}
+
+func TestViewToFramebuffer(t *testing.T) {
+	size := image.Pt(100, 50)
+	tests := []struct {
+		name                string
+		view                View
+		x, y, width, height float32
+		want                image.Point
+	}{
+		{"same size", View{}, 10, 20, 100, 50, image.Pt(10, 20)},
+		{"scaled up", View{}, 20, 40, 200, 100, image.Pt(10, 20)},
+		{"letterboxed", View{}, 50, 60, 100, 100, image.Pt(50, 35)},
+		{"outside", View{}, -5, 500, 100, 50, image.Pt(0, 49)},
+		{"stretched", View{Mode: ScaleStretch}, 50, 60, 100, 100, image.Pt(50, 30)},
+		{"native centred", View{Mode: ScaleNative}, 60, 45, 200, 100, image.Pt(10, 20)},
+		{"native panned", View{Mode: ScaleNative}, 10, 20, 40, 40, image.Pt(10, 20)},
+		{"zoomed", View{Mode: ScaleNative, Zoom: 2}, 21, 41, 100, 50, image.Pt(10, 20)},
+		{"device pixels", View{Mode: ScaleNative, DevicePixels: true}.OnDisplay(2), 5.25, 10.25, 50, 25, image.Pt(10, 20)},
+		{"integer", View{Mode: ScaleInteger}, 46, 51, 250, 120, image.Pt(10, 20)},
+		{"integer on HiDPI", View{Mode: ScaleInteger}.OnDisplay(2), 23, 25.5, 125, 60, image.Pt(10, 20)},
+		{"integer too large", View{Mode: ScaleInteger}, 5, 10, 50, 25, image.Pt(10, 20)},
+	}
+	for _, tt := range tests {
+		got, ok := tt.view.ToFramebuffer(tt.x, tt.y, tt.width, tt.height, size)
+		if !ok || got != tt.want {
+			t.Errorf("%s: ToFramebuffer() = %v, %v, want %v", tt.name, got, ok, tt.want)
+		}
+		x, y, ok := tt.view.FromFramebuffer(tt.want, tt.width, tt.height, size)
+		if back, _ := tt.view.ToFramebuffer(x, y, tt.width, tt.height, size); !ok || back != tt.want {
+			t.Errorf("%s: FromFramebuffer(%v) = %v, %v, which maps back to %v", tt.name, tt.want, x, y, back)
+		}
+	}
+	if _, ok := (View{}).ToFramebuffer(1, 1, 100, 100, image.Point{}); ok {
+		t.Error("ToFramebuffer() with an empty framebuffer succeeded")
+	}
+}
+
+func TestViewZoom(t *testing.T) {
+	tests := []struct {
+		name string
+		view View
+		want View
+	}{
+		{"in from fit", View{}.ZoomIn(), View{Mode: ScaleNative, Zoom: 1.5}},
+		{"out from fit", View{}.ZoomOut(), View{Mode: ScaleNative, Zoom: 0.75}},
+		{"in between steps", View{Zoom: 1.2}.ZoomIn(), View{Mode: ScaleNative, Zoom: 1.5}},
+		{"out between steps", View{Zoom: 1.2}.ZoomOut(), View{Mode: ScaleNative, Zoom: 1}},
+		{"in at most", View{Zoom: 4}.ZoomIn(), View{Mode: ScaleNative, Zoom: 4}},
+		{"out at least", View{Zoom: 0.25}.ZoomOut(), View{Mode: ScaleNative, Zoom: 0.25}},
+		{"keeps device pixels", View{DevicePixels: true}.ZoomIn(), View{Mode: ScaleNative, Zoom: 1.5, DevicePixels: true}},
+	}
+	for _, tt := range tests {
+		if tt.view != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, tt.view, tt.want)
+		}
+	}
+}
+
+func TestViewMinSize(t *testing.T) {
+	size := image.Pt(100, 50)
+	if w, h := (View{}).MinSize(size); w != 0 || h != 0 {
+		t.Errorf("fit MinSize() = %v, %v, want 0, 0", w, h)
+	}
+	if w, h := (View{Mode: ScaleNative, Zoom: 2}).MinSize(size); w != 200 || h != 100 {
+		t.Errorf("zoomed MinSize() = %v, %v, want 200, 100", w, h)
+	}
+	if w, h := (View{Mode: ScaleNative, DevicePixels: true}).OnDisplay(2).MinSize(size); w != 50 || h != 25 {
+		t.Errorf("device pixels MinSize() = %v, %v, want 50, 25", w, h)
+	}
+}
+
+func TestViewLayoutInteger(t *testing.T) {
+	size := image.Pt(100, 50)
+	tests := []struct {
+		name                  string
+		view                  View
+		areaWidth, areaHeight float32
+		x, y, width, height   float32
+	}{
+		{"two times", View{Mode: ScaleInteger}, 250, 120, 25, 10, 200, 100},
+		{"three display pixels", View{Mode: ScaleInteger}.OnDisplay(2), 150, 80, 0, 2.5, 150, 75},
+		{"snapped", View{Mode: ScaleInteger}.OnDisplay(2), 151, 80, 0.5, 2.5, 150, 75},
+		{"scaled down", View{Mode: ScaleInteger}, 50, 50, 0, 12, 50, 25},
+	}
+	for _, tt := range tests {
+		x, y, width, height, ok := tt.view.Layout(tt.areaWidth, tt.areaHeight, size)
+		if !ok || x != tt.x || y != tt.y || width != tt.width || height != tt.height {
+			t.Errorf("%s: Layout() = %v, %v, %v, %v, %v, want %v, %v, %v, %v", tt.name, x, y, width, height, ok, tt.x, tt.y, tt.width, tt.height)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package viewer
+
+import (
+	"fmt"
+	"image"
+	"path/filepath"
+	"time"
+)
+
+// SaveScreenshot writes a viewer's Screenshot to a PNG file in dir named for
+// the time, such as screenshot-20240102-150405.000.png, and returns its path
+func SaveScreenshot(v Viewer, dir string) (string, error) {
+	img := v.Screenshot()
+	if img == nil {
+		return "", fmt.Errorf("no frame shown yet")
+	}
+	return saveScreenshot(img, dir, time.Now())
+}
+
+func saveScreenshot(img image.Image, dir string, now time.Time) (string, error) {
+	name := filepath.Join(dir, "screenshot-"+now.Format("20060102-150405.000")+".png")
+	return name, savePNG(name, img)
+}
@@ -0,0 +1,41 @@
+//go:build gui
+
+package viewer
+
+import (
+	"image"
+	"log"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/driver/desktop"
+)
+
+// screenshotShortcut saves a screenshot: Ctrl+Shift+S, or Cmd+Shift+S on
+// macOS
+var screenshotShortcut = &desktop.CustomShortcut{
+	KeyName:  fyne.KeyS,
+	Modifier: fyne.KeyModifierShortcutDefault | fyne.KeyModifierShift,
+}
+
+func (v *FramebufferViewer) Screenshot() image.Image {
+	v.mutex.RLock()
+	defer v.mutex.RUnlock()
+	return v.frame.snapshot()
+}
+
+// saveScreenshot saves the frame shown to the working directory
+func (v *FramebufferViewer) saveScreenshot() {
+	name, err := SaveScreenshot(v, ".")
+	if err != nil {
+		log.Printf("Failed to save screenshot: %v", err)
+		return
+	}
+	log.Printf("Saved screenshot to %s", name)
+}
+
+// watchScreenshotKey saves a screenshot when screenshotShortcut is pressed
+func (v *FramebufferViewer) watchScreenshotKey(window fyne.Window) {
+	window.Canvas().AddShortcut(screenshotShortcut, func(fyne.Shortcut) {
+		v.saveScreenshot()
+	})
+}
@@ -0,0 +1,49 @@
+package viewer
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSaveScreenshot(t *testing.T) {
+	dir := t.TempDir()
+	img := image.NewRGBA(image.Rect(0, 0, 4, 3))
+	img.SetRGBA(1, 2, color.RGBA{R: 255, A: 255})
+	now := time.Date(2024, 1, 2, 15, 4, 5, 6e6, time.UTC)
+
+	name, err := saveScreenshot(img, dir, now)
+	if err != nil {
+		t.Fatalf("saveScreenshot() error = %v", err)
+	}
+	if want := filepath.Join(dir, "screenshot-20240102-150405.006.png"); name != want {
+		t.Errorf("saveScreenshot() = %q, want %q", name, want)
+	}
+
+	file, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	got, err := png.Decode(file)
+	if err != nil {
+		t.Fatalf("png.Decode() error = %v", err)
+	}
+	if got.Bounds() != img.Bounds() {
+		t.Errorf("screenshot bounds = %v, want %v", got.Bounds(), img.Bounds())
+	}
+	if r, _, _, _ := got.At(1, 2).RGBA(); r != 0xffff {
+		t.Errorf("screenshot pixel (1,2) red = 0x%x, want 0xffff", r)
+	}
+}
+
+func TestSaveScreenshotNoFrame(t *testing.T) {
+	v := &FramebufferViewer{}
+	if _, err := SaveScreenshot(v, t.TempDir()); err == nil {
+		t.Error("SaveScreenshot() before a frame succeeded")
+	}
+}
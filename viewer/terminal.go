@@ -0,0 +1,249 @@
+package viewer
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// terminalFrameInterval limits how often a TerminalViewer redraws
+const terminalFrameInterval = 100 * time.Millisecond
+
+// TerminalViewer implements Viewer by drawing the framebuffer in a terminal
+// with 24-bit ANSI colours, two pixels to a character cell using the upper
+// half block, so frames can be checked over SSH without a GUI. It draws on
+// the terminal's alternate screen from the first frame, which Close leaves.
+// No input is taken.
+type TerminalViewer struct {
+	out           io.Writer
+	columns, rows int
+
+	mutex   sync.Mutex
+	view    View
+	frame   retainedFrame
+	dirty   bool
+	entered bool // The alternate screen is shown
+	closed  bool
+	events  chan Event
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewTerminalViewer returns a TerminalViewer drawing to out, which should be a
+// terminal, in columns by rows character cells
+func NewTerminalViewer(out io.Writer, columns, rows int) *TerminalViewer {
+	v := &TerminalViewer{
+		out:     out,
+		columns: columns,
+		rows:    rows,
+		events:  make(chan Event, eventBuffer),
+		done:    make(chan struct{}),
+	}
+	v.wg.Add(1)
+	go v.drawLoop()
+	return v
+}
+
+// TerminalSize parses a size in character cells such as 120x40, or auto for
+// the size in the COLUMNS and LINES environment variables, less a line for
+// the shell prompt, and 80x24 where those are not set
+func TerminalSize(spec string) (columns, rows int, err error) {
+	if spec == "auto" {
+		columns, rows = 80, 24
+		if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n > 0 {
+			columns = n
+		}
+		if n, err := strconv.Atoi(os.Getenv("LINES")); err == nil && n > 1 {
+			rows = n - 1
+		}
+		return columns, rows, nil
+	}
+	c, r, ok := strings.Cut(spec, "x")
+	if ok {
+		columns, err = strconv.Atoi(c)
+	}
+	if ok && err == nil {
+		rows, err = strconv.Atoi(r)
+	}
+	if !ok || err != nil || columns < 1 || rows < 1 {
+		return 0, 0, fmt.Errorf("invalid terminal size %q, want COLUMNSxROWS such as 120x40, or auto", spec)
+	}
+	return columns, rows, nil
+}
+
+// Init draws a blank frame of the size before the first. There is no title
+// to set.
+func (v *TerminalViewer) Init(title string, width, height int) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if v.frame.img == nil {
+		v.frame.set(image.NewRGBA(image.Rect(0, 0, width, height)))
+		v.dirty = true
+	}
+}
+
+func (v *TerminalViewer) UpdateFramebuffer(img image.Image) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	v.frame.set(img)
+	v.dirty = true
+}
+
+func (v *TerminalViewer) UpdateRegion(img image.Image, r image.Rectangle) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if !v.frame.update(img, r).Empty() {
+		v.dirty = true
+	}
+}
+
+func (v *TerminalViewer) SetTitle(title string) {}
+
+// SetView sets how the frame is sized to the terminal. ScaleNative draws a
+// pixel per half cell times the zoom, cropped to the terminal.
+func (v *TerminalViewer) SetView(view View) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	v.view = view
+	v.dirty = true
+}
+
+// SetClipboard does nothing, as the terminal only shows frames
+func (v *TerminalViewer) SetClipboard(text string) {}
+
+func (v *TerminalViewer) Screenshot() image.Image {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	return v.frame.snapshot()
+}
+
+// Close stops drawing, restores the terminal and sends EventClosed
+func (v *TerminalViewer) Close() {
+	v.mutex.Lock()
+	if v.closed {
+		v.mutex.Unlock()
+		return
+	}
+	v.closed = true
+	v.mutex.Unlock()
+
+	close(v.done)
+	v.wg.Wait()
+	if v.entered {
+		// Show the cursor and return to the normal screen
+		io.WriteString(v.out, "\x1b[0m\x1b[?25h\x1b[?1049l")
+	}
+	sendEvent(v.events, Event{Type: EventClosed})
+}
+
+// Events returns a channel that only receives EventClosed from Close
+func (v *TerminalViewer) Events() <-chan Event {
+	return v.events
+}
+
+// drawLoop redraws the frame when it has changed, at most every
+// terminalFrameInterval
+func (v *TerminalViewer) drawLoop() {
+	defer v.wg.Done()
+	ticker := time.NewTicker(terminalFrameInterval)
+	defer ticker.Stop()
+
+	var buf bytes.Buffer
+	for {
+		select {
+		case <-ticker.C:
+		case <-v.done:
+			return
+		}
+
+		v.mutex.Lock()
+		if !v.dirty || v.frame.img == nil {
+			v.mutex.Unlock()
+			continue
+		}
+		v.dirty = false
+		buf.Reset()
+		if !v.entered {
+			// Switch to the alternate screen and hide the cursor
+			buf.WriteString("\x1b[?1049h\x1b[?25l\x1b[2J")
+			v.entered = true
+		}
+		buf.WriteString("\x1b[H")
+		renderHalfBlocks(&buf, v.frame.img, v.columns, v.rows, v.view)
+		v.mutex.Unlock()
+
+		v.out.Write(buf.Bytes())
+	}
+}
+
+// renderHalfBlocks writes img as rows of columns character cells, each
+// showing two pixels as the foreground and background colours of an upper
+// half block, placed in the cells as view places it in a window. Cells
+// outside the image are left in the default colours.
+func renderHalfBlocks(buf *bytes.Buffer, img image.Image, columns, rows int, view View) {
+	bounds := img.Bounds()
+	size := bounds.Size()
+	left, top, width, height, ok := view.Layout(float32(columns), float32(rows*2), size)
+
+	// sample returns the pixel drawn at x, y in half cells
+	sample := func(x, y int) (color.RGBA, bool) {
+		fx, fy := float32(x)+0.5-left, float32(y)+0.5-top
+		if !ok || fx < 0 || fy < 0 || fx >= width || fy >= height {
+			return color.RGBA{}, false
+		}
+		px := bounds.Min.X + int(fx*float32(size.X)/width)
+		py := bounds.Min.Y + int(fy*float32(size.Y)/height)
+		return color.RGBAModel.Convert(img.At(px, py)).(color.RGBA), true
+	}
+
+	for row := range rows {
+		var fg, bg string // Escape sequences in effect, to skip repeating them
+		setColours := func(f, b string) {
+			if f != fg {
+				buf.WriteString(f)
+				fg = f
+			}
+			if b != bg {
+				buf.WriteString(b)
+				bg = b
+			}
+		}
+		for col := range columns {
+			upper, upperOK := sample(col, row*2)
+			lower, lowerOK := sample(col, row*2+1)
+			switch {
+			case upperOK && lowerOK:
+				setColours(ansiColour(38, upper), ansiColour(48, lower))
+				buf.WriteString("▀")
+			case upperOK:
+				setColours(ansiColour(38, upper), "\x1b[49m")
+				buf.WriteString("▀")
+			case lowerOK:
+				setColours(ansiColour(38, lower), "\x1b[49m")
+				buf.WriteString("▄")
+			default:
+				setColours(fg, "\x1b[49m")
+				buf.WriteByte(' ')
+			}
+		}
+		buf.WriteString("\x1b[0m")
+		if row < rows-1 {
+			buf.WriteString("\r\n")
+		}
+	}
+}
+
+// ansiColour returns the escape sequence setting the foreground (38) or
+// background (48) to c
+func ansiColour(layer int, c color.RGBA) string {
+	return fmt.Sprintf("\x1b[%d;2;%d;%d;%dm", layer, c.R, c.G, c.B)
+}
+
+var _ Viewer = (*TerminalViewer)(nil)
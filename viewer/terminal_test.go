@@ -0,0 +1,125 @@
+package viewer
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRenderHalfBlocks(t *testing.T) {
+	red := color.RGBA{R: 255, A: 255}
+	green := color.RGBA{G: 255, A: 255}
+	blue := color.RGBA{B: 255, A: 255}
+	white := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+
+	stripes := image.NewRGBA(image.Rect(0, 0, 2, 4))
+	for x := range 2 {
+		stripes.SetRGBA(x, 0, red)
+		stripes.SetRGBA(x, 1, green)
+		stripes.SetRGBA(x, 2, blue)
+		stripes.SetRGBA(x, 3, white)
+	}
+	column := image.NewRGBA(image.Rect(0, 0, 1, 2))
+	column.SetRGBA(0, 0, red)
+	column.SetRGBA(0, 1, green)
+
+	tests := []struct {
+		name          string
+		img           image.Image
+		columns, rows int
+		view          View
+		want          string
+	}{
+		{
+			"same size", stripes, 2, 2, View{},
+			"\x1b[38;2;255;0;0m\x1b[48;2;0;255;0m▀▀\x1b[0m\r\n" +
+				"\x1b[38;2;0;0;255m\x1b[48;2;255;255;255m▀▀\x1b[0m",
+		},
+		{
+			"letterboxed", column, 3, 1, View{},
+			"\x1b[49m \x1b[38;2;255;0;0m\x1b[48;2;0;255;0m▀\x1b[49m \x1b[0m",
+		},
+		{
+			"scaled down", stripes, 1, 1, View{Mode: ScaleStretch},
+			"\x1b[38;2;0;255;0m\x1b[48;2;255;255;255m▀\x1b[0m",
+		},
+		{
+			"cropped", stripes, 1, 1, View{Mode: ScaleNative},
+			"\x1b[38;2;255;0;0m\x1b[48;2;0;255;0m▀\x1b[0m",
+		},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		renderHalfBlocks(&buf, tt.img, tt.columns, tt.rows, tt.view)
+		if got := buf.String(); got != tt.want {
+			t.Errorf("%s: renderHalfBlocks() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTerminalSize(t *testing.T) {
+	t.Setenv("COLUMNS", "132")
+	t.Setenv("LINES", "50")
+	tests := []struct {
+		spec          string
+		columns, rows int
+		wantErr       bool
+	}{
+		{"120x40", 120, 40, false},
+		{"auto", 132, 49, false},
+		{"120", 0, 0, true},
+		{"0x40", 0, 0, true},
+		{"axb", 0, 0, true},
+	}
+	for _, tt := range tests {
+		columns, rows, err := TerminalSize(tt.spec)
+		if columns != tt.columns || rows != tt.rows || (err != nil) != tt.wantErr {
+			t.Errorf("TerminalSize(%q) = %d, %d, %v, want %d, %d, error %v", tt.spec, columns, rows, err, tt.columns, tt.rows, tt.wantErr)
+		}
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe to write from the draw loop while a test
+// reads it
+type syncBuffer struct {
+	mutex sync.Mutex
+	buf   bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.String()
+}
+
+func TestTerminalViewer(t *testing.T) {
+	var out syncBuffer
+	v := NewTerminalViewer(&out, 4, 2)
+	v.UpdateFramebuffer(filled(image.Rect(0, 0, 4, 4), color.RGBA{R: 255, A: 255}))
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !strings.Contains(out.String(), "▀") {
+		if time.Now().After(deadline) {
+			t.Fatalf("frame not drawn: %q", out.String())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	v.Close()
+	if got := out.String(); !strings.HasPrefix(got, "\x1b[?1049h") || !strings.HasSuffix(got, "\x1b[?1049l") {
+		t.Errorf("output does not enter and leave the alternate screen: %q", got)
+	}
+	if ev := <-v.Events(); ev.Type != EventClosed {
+		t.Errorf("event after Close() = %v, want closed", ev)
+	}
+}
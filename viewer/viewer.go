@@ -0,0 +1,101 @@
+package viewer
+
+import (
+	"fmt"
+	"image"
+)
+
+// Viewer shows a framebuffer in a window. FramebufferViewer implements it
+// with Fyne when built with the gui tag and as a no-op otherwise, and other
+// display backends can implement it to stand in for either.
+type Viewer interface {
+	// Init titles, sizes and shows the window, and is called again when the
+	// framebuffer is resized
+	Init(title string, width, height int)
+	// UpdateFramebuffer shows a new frame. The viewer keeps img, so callers
+	// must not draw into it afterwards.
+	UpdateFramebuffer(img image.Image)
+	// UpdateRegion copies r of img into the frame shown and redraws it.
+	// img need only cover r, such as a rectangle's own pixels with bounds r,
+	// and is not kept.
+	UpdateRegion(img image.Image, r image.Rectangle)
+	SetTitle(title string)
+	// SetView sets how the framebuffer is sized to the window
+	SetView(view View)
+	// Screenshot returns the frame shown, or nil before the first
+	Screenshot() image.Image
+	// SetClipboard puts text cut on the server onto the host clipboard,
+	// where the viewer has one
+	SetClipboard(text string)
+	Close()
+	// Events returns the window's events, which are dropped when the
+	// channel is not drained
+	Events() <-chan Event
+}
+
+// EventType identifies what happened in a viewer window
+type EventType int
+
+const (
+	EventClosed    EventType = iota // The window was closed
+	EventKey                        // A key was pressed or released
+	EventPointer                    // The mouse moved or a button changed
+	EventClipboard                  // Text was copied to the host clipboard
+	EventResized                    // The window was resized
+)
+
+// Event is something that happened in a viewer window. Key events carry the
+// same values as Input.Key and pointer events the same as Input.Pointer.
+// After EventClosed the viewer ignores frames, so the caller can stop sending
+// them and close its connection.
+type Event struct {
+	Type    EventType
+	Key     uint32 // X11 keysym
+	Down    bool
+	X, Y    int    // Framebuffer pixels
+	Buttons uint8  // rfb.Button* bits
+	Text    string // Host clipboard text
+
+	Width, Height int // Size of the window's content in window pixels
+}
+
+func (e Event) String() string {
+	switch e.Type {
+	case EventClosed:
+		return "closed"
+	case EventKey:
+		return fmt.Sprintf("key 0x%04x down=%v", e.Key, e.Down)
+	case EventPointer:
+		return fmt.Sprintf("pointer %d,%d buttons=0x%02x", e.X, e.Y, e.Buttons)
+	case EventClipboard:
+		return fmt.Sprintf("clipboard %d bytes", len(e.Text))
+	case EventResized:
+		return fmt.Sprintf("resized %dx%d", e.Width, e.Height)
+	}
+	return fmt.Sprintf("event %d", e.Type)
+}
+
+// eventBuffer is how many events a viewer queues for Events
+const eventBuffer = 64
+
+var _ Viewer = (*FramebufferViewer)(nil)
+
+// sendEvent queues ev on events, dropping it if the queue is full. Closing
+// matters more than any input, so EventClosed takes the place of the oldest
+// event instead.
+func sendEvent(events chan Event, ev Event) {
+	for {
+		select {
+		case events <- ev:
+			return
+		default:
+		}
+		if ev.Type != EventClosed {
+			return
+		}
+		select {
+		case <-events:
+		default:
+		}
+	}
+}
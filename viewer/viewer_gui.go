@@ -6,7 +6,6 @@ import (
 	"image"
 	"log"
 	"sync"
-	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
@@ -19,17 +18,37 @@ type FramebufferViewer struct {
 	window      fyne.Window
 	image       *canvas.Image
 	mutex       sync.RWMutex
-	updateChan  chan image.Image
-	closeChan   chan bool
+	pacer       *framePacer // Shows queued frames, see pacer.go
+	done        chan struct{}
+	stopOnce    sync.Once
 	initialized bool
 	running     bool
+	events      chan Event
+
+	// How the framebuffer is sized to the window, see scale_gui.go
+	display *inputImage
+	scroll  *container.Scroll
+	view    View
+
+	menu             *fyne.Menu
+	devicePixelsItem *fyne.MenuItem // Checked with View.DevicePixels
+
+	frame retainedFrame // Shown in the window, see region.go
+
+	// Input from the window, see input_gui.go
+	input     Input
+	pressed   map[fyne.KeyName]uint32 // Keys sent down, to release when they come up
+	modifiers int                     // Control and Alt keys held
+
+	clipboard clipboardState // Host clipboard text, see clipboard_gui.go
 }
 
 func NewFramebufferViewer(title string, width, height int) (*FramebufferViewer, error) {
 	viewer := &FramebufferViewer{
-		updateChan: make(chan image.Image, 10),
-		closeChan:  make(chan bool, 1),
+		done:   make(chan struct{}),
+		events: make(chan Event, eventBuffer),
 	}
+	viewer.pacer = newFramePacer(displayRefreshInterval, viewer.done)
 
 	// Initialize Fyne app
 	viewer.app = app.New()
@@ -39,11 +58,14 @@ func NewFramebufferViewer(title string, width, height int) (*FramebufferViewer,
 	// Create initial blank image
 	blankImg := image.NewRGBA(image.Rect(0, 0, width, height))
 	viewer.image = canvas.NewImageFromImage(blankImg)
-	viewer.image.FillMode = canvas.ImageFillOriginal
+	viewer.frame.set(blankImg)
 
 	// Set up the window content
-	content := container.NewVBox(viewer.image)
-	viewer.window.SetContent(content)
+	viewer.window.SetContent(viewer.newDisplay(viewer.image))
+	viewer.window.SetMainMenu(fyne.NewMainMenu(viewer.viewMenu()))
+	viewer.watchKeys(viewer.window)
+	viewer.watchClose(viewer.window)
+	viewer.watchScreenshotKey(viewer.window)
 
 	viewer.initialized = true
 	return viewer, nil
@@ -63,13 +85,14 @@ func (v *FramebufferViewer) Start() {
 	v.running = true
 	v.mutex.Unlock()
 
-	// Start the update goroutine
+	// Start the update goroutines
 	go v.updateLoop()
+	go v.pollClipboard()
 
 	// Show the window and start the GUI loop (this blocks)
 	go func() {
 		v.window.ShowAndRun()
-		v.closeChan <- true
+		v.stop()
 	}()
 }
 
@@ -78,34 +101,101 @@ func (v *FramebufferViewer) UpdateFramebuffer(img image.Image) {
 		return
 	}
 
-	select {
-	case v.updateChan <- img:
-		// Image queued for update
-	default:
-		// Channel full, skip this frame
+	v.mutex.Lock()
+	v.frame.set(img)
+	shown := v.frame.img
+	v.mutex.Unlock()
+	v.queueFrame(shown)
+}
+
+// UpdateRegion copies r of img into the frame shown, which Fyne then redraws.
+// The window may briefly show a region half drawn.
+func (v *FramebufferViewer) UpdateRegion(img image.Image, r image.Rectangle) {
+	if !v.initialized || !v.running {
+		return
+	}
+
+	v.mutex.Lock()
+	drawn := v.frame.update(img, r)
+	shown := v.frame.img
+	v.mutex.Unlock()
+	if !drawn.Empty() {
+		v.queueFrame(shown)
 	}
 }
 
-func (v *FramebufferViewer) updateLoop() {
-	ticker := time.NewTicker(16 * time.Millisecond) // ~60 FPS
-	defer ticker.Stop()
+// queueFrame shows img at the next window refresh, unless a later frame
+// replaces it first. UpdateRegion queues the retained frame itself rather
+// than a copy, so the pacer only ever holds its latest state: regions drawn
+// after it was queued show too, and a region is never lost by coalescing.
+func (v *FramebufferViewer) queueFrame(img image.Image) {
+	v.pacer.submit(img)
+}
 
-	for {
-		select {
-		case img := <-v.updateChan:
-			v.image.Image = img
-			canvas.Refresh(v.image)
+// FrameStats counts the frames given to the viewer and how many it showed
+func (v *FramebufferViewer) FrameStats() FrameStats {
+	return v.pacer.frameStats()
+}
 
-		case <-ticker.C:
-			// Periodic refresh even if no new frames
+func (v *FramebufferViewer) SetTitle(title string) {
+	if v.window != nil {
+		v.window.SetTitle(title)
+	}
+}
+
+func (v *FramebufferViewer) Events() <-chan Event {
+	return v.events
+}
+
+// watchClose sends EventClosed and stops updates when the window closes
+func (v *FramebufferViewer) watchClose(window fyne.Window) {
+	window.SetOnClosed(func() {
+		v.stop()
+		sendEvent(v.events, Event{Type: EventClosed})
+	})
+}
+
+// resizeLayout fills the window with its content and sends EventResized when
+// the window's size changes
+type resizeLayout struct {
+	viewer *FramebufferViewer
+	size   fyne.Size
+}
 
-		case <-v.closeChan:
-			v.mutex.Lock()
-			v.running = false
-			v.mutex.Unlock()
-			return
-		}
+func (l *resizeLayout) Layout(objects []fyne.CanvasObject, size fyne.Size) {
+	for _, o := range objects {
+		o.Move(fyne.NewPos(0, 0))
+		o.Resize(size)
 	}
+	if size != l.size {
+		l.size = size
+		sendEvent(l.viewer.events, Event{Type: EventResized, Width: int(size.Width), Height: int(size.Height)})
+	}
+}
+
+func (l *resizeLayout) MinSize(objects []fyne.CanvasObject) fyne.Size {
+	var size fyne.Size
+	for _, o := range objects {
+		size = size.Max(o.MinSize())
+	}
+	return size
+}
+
+// updateLoop shows queued frames, pacing them to the window's refresh, until
+// the viewer stops
+func (v *FramebufferViewer) updateLoop() {
+	v.pacer.run(func(img image.Image) {
+		v.image.Image = img
+		v.refresh()
+	})
+	v.mutex.Lock()
+	v.running = false
+	v.mutex.Unlock()
+}
+
+// stop ends updateLoop and pollClipboard
+func (v *FramebufferViewer) stop() {
+	v.stopOnce.Do(func() { close(v.done) })
 }
 
 func (v *FramebufferViewer) IsRunning() bool {
@@ -114,13 +204,14 @@ func (v *FramebufferViewer) IsRunning() bool {
 	return v.running
 }
 
-func (v *FramebufferViewer) Initialize(title string, width, height int) {
+func (v *FramebufferViewer) Init(title string, width, height int) {
 	// When running with RunWithVNCClient, the window is already initialized
-	// This method can be used to update the title and size if needed
+	// This method updates the title and size and shows it
 	if v.window != nil {
 		v.window.SetTitle(title)
 		v.window.Resize(fyne.NewSize(float32(width), float32(height)))
 	}
+	v.Show()
 }
 
 func (v *FramebufferViewer) Show() {
@@ -128,7 +219,9 @@ func (v *FramebufferViewer) Show() {
 		return
 	}
 	
+	v.mutex.Lock()
 	v.running = true
+	v.mutex.Unlock()
 	if v.window != nil {
 		v.window.Show()
 	}
@@ -157,39 +250,18 @@ func (v *FramebufferViewer) Close() {
 	}
 	v.mutex.Unlock()
 
-	select {
-	case v.closeChan <- true:
-	default:
-	}
+	v.stop()
 
 	if v.window != nil {
 		v.window.Close()
 	}
 }
 
-func RunWithVNCClient(title string, width, height int, vncClientFunc func(*FramebufferViewer)) {
+func RunWithVNCClient(title string, width, height int, vncClientFunc func(Viewer)) {
 	// Create Fyne app on main thread
 	a := app.New()
-	w := a.NewWindow(title)
-	w.Resize(fyne.NewSize(float32(width), float32(height)))
-
-	img := canvas.NewImageFromResource(nil)
-	img.FillMode = canvas.ImageFillOriginal
-	img.ScaleMode = canvas.ImageScalePixels
+	viewer := newWindowViewer(a, title, width, height)
 
-	content := container.NewBorder(nil, nil, nil, nil, img)
-	w.SetContent(content)
-
-	viewer := &FramebufferViewer{
-		app:         a,
-		window:      w,
-		image:       img,
-		updateChan:  make(chan image.Image, 10),
-		closeChan:   make(chan bool, 1),
-		initialized: true,
-		running:     true,
-	}
-	
 	// Start VNC client in goroutine
 	go func() {
 		defer func() {
@@ -199,32 +271,42 @@ func RunWithVNCClient(title string, width, height int, vncClientFunc func(*Frame
 		}()
 		vncClientFunc(viewer)
 	}()
-	
-	// Start update handler
-	go viewer.handleUpdates()
-	
+
 	// Run GUI on main thread
-	w.ShowAndRun()
+	a.Run()
 }
 
-func (v *FramebufferViewer) handleUpdates() {
-	ticker := time.NewTicker(16 * time.Millisecond) // ~60 FPS
-	defer ticker.Stop()
-
-	for {
-		select {
-		case img := <-v.updateChan:
-			v.image.Image = img
-			canvas.Refresh(v.image)
+// newWindowViewer opens a window of a and returns its viewer, already
+// running. The window closes with the app.
+func newWindowViewer(a fyne.App, title string, width, height int) *FramebufferViewer {
+	w := a.NewWindow(title)
+	w.Resize(fyne.NewSize(float32(width), float32(height)))
 
-		case <-ticker.C:
-			// Periodic refresh even if no new frames
+	img := canvas.NewImageFromResource(nil)
+	img.ScaleMode = canvas.ImageScalePixels
 
-		case <-v.closeChan:
-			v.mutex.Lock()
-			v.running = false
-			v.mutex.Unlock()
-			return
-		}
+	viewer := &FramebufferViewer{
+		app:         a,
+		window:      w,
+		image:       img,
+		done:        make(chan struct{}),
+		events:      make(chan Event, eventBuffer),
+		initialized: true,
+		running:     true,
 	}
-}
\ No newline at end of file
+	viewer.pacer = newFramePacer(displayRefreshInterval, viewer.done)
+
+	// The view maps input back to framebuffer pixels
+	w.SetContent(viewer.newDisplay(img))
+	w.SetMainMenu(fyne.NewMainMenu(viewer.viewMenu()))
+	viewer.watchKeys(w)
+	viewer.watchClose(w)
+	viewer.watchScreenshotKey(w)
+
+	// Start update handlers
+	go viewer.updateLoop()
+	go viewer.pollClipboard()
+
+	w.Show()
+	return viewer
+}
@@ -5,18 +5,25 @@ package viewer
 import (
 	"image"
 	"log"
+	"sync"
 )
 
 // FramebufferViewer provides a no-op implementation when GUI is disabled
 type FramebufferViewer struct {
 	initialized bool
 	running     bool
+	events      chan Event
+
+	mutex sync.Mutex
+	frame retainedFrame // Kept for Screenshot
+	stats FrameStats
 }
 
 func NewFramebufferViewer(title string, width, height int) (*FramebufferViewer, error) {
 	log.Printf("GUI viewer disabled (built without 'gui' tag). Title: %s, Size: %dx%d", title, width, height)
 	return &FramebufferViewer{
 		initialized: true,
+		events:      make(chan Event, eventBuffer),
 	}, nil
 }
 
@@ -30,16 +37,59 @@ func (v *FramebufferViewer) Start() {
 	log.Println("GUI viewer started (no-op mode)")
 }
 
+// UpdateFramebuffer only keeps img for Screenshot when GUI is disabled
 func (v *FramebufferViewer) UpdateFramebuffer(img image.Image) {
-	// No-op when GUI is disabled
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	v.frame.set(img)
+	v.stats.Received++
+	v.stats.Shown++
+}
+
+// UpdateRegion only copies r of img into the frame kept for Screenshot
+func (v *FramebufferViewer) UpdateRegion(img image.Image, r image.Rectangle) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	v.frame.update(img, r)
+	v.stats.Received++
+	v.stats.Shown++
+}
+
+func (v *FramebufferViewer) Screenshot() image.Image {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	return v.frame.snapshot()
+}
+
+// FrameStats counts the frames given to the viewer, which are all kept and so
+// none coalesced
+func (v *FramebufferViewer) FrameStats() FrameStats {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	return v.stats
 }
 
+func (v *FramebufferViewer) SetTitle(title string) {}
+
+func (v *FramebufferViewer) SetView(view View) {}
+
+// SetClipboard does nothing, as there is no host clipboard to reach
+func (v *FramebufferViewer) SetClipboard(text string) {}
+
+// Events returns a channel that only receives EventClosed from Close
+func (v *FramebufferViewer) Events() <-chan Event {
+	return v.events
+}
+
+// SetInput does nothing, as there is no window to take input from
+func (v *FramebufferViewer) SetInput(input Input) {}
+
 func (v *FramebufferViewer) IsRunning() bool {
 	return v.running
 }
 
-func (v *FramebufferViewer) Initialize(title string, width, height int) {
-	log.Printf("GUI viewer initialize (no-op). Title: %s, Size: %dx%d", title, width, height)
+func (v *FramebufferViewer) Init(title string, width, height int) {
+	log.Printf("GUI viewer init (no-op). Title: %s, Size: %dx%d", title, width, height)
 }
 
 func (v *FramebufferViewer) Show() {
@@ -56,15 +106,17 @@ func (v *FramebufferViewer) Close() {
 	if v.running {
 		v.running = false
 		log.Println("GUI viewer closed")
+		sendEvent(v.events, Event{Type: EventClosed})
 	}
 }
 
-func RunWithVNCClient(title string, width, height int, vncClientFunc func(*FramebufferViewer)) {
+func RunWithVNCClient(title string, width, height int, vncClientFunc func(Viewer)) {
 	log.Printf("GUI viewer disabled (built without 'gui' tag). Running VNC client without GUI. Title: %s, Size: %dx%d", title, width, height)
 	
 	viewer := &FramebufferViewer{
 		initialized: true,
 		running:     true,
+		events:      make(chan Event, eventBuffer),
 	}
 	
 	// Run VNC client function directly (no GUI)
@@ -0,0 +1,53 @@
+package viewer
+
+import (
+	"testing"
+
+	"github.com/coder/websockify/rfb"
+)
+
+func TestEventString(t *testing.T) {
+	tests := []struct {
+		ev   Event
+		want string
+	}{
+		{Event{Type: EventClosed}, "closed"},
+		{Event{Type: EventKey, Key: rfb.KeyReturn, Down: true}, "key 0xff0d down=true"},
+		{Event{Type: EventPointer, X: 10, Y: 20, Buttons: rfb.ButtonLeft}, "pointer 10,20 buttons=0x01"},
+		{Event{Type: EventClipboard, Text: "hello"}, "clipboard 5 bytes"},
+		{Event{Type: EventResized, Width: 800, Height: 600}, "resized 800x600"},
+		{Event{Type: 9}, "event 9"},
+	}
+	for _, tt := range tests {
+		if got := tt.ev.String(); got != tt.want {
+			t.Errorf("%#v.String() = %q, want %q", tt.ev, got, tt.want)
+		}
+	}
+}
+
+func TestSendEventDropsWhenFull(t *testing.T) {
+	events := make(chan Event, 1)
+	sendEvent(events, Event{Type: EventKey, Key: 'a'})
+	sendEvent(events, Event{Type: EventKey, Key: 'b'})
+	if got := <-events; got.Key != 'a' {
+		t.Errorf("first event key = %q, want 'a'", got.Key)
+	}
+	select {
+	case ev := <-events:
+		t.Errorf("got %v after a full queue, want it dropped", ev)
+	default:
+	}
+}
+
+func TestSendEventClosedWhenFull(t *testing.T) {
+	events := make(chan Event, 2)
+	sendEvent(events, Event{Type: EventKey, Key: 'a'})
+	sendEvent(events, Event{Type: EventKey, Key: 'b'})
+	sendEvent(events, Event{Type: EventClosed})
+	if got := <-events; got.Key != 'b' {
+		t.Errorf("first event key = %q, want 'b' after 'a' made room", got.Key)
+	}
+	if got := <-events; got.Type != EventClosed {
+		t.Errorf("last event = %v, want closed", got)
+	}
+}
@@ -0,0 +1,288 @@
+package viewer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"log"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/textproto"
+	"sync"
+	"time"
+)
+
+// webFrameInterval limits how often /stream sends a frame to each browser
+const webFrameInterval = 33 * time.Millisecond
+
+// WebViewer implements Viewer by serving the framebuffer over HTTP instead of
+// showing a window, for machines without a display. The page at / shows an
+// MJPEG stream from /stream, and /frame.png is the frame shown. Browsers
+// watch only; no input is taken from them.
+type WebViewer struct {
+	mutex   sync.Mutex
+	title   string
+	view    View
+	frame   retainedFrame
+	changed chan struct{} // Closed and replaced when the frame changes
+	events  chan Event
+	server  *http.Server
+	closed  bool
+	mux     *http.ServeMux
+}
+
+// NewWebViewer returns a WebViewer titled title, which serves HTTP requests
+// itself or with Serve
+func NewWebViewer(title string) *WebViewer {
+	v := &WebViewer{
+		title:   title,
+		changed: make(chan struct{}),
+		events:  make(chan Event, eventBuffer),
+		mux:     http.NewServeMux(),
+	}
+	v.server = &http.Server{Handler: v}
+	v.mux.HandleFunc("GET /{$}", v.handlePage)
+	v.mux.HandleFunc("GET /stream", v.handleStream)
+	v.mux.HandleFunc("GET /frame.png", v.handleFrame)
+	return v
+}
+
+// Serve serves the viewer on listener until Close is called
+func (v *WebViewer) Serve(listener net.Listener) error {
+	err := v.server.Serve(listener)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// ListenWebViewer returns a WebViewer titled title serving on addr, such as
+// :8081, in the background until Close is called
+func ListenWebViewer(addr, title string) (*WebViewer, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	v := NewWebViewer(title)
+	go func() {
+		if err := v.Serve(listener); err != nil {
+			log.Printf("Web viewer stopped: %v", err)
+		}
+	}()
+	return v, nil
+}
+
+func (v *WebViewer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	v.mux.ServeHTTP(w, r)
+}
+
+// Init sets the title and, before the first frame, shows a blank one of the
+// size
+func (v *WebViewer) Init(title string, width, height int) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	v.title = title
+	if v.frame.img == nil {
+		v.frame.set(image.NewRGBA(image.Rect(0, 0, width, height)))
+		v.notify()
+	}
+}
+
+func (v *WebViewer) UpdateFramebuffer(img image.Image) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	v.frame.set(img)
+	v.notify()
+}
+
+func (v *WebViewer) UpdateRegion(img image.Image, r image.Rectangle) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if !v.frame.update(img, r).Empty() {
+		v.notify()
+	}
+}
+
+// notify wakes the streams waiting for a new frame. Callers must hold
+// v.mutex.
+func (v *WebViewer) notify() {
+	close(v.changed)
+	v.changed = make(chan struct{})
+}
+
+func (v *WebViewer) SetTitle(title string) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	v.title = title
+}
+
+// SetView sets how the page sizes the stream, which applies when it is next
+// loaded
+func (v *WebViewer) SetView(view View) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	v.view = view
+}
+
+// SetClipboard does nothing, as browsers only watch
+func (v *WebViewer) SetClipboard(text string) {}
+
+func (v *WebViewer) Screenshot() image.Image {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	return v.frame.snapshot()
+}
+
+// Close stops serving, ending any streams, and sends EventClosed
+func (v *WebViewer) Close() {
+	v.mutex.Lock()
+	if v.closed {
+		v.mutex.Unlock()
+		return
+	}
+	v.closed = true
+	v.mutex.Unlock()
+
+	v.server.Close()
+	sendEvent(v.events, Event{Type: EventClosed})
+}
+
+// Events returns a channel that only receives EventClosed from Close
+func (v *WebViewer) Events() <-chan Event {
+	return v.events
+}
+
+// next returns a copy of the frame and a channel closed when it changes
+func (v *WebViewer) next() (image.Image, <-chan struct{}) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	return v.frame.snapshot(), v.changed
+}
+
+var webPage = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+html, body { margin: 0; height: 100%; background: #222; }
+{{if .Sized}}body { overflow: auto; }
+img { display: block; margin: auto; image-rendering: pixelated; }
+{{else}}img { display: block; width: 100%; height: 100%; object-fit: {{.Fit}}; }
+{{end}}</style>
+</head>
+<body><img src="stream" alt="{{.Title}}">
+{{if .Sized}}<script>
+const img = document.querySelector("img");
+function resize() {
+	const ratio = window.devicePixelRatio || 1;
+	let scale = {{.Zoom}}{{if .DevicePixels}} / ratio{{end}};
+	{{if .Integer}}const fit = Math.min(innerWidth / {{.Width}}, innerHeight / {{.Height}});
+	const n = Math.floor(fit * ratio + 1e-4);
+	scale = n >= 1 ? n / ratio : fit;
+	{{end}}img.style.width = {{.Width}} * scale + "px";
+	img.style.height = {{.Height}} * scale + "px";
+}
+addEventListener("resize", resize);
+resize();
+</script>
+{{end}}</body>
+</html>
+`))
+
+// handlePage serves the page showing the stream as View places it. Sizes in
+// display pixels are worked out by a script, since only the browser knows how
+// many of them make up a CSS pixel on HiDPI displays.
+func (v *WebViewer) handlePage(w http.ResponseWriter, r *http.Request) {
+	v.mutex.Lock()
+	view, size := v.view, v.frame.size()
+	title := v.title
+	v.mutex.Unlock()
+
+	data := struct {
+		Title         string
+		Fit           string
+		Sized         bool
+		Integer       bool
+		DevicePixels  bool
+		Zoom          float32
+		Width, Height int
+	}{
+		Title:        title,
+		Fit:          "contain",
+		Sized:        view.Mode == ScaleNative || view.Mode == ScaleInteger,
+		Integer:      view.Mode == ScaleInteger,
+		DevicePixels: view.DevicePixels,
+		Zoom:         view.zoom(),
+		Width:        max(size.X, 1),
+		Height:       max(size.Y, 1),
+	}
+	if view.Mode == ScaleStretch {
+		data.Fit = "fill"
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	webPage.Execute(w, data)
+}
+
+// handleStream sends the frame as a multipart/x-mixed-replace MJPEG stream,
+// which browsers show in an img element, and a new part whenever it changes
+func (v *WebViewer) handleStream(w http.ResponseWriter, r *http.Request) {
+	mw := multipart.NewWriter(w)
+	w.Header().Set("Content-Type", "multipart/x-mixed-replace; boundary="+mw.Boundary())
+	w.Header().Set("Cache-Control", "no-store")
+	controller := http.NewResponseController(w)
+
+	var buf bytes.Buffer
+	for {
+		img, changed := v.next()
+		if img != nil {
+			buf.Reset()
+			if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90}); err != nil {
+				return
+			}
+			part, err := mw.CreatePart(textproto.MIMEHeader{
+				"Content-Type":   {"image/jpeg"},
+				"Content-Length": {fmt.Sprint(buf.Len())},
+			})
+			if err != nil {
+				return
+			}
+			if _, err := part.Write(buf.Bytes()); err != nil {
+				return
+			}
+			if err := controller.Flush(); err != nil {
+				return
+			}
+		}
+
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+		// Frames changing faster than this are skipped
+		select {
+		case <-time.After(webFrameInterval):
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (v *WebViewer) handleFrame(w http.ResponseWriter, r *http.Request) {
+	img := v.Screenshot()
+	if img == nil {
+		http.Error(w, "no frame shown yet", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-store")
+	png.Encode(w, img)
+}
+
+var _ Viewer = (*WebViewer)(nil)
@@ -0,0 +1,112 @@
+package viewer
+
+import (
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWebViewerPage(t *testing.T) {
+	v := NewWebViewer("Test <viewer>")
+	v.Init("VNC Client - localhost:5900", 100, 50)
+	v.SetView(View{Mode: ScaleNative, Zoom: 2, DevicePixels: true})
+	srv := httptest.NewServer(v)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	for _, want := range []string{"<title>VNC Client - localhost:5900</title>", `src="stream"`, "let scale =  2  / ratio;", "img.style.width =  100  * scale"} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("page does not contain %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestWebViewerFrame(t *testing.T) {
+	v := NewWebViewer("Test")
+	srv := httptest.NewServer(v)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/frame.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("/frame.png before a frame = %d, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+
+	v.UpdateFramebuffer(filled(image.Rect(0, 0, 8, 6), color.RGBA{R: 255, A: 255}))
+	region := image.Rect(2, 2, 4, 4)
+	v.UpdateRegion(filled(region, color.RGBA{B: 255, A: 255}), region)
+
+	resp, err = http.Get(srv.URL + "/frame.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	img, err := png.Decode(resp.Body)
+	if err != nil {
+		t.Fatalf("png.Decode() error = %v", err)
+	}
+	if _, _, b, _ := img.At(3, 3).RGBA(); b != 0xffff {
+		t.Errorf("/frame.png pixel in region blue = 0x%x, want 0xffff", b)
+	}
+	if r, _, _, _ := img.At(6, 3).RGBA(); r != 0xffff {
+		t.Errorf("/frame.png pixel outside region red = 0x%x, want 0xffff", r)
+	}
+}
+
+func TestWebViewerStream(t *testing.T) {
+	v := NewWebViewer("Test")
+	v.UpdateFramebuffer(filled(image.Rect(0, 0, 16, 8), color.RGBA{G: 255, A: 255}))
+	srv := httptest.NewServer(v)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/x-mixed-replace" {
+		t.Fatalf("Content-Type = %q, want multipart/x-mixed-replace", resp.Header.Get("Content-Type"))
+	}
+	parts := multipart.NewReader(resp.Body, params["boundary"])
+
+	next := func() image.Image {
+		part, err := parts.NextPart()
+		if err != nil {
+			t.Fatalf("NextPart() error = %v", err)
+		}
+		img, err := jpeg.Decode(part)
+		if err != nil {
+			t.Fatalf("jpeg.Decode() error = %v", err)
+		}
+		return img
+	}
+	if got := next().Bounds(); got != image.Rect(0, 0, 16, 8) {
+		t.Errorf("first frame bounds = %v, want 16x8", got)
+	}
+	v.UpdateFramebuffer(filled(image.Rect(0, 0, 32, 16), color.RGBA{A: 255}))
+	if got := next().Bounds(); got != image.Rect(0, 0, 32, 16) {
+		t.Errorf("frame after update bounds = %v, want 32x16", got)
+	}
+
+	v.Close()
+	if ev := <-v.Events(); ev.Type != EventClosed {
+		t.Errorf("event after Close() = %v, want closed", ev)
+	}
+}
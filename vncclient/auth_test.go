@@ -0,0 +1,55 @@
+package vncclient
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/coder/websockify/mockvnc"
+)
+
+func TestPasswordAuthentication(t *testing.T) {
+	tests := []struct {
+		name           string
+		serverPassword string
+		password       string
+		wantErr        string // Empty when the handshake should succeed
+	}{
+		{"correct", "secret", "secret", ""},
+		{"only first 8 characters", "password", "password-ignored", ""},
+		{"wrong", "secret", "wrong", "Authentication failed"},
+		{"missing", "secret", "", "no password"},
+		{"unused", "", "secret", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := mockvnc.Start(t, mockvnc.Options{Width: 8, Height: 8, Password: tt.serverPassword})
+
+			c, err := Connect(context.Background(), s.Addr(), Options{Password: tt.password, Logf: t.Logf})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Connect() error = %v", err)
+				}
+				c.Close()
+				return
+			}
+			if err == nil {
+				c.Close()
+				t.Fatalf("Connect() succeeded, want error containing %q", tt.wantErr)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Connect() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAuthFailedIsWrapped(t *testing.T) {
+	s := mockvnc.Start(t, mockvnc.Options{Width: 8, Height: 8, Password: "secret"})
+
+	_, err := Connect(context.Background(), s.Addr(), Options{Password: "wrong", Logf: t.Logf})
+	if !errors.Is(err, ErrAuthFailed) {
+		t.Errorf("Connect() error = %v, want ErrAuthFailed", err)
+	}
+}
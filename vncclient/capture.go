@@ -0,0 +1,63 @@
+package vncclient
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+)
+
+// CaptureOptions controls saving and keeping received frames
+type CaptureOptions struct {
+	Dir          string // Save each frame as frame_NNNN.png in this directory when set
+	Checkerboard bool   // Composite saved and kept frames over a checkerboard to show transparency
+	Keep         bool   // Keep a copy of every frame in memory for Frames
+}
+
+// captureFrame saves and keeps the current framebuffer as configured.
+// Callers must hold c.mutex.
+func (c *Client) captureFrame() error {
+	capture := c.opts.Capture
+	if capture.Dir == "" && !capture.Keep {
+		return nil
+	}
+
+	frame := c.displayFrame()
+	if capture.Checkerboard {
+		frame = Checkerboard(frame)
+	}
+	if capture.Keep {
+		c.frames = append(c.frames, cloneRGBA(frame))
+	}
+	if capture.Dir == "" {
+		return nil
+	}
+
+	filename := filepath.Join(capture.Dir, fmt.Sprintf("frame_%04d.png", c.frameCount))
+	if err := SavePNG(filename, frame); err != nil {
+		return err
+	}
+	c.logf("Saved frame %d to %s", c.frameCount, filename)
+	return nil
+}
+
+// Frames returns the frames kept so far with CaptureOptions.Keep
+func (c *Client) Frames() []*image.RGBA {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return append([]*image.RGBA(nil), c.frames...)
+}
+
+// SavePNG writes img to a PNG file, such as a reference frame for CompareFrames
+func SavePNG(filename string, img image.Image) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(file, img); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,573 @@
+// Package vncclient is a small RFB client for testing VNC servers and the
+// websockify proxy. It completes the handshake, decodes framebuffer updates
+// into an RGBA image and can save each frame as a PNG. The vncclient command
+// is a thin wrapper around it; Go tests can use Connect to drive a client
+// in-process.
+package vncclient
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/coder/websockify/rfb"
+)
+
+// DefaultUpdateInterval is how often Run requests incremental updates
+const DefaultUpdateInterval = time.Second
+
+// ErrAuthFailed is returned, wrapped with the server's reason, when the
+// server rejects the security handshake
+var ErrAuthFailed = errors.New("vncclient: authentication failed")
+
+// DefaultEncodings lists every encoding the client can read: the pixel
+// encodings in preference order, then CopyRect and the DesktopSize, Cursor
+// and PointerPos pseudo-encodings
+func DefaultEncodings() []int32 {
+	return append(rfb.SupportedDecodings(), rfb.CopyRectEncoding,
+		rfb.DesktopSizeEncoding, rfb.CursorEncoding, rfb.PointerPosEncoding)
+}
+
+// Options configures a Client. The zero value uses the server's pixel format,
+// shares the desktop with other clients and saves nothing.
+type Options struct {
+	// PixelFormat is sent with SetPixelFormat after the handshake when set
+	PixelFormat *rfb.PixelFormat
+
+	// Encodings are requested with SetEncodings after the handshake, in
+	// preference order; DefaultEncodings() when nil
+	Encodings []int32
+
+	Password       string        // Password for VNC Authentication; only the first 8 characters are used
+	Exclusive      bool          // Ask the server to disconnect other clients
+	HideCursor     bool          // Leave the cursor shape out of frames passed to OnFrame and captured
+	UpdateInterval time.Duration // Time between incremental update requests in Run
+
+	// ContinuousUpdates lists the ContinuousUpdates pseudo-encoding and, once
+	// the server announces support, asks it to send updates as the screen
+	// changes. Run stops requesting updates while they are enabled and
+	// resumes if the server ends them.
+	ContinuousUpdates bool
+
+	TLS      bool // Wrap the connection in TLS before the RFB handshake, as for a server behind stunnel
+	VeNCrypt bool // Choose VeNCrypt when the server offers it and upgrade to TLS during the handshake
+
+	// TLSConfig verifies the server for TLS, VeNCrypt and wss:// URLs. The
+	// system roots are used when nil; Connect fills in the server name.
+	TLSConfig *tls.Config
+
+	// OnFrame is called after each FramebufferUpdate has been applied, from
+	// the goroutine reading messages. The image is the client's own
+	// framebuffer and is only valid during the call; copy it to keep it.
+	OnFrame func(frame *image.RGBA)
+
+	// OnResize is called when the server changes the framebuffer size with a
+	// DesktopSize rectangle, from the goroutine reading messages. The
+	// framebuffer is locked during the call, so it must not call the Client.
+	OnResize func(width, height int)
+
+	// OnCutText is called with the text of each ServerCutText, from the
+	// goroutine reading messages
+	OnCutText func(text string)
+
+	// OnEvent is called with a structured Event for the handshake, each
+	// update and rectangle, cut text, bells and errors, from the goroutine
+	// connecting or reading messages. Update and rectangle events are sent
+	// with the framebuffer locked, so it must not call the Client.
+	OnEvent func(ev Event)
+
+	Capture CaptureOptions // Saving and keeping received frames
+
+	// Record receives an FBS recording of the server's messages after the
+	// handshake, for Replay. The recording starts with the handshake of a
+	// server without authentication, whatever security was used, so it
+	// replays without a password.
+	Record io.Writer
+
+	// Logf receives the client's log output; log.Printf when nil
+	Logf func(format string, args ...any)
+}
+
+// Client is a connected RFB client
+type Client struct {
+	conn   net.Conn
+	reader *bufio.Reader // Buffers server messages after the handshake
+	opts   Options
+	name   string
+
+	decoders map[int32]rfb.Decoder // Decoders in use, kept for stateful encodings like ZRLE
+
+	writeMutex sync.Mutex // Serializes messages to the server
+
+	mutex       sync.Mutex // Guards the framebuffer and captured frames
+	framebuffer *image.RGBA
+	pixelFormat rfb.PixelFormat // Format of pixel data sent by the server
+	colorMap    rfb.ColorMap    // Colours of pixel formats without true colour
+	frameCount  int
+	frames      []*image.RGBA // Frames kept for Capture.Keep
+	cursor      cursorState
+
+	continuousSupported bool // Server announced ContinuousUpdates with EndOfContinuousUpdates
+	continuousUpdates   bool // Continuous updates are enabled
+
+	// Statistics, see stats.go
+	connected   time.Time
+	bytesRead   atomic.Int64
+	decodeTime  time.Duration
+	latencies   []time.Duration
+	requestedAt time.Time       // Earliest unanswered FramebufferUpdateRequest
+	lastFrameAt time.Time       // When the latest FramebufferUpdate started arriving
+	intervals   []time.Duration // Times between FramebufferUpdates
+}
+
+// Connect dials a VNC server and completes the handshake. addr is a
+// host:port, a unix:// URL such as unix:///run/qemu/vnc.sock for a server on a
+// unix socket, or a ws:// or wss:// URL such as ws://localhost:6080/websockify
+// to speak RFB over WebSocket through websockify.
+func Connect(ctx context.Context, addr string, opts Options) (*Client, error) {
+	opts.TLSConfig = withServerName(opts.TLSConfig, addr)
+	conn, err := dial(ctx, addr, opts)
+	if err != nil {
+		err = fmt.Errorf("failed to connect: %v", err)
+		emitError(opts, err)
+		return nil, err
+	}
+	c, err := NewClient(conn, opts)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// NewClient completes the RFB handshake over an existing connection
+func NewClient(conn net.Conn, opts Options) (*Client, error) {
+	c, err := newClient(conn, opts)
+	if err != nil {
+		emitError(opts, err)
+		return nil, err
+	}
+	return c, nil
+}
+
+func newClient(conn net.Conn, opts Options) (*Client, error) {
+	if opts.Encodings == nil {
+		opts.Encodings = DefaultEncodings()
+	}
+	if opts.ContinuousUpdates && !slices.Contains(opts.Encodings, rfb.ContinuousUpdatesEncoding) {
+		opts.Encodings = append(slices.Clone(opts.Encodings), rfb.ContinuousUpdatesEncoding)
+	}
+	if opts.UpdateInterval <= 0 {
+		opts.UpdateInterval = DefaultUpdateInterval
+	}
+	if opts.Logf == nil {
+		opts.Logf = log.Printf
+	}
+	if opts.Capture.Dir != "" {
+		if err := os.MkdirAll(opts.Capture.Dir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create capture directory: %v", err)
+		}
+	}
+
+	c := &Client{conn: conn, opts: opts, decoders: make(map[int32]rfb.Decoder)}
+	if err := c.handshake(); err != nil {
+		return nil, fmt.Errorf("handshake failed: %w", err)
+	}
+	if opts.PixelFormat != nil {
+		if err := c.SetPixelFormat(*opts.PixelFormat); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.SetEncodings(opts.Encodings); err != nil {
+		return nil, err
+	}
+	if opts.Record != nil {
+		if err := c.startRecording(opts.Record); err != nil {
+			return nil, fmt.Errorf("failed to start recording: %v", err)
+		}
+	}
+	return c, nil
+}
+
+// logf writes to the configured logger
+func (c *Client) logf(format string, args ...any) {
+	c.opts.Logf(format, args...)
+}
+
+func (c *Client) handshake() error {
+	// Read server version
+	serverVersion, err := rfb.ReadRFBVersion(c.conn)
+	if err != nil {
+		return fmt.Errorf("failed to read server version: %v", err)
+	}
+	c.logf("Server version: %s", serverVersion)
+
+	// Send client version
+	if err := rfb.SendRFBVersion(c.conn); err != nil {
+		return fmt.Errorf("failed to send client version: %v", err)
+	}
+
+	// Read security types
+	securityTypes, err := rfb.ReadSecurityTypes(c.conn)
+	if err != nil {
+		return fmt.Errorf("failed to read security types: %v", err)
+	}
+	c.logf("Available security types: %v", securityTypes)
+
+	// Choose a security type and authenticate
+	securityType, err := c.chooseSecurityType(securityTypes)
+	if err != nil {
+		return err
+	}
+	if _, err := c.conn.Write([]byte{securityType}); err != nil {
+		return fmt.Errorf("failed to send security choice: %v", err)
+	}
+	switch securityType {
+	case rfb.SecurityVeNCrypt:
+		if err := c.startVeNCrypt(); err != nil {
+			return err
+		}
+	case rfb.SecurityVNCAuth:
+		if err := c.authenticate(); err != nil {
+			return err
+		}
+	}
+
+	// Read security result, followed by a reason when it failed
+	securityResult, err := rfb.ReadSecurityResult(c.conn)
+	if err != nil {
+		return fmt.Errorf("failed to read security result: %v", err)
+	}
+	if securityResult != rfb.SecurityResultOK {
+		reason, err := rfb.ReadSecurityFailureReason(c.conn)
+		if err != nil {
+			reason = fmt.Sprintf("result %d", securityResult)
+		}
+		return fmt.Errorf("%w: %s", ErrAuthFailed, reason)
+	}
+
+	// Send ClientInit with the shared flag
+	shared := byte(1)
+	if c.opts.Exclusive {
+		shared = 0
+	}
+	if _, err := c.conn.Write([]byte{shared}); err != nil {
+		return fmt.Errorf("failed to send client init: %v", err)
+	}
+
+	// Read ServerInit
+	serverInit, err := rfb.ReadServerInit(c.conn)
+	if err != nil {
+		return fmt.Errorf("failed to read server init: %v", err)
+	}
+
+	pf := serverInit.PixelFormat
+	c.reader = bufio.NewReader(countingReader{r: c.conn, bytes: &c.bytesRead})
+	c.connected = time.Now()
+	c.name = serverInit.Name
+	c.pixelFormat = pf
+	c.framebuffer = image.NewRGBA(image.Rect(0, 0, int(serverInit.Width), int(serverInit.Height)))
+
+	c.logf("Server: %s, %dx%d, %d bpp", serverInit.Name, serverInit.Width, serverInit.Height, pf.BitsPerPixel)
+	c.logf("Server pixel format: depth=%d, true-color=%d, endian=%s", pf.Depth, pf.TrueColorFlag, endianName(pf))
+	c.logf("Color maximums: R=%d G=%d B=%d, Shifts: R=%d G=%d B=%d",
+		pf.RedMax, pf.GreenMax, pf.BlueMax, pf.RedShift, pf.GreenShift, pf.BlueShift)
+
+	emit(c.opts, Event{Type: EventHandshake, Handshake: &HandshakeEvent{
+		Version:      strings.TrimSpace(serverVersion),
+		SecurityType: securityType,
+		Name:         serverInit.Name,
+		Width:        int(serverInit.Width),
+		Height:       int(serverInit.Height),
+		PixelFormat:  eventPixelFormat(pf),
+	}})
+	return nil
+}
+
+// chooseSecurityType picks VeNCrypt when enabled and offered, then VNC
+// Authentication when a password is set and the server offers it, otherwise None
+func (c *Client) chooseSecurityType(offered []uint8) (uint8, error) {
+	if c.opts.VeNCrypt && slices.Contains(offered, rfb.SecurityVeNCrypt) {
+		return rfb.SecurityVeNCrypt, nil
+	}
+	if c.opts.Password != "" && slices.Contains(offered, rfb.SecurityVNCAuth) {
+		return rfb.SecurityVNCAuth, nil
+	}
+	if slices.Contains(offered, rfb.SecurityNone) {
+		return rfb.SecurityNone, nil
+	}
+	if slices.Contains(offered, rfb.SecurityVNCAuth) {
+		return 0, fmt.Errorf("server requires VNC Authentication but no password was given")
+	}
+	if slices.Contains(offered, rfb.SecurityVeNCrypt) {
+		return 0, fmt.Errorf("server requires VeNCrypt but it is not enabled")
+	}
+	return 0, fmt.Errorf("no supported security type in %v", offered)
+}
+
+// authenticate answers the VNC Authentication challenge with the password
+func (c *Client) authenticate() error {
+	challenge := make([]byte, rfb.VNCAuthChallengeLength)
+	if _, err := io.ReadFull(c.conn, challenge); err != nil {
+		return fmt.Errorf("failed to read VNC auth challenge: %v", err)
+	}
+	response, err := rfb.EncryptVNCAuthChallenge(c.opts.Password, challenge)
+	if err != nil {
+		return err
+	}
+	if _, err := c.conn.Write(response); err != nil {
+		return fmt.Errorf("failed to send VNC auth response: %v", err)
+	}
+	c.logf("Sent VNC Authentication response")
+	return nil
+}
+
+// endianName describes a pixel format's byte order for logs
+func endianName(pf rfb.PixelFormat) string {
+	if pf.BigEndianFlag != 0 {
+		return "big"
+	}
+	return "little"
+}
+
+// Name returns the desktop name from ServerInit
+func (c *Client) Name() string {
+	return c.name
+}
+
+// Width returns the framebuffer width
+func (c *Client) Width() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.framebuffer.Rect.Dx()
+}
+
+// Height returns the framebuffer height
+func (c *Client) Height() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.framebuffer.Rect.Dy()
+}
+
+// FrameCount returns the number of FramebufferUpdates received
+func (c *Client) FrameCount() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.frameCount
+}
+
+// Close closes the connection to the server
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// write sends one complete message to the server
+func (c *Client) write(msg []byte) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	_, err := c.conn.Write(msg)
+	return err
+}
+
+// SetPixelFormat asks the server to send pixels in pf from now on
+func (c *Client) SetPixelFormat(pf rfb.PixelFormat) error {
+	if err := c.write(rfb.CreateSetPixelFormat(pf)); err != nil {
+		return fmt.Errorf("failed to send SetPixelFormat message: %v", err)
+	}
+	c.mutex.Lock()
+	c.pixelFormat = pf
+	c.mutex.Unlock()
+
+	c.logf("Sent SetPixelFormat: %d bpp, depth %d, %s-endian, true-color=%d",
+		pf.BitsPerPixel, pf.Depth, endianName(pf), pf.TrueColorFlag)
+	return nil
+}
+
+// SetEncodings tells the server which encodings to use, in preference order.
+// Rectangles in encodings without a decoder fail ReadMessage.
+func (c *Client) SetEncodings(encodings []int32) error {
+	if err := c.write(rfb.CreateSetEncodings(encodings)); err != nil {
+		return fmt.Errorf("failed to send SetEncodings message: %v", err)
+	}
+
+	names := make([]string, len(encodings))
+	for i, enc := range encodings {
+		names[i] = rfb.EncodingName(enc)
+	}
+	c.logf("Sent SetEncodings: %s", strings.Join(names, ", "))
+	return nil
+}
+
+// RequestUpdate asks for an update of the whole screen. Incremental requests
+// are answered when something changes.
+func (c *Client) RequestUpdate(incremental bool) error {
+	c.mutex.Lock()
+	screen := rfb.Rectangle{Width: uint16(c.framebuffer.Rect.Dx()), Height: uint16(c.framebuffer.Rect.Dy())}
+	c.mutex.Unlock()
+	c.requested()
+	return c.write(rfb.CreateFramebufferUpdateRequest(incremental, screen))
+}
+
+// Run requests a full update, then an incremental one every
+// Options.UpdateInterval while continuous updates are off, handling server
+// messages until ctx is done or the connection fails. It returns ctx's error
+// when ctx ends the run, and io.EOF when the server closes the connection.
+func (c *Client) Run(ctx context.Context) error {
+	if err := c.RequestUpdate(false); err != nil {
+		return fmt.Errorf("failed to request framebuffer update: %v", err)
+	}
+
+	// Unblock the reader when ctx ends
+	stop := context.AfterFunc(ctx, func() { c.conn.SetReadDeadline(time.Now()) })
+	defer stop()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(c.opts.UpdateInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if c.ContinuousUpdates() {
+					continue
+				}
+				if err := c.RequestUpdate(true); err != nil {
+					c.logf("Failed to request framebuffer update: %v", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for {
+		if err := c.ReadMessage(); err != nil {
+			if ctx.Err() != nil {
+				c.conn.SetReadDeadline(time.Time{})
+				return ctx.Err()
+			}
+			emitError(c.opts, err)
+			return err
+		}
+	}
+}
+
+// Screenshot requests a full update and returns a copy of the framebuffer
+// once it has been applied, with the cursor drawn as for OnFrame. Messages
+// arriving before the update are handled as in Run. It returns ctx's error if
+// ctx is done first.
+func (c *Client) Screenshot(ctx context.Context) (*image.RGBA, error) {
+	c.mutex.Lock()
+	frames := c.frameCount
+	c.mutex.Unlock()
+	if err := c.RequestUpdate(false); err != nil {
+		return nil, fmt.Errorf("failed to request framebuffer update: %v", err)
+	}
+
+	stop := context.AfterFunc(ctx, func() { c.conn.SetReadDeadline(time.Now()) })
+	defer stop()
+	for {
+		if err := c.ReadMessage(); err != nil {
+			if ctx.Err() != nil {
+				c.conn.SetReadDeadline(time.Time{})
+				err = ctx.Err()
+			}
+			// Unlike Run, ending without a frame is a failure however it happens
+			emitError(c.opts, err)
+			return nil, err
+		}
+
+		c.mutex.Lock()
+		if c.frameCount > frames {
+			frame := cloneRGBA(c.displayFrame())
+			c.mutex.Unlock()
+			return frame, nil
+		}
+		c.mutex.Unlock()
+	}
+}
+
+// ReadMessage reads and handles one message from the server
+func (c *Client) ReadMessage() error {
+	var messageType [1]byte
+	if _, err := io.ReadFull(c.reader, messageType[:]); err != nil {
+		return err
+	}
+
+	switch messageType[0] {
+	case rfb.FramebufferUpdate:
+		c.answered()
+		return c.handleFramebufferUpdate()
+	case rfb.SetColorMapEntries:
+		return c.handleSetColorMapEntries()
+	case rfb.Bell:
+		c.logf("Received Bell")
+		emit(c.opts, Event{Type: EventBell})
+		return nil
+	case rfb.ServerCutText:
+		return c.handleServerCutText()
+	case rfb.EndOfContinuousUpdates:
+		return c.handleEndOfContinuousUpdates()
+	default:
+		return fmt.Errorf("unknown message type: %d", messageType[0])
+	}
+}
+
+func (c *Client) handleSetColorMapEntries() error {
+	first, colors, err := rfb.ReadSetColorMapEntries(c.reader)
+	if err != nil {
+		return fmt.Errorf("failed to read SetColorMapEntries: %w", err)
+	}
+	c.mutex.Lock()
+	c.colorMap.Set(int(first), colors)
+	c.mutex.Unlock()
+
+	c.logf("Received SetColorMapEntries: %d colors from %d", len(colors), first)
+	return nil
+}
+
+func (c *Client) handleServerCutText() error {
+	header := make([]byte, 7) // Padding and length
+	if _, err := io.ReadFull(c.reader, header); err != nil {
+		return err
+	}
+	length := binary.BigEndian.Uint32(header[3:])
+	if length > rfb.MaxServerCutTextLength {
+		return fmt.Errorf("ServerCutText of %d bytes exceeds limit of %d", length, rfb.MaxServerCutTextLength)
+	}
+	text := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, text); err != nil {
+		return err
+	}
+
+	c.logf("Server cut text: %s", rfb.DecodeLatin1(text))
+	emit(c.opts, Event{Type: EventCutText, Text: rfb.DecodeLatin1(text)})
+	if c.opts.OnCutText != nil {
+		c.opts.OnCutText(rfb.DecodeLatin1(text))
+	}
+	return nil
+}
+
+// SendCutText sends text to the server's clipboard with ClientCutText.
+// Characters outside Latin-1 are sent as '?'.
+func (c *Client) SendCutText(text string) error {
+	if err := c.write(rfb.CreateClientCutText(text)); err != nil {
+		return fmt.Errorf("failed to send ClientCutText message: %v", err)
+	}
+	c.logf("Sent ClientCutText: %q", text)
+	return nil
+}
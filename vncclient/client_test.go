@@ -0,0 +1,307 @@
+package vncclient
+
+import (
+	"context"
+	"errors"
+	"image"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websockify/mockvnc"
+	"github.com/coder/websockify/rfb"
+)
+
+// connect starts a mock server and connects a client to it
+func connect(t *testing.T, serverOpts mockvnc.Options, opts Options) (*mockvnc.Server, *Client) {
+	t.Helper()
+	s := mockvnc.Start(t, serverOpts)
+	opts.Logf = t.Logf
+	c, err := Connect(context.Background(), s.Addr(), opts)
+	if err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return s, c
+}
+
+// checkFrame compares a decoded frame with the server's BGRA pixels, ignoring alpha
+func checkFrame(t *testing.T, got *image.RGBA, bgra []byte) {
+	t.Helper()
+	for i := 0; i < len(bgra); i += 4 {
+		p := got.Pix[i : i+4]
+		if p[0] != bgra[i+2] || p[1] != bgra[i+1] || p[2] != bgra[i] {
+			t.Fatalf("Pixel %d = %v, want BGRA %v", i/4, p[:3], bgra[i:i+4])
+		}
+	}
+}
+
+func TestConnectDecodesRaw(t *testing.T) {
+	s, c := connect(t, mockvnc.Options{Width: 32, Height: 24, Animation: "testcard", Name: "desk"}, Options{})
+
+	if c.Width() != 32 || c.Height() != 24 || c.Name() != "desk" {
+		t.Fatalf("Connected to %q at %dx%d, want %q at 32x24", c.Name(), c.Width(), c.Height(), "desk")
+	}
+	if err := c.RequestUpdate(false); err != nil {
+		t.Fatalf("RequestUpdate() error = %v", err)
+	}
+	if err := c.ReadMessage(); err != nil {
+		t.Fatalf("ReadMessage() error = %v", err)
+	}
+	if c.FrameCount() != 1 {
+		t.Errorf("FrameCount() = %d, want 1", c.FrameCount())
+	}
+	checkFrame(t, c.Snapshot(), s.Frame(0))
+}
+
+func TestEncodings(t *testing.T) {
+	// Every encoding the mock server can send
+	for _, enc := range rfb.SupportedEncodings() {
+		t.Run(rfb.EncodingName(enc), func(t *testing.T) {
+			s, c := connect(t, mockvnc.Options{Width: 40, Height: 20, Animation: "testcard"}, Options{Encodings: []int32{enc}})
+
+			// Two updates, so stateful decoders see more than one rectangle
+			for i := 0; i < 2; i++ {
+				if err := c.RequestUpdate(false); err != nil {
+					t.Fatalf("RequestUpdate() error = %v", err)
+				}
+				if err := c.ReadMessage(); err != nil {
+					t.Fatalf("ReadMessage() error = %v", err)
+				}
+			}
+			checkFrame(t, c.Snapshot(), s.Frame(0))
+		})
+	}
+}
+
+func TestResizeFromServer(t *testing.T) {
+	serverOpts := mockvnc.Options{
+		Width: 16, Height: 16, Animation: "testcard",
+		ResizeSizes: []mockvnc.Size{{Width: 24, Height: 8}}, ResizeInterval: 10 * time.Millisecond,
+	}
+	_, c := connect(t, serverOpts, Options{})
+
+	// Keep asking for the whole screen until the resize arrives
+	deadline := time.Now().Add(5 * time.Second)
+	for c.Width() != 24 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Size = %dx%d, want 24x8", c.Width(), c.Height())
+		}
+		if err := c.RequestUpdate(false); err != nil {
+			t.Fatalf("RequestUpdate() error = %v", err)
+		}
+		if err := c.ReadMessage(); err != nil {
+			t.Fatalf("ReadMessage() error = %v", err)
+		}
+	}
+
+	if c.Height() != 8 {
+		t.Errorf("Height() = %d, want 8", c.Height())
+	}
+	if frame := c.Snapshot(); frame.Rect.Dx() != 24 || frame.Rect.Dy() != 8 {
+		t.Errorf("Snapshot() size = %v, want 24x8", frame.Rect.Size())
+	}
+}
+
+func TestPixelFormat(t *testing.T) {
+	pf := rfb.RGB565PixelFormat()
+	_, c := connect(t, mockvnc.Options{Width: 8, Height: 8, Animation: "testcard"}, Options{PixelFormat: &pf})
+
+	c.RequestUpdate(false)
+	if err := c.ReadMessage(); err != nil {
+		t.Fatalf("ReadMessage() error = %v", err)
+	}
+	if p := c.Pixel(0, 0); p.A != 255 {
+		t.Errorf("Pixel(0, 0) = %v, want an opaque pixel", p)
+	}
+	if p := c.Pixel(8, 8); p.A != 0 {
+		t.Errorf("Pixel(8, 8) = %v, want transparent black outside the framebuffer", p)
+	}
+}
+
+func TestCapture(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "frames")
+	var seen int
+	_, c := connect(t, mockvnc.Options{Width: 16, Height: 16}, Options{
+		Capture: CaptureOptions{Dir: dir, Keep: true, Checkerboard: true},
+		OnFrame: func(frame *image.RGBA) { seen++ },
+	})
+
+	for i := 0; i < 2; i++ {
+		c.RequestUpdate(false)
+		if err := c.ReadMessage(); err != nil {
+			t.Fatalf("ReadMessage() error = %v", err)
+		}
+	}
+
+	if seen != 2 {
+		t.Errorf("OnFrame called %d times, want 2", seen)
+	}
+	if frames := c.Frames(); len(frames) != 2 {
+		t.Errorf("Frames() returned %d frames, want 2", len(frames))
+	}
+	for _, name := range []string{"frame_0001.png", "frame_0002.png"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("Captured frame %s missing: %v", name, err)
+		}
+	}
+}
+
+func TestRunStopsWithContext(t *testing.T) {
+	_, c := connect(t, mockvnc.Options{Width: 8, Height: 8}, Options{UpdateInterval: 10 * time.Millisecond})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if err := c.Run(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Run() = %v, want context.DeadlineExceeded", err)
+	}
+	if c.FrameCount() < 2 {
+		t.Errorf("FrameCount() = %d, want the full update and incremental ones", c.FrameCount())
+	}
+}
+
+func TestCutText(t *testing.T) {
+	received := make(chan string, 1)
+	_, c := connect(t, mockvnc.Options{Width: 8, Height: 8, ClipboardEcho: "upper"},
+		Options{OnCutText: func(text string) { received <- text }})
+
+	if err := c.SendCutText("hello"); err != nil {
+		t.Fatalf("SendCutText() error = %v", err)
+	}
+	if err := c.ReadMessage(); err != nil {
+		t.Fatalf("ReadMessage() error = %v", err)
+	}
+	select {
+	case text := <-received:
+		if text != "HELLO" {
+			t.Errorf("OnCutText() text = %q, want %q", text, "HELLO")
+		}
+	default:
+		t.Error("OnCutText was not called for the echoed ServerCutText")
+	}
+}
+
+func TestCutTextTooLong(t *testing.T) {
+	// Only the header is sent: the length alone must be refused, before
+	// anything is allocated for it
+	msg := []byte{rfb.ServerCutText, 0, 0, 0, 0xFF, 0xFF, 0xFF, 0xFF}
+	c := newTestClient(t, 1, 1, msg)
+	if err := c.ReadMessage(); err == nil || !strings.Contains(err.Error(), "exceeds limit") {
+		t.Errorf("ReadMessage() error = %v, want the ServerCutText refused", err)
+	}
+}
+
+func TestStats(t *testing.T) {
+	_, c := connect(t, mockvnc.Options{Width: 16, Height: 8}, Options{Encodings: []int32{rfb.RawEncoding}})
+
+	if err := c.RequestUpdate(false); err != nil {
+		t.Fatalf("RequestUpdate() error = %v", err)
+	}
+	if err := c.ReadMessage(); err != nil {
+		t.Fatalf("ReadMessage() error = %v", err)
+	}
+
+	st := c.Stats()
+	if st.Frames != 1 {
+		t.Errorf("Frames = %d, want 1", st.Frames)
+	}
+	if st.Bytes < 16*8*4 {
+		t.Errorf("Bytes = %d, want at least the %d bytes of raw pixels", st.Bytes, 16*8*4)
+	}
+	if len(st.Latencies) != 1 {
+		t.Errorf("Latencies = %v, want one for the answered request", st.Latencies)
+	}
+	if st.FPS() <= 0 || st.BytesPerSecond() <= 0 {
+		t.Errorf("FPS() = %v, BytesPerSecond() = %v, want positive rates", st.FPS(), st.BytesPerSecond())
+	}
+}
+
+func TestScreenshot(t *testing.T) {
+	s, c := connect(t, mockvnc.Options{Width: 32, Height: 24, Animation: "testcard"}, Options{})
+
+	frame, err := c.Screenshot(context.Background())
+	if err != nil {
+		t.Fatalf("Screenshot() error = %v", err)
+	}
+	if frame.Rect != image.Rect(0, 0, 32, 24) {
+		t.Errorf("Screenshot() size = %v, want 32x24", frame.Rect)
+	}
+	checkFrame(t, frame, s.Frame(0))
+	if c.FrameCount() != 1 {
+		t.Errorf("FrameCount() = %d, want 1", c.FrameCount())
+	}
+}
+
+func TestContinuousUpdates(t *testing.T) {
+	_, c := connect(t, mockvnc.Options{Width: 16, Height: 16, Animation: "plasma", FPS: 50},
+		Options{ContinuousUpdates: true, UpdateInterval: time.Hour})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	if err := c.Run(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Run() = %v, want context.DeadlineExceeded", err)
+	}
+	if !c.ContinuousUpdates() {
+		t.Error("ContinuousUpdates() = false, want true")
+	}
+	// Only the first update was requested; the rest were pushed by the server
+	st := c.Stats()
+	if st.Frames < 3 || len(st.Latencies) != 1 {
+		t.Errorf("Frames = %d with %d latencies, want pushed updates after one request", st.Frames, len(st.Latencies))
+	}
+	if len(st.Intervals) != st.Frames-1 {
+		t.Errorf("Intervals = %d, want %d", len(st.Intervals), st.Frames-1)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	var events []Event
+	s, c := connect(t, mockvnc.Options{Width: 16, Height: 8, Name: "desk", ClipboardEcho: "echo"},
+		Options{Encodings: []int32{rfb.RawEncoding}, OnEvent: func(ev Event) { events = append(events, ev) }})
+
+	c.RequestUpdate(false)
+	if err := c.ReadMessage(); err != nil {
+		t.Fatalf("ReadMessage() error = %v", err)
+	}
+	c.SendCutText("hello")
+	if err := c.ReadMessage(); err != nil {
+		t.Fatalf("ReadMessage() error = %v", err)
+	}
+	s.Bell()
+	if err := c.ReadMessage(); err != nil {
+		t.Fatalf("ReadMessage() error = %v", err)
+	}
+	s.Close()
+	if err := c.Run(context.Background()); err == nil {
+		t.Fatal("Run() error = nil after the server closed")
+	}
+
+	want := []string{EventHandshake, EventUpdate, EventRectangle, EventCutText, EventBell, EventError}
+	var types []string
+	for _, ev := range events {
+		types = append(types, ev.Type)
+	}
+	if !slices.Equal(types, want) {
+		t.Fatalf("Event types = %v, want %v", types, want)
+	}
+
+	hs := events[0].Handshake
+	if hs == nil || hs.Name != "desk" || hs.Width != 16 || hs.Height != 8 || hs.SecurityType != rfb.SecurityNone || hs.PixelFormat.BitsPerPixel != 32 {
+		t.Errorf("Handshake = %+v, want desk at 16x8 with no security and 32 bpp", hs)
+	}
+	if up := events[1].Update; up == nil || *up != (UpdateEvent{Frame: 1, Rectangles: 1}) {
+		t.Errorf("Update = %+v, want frame 1 with 1 rectangle", up)
+	}
+	if rect := events[2].Rectangle; rect == nil || *rect != (RectangleEvent{Width: 16, Height: 8, Encoding: "Raw"}) {
+		t.Errorf("Rectangle = %+v, want 16x8 Raw at (0,0)", rect)
+	}
+	if events[3].Text != "hello" {
+		t.Errorf("Cut text = %q, want %q", events[3].Text, "hello")
+	}
+	if events[5].Error == "" || events[5].Time.IsZero() {
+		t.Errorf("Error event = %+v, want an error message and time", events[5])
+	}
+}
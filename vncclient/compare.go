@@ -0,0 +1,69 @@
+package vncclient
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+)
+
+// FrameDiff describes how a frame differs from a reference image
+type FrameDiff struct {
+	Pixels   int         // Pixels with a colour component differing by more than the tolerance
+	MaxDelta uint8       // Largest difference of any colour component
+	First    image.Point // First differing pixel, in row order, when Pixels > 0
+}
+
+// Match reports whether no pixels differ
+func (d FrameDiff) Match() bool {
+	return d.Pixels == 0
+}
+
+// CompareFrames compares the red, green and blue components of got with want,
+// counting pixels where any component differs by more than tolerance. Alpha is
+// ignored, since the framebuffer has none. The images must be the same size.
+func CompareFrames(got, want image.Image, tolerance uint8) (FrameDiff, error) {
+	gb, wb := got.Bounds(), want.Bounds()
+	if gb.Size() != wb.Size() {
+		return FrameDiff{}, fmt.Errorf("frame is %dx%d, reference is %dx%d", gb.Dx(), gb.Dy(), wb.Dx(), wb.Dy())
+	}
+
+	var diff FrameDiff
+	for y := 0; y < gb.Dy(); y++ {
+		for x := 0; x < gb.Dx(); x++ {
+			g := color.RGBAModel.Convert(got.At(gb.Min.X+x, gb.Min.Y+y)).(color.RGBA)
+			w := color.RGBAModel.Convert(want.At(wb.Min.X+x, wb.Min.Y+y)).(color.RGBA)
+			delta := max(absDiff(g.R, w.R), absDiff(g.G, w.G), absDiff(g.B, w.B))
+			diff.MaxDelta = max(diff.MaxDelta, delta)
+			if delta > tolerance {
+				if diff.Pixels == 0 {
+					diff.First = image.Pt(x, y)
+				}
+				diff.Pixels++
+			}
+		}
+	}
+	return diff, nil
+}
+
+func absDiff(a, b uint8) uint8 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+// LoadPNG reads a PNG file, such as a reference frame for CompareFrames
+func LoadPNG(filename string) (image.Image, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	img, err := png.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %v", filename, err)
+	}
+	return img, nil
+}
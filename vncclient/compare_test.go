@@ -0,0 +1,68 @@
+package vncclient
+
+import (
+	"image"
+	"image/color"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompareFrames(t *testing.T) {
+	want := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	for i := range want.Pix {
+		want.Pix[i] = 100
+	}
+
+	tests := []struct {
+		name      string
+		change    map[image.Point]color.RGBA
+		tolerance uint8
+		want      FrameDiff
+	}{
+		{"identical", nil, 0, FrameDiff{}},
+		{"alpha ignored", map[image.Point]color.RGBA{{1, 1}: {100, 100, 100, 0}}, 0, FrameDiff{}},
+		{"within tolerance", map[image.Point]color.RGBA{{1, 1}: {103, 100, 97, 100}}, 3, FrameDiff{MaxDelta: 3}},
+		{
+			"outside tolerance",
+			map[image.Point]color.RGBA{{3, 0}: {100, 110, 100, 100}, {0, 1}: {90, 100, 100, 100}, {1, 1}: {101, 100, 100, 100}},
+			2,
+			FrameDiff{Pixels: 2, MaxDelta: 10, First: image.Pt(3, 0)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := cloneRGBA(want)
+			for p, c := range tt.change {
+				got.SetRGBA(p.X, p.Y, c)
+			}
+			diff, err := CompareFrames(got, want, tt.tolerance)
+			if err != nil {
+				t.Fatalf("CompareFrames() error = %v", err)
+			}
+			if diff != tt.want {
+				t.Errorf("CompareFrames() = %+v, want %+v", diff, tt.want)
+			}
+		})
+	}
+
+	if _, err := CompareFrames(image.NewRGBA(image.Rect(0, 0, 2, 2)), want, 0); err == nil {
+		t.Error("CompareFrames() with different sizes succeeded, want error")
+	}
+}
+
+func TestLoadPNG(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	img.SetRGBA(2, 1, color.RGBA{R: 255, A: 255})
+	filename := filepath.Join(t.TempDir(), "golden.png")
+	if err := SavePNG(filename, img); err != nil {
+		t.Fatalf("SavePNG() error = %v", err)
+	}
+
+	loaded, err := LoadPNG(filename)
+	if err != nil {
+		t.Fatalf("LoadPNG() error = %v", err)
+	}
+	if diff, err := CompareFrames(loaded, img, 0); err != nil || !diff.Match() {
+		t.Errorf("CompareFrames(loaded, saved) = %+v, %v, want a match", diff, err)
+	}
+}
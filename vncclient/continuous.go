@@ -0,0 +1,51 @@
+package vncclient
+
+import (
+	"fmt"
+
+	"github.com/coder/websockify/rfb"
+)
+
+// handleEndOfContinuousUpdates handles the server's announcement that it
+// supports continuous updates, enabling them for Options.ContinuousUpdates,
+// and its notice that it has stopped them, after which Run goes back to
+// requesting updates
+func (c *Client) handleEndOfContinuousUpdates() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.continuousUpdates {
+		c.continuousUpdates = false
+		c.logf("Server ended continuous updates; requesting updates every %s", c.opts.UpdateInterval)
+		return nil
+	}
+	if c.continuousSupported {
+		return nil
+	}
+	c.continuousSupported = true
+	c.logf("Server supports ContinuousUpdates")
+	if !c.opts.ContinuousUpdates {
+		return nil
+	}
+	return c.enableContinuousUpdates()
+}
+
+// enableContinuousUpdates asks the server to send updates of the whole screen
+// as it changes. Callers must hold c.mutex.
+func (c *Client) enableContinuousUpdates() error {
+	screen := rfb.Rectangle{Width: uint16(c.framebuffer.Rect.Dx()), Height: uint16(c.framebuffer.Rect.Dy())}
+	if err := c.write(rfb.CreateEnableContinuousUpdates(true, screen)); err != nil {
+		return fmt.Errorf("failed to send EnableContinuousUpdates message: %v", err)
+	}
+	c.continuousUpdates = true
+	c.logf("Enabled continuous updates for %dx%d", screen.Width, screen.Height)
+	return nil
+}
+
+// ContinuousUpdates reports whether the server is sending updates as the
+// screen changes rather than in answer to requests
+func (c *Client) ContinuousUpdates() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.continuousUpdates
+}
@@ -0,0 +1,49 @@
+package vncclient
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+
+	"github.com/coder/websockify/rfb"
+)
+
+// cursorState is the cursor shape from Cursor pseudo-rectangles and the
+// pointer position, which comes from PointerPos pseudo-rectangles or the
+// client's own PointerEvents
+type cursorState struct {
+	shape         *image.RGBA // Nil when the server has hidden the cursor or sent none
+	hotspot       image.Point
+	position      image.Point
+	positionKnown bool
+}
+
+// handleCursor reads a new cursor shape with its hotspot at (x, y). An empty
+// shape hides the cursor. Callers must hold c.mutex.
+func (c *Client) handleCursor(x, y, width, height int) error {
+	shape, err := rfb.ReadCursor(c.reader, width, height, c.decodeFormat())
+	if err != nil {
+		return fmt.Errorf("failed to read cursor: %w", err)
+	}
+	c.applyColorMap(shape)
+	if width == 0 || height == 0 {
+		shape = nil
+	}
+	c.cursor.shape, c.cursor.hotspot = shape, image.Pt(x, y)
+	return nil
+}
+
+// displayFrame returns the framebuffer as a user would see it: a copy with
+// the cursor drawn at the pointer position when there is one to draw, or the
+// framebuffer itself. Callers must hold c.mutex.
+func (c *Client) displayFrame() *image.RGBA {
+	cursor := c.cursor
+	if c.opts.HideCursor || cursor.shape == nil || !cursor.positionKnown {
+		return c.framebuffer
+	}
+
+	frame := cloneRGBA(c.framebuffer)
+	origin := cursor.position.Sub(cursor.hotspot)
+	draw.Draw(frame, cursor.shape.Rect.Add(origin), cursor.shape, image.Point{}, draw.Over)
+	return frame
+}
@@ -0,0 +1,64 @@
+package vncclient
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/coder/websockify/rfb"
+)
+
+// dial opens a connection to addr: a host:port for plain RFB, a unix:// URL
+// for a unix socket, or a ws:// or wss:// URL for RFB over WebSocket, as
+// through websockify. With Options.TLS a host:port or unix socket connection is
+// wrapped in TLS before the RFB handshake.
+func dial(ctx context.Context, addr string, opts Options) (net.Conn, error) {
+	if strings.HasPrefix(addr, "ws://") || strings.HasPrefix(addr, "wss://") {
+		if opts.TLS && strings.HasPrefix(addr, "ws://") {
+			return nil, fmt.Errorf("use a wss:// URL for TLS over WebSocket")
+		}
+		return rfb.DialWebSocketTLS(ctx, addr, nil, opts.TLSConfig)
+	}
+
+	network := "tcp"
+	if path, ok := strings.CutPrefix(addr, "unix://"); ok {
+		network, addr = "unix", path
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, addr)
+	if err != nil || !opts.TLS {
+		return conn, err
+	}
+	tlsConn := tls.Client(conn, tlsConfig(opts.TLSConfig))
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("TLS handshake failed: %v", err)
+	}
+	return tlsConn, nil
+}
+
+// withServerName returns config, or an empty configuration, set to verify the
+// certificate against the host of a host:port addr unless it names a server
+// already. The WebSocket dialer does the same for URLs.
+func withServerName(config *tls.Config, addr string) *tls.Config {
+	if strings.Contains(addr, "://") || config != nil && (config.ServerName != "" || config.InsecureSkipVerify) {
+		return config
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return config
+	}
+	config = tlsConfig(config).Clone()
+	config.ServerName = host
+	return config
+}
+
+// tlsConfig returns config, or an empty configuration using the system roots when nil
+func tlsConfig(config *tls.Config) *tls.Config {
+	if config == nil {
+		return &tls.Config{}
+	}
+	return config
+}
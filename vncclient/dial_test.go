@@ -0,0 +1,89 @@
+package vncclient
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/coder/websockify"
+	"github.com/coder/websockify/mockvnc"
+)
+
+func TestConnectThroughWebsockify(t *testing.T) {
+	vnc := mockvnc.Start(t, mockvnc.Options{Width: 16, Height: 8, Animation: "testcard"})
+	proxy := httptest.NewServer(websockify.New(websockify.Config{Target: vnc.Addr(), Logger: &websockify.NoOpLogger{}}))
+	defer proxy.Close()
+
+	url := "ws://" + strings.TrimPrefix(proxy.URL, "http://") + "/websockify"
+	c, err := Connect(context.Background(), url, Options{Logf: t.Logf})
+	if err != nil {
+		t.Fatalf("Connect(%q) error = %v", url, err)
+	}
+	defer c.Close()
+
+	c.RequestUpdate(false)
+	if err := c.ReadMessage(); err != nil {
+		t.Fatalf("ReadMessage() error = %v", err)
+	}
+	checkFrame(t, c.Snapshot(), vnc.Frame(0))
+}
+
+func TestConnectWebSocketServer(t *testing.T) {
+	vnc := mockvnc.Start(t, mockvnc.Options{Width: 8, Height: 8, WebSocket: true})
+
+	c, err := Connect(context.Background(), "ws://"+vnc.Addr()+"/", Options{Logf: t.Logf})
+	if err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer c.Close()
+	if c.Width() != 8 {
+		t.Errorf("Width() = %d, want 8", c.Width())
+	}
+}
+
+func TestConnectThroughWebsockifyTLS(t *testing.T) {
+	vnc := mockvnc.Start(t, mockvnc.Options{Width: 8, Height: 8})
+	proxy := httptest.NewTLSServer(websockify.New(websockify.Config{Target: vnc.Addr(), Logger: &websockify.NoOpLogger{}}))
+	defer proxy.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(proxy.Certificate())
+	url := "wss://" + strings.TrimPrefix(proxy.URL, "https://") + "/websockify"
+	c, err := Connect(context.Background(), url, Options{TLSConfig: &tls.Config{RootCAs: roots}, Logf: t.Logf})
+	if err != nil {
+		t.Fatalf("Connect(%q) error = %v", url, err)
+	}
+	defer c.Close()
+
+	if _, err := Connect(context.Background(), url, Options{Logf: t.Logf}); err == nil {
+		t.Errorf("Connect(%q) without the proxy's certificate succeeded, want error", url)
+	}
+}
+
+func TestConnectUnixSocket(t *testing.T) {
+	vnc, err := mockvnc.New(mockvnc.Options{Width: 8, Height: 8, Logf: t.Logf})
+	if err != nil {
+		t.Fatalf("mockvnc.New() error = %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "vnc.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	go vnc.Serve(listener)
+	defer vnc.Close()
+
+	c, err := Connect(context.Background(), "unix://"+path, Options{Logf: t.Logf})
+	if err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer c.Close()
+	if c.Width() != 8 {
+		t.Errorf("Width() = %d, want 8", c.Width())
+	}
+}
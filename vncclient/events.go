@@ -0,0 +1,99 @@
+package vncclient
+
+import (
+	"time"
+
+	"github.com/coder/websockify/rfb"
+)
+
+// Event types passed to Options.OnEvent
+const (
+	EventHandshake = "handshake" // The handshake completed; Handshake is set
+	EventUpdate    = "update"    // A FramebufferUpdate started; Update is set
+	EventRectangle = "rectangle" // A rectangle of the current update is about to be read; Rectangle is set
+	EventCutText   = "cut_text"  // ServerCutText arrived; Text is set
+	EventBell      = "bell"      // Bell arrived
+	EventError     = "error"     // The connection, handshake or a message failed; Error is set
+)
+
+// Event is one thing that happened on the connection. Only the fields for
+// its Type are set.
+type Event struct {
+	Time time.Time `json:"time"`
+	Type string    `json:"type"`
+
+	Handshake *HandshakeEvent `json:"handshake,omitempty"`
+	Update    *UpdateEvent    `json:"update,omitempty"`
+	Rectangle *RectangleEvent `json:"rectangle,omitempty"`
+	Text      string          `json:"text,omitempty"`
+	Error     string          `json:"error,omitempty"`
+}
+
+// HandshakeEvent describes the server as the handshake left it
+type HandshakeEvent struct {
+	Version      string           `json:"version"`       // Server's RFB version, such as "RFB 003.008"
+	SecurityType uint8            `json:"security_type"` // Security type chosen
+	Name         string           `json:"name"`
+	Width        int              `json:"width"`
+	Height       int              `json:"height"`
+	PixelFormat  EventPixelFormat `json:"pixel_format"` // Server's pixel format from ServerInit
+}
+
+// EventPixelFormat is an rfb.PixelFormat in an Event
+type EventPixelFormat struct {
+	BitsPerPixel uint8  `json:"bits_per_pixel"`
+	Depth        uint8  `json:"depth"`
+	BigEndian    bool   `json:"big_endian"`
+	TrueColor    bool   `json:"true_color"`
+	RedMax       uint16 `json:"red_max"`
+	GreenMax     uint16 `json:"green_max"`
+	BlueMax      uint16 `json:"blue_max"`
+	RedShift     uint8  `json:"red_shift"`
+	GreenShift   uint8  `json:"green_shift"`
+	BlueShift    uint8  `json:"blue_shift"`
+}
+
+// UpdateEvent describes a FramebufferUpdate header
+type UpdateEvent struct {
+	Frame      int `json:"frame"`      // Number of the update, counting from 1
+	Rectangles int `json:"rectangles"` // Rectangles that follow, including pseudo-rectangles
+}
+
+// RectangleEvent describes a rectangle header, including pseudo-rectangles
+// such as DesktopSize and Cursor
+type RectangleEvent struct {
+	X        int    `json:"x"`
+	Y        int    `json:"y"`
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+	Encoding string `json:"encoding"` // Name from rfb.EncodingName
+}
+
+// eventPixelFormat converts pf for an Event
+func eventPixelFormat(pf rfb.PixelFormat) EventPixelFormat {
+	return EventPixelFormat{
+		BitsPerPixel: pf.BitsPerPixel,
+		Depth:        pf.Depth,
+		BigEndian:    pf.BigEndianFlag != 0,
+		TrueColor:    pf.TrueColorFlag != 0,
+		RedMax:       pf.RedMax,
+		GreenMax:     pf.GreenMax,
+		BlueMax:      pf.BlueMax,
+		RedShift:     pf.RedShift,
+		GreenShift:   pf.GreenShift,
+		BlueShift:    pf.BlueShift,
+	}
+}
+
+// emit passes ev to Options.OnEvent, if set, stamped with the current time
+func emit(opts Options, ev Event) {
+	if opts.OnEvent != nil {
+		ev.Time = time.Now()
+		opts.OnEvent(ev)
+	}
+}
+
+// emitError reports err as an EventError
+func emitError(opts Options, err error) {
+	emit(opts, Event{Type: EventError, Error: err.Error()})
+}
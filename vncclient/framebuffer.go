@@ -0,0 +1,211 @@
+package vncclient
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"time"
+
+	"github.com/coder/websockify/rfb"
+)
+
+func (c *Client) handleFramebufferUpdate() error {
+	header := make([]byte, 3) // Padding and number of rectangles
+	if _, err := io.ReadFull(c.reader, header); err != nil {
+		return err
+	}
+	numRects := binary.BigEndian.Uint16(header[1:])
+	c.logf("Framebuffer update: %d rectangles", numRects)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	emit(c.opts, Event{Type: EventUpdate, Update: &UpdateEvent{Frame: c.frameCount + 1, Rectangles: int(numRects)}})
+
+	for i := uint16(0); i < numRects; i++ {
+		rectHeader := make([]byte, 12)
+		if _, err := io.ReadFull(c.reader, rectHeader); err != nil {
+			return err
+		}
+		x := int(binary.BigEndian.Uint16(rectHeader[0:]))
+		y := int(binary.BigEndian.Uint16(rectHeader[2:]))
+		width := int(binary.BigEndian.Uint16(rectHeader[4:]))
+		height := int(binary.BigEndian.Uint16(rectHeader[6:]))
+		encoding := int32(binary.BigEndian.Uint32(rectHeader[8:]))
+
+		c.logf("Rectangle %d: %dx%d at (%d,%d), encoding %s", i, width, height, x, y, rfb.EncodingName(encoding))
+		emit(c.opts, Event{Type: EventRectangle, Rectangle: &RectangleEvent{
+			X: x, Y: y, Width: width, Height: height, Encoding: rfb.EncodingName(encoding),
+		}})
+
+		if encoding == rfb.DesktopSizeEncoding {
+			c.resize(width, height)
+			continue
+		}
+		if encoding == rfb.CursorEncoding {
+			if err := c.handleCursor(x, y, width, height); err != nil {
+				return err
+			}
+			continue
+		}
+		if encoding == rfb.PointerPosEncoding {
+			c.cursor.position, c.cursor.positionKnown = image.Pt(x, y), true
+			continue
+		}
+		if encoding == rfb.CopyRectEncoding {
+			if err := c.copyRect(image.Rect(x, y, x+width, y+height)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// The length of a rectangle depends on its encoding, so one that
+		// cannot be decoded leaves the rest of the stream unreadable
+		decoder := c.decoder(encoding)
+		if decoder == nil {
+			return fmt.Errorf("unsupported encoding %s", rfb.EncodingName(encoding))
+		}
+		start := time.Now()
+		img, err := decoder.Decode(c.reader, width, height, c.decodeFormat())
+		c.decodeTime += time.Since(start)
+		if err != nil {
+			return fmt.Errorf("failed to decode %s rectangle: %w", rfb.EncodingName(encoding), err)
+		}
+		c.applyColorMap(img)
+		draw.Draw(c.framebuffer, image.Rect(x, y, x+width, y+height), img, image.Point{}, draw.Src)
+	}
+
+	c.frameCount++
+	if err := c.captureFrame(); err != nil {
+		c.logf("Failed to save frame: %v", err)
+	}
+	if c.opts.OnFrame != nil {
+		c.opts.OnFrame(c.displayFrame())
+	}
+	return nil
+}
+
+// resize replaces the framebuffer with one of the new size, keeping the
+// pixels both sizes share until the server redraws them. Callers must hold c.mutex.
+func (c *Client) resize(width, height int) {
+	old := c.framebuffer
+	c.framebuffer = image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(c.framebuffer, old.Rect, old, image.Point{}, draw.Src)
+
+	c.logf("Framebuffer resized from %dx%d to %dx%d", old.Rect.Dx(), old.Rect.Dy(), width, height)
+	if c.opts.OnResize != nil {
+		c.opts.OnResize(width, height)
+	}
+	if c.continuousUpdates {
+		// Cover the new screen, which may be larger than the region enabled before
+		if err := c.enableContinuousUpdates(); err != nil {
+			c.logf("Failed to enable continuous updates after resize: %v", err)
+		}
+	}
+}
+
+// copyRect reads a CopyRect source position and copies that area of the
+// framebuffer to rect. Callers must hold c.mutex.
+func (c *Client) copyRect(rect image.Rectangle) error {
+	srcX, srcY, err := rfb.ReadCopyRect(c.reader)
+	if err != nil {
+		return err
+	}
+	src := rect.Sub(rect.Min).Add(image.Pt(int(srcX), int(srcY)))
+	if !src.In(c.framebuffer.Rect) || !rect.In(c.framebuffer.Rect) {
+		return fmt.Errorf("CopyRect from %v to %v is outside the %dx%d framebuffer",
+			src, rect, c.framebuffer.Rect.Dx(), c.framebuffer.Rect.Dy())
+	}
+	// draw handles the overlap when scrolling within one image
+	draw.Draw(c.framebuffer, rect, c.framebuffer, src.Min, draw.Src)
+	return nil
+}
+
+// decoder returns the connection's decoder for an encoding, creating it on
+// first use, or nil when the encoding is not supported. Callers must hold c.mutex.
+func (c *Client) decoder(encoding int32) rfb.Decoder {
+	if d, ok := c.decoders[encoding]; ok {
+		return d
+	}
+	d := rfb.NewDecoder(encoding)
+	if d != nil {
+		c.decoders[encoding] = d
+	}
+	return d
+}
+
+// decodeFormat returns the pixel format to decode rectangles with: the
+// negotiated one, or for a colour map format one giving each pixel's index.
+// Callers must hold c.mutex.
+func (c *Client) decodeFormat() rfb.PixelFormat {
+	if c.pixelFormat.TrueColorFlag == 0 {
+		return rfb.IndexPixelFormat(c.pixelFormat)
+	}
+	return c.pixelFormat
+}
+
+// applyColorMap turns an image decoded with decodeFormat into colours.
+// Callers must hold c.mutex.
+func (c *Client) applyColorMap(img *image.RGBA) {
+	if c.pixelFormat.TrueColorFlag == 0 {
+		c.colorMap.Apply(img, img.Rect)
+	}
+}
+
+// Snapshot returns a copy of the current framebuffer
+func (c *Client) Snapshot() *image.RGBA {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return cloneRGBA(c.framebuffer)
+}
+
+// Pixel returns the color at the given coordinates, or transparent black
+// outside the framebuffer
+func (c *Client) Pixel(x, y int) color.RGBA {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.framebuffer.RGBAAt(x, y)
+}
+
+// cloneRGBA returns a copy of img
+func cloneRGBA(img *image.RGBA) *image.RGBA {
+	clone := image.NewRGBA(img.Rect)
+	copy(clone.Pix, img.Pix)
+	return clone
+}
+
+// Checkerboard composites img over a gray checkerboard, as image editors show
+// transparency, keeping img's alpha channel
+func Checkerboard(img *image.RGBA) *image.RGBA {
+	composite := image.NewRGBA(img.Rect)
+
+	// Checkerboard square size and light and dark gray colors
+	const squareSize = 20
+	lightGray := color.RGBA{240, 240, 240, 255}
+	darkGray := color.RGBA{200, 200, 200, 255}
+
+	bounds := img.Rect
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			bgColor := lightGray
+			if (x/squareSize+y/squareSize)%2 != 0 {
+				bgColor = darkGray
+			}
+
+			// Alpha blend the framebuffer pixel over the checkerboard
+			fbPixel := img.RGBAAt(x, y)
+			alpha := float64(fbPixel.A) / 255.0
+			invAlpha := 1.0 - alpha
+
+			composite.SetRGBA(x, y, color.RGBA{
+				R: uint8(float64(fbPixel.R)*alpha + float64(bgColor.R)*invAlpha),
+				G: uint8(float64(fbPixel.G)*alpha + float64(bgColor.G)*invAlpha),
+				B: uint8(float64(fbPixel.B)*alpha + float64(bgColor.B)*invAlpha),
+				A: fbPixel.A,
+			})
+		}
+	}
+	return composite
+}
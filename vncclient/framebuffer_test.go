@@ -0,0 +1,157 @@
+package vncclient
+
+import (
+	"bufio"
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"github.com/coder/websockify/rfb"
+)
+
+// newTestClient returns a client with a width x height framebuffer that reads
+// server messages from data
+func newTestClient(t *testing.T, width, height int, data []byte) *Client {
+	return &Client{
+		reader:      bufio.NewReader(bytes.NewReader(data)),
+		opts:        Options{Logf: t.Logf},
+		decoders:    make(map[int32]rfb.Decoder),
+		framebuffer: image.NewRGBA(image.Rect(0, 0, width, height)),
+		pixelFormat: rfb.DefaultPixelFormat(),
+	}
+}
+
+// updateMessage builds a FramebufferUpdate from complete rectangles
+func updateMessage(rects ...[]byte) []byte {
+	msg := rfb.CreateFramebufferUpdateHeader(uint16(len(rects)))
+	for _, r := range rects {
+		msg = append(msg, r...)
+	}
+	return msg
+}
+
+func TestCopyRect(t *testing.T) {
+	// Fill a 4x4 framebuffer with a different colour per row, then scroll it
+	// up by one row with an overlapping CopyRect
+	screen := rfb.Rectangle{Width: 4, Height: 4}
+	bgra := make([]byte, 4*4*4)
+	for i := range 16 {
+		copy(bgra[i*4:], []byte{0, 0, byte(i / 4 * 60), 255})
+	}
+	raw := append(rfb.CreateRectangleHeader(screen, rfb.RawEncoding), bgra...)
+	scroll := rfb.CreateCopyRect(rfb.Rectangle{Width: 4, Height: 3}, 0, 1)
+
+	c := newTestClient(t, 4, 4, append(updateMessage(raw), updateMessage(scroll)...))
+	for i := 0; i < 2; i++ {
+		if err := c.ReadMessage(); err != nil {
+			t.Fatalf("ReadMessage() error = %v", err)
+		}
+	}
+
+	for y := 0; y < 4; y++ {
+		want := color.RGBA{R: byte(min(y+1, 3) * 60), A: 255}
+		if got := c.Pixel(2, y); got != want {
+			t.Errorf("Pixel(2, %d) = %v, want %v", y, got, want)
+		}
+	}
+}
+
+func TestCopyRectOutOfBounds(t *testing.T) {
+	copyRect := rfb.CreateCopyRect(rfb.Rectangle{Width: 4, Height: 4}, 1, 0)
+	c := newTestClient(t, 4, 4, updateMessage(copyRect))
+	if err := c.ReadMessage(); err == nil {
+		t.Error("ReadMessage() with a CopyRect source outside the framebuffer succeeded, want error")
+	}
+}
+
+func TestDesktopSize(t *testing.T) {
+	// Grow from 4x4 to 6x2, then draw over the new area
+	resize := rfb.CreateDesktopSizeRectangle(6, 2)
+	raw := append(rfb.CreateRectangleHeader(rfb.Rectangle{X: 4, Width: 2, Height: 2}, rfb.RawEncoding),
+		bytes.Repeat([]byte{255, 0, 0, 255}, 4)...)
+
+	c := newTestClient(t, 4, 4, updateMessage(resize, raw))
+	var resized []image.Point
+	c.opts.OnResize = func(width, height int) { resized = append(resized, image.Pt(width, height)) }
+	if err := c.ReadMessage(); err != nil {
+		t.Fatalf("ReadMessage() error = %v", err)
+	}
+
+	if c.Width() != 6 || c.Height() != 2 {
+		t.Errorf("Size = %dx%d, want 6x2", c.Width(), c.Height())
+	}
+	if len(resized) != 1 || resized[0] != image.Pt(6, 2) {
+		t.Errorf("OnResize calls = %v, want [(6,2)]", resized)
+	}
+	if got, want := c.Pixel(5, 1), (color.RGBA{B: 255, A: 255}); got != want {
+		t.Errorf("Pixel(5, 1) = %v, want %v", got, want)
+	}
+}
+
+func TestCursor(t *testing.T) {
+	// A 2x2 cursor with its hotspot at (1,1) and only the diagonal opaque,
+	// placed with its hotspot at (2,2) on a black framebuffer
+	shape := []byte{
+		0, 0, 255, 255, 0, 0, 0, 0,
+		0, 0, 0, 0, 0, 0, 255, 255,
+	}
+	cursor := rfb.CreateCursorRectangle(1, 1, 2, 2, shape, rfb.DefaultPixelFormat())
+	pointer := rfb.CreateRectangleHeader(rfb.Rectangle{X: 2, Y: 2}, rfb.PointerPosEncoding)
+	black := color.RGBA{A: 255}
+	red := color.RGBA{R: 255, A: 255}
+
+	tests := []struct {
+		name       string
+		hideCursor bool
+		want       map[image.Point]color.RGBA
+	}{
+		{"shown", false, map[image.Point]color.RGBA{{1, 1}: red, {2, 1}: black, {1, 2}: black, {2, 2}: red}},
+		{"hidden", true, map[image.Point]color.RGBA{{1, 1}: black, {2, 2}: black}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestClient(t, 4, 4, updateMessage(cursor, pointer))
+			draw.Draw(c.framebuffer, c.framebuffer.Rect, image.NewUniform(black), image.Point{}, draw.Src)
+			c.opts.HideCursor = tt.hideCursor
+			c.opts.Capture.Keep = true
+			if err := c.ReadMessage(); err != nil {
+				t.Fatalf("ReadMessage() error = %v", err)
+			}
+
+			frames := c.Frames()
+			if len(frames) != 1 {
+				t.Fatalf("Frames() = %d frames, want 1", len(frames))
+			}
+			for p, want := range tt.want {
+				if got := frames[0].RGBAAt(p.X, p.Y); got != want {
+					t.Errorf("captured pixel %v = %v, want %v", p, got, want)
+				}
+			}
+			if got := c.Pixel(1, 1); got != black {
+				t.Errorf("Pixel(1, 1) = %v, want the framebuffer without the cursor %v", got, black)
+			}
+		})
+	}
+}
+
+func TestColorMap(t *testing.T) {
+	// An 8bpp colour map format: the colours arrive first, then a rectangle of indices
+	colors := rfb.CreateSetColorMapEntries(1, []color.RGBA{{R: 255, A: 255}, {B: 255, A: 255}})
+	raw := append(rfb.CreateRectangleHeader(rfb.Rectangle{Width: 2, Height: 1}, rfb.RawEncoding), 1, 2)
+
+	c := newTestClient(t, 2, 1, append(colors, updateMessage(raw)...))
+	c.pixelFormat = rfb.PixelFormat{BitsPerPixel: 8, Depth: 8}
+	for i := 0; i < 2; i++ {
+		if err := c.ReadMessage(); err != nil {
+			t.Fatalf("ReadMessage() error = %v", err)
+		}
+	}
+
+	for x, want := range []color.RGBA{{R: 255, A: 255}, {B: 255, A: 255}} {
+		if got := c.Pixel(x, 0); got != want {
+			t.Errorf("Pixel(%d, 0) = %v, want %v", x, got, want)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package vncclient
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"io"
+	"slices"
+	"time"
+)
+
+// gifSamplePixels bounds the pixels sampled across all frames to build the palette
+const gifSamplePixels = 1 << 20
+
+// EncodeGIF writes frames as a looping animated GIF showing each for delay,
+// which GIF rounds to hundredths of a second. The frames share one palette of
+// up to 256 colours chosen by median cut, and each pixel takes the nearest of
+// them without dithering, which suits desktop content. Frames of different
+// sizes are placed at the top-left of a canvas large enough for all of them.
+func EncodeGIF(w io.Writer, frames []*image.RGBA, delay time.Duration) error {
+	if len(frames) == 0 {
+		return fmt.Errorf("no frames to encode")
+	}
+
+	palette := quantize(frames, 256)
+	var bounds image.Rectangle
+	for _, frame := range frames {
+		bounds = bounds.Union(image.Rectangle{Max: frame.Rect.Size()})
+	}
+
+	anim := &gif.GIF{
+		Config: image.Config{ColorModel: palette, Width: bounds.Dx(), Height: bounds.Dy()},
+	}
+	centiseconds := max(int(delay/(10*time.Millisecond)), 1)
+	nearest := make(map[color.RGBA]uint8)
+	for _, frame := range frames {
+		paletted := image.NewPaletted(image.Rectangle{Max: frame.Rect.Size()}, palette)
+		for y := 0; y < frame.Rect.Dy(); y++ {
+			for x := 0; x < frame.Rect.Dx(); x++ {
+				c := frame.RGBAAt(frame.Rect.Min.X+x, frame.Rect.Min.Y+y)
+				c.A = 255
+				index, ok := nearest[c]
+				if !ok {
+					index = uint8(palette.Index(c))
+					nearest[c] = index
+				}
+				paletted.SetColorIndex(x, y, index)
+			}
+		}
+		anim.Image = append(anim.Image, paletted)
+		anim.Delay = append(anim.Delay, centiseconds)
+	}
+	return gif.EncodeAll(w, anim)
+}
+
+// colorCount is a colour and how often it was sampled
+type colorCount struct {
+	rgb   [3]uint8
+	count int
+}
+
+// quantize chooses up to n colours representing the frames by median cut:
+// the sampled colours are split repeatedly at the weighted median of the
+// widest channel of the box with the largest range, and each final box
+// contributes its weighted mean colour
+func quantize(frames []*image.RGBA, n int) color.Palette {
+	total := 0
+	for _, frame := range frames {
+		total += frame.Rect.Dx() * frame.Rect.Dy()
+	}
+	step := max(total/gifSamplePixels, 1)
+
+	counts := make(map[[3]uint8]int)
+	i := 0
+	for _, frame := range frames {
+		for y := frame.Rect.Min.Y; y < frame.Rect.Max.Y; y++ {
+			for x := frame.Rect.Min.X; x < frame.Rect.Max.X; x++ {
+				if i%step == 0 {
+					c := frame.RGBAAt(x, y)
+					counts[[3]uint8{c.R, c.G, c.B}]++
+				}
+				i++
+			}
+		}
+	}
+	colors := make([]colorCount, 0, len(counts))
+	for rgb, count := range counts {
+		colors = append(colors, colorCount{rgb, count})
+	}
+
+	boxes := []colorBox{newColorBox(colors)}
+	for len(boxes) < n {
+		widest := 0
+		for b := range boxes {
+			if boxes[b].spread > boxes[widest].spread {
+				widest = b
+			}
+		}
+		if boxes[widest].spread == 0 {
+			break
+		}
+
+		box, channel := boxes[widest].colors, boxes[widest].channel
+		slices.SortFunc(box, func(a, b colorCount) int { return int(a.rgb[channel]) - int(b.rgb[channel]) })
+		weight := 0
+		for _, c := range box {
+			weight += c.count
+		}
+		split, seen := 1, 0
+		for j, c := range box[:len(box)-1] {
+			seen += c.count
+			split = j + 1
+			if seen*2 >= weight {
+				break
+			}
+		}
+		boxes[widest] = newColorBox(box[:split])
+		boxes = append(boxes, newColorBox(box[split:]))
+	}
+
+	palette := make(color.Palette, 0, len(boxes))
+	for _, box := range boxes {
+		var r, g, b, weight int
+		for _, c := range box.colors {
+			r += int(c.rgb[0]) * c.count
+			g += int(c.rgb[1]) * c.count
+			b += int(c.rgb[2]) * c.count
+			weight += c.count
+		}
+		if weight == 0 {
+			continue
+		}
+		palette = append(palette, color.RGBA{uint8(r / weight), uint8(g / weight), uint8(b / weight), 255})
+	}
+	return palette
+}
+
+// colorBox is a set of colours for median cut with its widest channel
+type colorBox struct {
+	colors  []colorCount
+	channel int // Channel with the largest range
+	spread  int // Range of that channel
+}
+
+func newColorBox(colors []colorCount) colorBox {
+	box := colorBox{colors: colors}
+	for ch := 0; ch < 3; ch++ {
+		lo, hi := uint8(255), uint8(0)
+		for _, c := range colors {
+			lo, hi = min(lo, c.rgb[ch]), max(hi, c.rgb[ch])
+		}
+		if r := int(hi) - int(lo); r > box.spread {
+			box.channel, box.spread = ch, r
+		}
+	}
+	return box
+}
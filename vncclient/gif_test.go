@@ -0,0 +1,76 @@
+package vncclient
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"testing"
+	"time"
+)
+
+func TestEncodeGIF(t *testing.T) {
+	// Two frames with four colours, the second larger, as after a resize
+	small := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	large := image.NewRGBA(image.Rect(0, 0, 6, 3))
+	colors := []color.RGBA{{255, 0, 0, 255}, {0, 255, 0, 255}, {0, 0, 255, 255}, {10, 20, 30, 255}}
+	for _, frame := range []*image.RGBA{small, large} {
+		for y := 0; y < frame.Rect.Dy(); y++ {
+			for x := 0; x < frame.Rect.Dx(); x++ {
+				frame.SetRGBA(x, y, colors[(x+y)%len(colors)])
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := EncodeGIF(&buf, []*image.RGBA{small, large}, 250*time.Millisecond); err != nil {
+		t.Fatalf("EncodeGIF() error = %v", err)
+	}
+	anim, err := gif.DecodeAll(&buf)
+	if err != nil {
+		t.Fatalf("gif.DecodeAll() error = %v", err)
+	}
+
+	if anim.Config.Width != 6 || anim.Config.Height != 3 {
+		t.Errorf("GIF size = %dx%d, want 6x3", anim.Config.Width, anim.Config.Height)
+	}
+	if len(anim.Image) != 2 || anim.Delay[0] != 25 || anim.Delay[1] != 25 {
+		t.Fatalf("GIF has %d frames with delays %v, want 2 frames of 25", len(anim.Image), anim.Delay)
+	}
+	for i, want := range []*image.RGBA{small, large} {
+		if diff, err := CompareFrames(anim.Image[i], want, 0); err != nil || !diff.Match() {
+			t.Errorf("frame %d: CompareFrames() = %+v, %v, want an exact match", i, diff, err)
+		}
+	}
+}
+
+func TestEncodeGIFQuantizes(t *testing.T) {
+	// A gradient with far more than 256 colours
+	frame := image.NewRGBA(image.Rect(0, 0, 256, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 256; x++ {
+			frame.SetRGBA(x, y, color.RGBA{uint8(x), uint8(y * 4), uint8(255 - x), 255})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := EncodeGIF(&buf, []*image.RGBA{frame}, time.Second); err != nil {
+		t.Fatalf("EncodeGIF() error = %v", err)
+	}
+	anim, err := gif.DecodeAll(&buf)
+	if err != nil {
+		t.Fatalf("gif.DecodeAll() error = %v", err)
+	}
+	if n := len(anim.Image[0].Palette); n != 256 {
+		t.Errorf("palette has %d colours, want 256", n)
+	}
+	if diff, err := CompareFrames(anim.Image[0], frame, 16); err != nil || !diff.Match() {
+		t.Errorf("CompareFrames() = %+v, %v, want every pixel within 16", diff, err)
+	}
+}
+
+func TestEncodeGIFNoFrames(t *testing.T) {
+	if err := EncodeGIF(&bytes.Buffer{}, nil, time.Second); err == nil {
+		t.Error("EncodeGIF() with no frames succeeded, want error")
+	}
+}
@@ -0,0 +1,29 @@
+package vncclient
+
+import (
+	"fmt"
+	"image"
+
+	"github.com/coder/websockify/rfb"
+)
+
+// SendKey sends a KeyEvent pressing or releasing the key with the given X11
+// keysym, such as rfb.KeyReturn or rfb.RuneToKeysym('a')
+func (c *Client) SendKey(keysym uint32, down bool) error {
+	if err := c.write(rfb.CreateKeyEvent(down, keysym)); err != nil {
+		return fmt.Errorf("failed to send KeyEvent message: %v", err)
+	}
+	return nil
+}
+
+// SendPointer sends a PointerEvent moving the pointer to (x, y) with the
+// given rfb.Button* bits held. The cursor is drawn at the new position.
+func (c *Client) SendPointer(x, y int, buttons uint8) error {
+	if err := c.write(rfb.CreatePointerEvent(buttons, uint16(x), uint16(y))); err != nil {
+		return fmt.Errorf("failed to send PointerEvent message: %v", err)
+	}
+	c.mutex.Lock()
+	c.cursor.position, c.cursor.positionKnown = image.Pt(x, y), true
+	c.mutex.Unlock()
+	return nil
+}
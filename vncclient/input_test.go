@@ -0,0 +1,39 @@
+package vncclient
+
+import (
+	"bytes"
+	"image"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/coder/websockify/rfb"
+)
+
+func TestSendInput(t *testing.T) {
+	clientConn, serverConn := net.Pipe()
+	defer serverConn.Close()
+	c := &Client{conn: clientConn}
+	defer c.Close()
+
+	want := append(rfb.CreateKeyEvent(true, rfb.KeyReturn), rfb.CreatePointerEvent(rfb.ButtonLeft, 10, 20)...)
+	received := make(chan []byte)
+	go func() {
+		buf := make([]byte, len(want))
+		io.ReadFull(serverConn, buf)
+		received <- buf
+	}()
+
+	if err := c.SendKey(rfb.KeyReturn, true); err != nil {
+		t.Fatalf("SendKey() error = %v", err)
+	}
+	if err := c.SendPointer(10, 20, rfb.ButtonLeft); err != nil {
+		t.Fatalf("SendPointer() error = %v", err)
+	}
+	if got := <-received; !bytes.Equal(got, want) {
+		t.Errorf("sent %v, want %v", got, want)
+	}
+	if c.cursor.position != image.Pt(10, 20) || !c.cursor.positionKnown {
+		t.Errorf("pointer position = %v (known %v), want (10,20)", c.cursor.position, c.cursor.positionKnown)
+	}
+}
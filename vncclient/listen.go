@@ -0,0 +1,40 @@
+package vncclient
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+)
+
+// Accept waits for a server to open a reverse connection to listener, as
+// servers do for a listening viewer on port 5500, and completes the handshake over it.
+// The server still speaks first, so the handshake is the usual one;
+// Options.TLS does not apply. If ctx ends before a server connects, listener
+// is closed and ctx's error is returned.
+func Accept(ctx context.Context, listener net.Listener, opts Options) (*Client, error) {
+	stop := context.AfterFunc(ctx, func() { listener.Close() })
+	conn, err := listener.Accept()
+	if !stop() {
+		if conn != nil {
+			conn.Close()
+		}
+		err = ctx.Err()
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to accept reverse connection: %w", err)
+		emitError(opts, err)
+		return nil, err
+	}
+
+	if opts.Logf == nil {
+		opts.Logf = log.Printf
+	}
+	opts.Logf("Accepted reverse connection from %s", conn.RemoteAddr())
+	c, err := NewClient(conn, opts)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
@@ -0,0 +1,62 @@
+package vncclient
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/coder/websockify/mockvnc"
+)
+
+func TestAccept(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer listener.Close()
+
+	// The server dials the listening client
+	s, err := mockvnc.New(mockvnc.Options{Width: 32, Height: 24, Animation: "testcard", Logf: t.Logf})
+	if err != nil {
+		t.Fatalf("mockvnc.New() error = %v", err)
+	}
+	t.Cleanup(s.Close)
+	go func() {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			t.Errorf("Dial() error = %v", err)
+			return
+		}
+		s.ServeConn(conn)
+	}()
+
+	c, err := Accept(context.Background(), listener, Options{Logf: t.Logf})
+	if err != nil {
+		t.Fatalf("Accept() error = %v", err)
+	}
+	defer c.Close()
+
+	if err := c.RequestUpdate(false); err != nil {
+		t.Fatalf("RequestUpdate() error = %v", err)
+	}
+	if err := c.ReadMessage(); err != nil {
+		t.Fatalf("ReadMessage() error = %v", err)
+	}
+	checkFrame(t, c.Snapshot(), s.Frame(0))
+}
+
+func TestAcceptCanceled(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer listener.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := Accept(ctx, listener, Options{Logf: t.Logf}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Accept() error = %v, want context.DeadlineExceeded", err)
+	}
+}
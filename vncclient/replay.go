@@ -0,0 +1,68 @@
+package vncclient
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+
+	"github.com/coder/websockify/rfb"
+)
+
+// startRecording writes a handshake for the current session to w as FBS, then
+// tees everything read from the server into it. It must be called before
+// the first message is read. The ServerInit carries the pixel format in use,
+// so the recording decodes without sending SetPixelFormat again.
+func (c *Client) startRecording(w io.Writer) error {
+	fbs, err := rfb.NewFBSWriter(w)
+	if err != nil {
+		return err
+	}
+
+	handshake := []byte(rfb.RFBVersion)
+	handshake = append(handshake, 1, rfb.SecurityNone) // One security type
+	handshake = append(handshake, 0, 0, 0, 0)          // SecurityResult OK
+	handshake = append(handshake, rfb.CreateServerInit(rfb.ServerInit{
+		Width:       uint16(c.framebuffer.Rect.Dx()),
+		Height:      uint16(c.framebuffer.Rect.Dy()),
+		PixelFormat: c.pixelFormat,
+		Name:        c.name,
+	})...)
+	if _, err := fbs.Write(handshake); err != nil {
+		return err
+	}
+
+	c.reader = bufio.NewReader(io.TeeReader(countingReader{r: c.conn, bytes: &c.bytesRead}, fbs))
+	return nil
+}
+
+// Replay returns a client reading the server side of an FBS recording, such
+// as one made with Options.Record or by the vncserver command's -record,
+// instead of a connection. Blocks are released at speed times real time, or
+// as fast as they are read when speed is zero. Messages the client sends are
+// discarded, and ReadMessage and Run return io.EOF at the end of the recording.
+func Replay(ctx context.Context, r io.Reader, speed float64, opts Options) (*Client, error) {
+	fbs, err := rfb.NewFBSReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	conn, server := net.Pipe()
+	go func() {
+		defer server.Close()
+		io.Copy(server, rfb.NewFBSPlayer(ctx, fbs, speed))
+	}()
+	go func() {
+		// Stop the player once the client closes its end
+		defer cancel()
+		io.Copy(io.Discard, server)
+	}()
+
+	c, err := NewClient(conn, opts)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
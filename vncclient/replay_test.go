@@ -0,0 +1,61 @@
+package vncclient
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/coder/websockify/mockvnc"
+	"github.com/coder/websockify/rfb"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	// Record three updates in a 16bpp format, so the replay must take the
+	// pixel format from the recording
+	var recording bytes.Buffer
+	pf := rfb.RGB565PixelFormat()
+	_, c := connect(t, mockvnc.Options{Width: 32, Height: 24, Animation: "plasma", Password: "secret"},
+		Options{Password: "secret", PixelFormat: &pf, Record: &recording})
+	for i := 0; i < 3; i++ {
+		if err := c.RequestUpdate(i > 0); err != nil {
+			t.Fatalf("RequestUpdate() error = %v", err)
+		}
+		if err := c.ReadMessage(); err != nil {
+			t.Fatalf("ReadMessage() error = %v", err)
+		}
+	}
+	c.Close()
+
+	r, err := Replay(context.Background(), &recording, 0, Options{Logf: t.Logf})
+	if err != nil {
+		t.Fatalf("Replay() error = %v", err)
+	}
+	defer r.Close()
+	if r.Width() != 32 || r.Height() != 24 || r.Name() != c.Name() {
+		t.Errorf("Replay of %q at %dx%d, want %q at 32x24", r.Name(), r.Width(), r.Height(), c.Name())
+	}
+	for {
+		err := r.ReadMessage()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("ReadMessage() error = %v", err)
+		}
+	}
+
+	if r.FrameCount() != 3 {
+		t.Errorf("FrameCount() = %d, want 3", r.FrameCount())
+	}
+	if diff, err := CompareFrames(r.Snapshot(), c.Snapshot(), 0); err != nil || !diff.Match() {
+		t.Errorf("CompareFrames(replay, live) = %+v, %v, want a match", diff, err)
+	}
+}
+
+func TestReplayInvalid(t *testing.T) {
+	if _, err := Replay(context.Background(), bytes.NewReader([]byte("RFB 003.008\n")), 0, Options{Logf: t.Logf}); err == nil {
+		t.Error("Replay() of a non-FBS file succeeded, want error")
+	}
+}
@@ -0,0 +1,96 @@
+package vncclient
+
+import (
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// Stats summarizes what the client has received since the handshake
+type Stats struct {
+	Frames     int           // FramebufferUpdates received
+	Bytes      int64         // Bytes read from the server after the handshake
+	Duration   time.Duration // Time since the handshake completed
+	DecodeTime time.Duration // Time spent reading and decoding rectangles after their headers
+
+	// Latencies holds, for each FramebufferUpdate that answered a request,
+	// the time from the earliest unanswered FramebufferUpdateRequest to the
+	// update's first byte
+	Latencies []time.Duration
+
+	// Intervals holds the time between the first bytes of consecutive
+	// FramebufferUpdates, showing the server's frame pacing
+	Intervals []time.Duration
+
+	ContinuousUpdates bool // Continuous updates are enabled
+}
+
+// FPS returns the average frame rate since the handshake
+func (s Stats) FPS() float64 {
+	if s.Duration <= 0 {
+		return 0
+	}
+	return float64(s.Frames) / s.Duration.Seconds()
+}
+
+// BytesPerSecond returns the average rate data was received at since the handshake
+func (s Stats) BytesPerSecond() float64 {
+	if s.Duration <= 0 {
+		return 0
+	}
+	return float64(s.Bytes) / s.Duration.Seconds()
+}
+
+// countingReader counts the bytes read from the server
+type countingReader struct {
+	r     io.Reader
+	bytes *atomic.Int64
+}
+
+func (r countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.bytes.Add(int64(n))
+	return n, err
+}
+
+// Stats returns the client's statistics so far
+func (c *Client) Stats() Stats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return Stats{
+		Frames:     c.frameCount,
+		Bytes:      c.bytesRead.Load(),
+		Duration:   time.Since(c.connected),
+		DecodeTime: c.decodeTime,
+		Latencies:  append([]time.Duration(nil), c.latencies...),
+		Intervals:  append([]time.Duration(nil), c.intervals...),
+
+		ContinuousUpdates: c.continuousUpdates,
+	}
+}
+
+// requested notes when a FramebufferUpdateRequest was sent, unless an earlier
+// one is still unanswered
+func (c *Client) requested() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.requestedAt.IsZero() {
+		c.requestedAt = time.Now()
+	}
+}
+
+// answered records the time since the previous FramebufferUpdate and the
+// latency of the request this one answers, if any
+func (c *Client) answered() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	now := time.Now()
+	if !c.lastFrameAt.IsZero() {
+		c.intervals = append(c.intervals, now.Sub(c.lastFrameAt))
+	}
+	c.lastFrameAt = now
+	if !c.requestedAt.IsZero() {
+		c.latencies = append(c.latencies, now.Sub(c.requestedAt))
+		c.requestedAt = time.Time{}
+	}
+}
@@ -0,0 +1,35 @@
+package vncclient
+
+import (
+	"crypto/tls"
+	"fmt"
+
+	"github.com/coder/websockify/rfb"
+)
+
+// startVeNCrypt negotiates a VeNCrypt X509 subtype and upgrades the connection
+// to TLS. X509Vnc is accepted when a password is set, and VNC Authentication
+// then runs inside the TLS session.
+func (c *Client) startVeNCrypt() error {
+	supported := []uint32{rfb.VeNCryptX509None}
+	if c.opts.Password != "" {
+		supported = []uint32{rfb.VeNCryptX509Vnc, rfb.VeNCryptX509None}
+	}
+
+	subtype, err := rfb.VeNCryptClientHandshake(c.conn, supported)
+	if err != nil {
+		return err
+	}
+
+	tlsConn := tls.Client(c.conn, tlsConfig(c.opts.TLSConfig))
+	if err := tlsConn.Handshake(); err != nil {
+		return fmt.Errorf("VeNCrypt TLS handshake failed: %v", err)
+	}
+	c.conn = tlsConn
+	c.logf("VeNCrypt %s negotiated (%s)", rfb.VeNCryptSubtypeName(subtype), tls.VersionName(tlsConn.ConnectionState().Version))
+
+	if subtype == rfb.VeNCryptX509Vnc {
+		return c.authenticate()
+	}
+	return nil
+}
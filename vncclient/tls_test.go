@@ -0,0 +1,80 @@
+package vncclient
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"strings"
+	"testing"
+
+	"github.com/coder/websockify/mockvnc"
+)
+
+// testTLS returns a server configuration with a self-signed certificate and a
+// client configuration that trusts it
+func testTLS(t *testing.T) (server, client *tls.Config) {
+	t.Helper()
+	cert, err := mockvnc.SelfSignedCertificate()
+	if err != nil {
+		t.Fatalf("SelfSignedCertificate() error = %v", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("ParseCertificate() error = %v", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(leaf)
+	return &tls.Config{Certificates: []tls.Certificate{cert}}, &tls.Config{RootCAs: roots}
+}
+
+func TestEncryptedConnections(t *testing.T) {
+	serverTLS, clientTLS := testTLS(t)
+
+	tests := []struct {
+		name       string
+		serverOpts mockvnc.Options
+		opts       Options
+		wantErr    string // Empty when the handshake should succeed
+	}{
+		{"TLS", mockvnc.Options{TLS: true}, Options{TLS: true, TLSConfig: clientTLS}, ""},
+		{"TLS unverified", mockvnc.Options{TLS: true}, Options{TLS: true}, "certificate"},
+		{"TLS insecure", mockvnc.Options{TLS: true}, Options{TLS: true, TLSConfig: &tls.Config{InsecureSkipVerify: true}}, ""},
+		{"VeNCrypt", mockvnc.Options{VeNCrypt: true}, Options{VeNCrypt: true, TLSConfig: clientTLS}, ""},
+		{"VeNCrypt with password", mockvnc.Options{VeNCrypt: true, Password: "secret"}, Options{VeNCrypt: true, Password: "secret", TLSConfig: clientTLS}, ""},
+		{"VeNCrypt wrong password", mockvnc.Options{VeNCrypt: true, Password: "secret"}, Options{VeNCrypt: true, Password: "wrong", TLSConfig: clientTLS}, "Authentication failed"},
+		{"VeNCrypt unverified", mockvnc.Options{VeNCrypt: true}, Options{VeNCrypt: true}, "certificate"},
+		{"VeNCrypt not enabled", mockvnc.Options{VeNCrypt: true}, Options{}, "VeNCrypt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serverOpts := tt.serverOpts
+			serverOpts.Width, serverOpts.Height = 8, 8
+			serverOpts.TLSConfig = serverTLS
+			s := mockvnc.Start(t, serverOpts)
+
+			opts := tt.opts
+			opts.Logf = t.Logf
+			c, err := Connect(context.Background(), s.Addr(), opts)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Connect() error = %v", err)
+				}
+				defer c.Close()
+				if err := c.RequestUpdate(false); err != nil {
+					t.Fatalf("RequestUpdate() error = %v", err)
+				}
+				if err := c.ReadMessage(); err != nil {
+					t.Fatalf("ReadMessage() error = %v", err)
+				}
+				return
+			}
+			if err == nil {
+				c.Close()
+				t.Fatalf("Connect() succeeded, want error containing %q", tt.wantErr)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Connect() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
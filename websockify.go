@@ -2,6 +2,10 @@ package websockify
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io/fs"
 	"log"
 	"net"
 	"net/http"
@@ -22,6 +26,19 @@ type Server struct {
 	listener string
 	target   string
 	webRoot  string
+	webFS    fs.FS
+	routes   []Route
+	tokens   TokenResolver
+	pick     func(r *http.Request) (string, error)
+	auth     Authenticator
+	webAuth  bool
+	limits   Limits
+	limiter  *connLimiter
+	sessions sessionTable
+	certFile string
+	keyFile  string
+	tls      *tls.Config
+	autoCert *AutoCert
 	server   *http.Server
 	logger   Logger
 }
@@ -29,9 +46,43 @@ type Server struct {
 // Config holds the configuration for the websockify server.
 type Config struct {
 	Listener string
-	Target   string
+	Target   string // Served at /websockify; none if empty and there is no TokenResolver
 	WebRoot  string
 	Logger   Logger // Optional custom logger, defaults to standard log package
+
+	// WebFS, if set, is served at / in place of WebRoot, such as the noVNC
+	// bundled by the novnc package.
+	WebFS fs.FS
+
+	// TokenResolver, if set, picks the target for each connection from its
+	// token instead of using Target.
+	TokenResolver TokenResolver
+	// TargetFunc, if set, picks the target for each connection at
+	// /websockify from its request, such as by a header, cookie or session.
+	// If it returns "", the TokenResolver or Target is used, and if it
+	// returns an error, or "" with neither of those to fall back on, the
+	// connection is refused with 403 Forbidden.
+	TargetFunc func(r *http.Request) (string, error)
+	// Authenticator, if set, must accept each request before it is proxied.
+	Authenticator Authenticator
+	// WebAuth makes the Authenticator guard the WebRoot files too.
+	WebAuth bool
+	// Routes serve more paths, each proxied to its own target.
+	Routes []Route
+	// Limits bound how many connections are proxied and for how long.
+	Limits Limits
+
+	// CertFile and KeyFile, if set, make Serve terminate TLS so clients
+	// connect with wss:// directly. The key is read from CertFile if KeyFile
+	// is empty, and both are read again when CertFile changes.
+	CertFile string
+	KeyFile  string
+	// TLSConfig, if set, is used to terminate TLS, with the certificate from
+	// CertFile added if one is given.
+	TLSConfig *tls.Config
+	// AutoCert, if set, terminates TLS with certificates obtained and
+	// renewed automatically, in place of CertFile.
+	AutoCert *AutoCert
 }
 
 // defaultLogger wraps the standard log package to implement our Logger interface.
@@ -62,6 +113,18 @@ func New(config Config) *Server {
 		listener: config.Listener,
 		target:   config.Target,
 		webRoot:  config.WebRoot,
+		webFS:    config.WebFS,
+		routes:   config.Routes,
+		tokens:   config.TokenResolver,
+		pick:     config.TargetFunc,
+		auth:     config.Authenticator,
+		webAuth:  config.WebAuth,
+		limits:   config.Limits,
+		limiter:  newConnLimiter(config.Limits),
+		certFile: config.CertFile,
+		keyFile:  config.KeyFile,
+		tls:      config.TLSConfig,
+		autoCert: config.AutoCert,
 		logger:   logger,
 	}
 }
@@ -72,10 +135,40 @@ func (s *Server) Serve(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
+	routes := s.routes
+	if s.target != "" && s.tokens == nil && s.pick == nil {
+		routes = append([]Route{{Path: "/websockify", Target: s.target}}, routes...)
+	}
+	reserved := make(map[string]string)
+	if s.webFS != nil || s.webRoot != "" {
+		reserved["/"] = "the web files"
+	}
+	switch {
+	case s.pick != nil:
+		reserved["/websockify"] = "the TargetFunc's connections"
+	case s.tokens != nil:
+		reserved["/websockify"] = "the token connections"
+	}
+	if err := checkRoutes(routes, reserved); err != nil {
+		return err
+	}
+	if s.webAuth && s.auth == nil {
+		return fmt.Errorf("WebAuth needs an Authenticator")
+	}
+	if s.webFS != nil && s.webRoot != "" {
+		return fmt.Errorf("WebRoot and WebFS cannot both be set")
+	}
+	tlsConfig, err := s.tlsConfig()
+	if err != nil {
+		return err
+	}
 
 	mux := http.NewServeMux()
 
 	switch {
+	case s.webFS != nil:
+		s.logger.Printf("Serving bundled web files at %s", s.listener)
+		mux.Handle("/", s.fileServer())
 	case s.webRoot == path:
 		s.logger.Println("Refusing to serve static content from the current working directory.")
 		s.logger.Println("Please use the --web-root flag to specify a different directory.")
@@ -85,11 +178,21 @@ func (s *Server) Serve(ctx context.Context) error {
 		s.logger.Println("No web root specified; serving no static content.")
 	default:
 		s.logger.Printf("Serving %s at %s", s.webRoot, s.listener)
-		mux.Handle("/", http.FileServer(http.Dir(s.webRoot)))
+		mux.Handle("/", s.fileServer())
 	}
 
-	s.logger.Printf("Serving WS of %s at %s", s.target, s.listener)
-	mux.HandleFunc("/websockify", s.newServeWS())
+	switch {
+	case s.pick != nil:
+		s.logger.Printf("Serving WS of per-request targets at %s", s.listener)
+		mux.HandleFunc("/websockify", s.newServeWS())
+	case s.tokens != nil:
+		s.logger.Printf("Serving WS of token targets at %s", s.listener)
+		mux.HandleFunc("/websockify", s.newServeWS())
+	}
+	for _, route := range routes {
+		s.logger.Printf("Serving WS of %s at %s%s", route.Target, s.listener, route.Path)
+		mux.HandleFunc(route.Path, s.routeHandler(route.Target))
+	}
 
 	s.server = &http.Server{
 		Addr:           s.listener,
@@ -97,6 +200,11 @@ func (s *Server) Serve(ctx context.Context) error {
 		ReadTimeout:    10 * time.Second,
 		WriteTimeout:   10 * time.Second,
 		MaxHeaderBytes: 1 << 20,
+		TLSConfig:      tlsConfig,
+	}
+
+	if watcher, ok := s.tokens.(tokenWatcher); ok {
+		go watcher.Watch(ctx, s.logger)
 	}
 
 	// Handle graceful shutdown
@@ -107,6 +215,10 @@ func (s *Server) Serve(ctx context.Context) error {
 		}
 	}()
 
+	if tlsConfig != nil {
+		s.logger.Printf("Terminating TLS at %s", s.listener)
+		return s.server.ListenAndServeTLS("", "")
+	}
 	return s.server.ListenAndServe()
 }
 
@@ -119,9 +231,13 @@ var upgrader = websocket.Upgrader{
 }
 
 // handleConnection manages the bidirectional forwarding for a single connection pair.
-func (s *Server) handleConnection(ctx context.Context, wsConn *websocket.Conn, tcpConn net.Conn) {
-	// Create a cancellable context for this connection
+func (s *Server) handleConnection(ctx context.Context, wsConn *websocket.Conn, tcpConn net.Conn, sess *session) {
+	// Create a cancellable context for this connection, which ends with the
+	// session if it is limited
 	connCtx, cancel := context.WithCancel(ctx)
+	if s.limits.SessionTimeout > 0 {
+		connCtx, cancel = context.WithTimeout(ctx, s.limits.SessionTimeout)
+	}
 	defer cancel()
 
 	// Clean up connections when done
@@ -138,21 +254,42 @@ func (s *Server) handleConnection(ctx context.Context, wsConn *websocket.Conn, t
 	done := make(chan struct{}, 2)
 
 	// Forward TCP -> WebSocket
-	go s.forwardTCP(connCtx, wsConn, tcpConn, done)
-	
-	// Forward WebSocket -> TCP  
-	go s.forwardWeb(connCtx, wsConn, tcpConn, done)
+	go s.forwardTCP(connCtx, wsConn, tcpConn, sess, done)
+
+	// Forward WebSocket -> TCP
+	go s.forwardWeb(connCtx, wsConn, tcpConn, sess, done)
+
+	var idleCheck <-chan time.Time
+	if s.limits.IdleTimeout > 0 {
+		ticker := time.NewTicker(max(min(s.limits.IdleTimeout/4, time.Second), time.Millisecond))
+		defer ticker.Stop()
+		idleCheck = ticker.C
+	}
 
-	// Wait for context cancellation or either goroutine to finish
-	select {
-	case <-connCtx.Done():
-		s.logger.Printf("connection cancelled: %v", connCtx.Err())
-	case <-done:
-		// One direction failed, which will close connections and cause the other to fail
+	// Wait for context cancellation, either goroutine to finish, or the
+	// connection to go idle
+	for {
+		select {
+		case <-connCtx.Done():
+			if errors.Is(connCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+				s.logger.Printf("closing %s: session timeout of %v reached", wsConn.RemoteAddr(), s.limits.SessionTimeout)
+			} else {
+				s.logger.Printf("connection cancelled: %v", connCtx.Err())
+			}
+			return
+		case <-done:
+			// One direction failed, which will close connections and cause the other to fail
+			return
+		case <-idleCheck:
+			if idle := sess.idleFor(); idle >= s.limits.IdleTimeout {
+				s.logger.Printf("closing %s: idle for %v", wsConn.RemoteAddr(), idle.Round(time.Second))
+				return
+			}
+		}
 	}
 }
 
-func (s *Server) forwardTCP(ctx context.Context, wsConn *websocket.Conn, tcpConn net.Conn, done chan<- struct{}) {
+func (s *Server) forwardTCP(ctx context.Context, wsConn *websocket.Conn, tcpConn net.Conn, sess *session, done chan<- struct{}) {
 	defer func() {
 		select {
 		case done <- struct{}{}:
@@ -190,10 +327,12 @@ func (s *Server) forwardTCP(ctx context.Context, wsConn *websocket.Conn, tcpConn
 			s.logger.Printf("writing to WS failed: %s", err)
 			return
 		}
+		sess.toClient.Add(int64(n))
+		sess.touch()
 	}
 }
 
-func (s *Server) forwardWeb(ctx context.Context, wsConn *websocket.Conn, tcpConn net.Conn, done chan<- struct{}) {
+func (s *Server) forwardWeb(ctx context.Context, wsConn *websocket.Conn, tcpConn net.Conn, sess *session, done chan<- struct{}) {
 	defer func() {
 		if err := recover(); err != nil {
 			s.logger.Printf("WebSocket forwarding panic: %s", err)
@@ -204,30 +343,17 @@ func (s *Server) forwardWeb(ctx context.Context, wsConn *websocket.Conn, tcpConn
 		}
 	}()
 
+	// A WebSocket cannot be read again after a read times out, so this blocks
+	// until a message arrives or handleConnection closes the connection.
 	for {
-		select {
-		case <-ctx.Done():
-			return
-		default:
-		}
-
-		// Set read deadline to make read cancellable
-		wsConn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
-		
 		_, buffer, err := wsConn.ReadMessage()
 		if err != nil {
-			// Check if it's just a timeout, continue if context not cancelled
-			if websocket.IsCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				s.logger.Printf("WebSocket closed: %s", err)
+			if ctx.Err() != nil {
 				return
 			}
-			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
-				select {
-				case <-ctx.Done():
-					return
-				default:
-					continue
-				}
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+				s.logger.Printf("WebSocket closed: %s", err)
+				return
 			}
 			s.logger.Printf("reading from WS failed: %s", err)
 			return
@@ -237,20 +363,62 @@ func (s *Server) forwardWeb(ctx context.Context, wsConn *websocket.Conn, tcpConn
 			s.logger.Printf("writing to TCP failed: %s", err)
 			return
 		}
+		sess.toTarget.Add(int64(len(buffer)))
+		sess.touch()
 	}
 }
 
 // ServeHTTP implements http.Handler for integration with existing HTTP servers.
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.authenticate(w, r) {
+		return
+	}
+
+	target, err := s.resolveTarget(r)
+	if err != nil {
+		s.logger.Printf("failed to resolve the target: %s", err)
+		s.sessions.refused.Add(1)
+		message := "Invalid token"
+		if errors.Is(err, errTargetFunc) {
+			message = http.StatusText(http.StatusForbidden)
+		}
+		http.Error(w, message, http.StatusForbidden)
+		return
+	}
+	s.proxy(w, r, target)
+}
+
+// routeHandler returns the handler of a route, which always proxies to target.
+func (s *Server) routeHandler(target string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.authenticate(w, r) {
+			s.proxy(w, r, target)
+		}
+	}
+}
+
+// proxy upgrades the request to a WebSocket and forwards it to target.
+func (s *Server) proxy(w http.ResponseWriter, r *http.Request, target string) {
+	ip := clientIP(r)
+	status, ok := s.limiter.acquire(ip)
+	if !ok {
+		s.logger.Printf("refused %s: connection limit reached", r.RemoteAddr)
+		s.sessions.refused.Add(1)
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	defer s.limiter.release(ip)
+
 	ws, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		s.logger.Printf("failed to upgrade to WS: %s", err)
 		return
 	}
 
-	vnc, err := net.Dial("tcp", s.target)
+	vnc, err := net.Dial("tcp", target)
 	if err != nil {
 		s.logger.Printf("failed to bind to the target: %s", err)
+		s.sessions.targetFailures.Add(1)
 		if ws != nil {
 			ws.Close()
 		}
@@ -259,7 +427,78 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	// Use request context for connection lifecycle
 	ctx := r.Context()
-	s.handleConnection(ctx, ws, vnc)
+	sess := s.sessions.start(r, target)
+	defer s.sessions.end(sess)
+	s.handleConnection(ctx, ws, vnc, sess)
+}
+
+// fileServer serves the WebFS or WebRoot files, behind the Authenticator with
+// WebAuth.
+func (s *Server) fileServer() http.Handler {
+	files := http.FileServer(http.Dir(s.webRoot))
+	if s.webFS != nil {
+		files = http.FileServerFS(s.webFS)
+	}
+	if !s.webAuth {
+		return files
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.authenticate(w, r) {
+			files.ServeHTTP(w, r)
+		}
+	})
+}
+
+// authenticate checks a request with the server's Authenticator, if it has
+// one, and refuses it with 401 Unauthorized if it fails.
+func (s *Server) authenticate(w http.ResponseWriter, r *http.Request) bool {
+	if s.auth == nil {
+		return true
+	}
+	err := s.auth.Authenticate(r)
+	if err == nil {
+		return true
+	}
+	s.logger.Printf("refused %s: %s", r.RemoteAddr, err)
+	s.sessions.refused.Add(1)
+	if c, ok := s.auth.(challenger); ok {
+		w.Header().Set("WWW-Authenticate", c.Challenge())
+	}
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	return false
+}
+
+// errTargetFunc wraps the errors of a TargetFunc, which refuse requests for
+// reasons other than their token.
+var errTargetFunc = errors.New("TargetFunc")
+
+// resolveTarget returns the target for a request, from the TargetFunc if it
+// picks one, or else from its token when the server has a TokenResolver.
+func (s *Server) resolveTarget(r *http.Request) (string, error) {
+	if s.pick != nil {
+		target, err := s.pick(r)
+		if err != nil {
+			return "", fmt.Errorf("%w: %w", errTargetFunc, err)
+		}
+		if target != "" {
+			return target, nil
+		}
+		if s.tokens == nil && s.target == "" {
+			return "", fmt.Errorf("%w: no target picked for %s", errTargetFunc, r.RemoteAddr)
+		}
+	}
+	if s.tokens == nil {
+		return s.target, nil
+	}
+	token := requestToken(r)
+	if token == "" {
+		return "", fmt.Errorf("no token in request")
+	}
+	target, err := s.tokens.Resolve(token)
+	if err != nil {
+		return "", fmt.Errorf("token %q: %v", token, err)
+	}
+	return target, nil
 }
 
 func (s *Server) newServeWS() http.HandlerFunc {
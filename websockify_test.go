@@ -0,0 +1,387 @@
+package websockify
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// WebSocket opcodes, for writing frames by hand
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xa
+)
+
+// wsFrame returns a masked client frame. Nothing is checked, so it can
+// write frames a well-behaved client never would.
+func wsFrame(fin bool, opcode byte, payload []byte) []byte {
+	first := opcode
+	if fin {
+		first |= 0x80
+	}
+	frame := []byte{first}
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, 0x80|byte(n))
+	case n <= 0xffff:
+		frame = append(frame, 0x80|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame = append(frame, 0x80|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+	mask := [4]byte{0x12, 0x34, 0x56, 0x78}
+	frame = append(frame, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	return frame
+}
+
+// panicLogger fails the test when the server logs a recovered panic
+type panicLogger struct {
+	t testing.TB
+}
+
+func (l *panicLogger) Printf(format string, v ...interface{}) {
+	if msg := fmt.Sprintf(format, v...); strings.Contains(msg, "panic") {
+		l.t.Errorf("server logged %q", msg)
+	}
+}
+
+func (l *panicLogger) Println(v ...interface{}) {
+	l.Printf("%s", fmt.Sprintln(v...))
+}
+
+// panicWriter fails the test when net/http recovers a panic from a handler
+type panicWriter struct {
+	t testing.TB
+}
+
+func (w panicWriter) Write(p []byte) (int, error) {
+	if bytes.Contains(p, []byte("panic")) {
+		w.t.Errorf("HTTP server logged %q", p)
+	}
+	return len(p), nil
+}
+
+// forwardHarness is a server proxying to a backend that counts what it
+// receives and answers every read, with raw connections to it
+type forwardHarness struct {
+	t        testing.TB
+	server   *Server
+	addr     string
+	received atomic.Int64
+}
+
+func newForwardHarness(t testing.TB) *forwardHarness {
+	h := &forwardHarness{t: t}
+	backend, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { backend.Close() })
+	go func() {
+		for {
+			conn, err := backend.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				buf := make([]byte, 32*1024)
+				for {
+					n, err := conn.Read(buf)
+					if err != nil {
+						return
+					}
+					h.received.Add(int64(n))
+					if _, err := conn.Write(buf[:min(n, 64)]); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+
+	h.server = New(Config{Logger: &panicLogger{t: t}, Target: backend.Addr().String()})
+	web := httptest.NewUnstartedServer(h.server)
+	web.Config.ErrorLog = log.New(panicWriter{t: t}, "", 0)
+	web.Start()
+	t.Cleanup(web.Close)
+	h.addr = web.Listener.Addr().String()
+	return h
+}
+
+// dial opens a raw connection and completes the WebSocket handshake
+func (h *forwardHarness) dial() (net.Conn, *bufio.Reader) {
+	h.t.Helper()
+	conn, err := net.Dial("tcp", h.addr)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	fmt.Fprintf(conn, "GET /websockify HTTP/1.1\r\nHost: %s\r\nOrigin: http://%s\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n", h.addr, h.addr)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, nil)
+	if err != nil {
+		h.t.Fatalf("handshake: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		h.t.Fatalf("handshake status = %s, want 101", resp.Status)
+	}
+	conn.SetReadDeadline(time.Time{})
+	return conn, r
+}
+
+// proxyGoroutines returns the stacks of goroutines serving a connection:
+// the server's handlers and forwarders, and the backend's side of them
+func proxyGoroutines() []string {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+	var found []string
+	for _, g := range strings.Split(string(buf), "\n\n") {
+		if strings.Contains(g, "websockify.(*Server).") || strings.Contains(g, "websockify.newForwardHarness.func1.1") {
+			found = append(found, g)
+		}
+	}
+	return found
+}
+
+// waitClosed fails the test unless every session ends, and every goroutine
+// serving one with it, soon after the client went away
+func (h *forwardHarness) waitClosed() {
+	h.t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		leaked := proxyGoroutines()
+		if len(leaked) == 0 && len(h.server.Sessions()) == 0 && h.server.limiter.open() == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			h.t.Fatalf("%d sessions open and %d goroutines left after the client went away:\n%s",
+				len(h.server.Sessions()), len(leaked), strings.Join(leaked, "\n\n"))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// playScript writes frames decoded from script to conn, then closes it
+// unless the script closed it first. Each step is an action byte followed by
+// its arguments; running out of bytes ends the script.
+func playScript(conn net.Conn, script []byte) {
+	defer conn.Close()
+	next := func() (byte, bool) {
+		if len(script) == 0 {
+			return 0, false
+		}
+		b := script[0]
+		script = script[1:]
+		return b, true
+	}
+	payload := func(n int) []byte {
+		p := bytes.Repeat([]byte{0xa5}, n)
+		copy(p, script)
+		return p
+	}
+	for {
+		action, ok := next()
+		if !ok {
+			return
+		}
+		arg, _ := next()
+		var frame []byte
+		switch action % 10 {
+		case 0:
+			frame = wsFrame(true, opBinary, payload(int(arg)))
+		case 1:
+			frame = wsFrame(true, opText, payload(int(arg)))
+		case 2:
+			// A large message, up to 255 KiB
+			frame = wsFrame(true, opBinary, payload(int(arg)<<10))
+		case 3:
+			frame = wsFrame(false, opBinary, payload(int(arg)))
+		case 4:
+			frame = wsFrame(arg&1 == 1, opContinuation, payload(int(arg)))
+		case 5:
+			frame = wsFrame(true, opPing, payload(int(arg%126)))
+		case 6:
+			frame = wsFrame(true, opPong, payload(int(arg%126)))
+		case 7:
+			frame = wsFrame(true, opClose, binary.BigEndian.AppendUint16(nil, 1000+uint16(arg)))
+		case 8:
+			// Bytes that need not be a frame at all
+			frame = payload(int(arg))
+		case 9:
+			// An abrupt close, without a close frame
+			return
+		}
+		conn.SetWriteDeadline(time.Now().Add(time.Second))
+		if _, err := conn.Write(frame); err != nil {
+			return
+		}
+	}
+}
+
+func FuzzForwarding(f *testing.F) {
+	f.Add([]byte{})
+	f.Add([]byte{0, 4, 0, 0})                          // Empty and short messages
+	f.Add([]byte{2, 255, 2, 255})                      // Large messages
+	f.Add([]byte{3, 10, 5, 4, 4, 9})                   // A ping between fragments
+	f.Add([]byte{4, 1})                                // A continuation with nothing to continue
+	f.Add([]byte{3, 10, 0, 10})                        // A new message inside a fragmented one
+	f.Add([]byte{5, 200})                              // A ping too large for a control frame
+	f.Add([]byte{7, 0, 0, 10})                         // Data after a close frame
+	f.Add([]byte{8, 14, 1, 1})                         // Garbage
+	f.Add([]byte{0, 100, 9, 0, 0, 100})                // An abrupt close
+	f.Add([]byte{1, 3, 6, 0, 7, 10, 7, 0, 5, 1, 0, 1}) // Everything at once
+
+	h := newForwardHarness(f)
+	f.Fuzz(func(t *testing.T, script []byte) {
+		h.t = t
+		conn, r := h.dial()
+		// Drain what the server sends so its writes never block
+		go io.Copy(io.Discard, r)
+		playScript(conn, script)
+		h.waitClosed()
+	})
+}
+
+func TestForwardingChaos(t *testing.T) {
+	h := newForwardHarness(t)
+
+	// Many clients at once, each playing a random script
+	rng := rand.New(rand.NewPCG(1, 2))
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		script := make([]byte, rng.IntN(64))
+		for j := range script {
+			script[j] = byte(rng.Uint32())
+		}
+		conn, r := h.dial()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			go io.Copy(io.Discard, r)
+			playScript(conn, script)
+		}()
+	}
+	wg.Wait()
+	h.waitClosed()
+}
+
+func TestForwardingFragmentedMessage(t *testing.T) {
+	h := newForwardHarness(t)
+	conn, r := h.dial()
+	go io.Copy(io.Discard, r)
+
+	// A 4 MiB message in fragments, with control frames between them
+	const size = 4 << 20
+	chunk := bytes.Repeat([]byte{0x5a}, 64<<10)
+	for sent := 0; sent < size; sent += len(chunk) {
+		opcode := byte(opContinuation)
+		if sent == 0 {
+			opcode = opBinary
+		}
+		conn.Write(wsFrame(sent+len(chunk) == size, opcode, chunk))
+		conn.Write(wsFrame(true, opPing, []byte("ping")))
+		conn.Write(wsFrame(true, opPong, nil))
+	}
+	conn.Write(wsFrame(true, opBinary, nil))
+
+	deadline := time.Now().Add(5 * time.Second)
+	for h.received.Load() < size {
+		if time.Now().After(deadline) {
+			t.Fatalf("backend received %d bytes, want %d", h.received.Load(), size)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	conn.Write(wsFrame(true, opClose, binary.BigEndian.AppendUint16(nil, 1000)))
+	conn.Close()
+	h.waitClosed()
+	if got := h.received.Load(); got != size {
+		t.Errorf("backend received %d bytes, want %d", got, size)
+	}
+}
+
+func TestForwardingClosesOnProtocolError(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame []byte
+	}{
+		{"reserved opcode", wsFrame(true, 0x3, []byte("x"))},
+		{"fragmented control frame", wsFrame(false, opPing, nil)},
+		{"oversized control frame", wsFrame(true, opPing, make([]byte, 126))},
+		{"orphan continuation", wsFrame(true, opContinuation, []byte("x"))},
+		{"unmasked frame", []byte{0x82, 0x01, 'x'}},
+	}
+	h := newForwardHarness(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h.t = t
+			conn, r := h.dial()
+			defer conn.Close()
+			conn.Write(tt.frame)
+
+			// The server hangs up without waiting for the client to
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			if _, err := io.Copy(io.Discard, r); err != nil {
+				t.Errorf("reading until the server closes error = %v, want it closed", err)
+			}
+			h.waitClosed()
+		})
+	}
+}
+
+func TestWebFS(t *testing.T) {
+	files := fstest.MapFS{"vnc.html": {Data: []byte("noVNC")}}
+	server := New(Config{WebFS: files, Logger: &NoOpLogger{}})
+
+	tests := []struct {
+		path     string
+		wantCode int
+		wantBody string
+	}{
+		{"/vnc.html", 200, "noVNC"},
+		{"/missing.html", 404, ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		server.fileServer().ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+		if w.Code != tt.wantCode || tt.wantBody != "" && w.Body.String() != tt.wantBody {
+			t.Errorf("GET %s = %d %q, want %d %q", tt.path, w.Code, w.Body.String(), tt.wantCode, tt.wantBody)
+		}
+	}
+
+	both := New(Config{Listener: "127.0.0.1:0", WebRoot: t.TempDir(), WebFS: files, Logger: &NoOpLogger{}})
+	if err := both.Serve(context.Background()); err == nil || !strings.Contains(err.Error(), "WebFS") {
+		t.Errorf("Serve() with WebRoot and WebFS = %v, want an error", err)
+	}
+}